@@ -50,12 +50,26 @@ func main() {
 		}
 	}()
 
+	// Reload the configuration on SIGHUP
+	reloadChan := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(reloadChan, reloadSignals...)
+	}
+
 	// Wait for either an error or a signal
-	select {
-	case err := <-errChan:
-		logger.Fatal("Fatal error running server: %v", err)
-	case sig := <-sigChan:
-		logger.Info("Received signal: %v", sig)
-		s.Stop()
+	for {
+		select {
+		case err := <-errChan:
+			logger.Fatal("Fatal error running server: %v", err)
+		case sig := <-reloadChan:
+			logger.Info("Received signal: %v, reloading configuration", sig)
+			if err := s.ReloadConfig(); err != nil {
+				logger.Error("Keeping the current configuration: %v", err)
+			}
+		case sig := <-sigChan:
+			logger.Info("Received signal: %v", sig)
+			s.Stop()
+			return
+		}
 	}
 }
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// reloadSignals make the server reload its configuration. There is no SIGHUP
+// here, so only changes to the config file trigger a reload.
+var reloadSignals []os.Signal
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/ratelimit"
 	"github.com/moguyn/mcp-go-filesystem/internal/tools"
 )
 
@@ -26,11 +30,40 @@ const (
 
 // Config holds the configuration for the filesystem server
 type Config struct {
-	Version     string
-	AllowedDirs []string
-	ServerMode  ServerMode
-	ListenAddr  string
-	LogLevel    string
+	Version        string
+	Args           []string // Command line the configuration was parsed from, for reloads
+	ConfigFile     string   // File given with --config, watched for changes
+	AllowedDirs    []string
+	ServerMode     ServerMode
+	ListenAddr     string
+	LogLevel       string
+	RateLimits     ratelimit.Config
+	WriteLimits    tools.WriteLimits
+	ArchiveLimits  tools.ArchiveLimits
+	PathRules      []tools.PolicyRule
+	PathPolicy     *tools.PathPolicy
+	Redact         bool
+	RedactPatterns []string
+	Redactor       *tools.Redactor
+	Tools          tools.ToolSelection
+	Confirmation   tools.ConfirmationPolicy
+	DryRun         bool
+	GitCommit      bool
+	ClientRoots    bool
+	WorkDir        string   // Directory relative paths are resolved against
+	Tenants        []Tenant // Sessions served with their own configuration
+	Tokens         []string // Bearer tokens selecting a tenant, in tenant files only
+	Backends       []tools.BackendBinding
+
+	serverBackends []tools.BackendBinding // Backends of the server, in tenant files only
+}
+
+// Tenant is a group of sessions served with the directories, rules and limits
+// of its own tenant file
+type Tenant struct {
+	Name   string
+	File   string
+	Config *Config
 }
 
 // DefaultConfig returns a default configuration
@@ -41,6 +74,10 @@ func DefaultConfig(version string) *Config {
 		ListenAddr:  "0.0.0.0:38085",
 		AllowedDirs: make([]string, 0),
 		LogLevel:    "INFO",
+		RateLimits: ratelimit.Config{
+			Tools: make(map[string]ratelimit.Rule),
+		},
+		ArchiveLimits: tools.DefaultArchiveLimits(),
 	}
 }
 
@@ -57,6 +94,7 @@ func ParseCommandLineArgs(version string, args []string) (*Config, error) {
 
 	// Initialize default configuration
 	config := DefaultConfig(version)
+	config.Args = args
 
 	// Check environment variables first
 	if mode := os.Getenv(envServerMode); mode != "" {
@@ -74,10 +112,28 @@ func ParseCommandLineArgs(version string, args []string) (*Config, error) {
 		config.ListenAddr = addr
 	}
 
+	// Splice the options from the config file into the command line
+	args, configFile, err := expandConfigFile(args)
+	if err != nil {
+		return nil, err
+	}
+	config.ConfigFile = configFile
+
 	// Parse command line options (these will override environment variables)
-	for i := 1; i < len(args); i++ {
-		arg := args[i]
+	if err := parseOptions(config, args[1:]); err != nil {
+		return nil, err
+	}
+	if len(config.Tokens) > 0 {
+		return nil, errors.NewFileSystemError("parse_args", "", fmt.Errorf("--token is only valid in tenant files"))
+	}
 
+	return config, nil
+}
+
+// parseOptions applies options and allowed directories to config and checks the result
+func parseOptions(config *Config, args []string) error {
+	var dirs, tenants []string
+	for _, arg := range args {
 		// Check for options
 		if strings.HasPrefix(arg, "--mode=") {
 			mode := strings.TrimPrefix(arg, "--mode=")
@@ -87,7 +143,7 @@ func ParseCommandLineArgs(version string, args []string) (*Config, error) {
 			case "sse":
 				config.ServerMode = SSEMode
 			default:
-				return nil, errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid server mode: %s", mode))
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid server mode: %s", mode))
 			}
 			continue
 		}
@@ -102,21 +158,544 @@ func ParseCommandLineArgs(version string, args []string) (*Config, error) {
 			continue
 		}
 
+		if strings.HasPrefix(arg, "--rate-limit=") {
+			rule, err := parseRateRule(strings.TrimPrefix(arg, "--rate-limit="))
+			if err != nil {
+				return errors.NewFileSystemError("parse_args", "", err)
+			}
+			config.RateLimits.Client = rule
+			continue
+		}
+
+		if strings.HasPrefix(arg, "--tool-rate-limit=") {
+			tool, rule, err := parseToolRateRule(strings.TrimPrefix(arg, "--tool-rate-limit="))
+			if err != nil {
+				return errors.NewFileSystemError("parse_args", "", err)
+			}
+			config.RateLimits.Tools[tool] = rule
+			continue
+		}
+
+		if strings.HasPrefix(arg, "--max-concurrent-expensive=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-concurrent-expensive="))
+			if err != nil || n < 0 {
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid concurrency cap: %s", arg))
+			}
+			config.RateLimits.MaxConcurrentExpensive = n
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--max-write-size="); ok {
+			size, err := parseByteSize(value)
+			if err != nil {
+				return errors.NewFileSystemError("parse_args", "", err)
+			}
+			config.WriteLimits.MaxWriteSize = size
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--max-file-size="); ok {
+			size, err := parseByteSize(value)
+			if err != nil {
+				return errors.NewFileSystemError("parse_args", "", err)
+			}
+			config.WriteLimits.MaxFileSize = size
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--quota-bytes="); ok {
+			size, err := parseByteSize(value)
+			if err != nil {
+				return errors.NewFileSystemError("parse_args", "", err)
+			}
+			config.WriteLimits.QuotaBytes = size
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--quota-files="); ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid file quota: %s", value))
+			}
+			config.WriteLimits.QuotaFiles = n
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--archive-max-size="); ok {
+			size, err := parseByteSize(value)
+			if err != nil {
+				return errors.NewFileSystemError("parse_args", "", err)
+			}
+			config.ArchiveLimits.MaxTotalSize = size
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--archive-max-entries="); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid archive entry limit: %s", value))
+			}
+			config.ArchiveLimits.MaxEntries = n
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--archive-max-ratio="); ok {
+			ratio, err := strconv.ParseFloat(value, 64)
+			if err != nil || ratio < 0 {
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid archive compression ratio: %s", value))
+			}
+			config.ArchiveLimits.MaxRatio = ratio
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--profile="); ok {
+			config.Tools.Profile = value
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--tools="); ok {
+			config.Tools.Enable = append(config.Tools.Enable, splitList(value)...)
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--disable-tools="); ok {
+			config.Tools.Disable = append(config.Tools.Disable, splitList(value)...)
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--confirm="); ok {
+			config.Confirmation.Rules = append(config.Confirmation.Rules, parseConfirmRules(value)...)
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--confirm-timeout="); ok {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid confirmation timeout: %s", value))
+			}
+			config.Confirmation.Timeout = timeout
+			continue
+		}
+
+		if arg == "--dry-run" {
+			config.DryRun = true
+			continue
+		}
+
+		if arg == "--allow-git-commit" {
+			config.GitCommit = true
+			continue
+		}
+
+		if arg == "--client-roots" {
+			config.ClientRoots = true
+			continue
+		}
+
+		if arg == "--redact" {
+			config.Redact = true
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--redact-pattern="); ok {
+			config.Redact = true
+			config.RedactPatterns = append(config.RedactPatterns, value)
+			continue
+		}
+
+		if rule, ok, err := parsePolicyFlag(arg); ok {
+			if err != nil {
+				return errors.NewFileSystemError("parse_args", "", err)
+			}
+			config.PathRules = append(config.PathRules, rule)
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--workdir="); ok {
+			config.WorkDir = value
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--token="); ok {
+			if value == "" {
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("empty tenant token"))
+			}
+			config.Tokens = append(config.Tokens, value)
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--tenant="); ok {
+			tenants = append(tenants, value)
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(arg, "--backend="); ok {
+			binding, err := parseBackend(value)
+			if err != nil {
+				return err
+			}
+			config.Backends = append(config.Backends, binding)
+			continue
+		}
+
 		// If not an option, treat as directory
-		dir, err := validateDirectory(arg)
+		dirs = append(dirs, arg)
+	}
+
+	// Directories stored in memory do not exist on disk
+	for _, arg := range dirs {
+		dir, err := config.resolveDirectory(arg)
 		if err != nil {
-			return nil, err
+			return err
 		}
-
 		config.AllowedDirs = append(config.AllowedDirs, dir)
 	}
+	for i, binding := range config.Backends {
+		if !slices.Contains(config.AllowedDirs, binding.Root) {
+			return errors.NewFileSystemError("parse_args", binding.Root, fmt.Errorf("backend bound to a directory that is not allowed"))
+		}
+		if binding.Upper == "" {
+			continue
+		}
+
+		// The upper directory of an overlay is only changed through the overlay
+		upper, err := validateDirectory(binding.Upper)
+		if err != nil {
+			return err
+		}
+		for _, dir := range config.AllowedDirs {
+			if upper == dir || strings.HasPrefix(upper, dir+string(filepath.Separator)) || strings.HasPrefix(dir, upper+string(filepath.Separator)) {
+				return errors.NewFileSystemError("parse_args", upper, fmt.Errorf("overlay upper directory overlaps the allowed directory %s", dir))
+			}
+		}
+		config.Backends[i].Upper = upper
+	}
+
+	// Tenants are served from the server's backends, so they are parsed once
+	// all bindings are known
+	for _, value := range tenants {
+		tenant, err := parseTenant(config.Version, value, config.Backends)
+		if err != nil {
+			return err
+		}
+		for _, other := range config.Tenants {
+			if other.Name == tenant.Name {
+				return errors.NewFileSystemError("parse_args", "", fmt.Errorf("duplicate tenant: %s", tenant.Name))
+			}
+		}
+		config.Tenants = append(config.Tenants, tenant)
+	}
 
 	// Ensure we have at least one allowed directory
 	if len(config.AllowedDirs) == 0 {
-		return nil, errors.NewFileSystemError("parse_args", "", errors.ErrInvalidArgument)
+		return errors.NewFileSystemError("parse_args", "", errors.ErrInvalidArgument)
 	}
 
-	return config, nil
+	if config.WorkDir != "" {
+		dir, err := config.resolveDirectory(config.WorkDir)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(config.AllowedDirs, func(allowed string) bool {
+			return dir == allowed || strings.HasPrefix(dir, allowed+string(filepath.Separator))
+		}) {
+			return errors.NewFileSystemError("parse_args", config.WorkDir, fmt.Errorf("working directory is outside the allowed directories"))
+		}
+		config.WorkDir = dir
+	}
+
+	policy, err := tools.NewPathPolicy(config.PathRules)
+	if err != nil {
+		return errors.NewFileSystemError("parse_args", "", err)
+	}
+	config.PathPolicy = policy
+
+	if err := config.Tools.Validate(); err != nil {
+		return errors.NewFileSystemError("parse_args", "", err)
+	}
+
+	if err := config.Confirmation.Validate(); err != nil {
+		return errors.NewFileSystemError("parse_args", "", err)
+	}
+
+	if config.Redact {
+		redactor, err := tools.NewRedactor(config.RedactPatterns)
+		if err != nil {
+			return errors.NewFileSystemError("parse_args", "", err)
+		}
+		config.Redactor = redactor
+	}
+
+	return nil
+}
+
+// expandConfigFile replaces a --config=<file> option with the options and
+// directories listed in the file, one per line. Blank lines and lines starting
+// with # are ignored. It returns the expanded arguments and the file's
+// absolute path.
+func expandConfigFile(args []string) ([]string, string, error) {
+	expanded := make([]string, 0, len(args))
+	configFile := ""
+	for _, arg := range args {
+		value, ok := strings.CutPrefix(arg, "--config=")
+		if !ok {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if configFile != "" {
+			return nil, "", errors.NewFileSystemError("parse_args", value, fmt.Errorf("only one --config option is allowed"))
+		}
+
+		path, err := filepath.Abs(tools.ExpandHome(value))
+		if err != nil {
+			return nil, "", errors.NewFileSystemError("read_config", value, err)
+		}
+		lines, err := readConfigLines(path)
+		if err != nil {
+			return nil, "", errors.NewFileSystemError("read_config", value, err)
+		}
+		configFile = path
+		expanded = append(expanded, lines...)
+	}
+	return expanded, configFile, nil
+}
+
+// readConfigLines returns the options and directories listed in a config or
+// tenant file, one per line, skipping blank lines and lines starting with #
+func readConfigLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - the file is chosen by the operator
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "--config=") {
+			return nil, fmt.Errorf("config files cannot include other config files")
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// parseTenant parses a tenant option of the form <name>=<file>. The tenant
+// file lists the tenant's directories and options like a config file, plus
+// the tokens selecting the tenant. Its directories are stored in the server's
+// backends.
+func parseTenant(version, value string, backends []tools.BackendBinding) (Tenant, error) {
+	name, file, ok := strings.Cut(value, "=")
+	if !ok || name == "" || file == "" {
+		return Tenant{}, errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid tenant: %s", value))
+	}
+
+	path, err := filepath.Abs(tools.ExpandHome(file))
+	if err != nil {
+		return Tenant{}, errors.NewFileSystemError("read_tenant", file, err)
+	}
+	lines, err := readConfigLines(path)
+	if err != nil {
+		return Tenant{}, errors.NewFileSystemError("read_tenant", file, err)
+	}
+
+	config := DefaultConfig(version)
+	config.serverBackends = backends
+	if err := parseOptions(config, lines); err != nil {
+		return Tenant{}, fmt.Errorf("tenant %s: %w", name, err)
+	}
+	if len(config.Tenants) > 0 {
+		return Tenant{}, errors.NewFileSystemError("read_tenant", file, fmt.Errorf("tenant files cannot define tenants"))
+	}
+	if len(config.Backends) > 0 {
+		return Tenant{}, errors.NewFileSystemError("read_tenant", file, fmt.Errorf("tenant files cannot bind storage backends"))
+	}
+	for _, binding := range backends {
+		if binding.Upper == "" {
+			continue
+		}
+		for _, dir := range config.AllowedDirs {
+			if binding.Upper == dir || strings.HasPrefix(binding.Upper, dir+string(filepath.Separator)) || strings.HasPrefix(dir, binding.Upper+string(filepath.Separator)) {
+				return Tenant{}, errors.NewFileSystemError("read_tenant", file, fmt.Errorf("tenant directory %s overlaps the overlay upper directory %s", dir, binding.Upper))
+			}
+		}
+	}
+	return Tenant{Name: name, File: path, Config: config}, nil
+}
+
+// parseBackend parses a --backend=<dir>=<kind> option binding an allowed
+// directory to a storage backend, where an overlay's kind may name its upper
+// directory as overlay:<upper-dir>
+func parseBackend(value string) (tools.BackendBinding, error) {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return tools.BackendBinding{}, errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid backend: %s", value))
+	}
+
+	root, err := filepath.Abs(tools.ExpandHome(value[:i]))
+	if err != nil {
+		return tools.BackendBinding{}, errors.NewFileSystemError("parse_args", value[:i], err)
+	}
+	binding := tools.BackendBinding{Root: filepath.Clean(root), Kind: value[i+1:]}
+	if upper, ok := strings.CutPrefix(binding.Kind, tools.BackendOverlay+":"); ok {
+		if upper == "" {
+			return tools.BackendBinding{}, errors.NewFileSystemError("parse_args", "", fmt.Errorf("invalid backend: %s", value))
+		}
+		binding.Kind = tools.BackendOverlay
+		binding.Upper = tools.ExpandHome(upper)
+	}
+	if err := binding.Validate(); err != nil {
+		return tools.BackendBinding{}, errors.NewFileSystemError("parse_args", "", err)
+	}
+	return binding, nil
+}
+
+// resolveDirectory validates a directory like validateDirectory, except that
+// directories inside one bound to the memory backend, by the config or by the
+// server serving its tenant, are only normalized
+func (c *Config) resolveDirectory(path string) (string, error) {
+	absPath, err := filepath.Abs(tools.ExpandHome(path))
+	if err != nil {
+		return "", errors.NewFileSystemError("validate_directory", path, err)
+	}
+	normalizedPath := filepath.Clean(absPath)
+
+	for _, binding := range slices.Concat(c.Backends, c.serverBackends) {
+		if binding.Kind == tools.BackendMemory &&
+			(normalizedPath == binding.Root || strings.HasPrefix(normalizedPath, binding.Root+string(filepath.Separator))) {
+			return normalizedPath, nil
+		}
+	}
+	return validateDirectory(path)
+}
+
+// policyFlags maps path policy options to the access they grant or refuse
+var policyFlags = []struct {
+	prefix string
+	rule   tools.PolicyRule
+}{
+	{"--allow=", tools.PolicyRule{Allow: true, Read: true, Write: true}},
+	{"--deny=", tools.PolicyRule{Allow: false, Read: true, Write: true}},
+	{"--allow-read=", tools.PolicyRule{Allow: true, Read: true}},
+	{"--deny-read=", tools.PolicyRule{Allow: false, Read: true}},
+	{"--allow-write=", tools.PolicyRule{Allow: true, Write: true}},
+	{"--deny-write=", tools.PolicyRule{Allow: false, Write: true}},
+}
+
+// parsePolicyFlag parses a path policy option of the form --<kind>=[<root>=]<glob>.
+// It reports whether arg was a policy option at all.
+func parsePolicyFlag(arg string) (tools.PolicyRule, bool, error) {
+	for _, flag := range policyFlags {
+		value, ok := strings.CutPrefix(arg, flag.prefix)
+		if !ok {
+			continue
+		}
+
+		rule := flag.rule
+		rule.Pattern = value
+		if root, pattern, scoped := strings.Cut(value, "="); scoped && filepath.IsAbs(tools.ExpandHome(root)) {
+			rule.Root = root
+			rule.Pattern = pattern
+		}
+		if rule.Pattern == "" {
+			return tools.PolicyRule{}, true, fmt.Errorf("empty path pattern: %s", arg)
+		}
+		return rule, true, nil
+	}
+	return tools.PolicyRule{}, false, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseConfirmRules parses a confirmation option of the form [<root>=]<tool>[,<tool>...]
+func parseConfirmRules(value string) []tools.ConfirmationRule {
+	root := ""
+	if dir, toolList, scoped := strings.Cut(value, "="); scoped && filepath.IsAbs(tools.ExpandHome(dir)) {
+		root = filepath.Clean(tools.ExpandHome(dir))
+		value = toolList
+	}
+
+	var rules []tools.ConfirmationRule
+	for _, tool := range splitList(value) {
+		rules = append(rules, tools.ConfirmationRule{Tool: tool, Root: root})
+	}
+	return rules
+}
+
+// parseRateRule parses a rate limit of the form <calls-per-second>[:<burst>]
+func parseRateRule(value string) (ratelimit.Rule, error) {
+	rateStr, burstStr, hasBurst := strings.Cut(value, ":")
+
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate < 0 {
+		return ratelimit.Rule{}, fmt.Errorf("invalid rate limit: %s", value)
+	}
+
+	rule := ratelimit.Rule{Rate: rate}
+	if hasBurst {
+		burst, err := strconv.Atoi(burstStr)
+		if err != nil || burst < 1 {
+			return ratelimit.Rule{}, fmt.Errorf("invalid rate limit burst: %s", value)
+		}
+		rule.Burst = burst
+	}
+
+	return rule, nil
+}
+
+// parseToolRateRule parses a per-tool rate limit of the form <tool>=<calls-per-second>[:<burst>]
+func parseToolRateRule(value string) (string, ratelimit.Rule, error) {
+	tool, ruleStr, ok := strings.Cut(value, "=")
+	if !ok || tool == "" {
+		return "", ratelimit.Rule{}, fmt.Errorf("invalid tool rate limit: %s", value)
+	}
+	if !slices.Contains(tools.ToolNames(), tool) {
+		return "", ratelimit.Rule{}, fmt.Errorf("unknown tool: %s (available: %s)", tool, strings.Join(tools.ToolNames(), ", "))
+	}
+
+	rule, err := parseRateRule(ruleStr)
+	if err != nil {
+		return "", ratelimit.Rule{}, err
+	}
+
+	return tool, rule, nil
+}
+
+// parseByteSize parses a size in bytes with an optional K, M or G (binary) suffix
+func parseByteSize(value string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.ToUpper(strings.TrimSpace(value))
+	number = strings.TrimSuffix(number, "B")
+
+	switch {
+	case strings.HasSuffix(number, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(number, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(number, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		number = number[:len(number)-1]
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	return n * multiplier, nil
 }
 
 // validateDirectory validates that a directory exists and is accessible
@@ -148,9 +727,58 @@ func PrintUsage(version string) {
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Options:")
 	fmt.Fprintln(os.Stderr, "  --help, -h           Show this help message")
+	fmt.Fprintln(os.Stderr, "  --config=<file>      Read options and directories from a file, one per line; the file is")
+	fmt.Fprintln(os.Stderr, "                       watched and the server reloads when it changes (also on SIGHUP)")
 	fmt.Fprintln(os.Stderr, "  --mode=<mode>        Server mode: 'stdio' (default) or 'sse'")
 	fmt.Fprintln(os.Stderr, "  --listen=<address>   HTTP listen address for SSE mode (default: 0.0.0.0:38085)")
 	fmt.Fprintln(os.Stderr, "  --log-level=<level>  Log level: DEBUG, INFO, WARN, ERROR, FATAL (default: INFO)")
+	fmt.Fprintln(os.Stderr, "  --rate-limit=<rate>[:<burst>]")
+	fmt.Fprintln(os.Stderr, "                       Tool calls per second allowed for each session or token")
+	fmt.Fprintln(os.Stderr, "  --tool-rate-limit=<tool>=<rate>[:<burst>]")
+	fmt.Fprintln(os.Stderr, "                       Calls per second allowed for one tool, per session or token (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --max-concurrent-expensive=<n>")
+	fmt.Fprintln(os.Stderr, "                       Maximum concurrent searches, recursive deletes and tree walks")
+	fmt.Fprintln(os.Stderr, "  --max-write-size=<size>  Maximum bytes in a single write, e.g. 10M")
+	fmt.Fprintln(os.Stderr, "  --max-file-size=<size>   Maximum size of a file after a write or append")
+	fmt.Fprintln(os.Stderr, "  --quota-bytes=<size>     Maximum total size of files under each allowed directory")
+	fmt.Fprintln(os.Stderr, "  --quota-files=<n>        Maximum number of files under each allowed directory")
+	fmt.Fprintln(os.Stderr, "  --archive-max-size=<size>")
+	fmt.Fprintln(os.Stderr, "                       Maximum uncompressed size of an extracted archive (default: 1G, 0 disables)")
+	fmt.Fprintln(os.Stderr, "  --archive-max-entries=<n>")
+	fmt.Fprintln(os.Stderr, "                       Maximum number of entries in an extracted archive (default: 10000)")
+	fmt.Fprintln(os.Stderr, "  --archive-max-ratio=<ratio>")
+	fmt.Fprintln(os.Stderr, "                       Maximum compression ratio of an extracted archive (default: 100)")
+	fmt.Fprintln(os.Stderr, "  --allow=[<dir>=]<glob>, --deny=[<dir>=]<glob>")
+	fmt.Fprintln(os.Stderr, "                       Allow or deny read and write access to matching paths (repeatable,")
+	fmt.Fprintln(os.Stderr, "                       first matching rule wins, optionally scoped to one allowed directory)")
+	fmt.Fprintln(os.Stderr, "  --allow-read=, --deny-read=, --allow-write=, --deny-write=")
+	fmt.Fprintln(os.Stderr, "                       Same as above for read or write access only")
+	fmt.Fprintln(os.Stderr, "  --profile=<profile>  Tool profile: 'full' (default), 'readonly' or 'no-delete'")
+	fmt.Fprintln(os.Stderr, "  --tools=<tool,...>   Register only these tools (within the profile)")
+	fmt.Fprintln(os.Stderr, "  --disable-tools=<tool,...>")
+	fmt.Fprintln(os.Stderr, "                       Do not register these tools")
+	fmt.Fprintln(os.Stderr, "  --confirm=[<dir>=]<tool,...>")
+	fmt.Fprintln(os.Stderr, "                       Require confirmation for delete_file, delete_directory (recursive),")
+	fmt.Fprintln(os.Stderr, "                       overwriting write_file, move_file or copy_file, overlay_commit or")
+	fmt.Fprintln(os.Stderr, "                       overlay_discard, optionally only under one allowed directory")
+	fmt.Fprintln(os.Stderr, "  --confirm-timeout=<duration>")
+	fmt.Fprintln(os.Stderr, "                       How long a pending operation waits for confirmation (default: 5m)")
+	fmt.Fprintln(os.Stderr, "  --dry-run            Validate and describe every change without applying it")
+	fmt.Fprintln(os.Stderr, "  --allow-git-commit   Register git_commit, which commits staged changes")
+	fmt.Fprintln(os.Stderr, "  --client-roots       Confine each SSE session to the roots its client advertises,")
+	fmt.Fprintln(os.Stderr, "                       within the allowed directories")
+	fmt.Fprintln(os.Stderr, "  --workdir=<dir>      Resolve relative paths against this allowed directory")
+	fmt.Fprintln(os.Stderr, "  --backend=<dir>=<backend>")
+	fmt.Fprintln(os.Stderr, "                       Store an allowed directory in a backend: 'os' (default), 'memory',")
+	fmt.Fprintln(os.Stderr, "                       an empty scratch directory that is lost on exit, or 'overlay', which")
+	fmt.Fprintln(os.Stderr, "                       keeps changes aside until overlay_commit; 'overlay:<dir>' keeps them")
+	fmt.Fprintln(os.Stderr, "                       in <dir> instead of memory (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --tenant=<name>=<file>")
+	fmt.Fprintln(os.Stderr, "                       Serve the SSE sessions of a tenant with the directories and options")
+	fmt.Fprintln(os.Stderr, "                       listed in its file; --token=<token> lines in the file select it (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --redact             Mask secrets (AWS keys, private keys, JWTs, KEY= values) in read and search output")
+	fmt.Fprintln(os.Stderr, "  --redact-pattern=<regex>")
+	fmt.Fprintln(os.Stderr, "                       Additional pattern to mask, implies --redact (repeatable)")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Environment Variables:")
 	fmt.Fprintln(os.Stderr, "  MCP_SERVER_MODE      Server mode (overridden by --mode)")
@@ -161,5 +789,13 @@ func PrintUsage(version string) {
 	fmt.Fprintln(os.Stderr, "Examples:")
 	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem /path/to/dir1 /path/to/dir2")
 	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --mode=sse --listen=0.0.0.0:38085 --log-level=DEBUG /path/to/dir")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --mode=sse --rate-limit=20:40 --tool-rate-limit=search_files=2 /path/to/dir")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --profile=readonly --disable-tools=search_files /path/to/dir")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --deny=.env --deny='*.pem' --deny=.git/** --deny-write=vendor /path/to/repo")
 	fmt.Fprintln(os.Stderr, "  MCP_SERVER_MODE=sse MCP_LISTEN_ADDR=0.0.0.0:38086 mcp-server-filesystem /path/to/dir")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --mode=sse --config=/etc/mcp-filesystem.conf")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --mode=sse --client-roots /home/me/projects")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --backend=/scratch=memory /path/to/repo /scratch")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --backend=/path/to/repo=overlay:/var/lib/mcp/repo-changes /path/to/repo")
+	fmt.Fprintln(os.Stderr, "  mcp-server-filesystem --mode=sse --tenant=web=/etc/mcp/web.conf --tenant=api=/etc/mcp/api.conf /srv/empty")
 }
@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/tools"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -93,6 +96,181 @@ func TestParseCommandLineArgs(t *testing.T) {
 			args:        []string{"cmd", "/path/that/does/not/exist"},
 			expectError: true,
 		},
+		{
+			name:        "Rate limits",
+			args:        []string{"cmd", "--rate-limit=10:20", "--tool-rate-limit=search_files=0.5", "--max-concurrent-expensive=4", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.RateLimits.Client.Rate == 10 && cfg.RateLimits.Client.Burst == 20 &&
+					cfg.RateLimits.Tools["search_files"].Rate == 0.5 && cfg.RateLimits.Tools["search_files"].Burst == 0 &&
+					cfg.RateLimits.MaxConcurrentExpensive == 4
+			},
+		},
+		{
+			name:        "Invalid rate limit",
+			args:        []string{"cmd", "--rate-limit=fast", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Invalid rate limit burst",
+			args:        []string{"cmd", "--rate-limit=10:0", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Invalid tool rate limit",
+			args:        []string{"cmd", "--tool-rate-limit=search_files", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Unknown tool rate limit",
+			args:        []string{"cmd", "--tool-rate-limit=search_file=5", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Write limits",
+			args:        []string{"cmd", "--max-write-size=1M", "--max-file-size=2048", "--quota-bytes=1G", "--quota-files=100", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.WriteLimits.MaxWriteSize == 1<<20 && cfg.WriteLimits.MaxFileSize == 2048 &&
+					cfg.WriteLimits.QuotaBytes == 1<<30 && cfg.WriteLimits.QuotaFiles == 100
+			},
+		},
+		{
+			name:        "Invalid write size",
+			args:        []string{"cmd", "--max-write-size=big", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Invalid file quota",
+			args:        []string{"cmd", "--quota-files=-3", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Archive limits",
+			args:        []string{"cmd", "--archive-max-size=100M", "--archive-max-entries=0", "--archive-max-ratio=20.5", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.ArchiveLimits.MaxTotalSize == 100<<20 && cfg.ArchiveLimits.MaxEntries == 0 &&
+					cfg.ArchiveLimits.MaxRatio == 20.5
+			},
+		},
+		{
+			name:        "Invalid archive ratio",
+			args:        []string{"cmd", "--archive-max-ratio=-1", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Path policy rules",
+			args:        []string{"cmd", "--deny=.env", "--allow-read=" + tempDir + "=secrets/README.md", "--deny-write=vendor/**", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return len(cfg.PathRules) == 3 && !cfg.PathPolicy.Empty() &&
+					cfg.PathRules[0].Pattern == ".env" && cfg.PathRules[0].Root == "" && cfg.PathRules[0].Read && cfg.PathRules[0].Write && !cfg.PathRules[0].Allow &&
+					cfg.PathRules[1].Root == tempDir && cfg.PathRules[1].Pattern == "secrets/README.md" && cfg.PathRules[1].Allow && !cfg.PathRules[1].Write &&
+					cfg.PathRules[2].Write && !cfg.PathRules[2].Read
+			},
+		},
+		{
+			name:        "Invalid path policy pattern",
+			args:        []string{"cmd", "--deny=[", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Empty path policy pattern",
+			args:        []string{"cmd", "--deny-read=", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Redaction disabled by default",
+			args:        []string{"cmd", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return !cfg.Redact && cfg.Redactor == nil
+			},
+		},
+		{
+			name:        "Redaction with custom patterns",
+			args:        []string{"cmd", "--redact-pattern=internal-[0-9]+", "--redact-pattern=pin: ([0-9]{4})", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.Redact && cfg.Redactor != nil && len(cfg.RedactPatterns) == 2
+			},
+		},
+		{
+			name:        "Invalid redaction pattern",
+			args:        []string{"cmd", "--redact-pattern=(", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Tool selection",
+			args:        []string{"cmd", "--profile=no-delete", "--tools=read_file, write_file", "--disable-tools=write_file", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.Tools.Profile == "no-delete" &&
+					len(cfg.Tools.Enable) == 2 && cfg.Tools.Enable[1] == "write_file" &&
+					len(cfg.Tools.Disable) == 1 && cfg.Tools.Enabled("read_file") && !cfg.Tools.Enabled("write_file")
+			},
+		},
+		{
+			name:        "Unknown tool profile",
+			args:        []string{"cmd", "--profile=admin", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Unknown tool",
+			args:        []string{"cmd", "--disable-tools=format_disk", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Confirmation policy",
+			args:        []string{"cmd", "--confirm=delete_file,delete_directory", "--confirm=" + tempDir + "=write_file", "--confirm-timeout=30s", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				rules := cfg.Confirmation.Rules
+				return len(rules) == 3 && rules[0].Tool == "delete_file" && rules[0].Root == "" &&
+					rules[2].Tool == "write_file" && rules[2].Root == tempDir &&
+					cfg.Confirmation.Timeout == 30*time.Second
+			},
+		},
+		{
+			name:        "Confirmation for unsupported tool",
+			args:        []string{"cmd", "--confirm=read_file", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Invalid confirmation timeout",
+			args:        []string{"cmd", "--confirm-timeout=soon", tempDir},
+			expectError: true,
+		},
+		{
+			name:        "Dry run",
+			args:        []string{"cmd", "--dry-run", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.DryRun
+			},
+		},
+		{
+			name:        "Git commit",
+			args:        []string{"cmd", "--allow-git-commit", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.GitCommit && !DefaultConfig("1.0.0").GitCommit
+			},
+		},
+		{
+			name:        "Client roots",
+			args:        []string{"cmd", "--client-roots", tempDir},
+			expectError: false,
+			checkConfig: func(cfg *Config) bool {
+				return cfg.ClientRoots && !DefaultConfig("1.0.0").ClientRoots
+			},
+		},
+		{
+			name:        "Invalid concurrency cap",
+			args:        []string{"cmd", "--max-concurrent-expensive=-1", tempDir},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -180,3 +358,217 @@ func TestPrintUsage(t *testing.T) {
 	// Just ensure it doesn't panic
 	PrintUsage("1.0.0")
 }
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    int64
+		expectError bool
+	}{
+		{"1024", 1024, false},
+		{"4k", 4096, false},
+		{"10M", 10 << 20, false},
+		{"2GB", 2 << 30, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			size, err := parseByteSize(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if size != tt.expected {
+				t.Errorf("parseByteSize(%q) = %d, want %d", tt.value, size, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCommandLineArgs_ConfigFile(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	configFile := filepath.Join(t.TempDir(), "filesystem.conf")
+	content := "# Projects\n" + dirB + "\n\n  --deny=.env  \n--max-write-size=1M\n"
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	args := []string{"cmd", dirA, "--config=" + configFile, "--max-write-size=2M"}
+	cfg, err := ParseCommandLineArgs("1.0.0", args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.AllowedDirs) != 2 || cfg.AllowedDirs[1] != dirB {
+		t.Errorf("Expected directories from the command line and the file, got %v", cfg.AllowedDirs)
+	}
+	if len(cfg.PathRules) != 1 || cfg.PathRules[0].Pattern != ".env" {
+		t.Errorf("Expected the policy rule from the file, got %v", cfg.PathRules)
+	}
+	if cfg.WriteLimits.MaxWriteSize != 2<<20 {
+		t.Errorf("Expected options after --config to override the file, got %d", cfg.WriteLimits.MaxWriteSize)
+	}
+	if cfg.ConfigFile != configFile {
+		t.Errorf("Expected ConfigFile %s, got %s", configFile, cfg.ConfigFile)
+	}
+	if len(cfg.Args) != len(args) {
+		t.Errorf("Expected the original arguments to be kept, got %v", cfg.Args)
+	}
+
+	for name, args := range map[string][]string{
+		"missing file":  {"cmd", "--config=" + filepath.Join(dirA, "missing.conf")},
+		"two files":     {"cmd", "--config=" + configFile, "--config=" + configFile},
+		"nested config": {"cmd", "--config=" + writeConfig(t, "--config="+configFile+"\n")},
+	} {
+		if _, err := ParseCommandLineArgs("1.0.0", args); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// writeConfig writes a config file with the given content and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nested.conf")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestParseCommandLineArgs_Tenants(t *testing.T) {
+	serverDir := t.TempDir()
+	teamDir := t.TempDir()
+	workDir := filepath.Join(teamDir, "src")
+	if err := os.Mkdir(workDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	tenantFile := writeConfig(t, teamDir+"\n--token=secret\n--token=other\n--workdir="+workDir+"\n--deny-write=vendor\n--profile=readonly\n--quota-bytes=1M\n")
+
+	cfg, err := ParseCommandLineArgs("1.0.0", []string{"cmd", "--mode=sse", "--tenant=team=" + tenantFile, serverDir})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Tenants) != 1 {
+		t.Fatalf("Expected one tenant, got %v", cfg.Tenants)
+	}
+
+	tenant := cfg.Tenants[0]
+	if tenant.Name != "team" || tenant.File != tenantFile {
+		t.Errorf("Unexpected tenant %s from %s", tenant.Name, tenant.File)
+	}
+	if len(tenant.Config.AllowedDirs) != 1 || tenant.Config.AllowedDirs[0] != teamDir {
+		t.Errorf("Expected the tenant's directory, got %v", tenant.Config.AllowedDirs)
+	}
+	if len(tenant.Config.Tokens) != 2 || tenant.Config.Tokens[0] != "secret" {
+		t.Errorf("Expected the tenant's tokens, got %v", tenant.Config.Tokens)
+	}
+	if tenant.Config.WorkDir != workDir {
+		t.Errorf("Expected working directory %s, got %s", workDir, tenant.Config.WorkDir)
+	}
+	if len(tenant.Config.PathRules) != 1 || tenant.Config.Tools.Profile != "readonly" || tenant.Config.WriteLimits.QuotaBytes != 1<<20 {
+		t.Errorf("Expected the tenant's rules and limits, got %+v", tenant.Config)
+	}
+	if len(cfg.AllowedDirs) != 1 || cfg.AllowedDirs[0] != serverDir || cfg.WorkDir != "" {
+		t.Errorf("Expected the server's own settings to be unchanged, got %v %q", cfg.AllowedDirs, cfg.WorkDir)
+	}
+
+	for name, args := range map[string][]string{
+		"invalid tenant":       {"cmd", "--tenant=team", serverDir},
+		"missing tenant file":  {"cmd", "--tenant=team=" + filepath.Join(teamDir, "missing.conf"), serverDir},
+		"duplicate tenant":     {"cmd", "--tenant=team=" + tenantFile, "--tenant=team=" + tenantFile, serverDir},
+		"nested tenant":        {"cmd", "--tenant=team=" + writeConfig(t, teamDir+"\n--tenant=other="+tenantFile+"\n"), serverDir},
+		"tenant without dirs":  {"cmd", "--tenant=team=" + writeConfig(t, "--token=secret\n"), serverDir},
+		"token outside tenant": {"cmd", "--token=secret", serverDir},
+		"workdir outside dirs": {"cmd", "--workdir=" + teamDir, serverDir},
+		"missing workdir":      {"cmd", "--workdir=" + filepath.Join(serverDir, "missing"), serverDir},
+	} {
+		if _, err := ParseCommandLineArgs("1.0.0", args); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseCommandLineArgs_Backends(t *testing.T) {
+	diskDir := t.TempDir()
+	scratch := filepath.Join(t.TempDir(), "scratch")
+
+	cfg, err := ParseCommandLineArgs("1.0.0", []string{"cmd", "--backend=" + scratch + "=memory", diskDir, scratch, "--workdir=" + filepath.Join(scratch, "src")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Backends) != 1 || cfg.Backends[0].Root != scratch || cfg.Backends[0].Kind != tools.BackendMemory {
+		t.Errorf("Expected %s bound to the memory backend, got %v", scratch, cfg.Backends)
+	}
+	if len(cfg.AllowedDirs) != 2 || cfg.AllowedDirs[1] != scratch {
+		t.Errorf("Expected the memory directory to be allowed without existing on disk, got %v", cfg.AllowedDirs)
+	}
+	if cfg.WorkDir != filepath.Join(scratch, "src") {
+		t.Errorf("Expected a working directory inside the memory directory, got %q", cfg.WorkDir)
+	}
+
+	// Tenants are served from the server's backends, wherever the option is given
+	tenantDir := filepath.Join(scratch, "team")
+	cfg, err = ParseCommandLineArgs("1.0.0", []string{"cmd", "--mode=sse", "--tenant=team=" + writeConfig(t, tenantDir+"\n"), "--backend=" + scratch + "=memory", diskDir, scratch})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Tenants) != 1 || len(cfg.Tenants[0].Config.AllowedDirs) != 1 || cfg.Tenants[0].Config.AllowedDirs[0] != tenantDir {
+		t.Errorf("Expected a tenant directory inside the memory directory, got %v", cfg.Tenants)
+	}
+
+	for name, args := range map[string][]string{
+		"unknown backend":       {"cmd", "--backend=" + diskDir + "=s3", diskDir},
+		"missing backend":       {"cmd", "--backend=" + diskDir, diskDir},
+		"directory not allowed": {"cmd", "--backend=" + scratch + "=memory", diskDir},
+		"missing os dir":        {"cmd", "--backend=" + scratch + "=os", scratch},
+		"tenant backend":        {"cmd", "--mode=sse", "--tenant=team=" + writeConfig(t, diskDir+"\n--backend="+diskDir+"=memory\n"), diskDir},
+	} {
+		if _, err := ParseCommandLineArgs("1.0.0", args); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseCommandLineArgs_OverlayBackend(t *testing.T) {
+	repo := t.TempDir()
+	upper := t.TempDir()
+
+	cfg, err := ParseCommandLineArgs("1.0.0", []string{"cmd", "--backend=" + repo + "=overlay", repo})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Backends) != 1 || cfg.Backends[0].Kind != tools.BackendOverlay || cfg.Backends[0].Upper != "" {
+		t.Errorf("Expected %s bound to an overlay kept in memory, got %v", repo, cfg.Backends)
+	}
+
+	cfg, err = ParseCommandLineArgs("1.0.0", []string{"cmd", "--backend=" + repo + "=overlay:" + upper, repo})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Backends) != 1 || cfg.Backends[0].Kind != tools.BackendOverlay || cfg.Backends[0].Upper != upper {
+		t.Errorf("Expected %s bound to an overlay kept in %s, got %v", repo, upper, cfg.Backends)
+	}
+
+	for name, args := range map[string][]string{
+		"empty upper":       {"cmd", "--backend=" + repo + "=overlay:", repo},
+		"missing upper":     {"cmd", "--backend=" + repo + "=overlay:" + filepath.Join(upper, "missing"), repo},
+		"upper inside root": {"cmd", "--backend=" + repo + "=overlay:" + filepath.Join(repo, "changes"), repo},
+		"upper allowed":     {"cmd", "--backend=" + repo + "=overlay:" + upper, repo, upper},
+		"upper of memory":   {"cmd", "--backend=" + repo + "=memory:" + upper, repo},
+		"missing lower":     {"cmd", "--backend=" + filepath.Join(repo, "missing") + "=overlay", filepath.Join(repo, "missing")},
+		"tenant upper":      {"cmd", "--mode=sse", "--backend=" + repo + "=overlay:" + upper, "--tenant=team=" + writeConfig(t, upper+"\n"), repo},
+	} {
+		if _, err := ParseCommandLineArgs("1.0.0", args); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -3,17 +3,21 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Standard error types
 var (
 	ErrInvalidPath       = errors.New("invalid path")
 	ErrPathNotAllowed    = errors.New("path not within allowed directories")
+	ErrPathDenied        = errors.New("path denied by policy")
 	ErrFileNotFound      = errors.New("file not found")
 	ErrDirectoryNotFound = errors.New("directory not found")
 	ErrPermissionDenied  = errors.New("permission denied")
 	ErrInvalidArgument   = errors.New("invalid argument")
 	ErrInvalidOperation  = errors.New("invalid operation")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrQuotaExceeded     = errors.New("quota exceeded")
 )
 
 // FileSystemError represents an error related to filesystem operations
@@ -50,6 +54,56 @@ func NewFileSystemError(op, path string, err error) *FileSystemError {
 	}
 }
 
+// RateLimitError reports that a call was rejected by a rate limit or concurrency cap
+type RateLimitError struct {
+	Scope      string        // Limit that was exceeded, e.g. "client" or "tool:search_files"
+	RetryAfter time.Duration // How long the caller should wait before retrying
+}
+
+// Error returns the error message
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v (%s), retry after %d ms", ErrRateLimited, e.Scope, e.RetryAfter.Milliseconds())
+}
+
+// Is reports whether target is ErrRateLimited
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// NewRateLimitError creates a new RateLimitError
+func NewRateLimitError(scope string, retryAfter time.Duration) *RateLimitError {
+	return &RateLimitError{
+		Scope:      scope,
+		RetryAfter: retryAfter,
+	}
+}
+
+// QuotaError reports that a write was rejected because it would exceed a size limit or quota
+type QuotaError struct {
+	Limit     string // Limit that would be exceeded, e.g. "max_write_size" or "quota_bytes"
+	Max       int64  // Configured maximum
+	Requested int64  // Value the write would have resulted in
+}
+
+// Error returns the error message
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%v: %s would be %d, maximum is %d", ErrQuotaExceeded, e.Limit, e.Requested, e.Max)
+}
+
+// Is reports whether target is ErrQuotaExceeded
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// NewQuotaError creates a new QuotaError
+func NewQuotaError(limit string, max, requested int64) *QuotaError {
+	return &QuotaError{
+		Limit:     limit,
+		Max:       max,
+		Requested: requested,
+	}
+}
+
 // IsNotFound returns true if the error indicates a not found condition
 func IsNotFound(err error) bool {
 	return errors.Is(err, ErrFileNotFound) || errors.Is(err, ErrDirectoryNotFound)
@@ -57,7 +111,7 @@ func IsNotFound(err error) bool {
 
 // IsPermissionDenied returns true if the error indicates a permission denied condition
 func IsPermissionDenied(err error) bool {
-	return errors.Is(err, ErrPermissionDenied) || errors.Is(err, ErrPathNotAllowed)
+	return errors.Is(err, ErrPermissionDenied) || errors.Is(err, ErrPathNotAllowed) || errors.Is(err, ErrPathDenied)
 }
 
 // IsInvalidArgument returns true if the error indicates an invalid argument
@@ -69,3 +123,51 @@ func IsInvalidArgument(err error) bool {
 func IsInvalidOperation(err error) bool {
 	return errors.Is(err, ErrInvalidOperation)
 }
+
+// IsRateLimited returns true if the error indicates a rate limit was exceeded
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// IsQuotaExceeded returns true if the error indicates a size limit or quota was exceeded
+func IsQuotaExceeded(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded)
+}
+
+// AsRateLimitError returns the RateLimitError in err's chain, if any
+func AsRateLimitError(err error) (*RateLimitError, bool) {
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) {
+		return rateErr, true
+	}
+	return nil, false
+}
+
+// Kind returns a short, stable label describing the category of err.
+// It is intended for use as a metrics label and never returns an empty string.
+func Kind(err error) string {
+	switch {
+	case err == nil:
+		return "none"
+	case errors.Is(err, ErrPathNotAllowed):
+		return "path_not_allowed"
+	case errors.Is(err, ErrPathDenied):
+		return "path_denied"
+	case IsNotFound(err):
+		return "not_found"
+	case errors.Is(err, ErrPermissionDenied):
+		return "permission_denied"
+	case errors.Is(err, ErrInvalidPath):
+		return "invalid_path"
+	case IsInvalidArgument(err):
+		return "invalid_argument"
+	case IsInvalidOperation(err):
+		return "invalid_operation"
+	case IsRateLimited(err):
+		return "rate_limited"
+	case IsQuotaExceeded(err):
+		return "quota_exceeded"
+	default:
+		return "internal"
+	}
+}
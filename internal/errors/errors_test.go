@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestFileSystemError(t *testing.T) {
@@ -98,6 +99,11 @@ func TestIsPermissionDenied(t *testing.T) {
 			err:      NewFileSystemError("write", "/path", ErrPermissionDenied),
 			expected: true,
 		},
+		{
+			name:     "PathDenied",
+			err:      NewFileSystemError("read", "/repo/.env", ErrPathDenied),
+			expected: true,
+		},
 		{
 			name:     "OtherError",
 			err:      ErrFileNotFound,
@@ -180,3 +186,74 @@ func TestIsInvalidOperation(t *testing.T) {
 		})
 	}
 }
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Nil", nil, "none"},
+		{"PathNotAllowed", NewFileSystemError("read", "/etc", ErrPathNotAllowed), "path_not_allowed"},
+		{"PathDenied", NewFileSystemError("read", "/repo/.env", ErrPathDenied), "path_denied"},
+		{"FileNotFound", NewFileSystemError("read", "/path", ErrFileNotFound), "not_found"},
+		{"DirectoryNotFound", ErrDirectoryNotFound, "not_found"},
+		{"PermissionDenied", ErrPermissionDenied, "permission_denied"},
+		{"InvalidPath", ErrInvalidPath, "invalid_path"},
+		{"InvalidArgument", NewFileSystemError("edit", "/path", ErrInvalidArgument), "invalid_argument"},
+		{"InvalidOperation", ErrInvalidOperation, "invalid_operation"},
+		{"RateLimited", NewFileSystemError("search_files", "", NewRateLimitError("client", time.Second)), "rate_limited"},
+		{"QuotaExceeded", NewFileSystemError("write_file", "/path", NewQuotaError("quota_bytes", 10, 20)), "quota_exceeded"},
+		{"Other", fmt.Errorf("boom"), "internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Kind(tt.err); got != tt.expected {
+				t.Errorf("Kind(%v) = %s, want %s", tt.err, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRateLimitError(t *testing.T) {
+	err := NewRateLimitError("tool:search_files", 1500*time.Millisecond)
+
+	expected := "rate limited (tool:search_files), retry after 1500 ms"
+	if err.Error() != expected {
+		t.Errorf("Expected error message '%s', got '%s'", expected, err.Error())
+	}
+
+	wrapped := NewFileSystemError("search_files", "", err)
+	if !IsRateLimited(wrapped) {
+		t.Errorf("IsRateLimited should return true for a wrapped RateLimitError")
+	}
+
+	rateErr, ok := AsRateLimitError(wrapped)
+	if !ok || rateErr.RetryAfter != 1500*time.Millisecond {
+		t.Errorf("AsRateLimitError should recover the RateLimitError")
+	}
+	if _, ok := AsRateLimitError(ErrInvalidArgument); ok {
+		t.Errorf("AsRateLimitError should return false for other errors")
+	}
+
+	if IsRateLimited(ErrInvalidArgument) {
+		t.Errorf("IsRateLimited should return false for other errors")
+	}
+}
+
+func TestQuotaError(t *testing.T) {
+	err := NewQuotaError("max_write_size", 1024, 2048)
+
+	expected := "quota exceeded: max_write_size would be 2048, maximum is 1024"
+	if err.Error() != expected {
+		t.Errorf("Expected error message '%s', got '%s'", expected, err.Error())
+	}
+
+	if !IsQuotaExceeded(NewFileSystemError("write_file", "/path", err)) {
+		t.Errorf("IsQuotaExceeded should return true for a wrapped QuotaError")
+	}
+	if IsQuotaExceeded(ErrRateLimited) {
+		t.Errorf("IsQuotaExceeded should return false for other errors")
+	}
+}
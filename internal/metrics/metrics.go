@@ -0,0 +1,332 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDurationBuckets are the histogram buckets, in seconds, used for tool latency
+var DefaultDurationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector is implemented by every metric family that can be exposed by a Registry
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds a set of metric families and renders them in the Prometheus text format
+type Registry struct {
+	mu         sync.Mutex
+	names      []string
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// register adds a collector under the given name, panicking on duplicates
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.collectors[name]; exists {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names = append(r.names, name)
+	r.collectors[name] = c
+}
+
+// WriteText writes all registered metrics to w in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	names := append([]string(nil), r.names...)
+	r.mu.Unlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		r.mu.Lock()
+		c := r.collectors[name]
+		r.mu.Unlock()
+		c.write(w)
+	}
+}
+
+// Handler returns an HTTP handler serving the registry contents
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// CounterVec is a set of monotonically increasing counters partitioned by labels
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a new CounterVec
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+	r.register(name, c)
+	return c
+}
+
+// Inc increments the counter identified by labelValues by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter identified by labelValues by v. Negative values are ignored.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := labelKey(c.labels, labelValues)
+
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the current value of the counter identified by labelValues
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := labelKey(c.labels, labelValues)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+// Gauge is a single value that can go up and down
+type Gauge struct {
+	name  string
+	help  string
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates and registers a new Gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{
+		name: name,
+		help: help,
+	}
+	r.register(name, g)
+	return g
+}
+
+// Inc increments the gauge by one
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec decrements the gauge by one
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Add adds v to the gauge
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	g.value += v
+	g.mu.Unlock()
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.value = v
+	g.mu.Unlock()
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.value))
+}
+
+// HistogramVec is a set of histograms partitioned by labels
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+// histogram holds the observations for a single label combination
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec creates and registers a new HistogramVec with the given upper bounds
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: sorted,
+		values:  make(map[string]*histogram),
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v in the histogram identified by labelValues
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := labelKey(h.labels, labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = hist
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+// Count returns the number of observations for labelValues
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := labelKey(h.labels, labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hist, ok := h.values[key]; ok {
+		return hist.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		for i, upper := range h.buckets {
+			le := labelKey(append(append([]string(nil), h.labels...), "le"), append(append([]string(nil), hist.labelValues...), formatFloat(upper)))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, le, hist.counts[i])
+		}
+		inf := labelKey(append(append([]string(nil), h.labels...), "le"), append(append([]string(nil), hist.labelValues...), "+Inf"))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, inf, hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, hist.count)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines for a metric family
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.ReplaceAll(help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// labelKey renders label names and values as a Prometheus label set, e.g. {tool="read_file"}
+func labelKey(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// escapeLabelValue escapes backslashes, quotes and newlines in a label value
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+// formatFloat formats a sample value the way Prometheus expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
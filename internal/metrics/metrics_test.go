@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounterVec("test_total", "A test counter.", "tool")
+
+	counter.Inc("read_file")
+	counter.Inc("read_file")
+	counter.Add(3, "write_file")
+	counter.Add(-1, "write_file") // ignored
+
+	assert.Equal(t, float64(2), counter.Value("read_file"))
+	assert.Equal(t, float64(3), counter.Value("write_file"))
+	assert.Equal(t, float64(0), counter.Value("unknown"))
+
+	var buf bytes.Buffer
+	registry.WriteText(&buf)
+	output := buf.String()
+
+	assert.Contains(t, output, "# HELP test_total A test counter.")
+	assert.Contains(t, output, "# TYPE test_total counter")
+	assert.Contains(t, output, `test_total{tool="read_file"} 2`)
+	assert.Contains(t, output, `test_total{tool="write_file"} 3`)
+}
+
+func TestGauge(t *testing.T) {
+	registry := NewRegistry()
+	gauge := registry.NewGauge("test_gauge", "A test gauge.")
+
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	assert.Equal(t, float64(1), gauge.Value())
+
+	gauge.Set(7)
+	assert.Equal(t, float64(7), gauge.Value())
+
+	var buf bytes.Buffer
+	registry.WriteText(&buf)
+	assert.Contains(t, buf.String(), "# TYPE test_gauge gauge")
+	assert.Contains(t, buf.String(), "test_gauge 7\n")
+}
+
+func TestHistogramVec(t *testing.T) {
+	registry := NewRegistry()
+	hist := registry.NewHistogramVec("test_seconds", "A test histogram.", []float64{1, 0.1}, "tool")
+
+	hist.Observe(0.05, "search_files")
+	hist.Observe(0.5, "search_files")
+	hist.Observe(5, "search_files")
+
+	assert.Equal(t, uint64(3), hist.Count("search_files"))
+	assert.Equal(t, uint64(0), hist.Count("read_file"))
+
+	var buf bytes.Buffer
+	registry.WriteText(&buf)
+	output := buf.String()
+
+	assert.Contains(t, output, "# TYPE test_seconds histogram")
+	assert.Contains(t, output, `test_seconds_bucket{tool="search_files",le="0.1"} 1`)
+	assert.Contains(t, output, `test_seconds_bucket{tool="search_files",le="1"} 2`)
+	assert.Contains(t, output, `test_seconds_bucket{tool="search_files",le="+Inf"} 3`)
+	assert.Contains(t, output, `test_seconds_sum{tool="search_files"} 5.55`)
+	assert.Contains(t, output, `test_seconds_count{tool="search_files"} 3`)
+}
+
+func TestLabelEscaping(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounterVec("escape_total", "Escaping.", "value")
+	counter.Inc("a\"b\\c\nd")
+
+	var buf bytes.Buffer
+	registry.WriteText(&buf)
+	assert.Contains(t, buf.String(), `escape_total{value="a\"b\\c\nd"} 1`)
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewGauge("dup", "first")
+
+	assert.Panics(t, func() {
+		registry.NewGauge("dup", "second")
+	})
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ToolCalls.Inc("read_file")
+	m.SSESessions.Inc()
+
+	recorder := httptest.NewRecorder()
+	m.Registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain"))
+	body := recorder.Body.String()
+	assert.Contains(t, body, `mcp_fs_tool_calls_total{tool="read_file"} 1`)
+	assert.Contains(t, body, "mcp_fs_sse_sessions_active 1")
+	assert.Contains(t, body, "# TYPE mcp_fs_tool_duration_seconds histogram")
+}
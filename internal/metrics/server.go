@@ -0,0 +1,36 @@
+package metrics
+
+// Metrics groups the metrics exported by the filesystem server
+type Metrics struct {
+	Registry     *Registry
+	ToolCalls    *CounterVec
+	ToolErrors   *CounterVec
+	ToolDuration *HistogramVec
+	BytesRead    *CounterVec
+	BytesWritten *CounterVec
+	Redactions   *CounterVec
+	SSESessions  *Gauge
+}
+
+// New creates the server metrics on a fresh registry
+func New() *Metrics {
+	registry := NewRegistry()
+
+	return &Metrics{
+		Registry: registry,
+		ToolCalls: registry.NewCounterVec("mcp_fs_tool_calls_total",
+			"Total number of tool calls.", "tool"),
+		ToolErrors: registry.NewCounterVec("mcp_fs_tool_errors_total",
+			"Total number of failed tool calls by error kind.", "tool", "kind"),
+		ToolDuration: registry.NewHistogramVec("mcp_fs_tool_duration_seconds",
+			"Tool call latency in seconds.", DefaultDurationBuckets, "tool"),
+		BytesRead: registry.NewCounterVec("mcp_fs_bytes_read_total",
+			"Total number of bytes returned from file reads.", "tool"),
+		BytesWritten: registry.NewCounterVec("mcp_fs_bytes_written_total",
+			"Total number of bytes written to files.", "tool"),
+		Redactions: registry.NewCounterVec("mcp_fs_redactions_total",
+			"Total number of secrets masked in tool output.", "tool"),
+		SSESessions: registry.NewGauge("mcp_fs_sse_sessions_active",
+			"Number of currently connected SSE sessions."),
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets is the number of buckets kept before idle ones are pruned
+const maxIdleBuckets = 10000
+
+// Rule describes a token bucket: Rate tokens are added per second up to Burst
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled reports whether the rule imposes a limit
+func (r Rule) Enabled() bool {
+	return r.Rate > 0
+}
+
+// capacity returns the bucket size, defaulting to one second worth of tokens
+func (r Rule) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return math.Max(1, math.Ceil(r.Rate))
+}
+
+// Config holds the rate limiting settings of the server
+type Config struct {
+	// Client limits all tool calls made by a single session or token
+	Client Rule
+	// Tools limits calls to individual tools, per session or token
+	Tools map[string]Rule
+	// MaxConcurrentExpensive caps the number of expensive operations running at once
+	MaxConcurrentExpensive int
+}
+
+// bucket is a single token bucket
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter applies a Rule independently to each key
+type Limiter struct {
+	rule    Rule
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter creates a Limiter for rule
+func NewLimiter(rule Rule) *Limiter {
+	return &Limiter{
+		rule:    rule,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token for key. When no token is available it returns false and
+// the time until the next token becomes available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.rule.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	capacity := l.rule.capacity()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.prune(now, capacity)
+		}
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill based on elapsed time
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(capacity, b.tokens+elapsed*l.rule.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rule.Rate * float64(time.Second))
+	return false, wait
+}
+
+// prune drops buckets that have refilled completely and so carry no state
+func (l *Limiter) prune(now time.Time, capacity float64) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rule.Rate >= capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Semaphore caps the number of concurrent holders. A nil Semaphore is unlimited.
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// NewSemaphore creates a Semaphore with n slots, or nil if n is not positive
+func NewSemaphore(n int) *Semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return &Semaphore{slots: make(chan struct{}, n)}
+}
+
+// TryAcquire takes a slot without blocking and reports whether it succeeded
+func (s *Semaphore) TryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release returns a slot taken by TryAcquire
+func (s *Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// InUse returns the number of slots currently held
+func (s *Semaphore) InUse() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.slots)
+}
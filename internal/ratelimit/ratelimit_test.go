@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterDisabled(t *testing.T) {
+	limiter := NewLimiter(Rule{})
+	for i := 0; i < 100; i++ {
+		ok, _ := limiter.Allow("client")
+		assert.True(t, ok)
+	}
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(Rule{Rate: 2, Burst: 3})
+	limiter.now = func() time.Time { return now }
+
+	// The burst is available immediately
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("client")
+		assert.True(t, ok, "call %d should be allowed", i)
+	}
+
+	ok, wait := limiter.Allow("client")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Other keys have their own bucket
+	ok, _ = limiter.Allow("other")
+	assert.True(t, ok)
+
+	// After half a second one token has been added
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("client")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("client")
+	assert.False(t, ok)
+}
+
+func TestLimiterDefaultBurst(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(Rule{Rate: 0.5})
+	limiter.now = func() time.Time { return now }
+
+	ok, _ := limiter.Allow("client")
+	assert.True(t, ok)
+
+	ok, wait := limiter.Allow("client")
+	assert.False(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+}
+
+func TestLimiterPrune(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewLimiter(Rule{Rate: 1, Burst: 1})
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("a")
+	limiter.Allow("b")
+	now = now.Add(time.Second)
+	limiter.prune(now, 1)
+
+	assert.Empty(t, limiter.buckets)
+}
+
+func TestSemaphore(t *testing.T) {
+	sem := NewSemaphore(2)
+	assert.True(t, sem.TryAcquire())
+	assert.True(t, sem.TryAcquire())
+	assert.False(t, sem.TryAcquire())
+	assert.Equal(t, 2, sem.InUse())
+
+	sem.Release()
+	assert.True(t, sem.TryAcquire())
+}
+
+func TestNilSemaphore(t *testing.T) {
+	sem := NewSemaphore(0)
+	assert.Nil(t, sem)
+	assert.True(t, sem.TryAcquire())
+	sem.Release()
+	assert.Equal(t, 0, sem.InUse())
+}
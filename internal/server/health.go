@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// healthStatus is the JSON body returned by the health endpoints
+type healthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// registerOperationalEndpoints adds the health, readiness and metrics endpoints to mux
+func (s *Server) registerOperationalEndpoints(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.Handle("/metrics", s.metrics.Registry.Handler())
+}
+
+// handleHealthz reports that the process is alive
+func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeHealthStatus(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// handleReadyz reports whether every allowed directory is still accessible
+func (s *Server) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	if s.provider == nil {
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Error: "server not initialized"})
+		return
+	}
+
+	if err := s.provider.CheckAllowedDirectories(); err != nil {
+		s.logger.Warn("Readiness check failed: %v", err)
+		writeHealthStatus(w, http.StatusServiceUnavailable, healthStatus{Status: "unavailable", Error: err.Error()})
+		return
+	}
+
+	writeHealthStatus(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// writeHealthStatus writes a health status as JSON
+func writeHealthStatus(w http.ResponseWriter, code int, status healthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOperationalTestServer(t *testing.T, allowedDirs []string) (*Server, *http.ServeMux) {
+	cfg := &config.Config{
+		Version:     "1.0.0",
+		AllowedDirs: allowedDirs,
+		ServerMode:  config.SSEMode,
+		ListenAddr:  "localhost:0",
+		LogLevel:    "ERROR",
+	}
+	s := NewServer(cfg)
+	s.initialize()
+
+	mux := http.NewServeMux()
+	s.registerOperationalEndpoints(mux)
+	return s, mux
+}
+
+func TestHealthz(t *testing.T) {
+	_, mux := newOperationalTestServer(t, []string{t.TempDir()})
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var status healthStatus
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.Equal(t, "ok", status.Status)
+}
+
+func TestReadyz(t *testing.T) {
+	dir := t.TempDir()
+	_, mux := newOperationalTestServer(t, []string{dir})
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// Removing an allowed directory makes the server unready
+	assert.NoError(t, os.Remove(dir))
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	var status healthStatus
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.Equal(t, "unavailable", status.Status)
+	assert.NotEmpty(t, status.Error)
+}
+
+func TestReadyzBeforeInitialize(t *testing.T) {
+	cfg := &config.Config{
+		Version:     "1.0.0",
+		AllowedDirs: []string{t.TempDir()},
+		ServerMode:  config.SSEMode,
+		ListenAddr:  "localhost:0",
+	}
+	s := NewServer(cfg)
+
+	recorder := httptest.NewRecorder()
+	s.handleReadyz(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	s, mux := newOperationalTestServer(t, []string{t.TempDir()})
+	s.metrics.ToolCalls.Inc("read_file")
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `mcp_fs_tool_calls_total{tool="read_file"} 1`)
+	assert.Contains(t, recorder.Body.String(), "mcp_fs_sse_sessions_active 0")
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/config"
+	"github.com/moguyn/mcp-go-filesystem/internal/tools"
+)
+
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 2 * time.Second
+
+// toolsListChanged is the notification telling clients to list the tools again
+const toolsListChanged = "notifications/tools/list_changed"
+
+// ReloadConfig parses the command line the server was started with again,
+// reading the config file anew, and applies the result with Reload
+func (s *Server) ReloadConfig() error {
+	s.reloadMu.Lock()
+	args := s.config.Args
+	s.reloadMu.Unlock()
+	if len(args) == 0 {
+		return fmt.Errorf("no command line to reload the configuration from")
+	}
+
+	cfg, err := config.ParseCommandLineArgs(s.version, args)
+	if err != nil {
+		return err
+	}
+	return s.Reload(cfg)
+}
+
+// Reload applies cfg to the running server without dropping sessions. The
+// allowed directories, path rules, write, archive and rate limits and the tool
+// selection are swapped at once; the other settings only change on restart.
+// Clients are sent tools/list_changed when the enabled tools change.
+func (s *Server) Reload(cfg *config.Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.provider == nil {
+		return fmt.Errorf("server is not started")
+	}
+
+	old := s.config
+	for _, setting := range restartOnlyChanges(old, cfg) {
+		s.logger.Warn("Ignoring change to %s: restart the server to apply it", setting)
+	}
+	changes := configChanges(old, cfg)
+
+	before := s.provider.EnabledTools()
+	s.provider.Reload(tools.Settings{
+		AllowedDirs:   cfg.AllowedDirs,
+		PathPolicy:    cfg.PathPolicy,
+		WriteLimits:   cfg.WriteLimits,
+		ArchiveLimits: cfg.ArchiveLimits,
+		RateLimits:    cfg.RateLimits,
+		ToolSelection: cfg.Tools,
+		GitCommit:     cfg.GitCommit,
+		WorkDir:       cfg.WorkDir,
+		Tenants:       tenantSettings(cfg.Tenants),
+	})
+
+	// mcp-go cannot unregister tools, so the selected tools are registered
+	// with a new MCP server that replaces the current one
+	mcpServer := newMCPServer(s.version)
+	s.provider.Register(mcpServer)
+	added, removed := diffLists(before, s.provider.EnabledTools())
+	if len(added) > 0 || len(removed) > 0 {
+		s.mcpServer.Store(mcpServer)
+		changes = append(changes, listChange("tools", added, removed))
+		s.notify(toolsListChanged)
+	}
+
+	s.config = keepRestartOnly(old, cfg)
+
+	if len(changes) == 0 {
+		s.logger.Info("Configuration reloaded, nothing changed")
+		return nil
+	}
+	for _, change := range changes {
+		s.logger.Info("Configuration reloaded: %s", change)
+	}
+	return nil
+}
+
+// setNotifier records the transport serving the clients
+func (s *Server) setNotifier(n notifier) {
+	s.notifyMu.Lock()
+	defer s.notifyMu.Unlock()
+	s.notifier = n
+}
+
+// notify sends a notification to every connected client, if the server is serving any
+func (s *Server) notify(method string) {
+	s.notifyMu.Lock()
+	n := s.notifier
+	s.notifyMu.Unlock()
+	if n != nil {
+		n.notify(method)
+	}
+}
+
+// watchConfig reloads the configuration whenever the config file's size or
+// modification time changes, until ctx is done
+func (s *Server) watchConfig(ctx context.Context, path string, interval time.Duration) {
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// Editors may replace the file; wait for it to reappear
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+
+		s.logger.Info("Config file %s changed, reloading", path)
+		if err := s.ReloadConfig(); err != nil {
+			s.logger.Error("Keeping the current configuration: %v", err)
+		}
+	}
+}
+
+// configChanges describes how the reloadable settings of next differ from old
+func configChanges(old, next *config.Config) []string {
+	var changes []string
+
+	if added, removed := diffLists(old.AllowedDirs, next.AllowedDirs); len(added) > 0 || len(removed) > 0 {
+		changes = append(changes, listChange("allowed directories", added, removed))
+	}
+	if added, removed := diffLists(ruleStrings(old.PathRules), ruleStrings(next.PathRules)); len(added) > 0 || len(removed) > 0 {
+		changes = append(changes, listChange("path rules", added, removed))
+	}
+	if old.WriteLimits != next.WriteLimits {
+		changes = append(changes, fmt.Sprintf("write limits %+v -> %+v", old.WriteLimits, next.WriteLimits))
+	}
+	if old.ArchiveLimits != next.ArchiveLimits {
+		changes = append(changes, fmt.Sprintf("archive limits %+v -> %+v", old.ArchiveLimits, next.ArchiveLimits))
+	}
+	if !reflect.DeepEqual(old.RateLimits, next.RateLimits) {
+		changes = append(changes, fmt.Sprintf("rate limits %+v -> %+v", old.RateLimits, next.RateLimits))
+	}
+	if old.WorkDir != next.WorkDir {
+		changes = append(changes, fmt.Sprintf("working directory %q -> %q", old.WorkDir, next.WorkDir))
+	}
+
+	oldTenants, nextTenants := tenantSettings(old.Tenants), tenantSettings(next.Tenants)
+	var oldNames, nextNames []string
+	for _, tenant := range oldTenants {
+		oldNames = append(oldNames, tenant.Name)
+	}
+	for _, tenant := range nextTenants {
+		nextNames = append(nextNames, tenant.Name)
+		i := slices.IndexFunc(oldTenants, func(t tools.Tenant) bool { return t.Name == tenant.Name })
+		if i >= 0 && !reflect.DeepEqual(oldTenants[i], tenant) {
+			changes = append(changes, fmt.Sprintf("tenant %s changed", tenant.Name))
+		}
+	}
+	if added, removed := diffLists(oldNames, nextNames); len(added) > 0 || len(removed) > 0 {
+		changes = append(changes, listChange("tenants", added, removed))
+	}
+	return changes
+}
+
+// restartOnlyChanges names the settings that differ between old and next but
+// cannot change while the server runs
+func restartOnlyChanges(old, next *config.Config) []string {
+	var settings []string
+	if old.ServerMode != next.ServerMode {
+		settings = append(settings, "--mode")
+	}
+	if old.ListenAddr != next.ListenAddr {
+		settings = append(settings, "--listen")
+	}
+	if old.LogLevel != next.LogLevel {
+		settings = append(settings, "--log-level")
+	}
+	if old.Redact != next.Redact || !slices.Equal(old.RedactPatterns, next.RedactPatterns) {
+		settings = append(settings, "--redact")
+	}
+	if !reflect.DeepEqual(old.Confirmation, next.Confirmation) {
+		settings = append(settings, "--confirm")
+	}
+	if old.DryRun != next.DryRun {
+		settings = append(settings, "--dry-run")
+	}
+	if old.ClientRoots != next.ClientRoots {
+		settings = append(settings, "--client-roots")
+	}
+	if !slices.Equal(old.Backends, next.Backends) {
+		settings = append(settings, "--backend")
+	}
+	return settings
+}
+
+// keepRestartOnly returns next with the settings that only change on restart
+// taken from old, so that it describes the configuration in effect
+func keepRestartOnly(old, next *config.Config) *config.Config {
+	effective := *next
+	effective.ServerMode = old.ServerMode
+	effective.ListenAddr = old.ListenAddr
+	effective.LogLevel = old.LogLevel
+	effective.Redact = old.Redact
+	effective.RedactPatterns = old.RedactPatterns
+	effective.Redactor = old.Redactor
+	effective.Confirmation = old.Confirmation
+	effective.DryRun = old.DryRun
+	effective.ClientRoots = old.ClientRoots
+	effective.Backends = old.Backends
+	return &effective
+}
+
+// ruleStrings formats path policy rules as the options that define them
+func ruleStrings(rules []tools.PolicyRule) []string {
+	formatted := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		kind := "--deny"
+		if rule.Allow {
+			kind = "--allow"
+		}
+		switch {
+		case rule.Read && !rule.Write:
+			kind += "-read"
+		case rule.Write && !rule.Read:
+			kind += "-write"
+		}
+		value := rule.Pattern
+		if rule.Root != "" {
+			value = rule.Root + "=" + value
+		}
+		formatted = append(formatted, kind+"="+value)
+	}
+	return formatted
+}
+
+// diffLists returns the items of next missing from old and those of old missing from next
+func diffLists(old, next []string) (added, removed []string) {
+	for _, item := range next {
+		if !slices.Contains(old, item) {
+			added = append(added, item)
+		}
+	}
+	for _, item := range old {
+		if !slices.Contains(next, item) {
+			removed = append(removed, item)
+		}
+	}
+	return added, removed
+}
+
+// listChange describes the items added to and removed from a list
+func listChange(name string, added, removed []string) string {
+	switch {
+	case len(removed) == 0:
+		return fmt.Sprintf("%s added %v", name, added)
+	case len(added) == 0:
+		return fmt.Sprintf("%s removed %v", name, removed)
+	default:
+		return fmt.Sprintf("%s added %v, removed %v", name, added, removed)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/config"
+	"github.com/moguyn/mcp-go-filesystem/internal/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier records the notifications sent to clients
+type recordingNotifier struct {
+	mu      sync.Mutex
+	methods []string
+}
+
+func (n *recordingNotifier) notify(method string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.methods = append(n.methods, method)
+}
+
+func (n *recordingNotifier) sent() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string{}, n.methods...)
+}
+
+// parseConfig parses a command line for a test server
+func parseConfig(t *testing.T, args ...string) *config.Config {
+	t.Helper()
+	cfg, err := config.ParseCommandLineArgs("1.0.0", append([]string{"cmd"}, args...))
+	require.NoError(t, err)
+	return cfg
+}
+
+// listedTools returns the names of the tools the server lists to clients
+func listedTools(t *testing.T, s *Server) []string {
+	t.Helper()
+	response := s.HandleMessage(context.Background(), json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	result, ok := response.(mcp.JSONRPCResponse).Result.(mcp.ListToolsResult)
+	require.True(t, ok)
+	names := make([]string, 0, len(result.Tools))
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestReload(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+
+	s := NewServer(parseConfig(t, dirA))
+	assert.Error(t, s.Reload(parseConfig(t, dirA)), "reloading needs a started server")
+
+	s.initialize()
+	notifier := &recordingNotifier{}
+	s.setNotifier(notifier)
+	assert.Contains(t, listedTools(t, s), "write_file")
+
+	// Reloading the same configuration changes nothing
+	mcpServer := s.mcpServer.Load()
+	require.NoError(t, s.Reload(parseConfig(t, dirA)))
+	assert.Same(t, mcpServer, s.mcpServer.Load())
+	assert.Empty(t, notifier.sent())
+
+	require.NoError(t, s.Reload(parseConfig(t, dirA, dirB, "--deny=.env", "--profile=readonly", "--mode=sse")))
+	assert.Equal(t, []string{dirA, dirB}, s.provider.ListAllowedDirectories())
+	assert.NotContains(t, listedTools(t, s), "write_file")
+	assert.Contains(t, listedTools(t, s), "read_file")
+	assert.Equal(t, []string{toolsListChanged}, notifier.sent())
+	assert.Equal(t, config.StdioMode, s.config.ServerMode, "the mode only changes on restart")
+
+	// Denied paths apply at once
+	require.NoError(t, os.WriteFile(filepath.Join(dirB, ".env"), []byte("TOKEN=b"), 0600))
+	request := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"read_file","arguments":{"path":"` + filepath.ToSlash(filepath.Join(dirB, ".env")) + `"}}}`
+	response := s.HandleMessage(context.Background(), json.RawMessage(request))
+	_, failed := response.(mcp.JSONRPCError)
+	assert.True(t, failed, "the new path rules apply")
+}
+
+func TestReloadConfigFile(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	configFile := filepath.Join(t.TempDir(), "filesystem.conf")
+	require.NoError(t, os.WriteFile(configFile, []byte(dirA+"\n"), 0600))
+
+	s := NewServer(parseConfig(t, "--config="+configFile))
+	s.initialize()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchConfig(ctx, configFile, 10*time.Millisecond)
+
+	// A config that does not parse is not applied
+	require.NoError(t, os.WriteFile(configFile, []byte(dirA+"\n"+filepath.Join(dirB, "missing")+"\n"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []string{dirA}, s.provider.ListAllowedDirectories())
+
+	require.NoError(t, os.WriteFile(configFile, []byte(dirA+"\n"+dirB+"\n"), 0600))
+	assert.Eventually(t, func() bool {
+		return len(s.provider.ListAllowedDirectories()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// SIGHUP reloads through ReloadConfig
+	require.NoError(t, os.WriteFile(configFile, []byte(dirB+"\n"), 0600))
+	require.NoError(t, s.ReloadConfig())
+	assert.Equal(t, []string{dirB}, s.provider.ListAllowedDirectories())
+}
+
+func TestConfigChanges(t *testing.T) {
+	old := &config.Config{
+		AllowedDirs:   []string{"/a", "/b"},
+		PathRules:     []tools.PolicyRule{{Pattern: ".env", Read: true, Write: true}},
+		ArchiveLimits: tools.DefaultArchiveLimits(),
+		ServerMode:    config.StdioMode,
+	}
+	next := &config.Config{
+		AllowedDirs:   []string{"/a", "/c"},
+		PathRules:     []tools.PolicyRule{{Root: "/a", Pattern: "*.pem", Allow: true, Read: true}},
+		WriteLimits:   tools.WriteLimits{MaxWriteSize: 10},
+		ArchiveLimits: tools.DefaultArchiveLimits(),
+		ServerMode:    config.SSEMode,
+		DryRun:        true,
+		Backends:      []tools.BackendBinding{{Root: "/c", Kind: tools.BackendMemory}},
+	}
+
+	changes := configChanges(old, next)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "allowed directories added [/c], removed [/b]", changes[0])
+	assert.Equal(t, "path rules added [--allow-read=/a=*.pem], removed [--deny=.env]", changes[1])
+	assert.Contains(t, changes[2], "MaxWriteSize:10")
+	assert.Empty(t, configChanges(old, old))
+
+	assert.Equal(t, []string{"--mode", "--dry-run", "--backend"}, restartOnlyChanges(old, next))
+	effective := keepRestartOnly(old, next)
+	assert.Equal(t, config.StdioMode, effective.ServerMode)
+	assert.False(t, effective.DryRun)
+	assert.Empty(t, effective.Backends)
+	assert.Equal(t, next.AllowedDirs, effective.AllowedDirs)
+
+	withTenants := func(workDir string, tenants ...config.Tenant) *config.Config {
+		cfg := *old
+		cfg.WorkDir = workDir
+		cfg.Tenants = tenants
+		return &cfg
+	}
+	tenant := func(name string, dirs ...string) config.Tenant {
+		return config.Tenant{Name: name, Config: &config.Config{AllowedDirs: dirs}}
+	}
+	assert.Equal(t, []string{
+		`working directory "" -> "/a/src"`,
+		"tenant a changed",
+		"tenants added [c], removed [b]",
+	}, configChanges(
+		withTenants("", tenant("a", "/x"), tenant("b", "/y")),
+		withTenants("/a/src", tenant("a", "/x", "/z"), tenant("c", "/y")),
+	))
+}
@@ -2,11 +2,21 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/moguyn/mcp-go-filesystem/internal/config"
 	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+	"github.com/moguyn/mcp-go-filesystem/internal/metrics"
+	"github.com/moguyn/mcp-go-filesystem/internal/ratelimit"
 	"github.com/moguyn/mcp-go-filesystem/internal/tools"
 )
 
@@ -20,26 +30,51 @@ const (
 	SSEMode ServerMode = "sse"
 )
 
+// messageHandler handles the JSON-RPC messages sent by clients
+type messageHandler interface {
+	HandleMessage(ctx context.Context, message json.RawMessage) mcp.JSONRPCMessage
+}
+
+// notifier sends a notification to every connected client
+type notifier interface {
+	notify(method string)
+}
+
 // Server represents the filesystem server
 type Server struct {
-	mcpServer      *server.MCPServer
+	mcpServer      atomic.Pointer[server.MCPServer] // Replaced when a reload changes the tools
 	allowedDirs    []string
 	version        string
 	mode           config.ServerMode
 	httpListenAddr string
 	logger         *logging.Logger
+	rateLimits     ratelimit.Config
+	writeLimits    tools.WriteLimits
+	archiveLimits  tools.ArchiveLimits
+	pathPolicy     *tools.PathPolicy
+	redactor       *tools.Redactor
+	toolSelection  tools.ToolSelection
+	confirmation   tools.ConfirmationPolicy
+	dryRun         bool
+	gitCommit      bool
+	clientRoots    bool
+	workDir        string
+	tenants        []tools.Tenant
+	backends       []tools.BackendBinding
+	metrics        *metrics.Metrics
+	provider       *tools.ServiceProvider
 	ctx            context.Context
 	cancel         context.CancelFunc
+
+	// Reload state
+	reloadMu sync.Mutex
+	config   *config.Config // Configuration in effect
+	notifyMu sync.Mutex
+	notifier notifier // Transport serving the clients, once started
 }
 
 // NewServer creates a new filesystem server
 func NewServer(cfg *config.Config) *Server {
-	// Create a new MCP server
-	mcpServer := server.NewMCPServer(
-		"mcp-go-filesystem",
-		cfg.Version,
-	)
-
 	// Create a context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -64,22 +99,84 @@ func NewServer(cfg *config.Config) *Server {
 		logger.SetLevel(level)
 	}
 
-	return &Server{
-		mcpServer:      mcpServer,
+	s := &Server{
 		allowedDirs:    cfg.AllowedDirs,
 		version:        cfg.Version,
 		mode:           cfg.ServerMode,
 		httpListenAddr: cfg.ListenAddr,
 		logger:         logger,
+		rateLimits:     cfg.RateLimits,
+		writeLimits:    cfg.WriteLimits,
+		archiveLimits:  cfg.ArchiveLimits,
+		pathPolicy:     cfg.PathPolicy,
+		redactor:       cfg.Redactor,
+		toolSelection:  cfg.Tools,
+		confirmation:   cfg.Confirmation,
+		dryRun:         cfg.DryRun,
+		gitCommit:      cfg.GitCommit,
+		clientRoots:    cfg.ClientRoots,
+		workDir:        cfg.WorkDir,
+		tenants:        tenantSettings(cfg.Tenants),
+		backends:       cfg.Backends,
+		metrics:        metrics.New(),
 		ctx:            ctx,
 		cancel:         cancel,
+		config:         cfg,
+	}
+	s.mcpServer.Store(newMCPServer(cfg.Version))
+	return s
+}
+
+// newMCPServer creates the MCP server the tools are registered with
+func newMCPServer(version string) *server.MCPServer {
+	return server.NewMCPServer(
+		"mcp-go-filesystem",
+		version,
+	)
+}
+
+// HandleMessage dispatches a client message to the current MCP server. Once a
+// client has initialized its session is set up, selecting its tenant and
+// confining it to the client's roots if --client-roots is set; the roots are
+// listed again whenever the client reports that they changed.
+func (s *Server) HandleMessage(ctx context.Context, message json.RawMessage) mcp.JSONRPCMessage {
+	var envelope struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(message, &envelope); err == nil && s.provider != nil {
+		switch envelope.Method {
+		case "notifications/initialized":
+			s.provider.StartSession(ctx)
+		case "notifications/roots/list_changed":
+			s.provider.RefreshRoots(ctx)
+		}
 	}
+
+	return s.mcpServer.Load().HandleMessage(ctx, message)
 }
 
 // initialize sets up the server by registering all tools
 func (s *Server) initialize() {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
 	// Register all filesystem tools
-	tools.RegisterTools(s.mcpServer, s.allowedDirs)
+	s.provider = tools.RegisterTools(s.mcpServer.Load(), s.allowedDirs,
+		tools.WithMetrics(s.metrics),
+		tools.WithRateLimits(s.rateLimits),
+		tools.WithWriteLimits(s.writeLimits),
+		tools.WithArchiveLimits(s.archiveLimits),
+		tools.WithPathPolicy(s.pathPolicy),
+		tools.WithRedactor(s.redactor),
+		tools.WithToolSelection(s.toolSelection),
+		tools.WithConfirmationPolicy(s.confirmation),
+		tools.WithDryRun(s.dryRun),
+		tools.WithGitCommit(s.gitCommit),
+		tools.WithClientRoots(s.clientRoots),
+		tools.WithWorkDir(s.workDir),
+		tools.WithTenants(s.tenants),
+		tools.WithBackends(s.backends),
+	)
 }
 
 // Start starts the server in the configured mode
@@ -88,11 +185,31 @@ func (s *Server) Start() error {
 	s.initialize()
 
 	s.logger.Info("Allowed directories: %v", s.allowedDirs)
+	s.logger.Info("Enabled tools: %v", s.provider.EnabledTools())
+	for _, tenant := range s.tenants {
+		s.logger.Info("Tenant %s: directories %v", tenant.Name, tenant.AllowedDirs)
+	}
+	for _, binding := range s.backends {
+		if binding.Upper != "" {
+			s.logger.Info("Storing %s in the %s backend, with changes in %s", binding.Root, binding.Kind, binding.Upper)
+			continue
+		}
+		s.logger.Info("Storing %s in the %s backend", binding.Root, binding.Kind)
+	}
+	if s.dryRun {
+		s.logger.Info("Dry-run mode: changes are validated and described but never applied")
+	}
+
+	if s.config.ConfigFile != "" {
+		go s.watchConfig(s.ctx, s.config.ConfigFile, configPollInterval)
+	}
 
 	switch s.mode {
 	case config.StdioMode:
 		s.logger.Info("Running in stdio mode")
-		return server.ServeStdio(s.mcpServer)
+		transport := newStdioTransport(s, os.Stdout, s.logger)
+		s.setNotifier(transport)
+		return transport.serve(s.ctx, os.Stdin)
 	case config.SSEMode:
 		s.logger.Info("Running in SSE mode on %s", s.httpListenAddr)
 		return startSSEServer(s)
@@ -107,17 +224,67 @@ func (s *Server) Stop() {
 	s.cancel()
 }
 
-// startSSEServer starts the server in SSE mode
+// startSSEServer starts the server in SSE mode together with the health,
+// readiness and metrics endpoints
 func (s *Server) startSSEServer() error {
-	// Create an SSE server
 	baseURL := "http://" + s.httpListenAddr
-	sseServer := server.NewSSEServer(s.mcpServer, baseURL)
+	transport := newSSETransport(s, baseURL, s.metrics, s.logger)
+	transport.onClose = s.provider.EndSession
+	s.setNotifier(transport)
+
+	mux := http.NewServeMux()
+	transport.register(mux)
+	s.registerOperationalEndpoints(mux)
 
-	// Start the SSE server
-	return sseServer.Start(s.httpListenAddr)
+	httpServer := &http.Server{
+		Addr:              s.httpListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Shut the HTTP server down once the server is stopped
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			transport.closeAll()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				s.logger.Warn("Error shutting down HTTP server: %v", err)
+			}
+		case <-done:
+		}
+	}()
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
 // Default implementation of startSSEServer
 var startSSEServer = func(s *Server) error {
 	return s.startSSEServer()
 }
+
+// tenantSettings returns the provider settings of the tenants of a configuration
+func tenantSettings(tenants []config.Tenant) []tools.Tenant {
+	settings := make([]tools.Tenant, 0, len(tenants))
+	for _, tenant := range tenants {
+		cfg := tenant.Config
+		settings = append(settings, tools.Tenant{
+			Name:          tenant.Name,
+			Tokens:        cfg.Tokens,
+			AllowedDirs:   cfg.AllowedDirs,
+			WorkDir:       cfg.WorkDir,
+			PathPolicy:    cfg.PathPolicy,
+			WriteLimits:   cfg.WriteLimits,
+			ArchiveLimits: cfg.ArchiveLimits,
+			ToolSelection: cfg.Tools,
+			GitCommit:     cfg.GitCommit,
+		})
+	}
+	return settings
+}
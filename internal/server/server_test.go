@@ -31,7 +31,7 @@ func TestNewServer(t *testing.T) {
 
 	// Verify the server was created correctly
 	assert.NotNil(t, s)
-	assert.NotNil(t, s.mcpServer)
+	assert.NotNil(t, s.mcpServer.Load())
 	assert.Equal(t, version, s.version)
 	assert.Equal(t, allowedDirs, s.allowedDirs)
 	assert.Equal(t, mode, s.mode)
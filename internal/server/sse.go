@@ -0,0 +1,452 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+	"github.com/moguyn/mcp-go-filesystem/internal/metrics"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+)
+
+// sseSession represents a connected SSE client
+type sseSession struct {
+	id      string
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	mu      sync.Mutex
+	done    chan struct{}
+
+	// Capabilities and tenant the client sent in its initialize request, and
+	// the bearer token fixed when the session was established
+	capsMu       sync.RWMutex
+	capabilities map[string]bool
+	tenant       string
+	token        string
+	tokenFixed   bool
+
+	// Requests sent to the client that are waiting for a response
+	requestsMu    sync.Mutex
+	nextRequestID atomic.Int64
+	requests      map[string]chan peerResponse
+}
+
+// peerResponse is the outcome of a request sent to the client
+type peerResponse struct {
+	result json.RawMessage
+	err    error
+}
+
+// newSSESession creates a session writing to w
+func newSSESession(w http.ResponseWriter, flusher http.Flusher) *sseSession {
+	return &sseSession{
+		id:       uuid.New().String(),
+		writer:   w,
+		flusher:  flusher,
+		done:     make(chan struct{}),
+		requests: make(map[string]chan peerResponse),
+	}
+}
+
+// send writes an event to the session stream
+func (s *sseSession) send(event string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return fmt.Errorf("session closed")
+	default:
+	}
+
+	if _, err := fmt.Fprintf(s.writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Supports reports whether the client advertised the named capability
+func (s *sseSession) Supports(capability string) bool {
+	s.capsMu.RLock()
+	defer s.capsMu.RUnlock()
+	return s.capabilities[capability]
+}
+
+// tenantName returns the tenant the client named in its initialize request
+func (s *sseSession) tenantName() string {
+	s.capsMu.RLock()
+	defer s.capsMu.RUnlock()
+	return s.tenant
+}
+
+// bearer returns the bearer token fixed for the session
+func (s *sseSession) bearer() string {
+	s.capsMu.RLock()
+	defer s.capsMu.RUnlock()
+	return s.token
+}
+
+// fixToken records the bearer token identifying the session, unless one was
+// already fixed. Tokens sent with later messages are ignored, so a client
+// cannot change its identity mid-session.
+func (s *sseSession) fixToken(token string) {
+	s.capsMu.Lock()
+	defer s.capsMu.Unlock()
+	if !s.tokenFixed {
+		s.token = token
+		s.tokenFixed = true
+	}
+}
+
+// setCapabilities records the capabilities, and the tenant given as
+// _meta.tenant, from the params of an initialize request
+func (s *sseSession) setCapabilities(params json.RawMessage) {
+	var init struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+		Meta         struct {
+			Tenant string `json:"tenant"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(params, &init); err != nil {
+		return
+	}
+
+	s.capsMu.Lock()
+	defer s.capsMu.Unlock()
+	s.tenant = init.Meta.Tenant
+	s.capabilities = make(map[string]bool, len(init.Capabilities))
+	for name := range init.Capabilities {
+		s.capabilities[name] = true
+	}
+}
+
+// Request sends a JSON-RPC request to the client over the event stream and
+// waits for the client to post its response
+func (s *sseSession) Request(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := fmt.Sprintf("server-%d", s.nextRequestID.Add(1))
+	responses := make(chan peerResponse, 1)
+
+	s.requestsMu.Lock()
+	s.requests[id] = responses
+	s.requestsMu.Unlock()
+	defer func() {
+		s.requestsMu.Lock()
+		delete(s.requests, id)
+		s.requestsMu.Unlock()
+	}()
+
+	data, err := json.Marshal(struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID      string `json:"id"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{mcp.JSONRPC_VERSION, id, method, params})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.send("message", data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case response := <-responses:
+		return response.result, response.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.done:
+		return nil, fmt.Errorf("session closed")
+	}
+}
+
+// resolve delivers a response posted by the client to the request waiting for it.
+// It reports whether a request was waiting.
+func (s *sseSession) resolve(id string, response peerResponse) bool {
+	s.requestsMu.Lock()
+	responses, ok := s.requests[id]
+	s.requestsMu.Unlock()
+
+	if ok {
+		// Only the first response to a request counts
+		select {
+		case responses <- response:
+		default:
+		}
+	}
+	return ok
+}
+
+// sseTransport serves the MCP protocol over Server-Sent Events. Unlike the
+// transport bundled with mcp-go it tracks sessions itself, so they can be
+// counted and addressed, and it shares its mux with the operational endpoints.
+type sseTransport struct {
+	handler messageHandler
+	baseURL string
+	metrics *metrics.Metrics
+	logger  *logging.Logger
+	onClose func(id string) // Called once a session has disconnected, if set
+
+	mu       sync.RWMutex
+	sessions map[string]*sseSession
+}
+
+// newSSETransport creates a transport passing client messages to handler
+func newSSETransport(handler messageHandler, baseURL string, m *metrics.Metrics, logger *logging.Logger) *sseTransport {
+	return &sseTransport{
+		handler:  handler,
+		baseURL:  baseURL,
+		metrics:  m,
+		logger:   logger,
+		sessions: make(map[string]*sseSession),
+	}
+}
+
+// register adds the SSE and message endpoints to mux
+func (t *sseTransport) register(mux *http.ServeMux) {
+	mux.HandleFunc("/sse", t.handleSSE)
+	mux.HandleFunc("/message", t.handleMessage)
+}
+
+// sessionCount returns the number of connected sessions
+func (t *sseTransport) sessionCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.sessions)
+}
+
+// addSession stores a newly connected session
+func (t *sseTransport) addSession(session *sseSession) {
+	t.mu.Lock()
+	t.sessions[session.id] = session
+	t.mu.Unlock()
+
+	t.metrics.SSESessions.Inc()
+	t.logger.Debug("SSE session connected: %s", session.id)
+}
+
+// removeSession forgets a session once its stream has ended
+func (t *sseTransport) removeSession(id string) {
+	t.mu.Lock()
+	session, ok := t.sessions[id]
+	delete(t.sessions, id)
+	t.mu.Unlock()
+
+	if ok {
+		// Holding the write lock waits for any in-flight send, so nothing
+		// writes to the stream once its handler has returned
+		session.mu.Lock()
+		close(session.done)
+		session.mu.Unlock()
+
+		t.metrics.SSESessions.Dec()
+		t.logger.Debug("SSE session disconnected: %s", id)
+		if t.onClose != nil {
+			t.onClose(id)
+		}
+	}
+}
+
+// session looks up a connected session
+func (t *sseTransport) session(id string) (*sseSession, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	session, ok := t.sessions[id]
+	return session, ok
+}
+
+// closeAll terminates every connected session
+func (t *sseTransport) closeAll() {
+	t.mu.RLock()
+	ids := make([]string, 0, len(t.sessions))
+	for id := range t.sessions {
+		ids = append(ids, id)
+	}
+	t.mu.RUnlock()
+
+	for _, id := range ids {
+		t.removeSession(id)
+	}
+}
+
+// notify sends a notification to every connected session
+func (t *sseTransport) notify(method string) {
+	data, err := json.Marshal(struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+	}{mcp.JSONRPC_VERSION, method})
+	if err != nil {
+		return
+	}
+
+	t.mu.RLock()
+	sessions := make([]*sseSession, 0, len(t.sessions))
+	for _, session := range t.sessions {
+		sessions = append(sessions, session)
+	}
+	t.mu.RUnlock()
+
+	for _, session := range sessions {
+		if err := session.send("message", data); err != nil {
+			t.logger.Debug("Error sending %s to session %s: %v", method, session.id, err)
+		}
+	}
+}
+
+// handleSSE opens an event stream for a new session
+func (t *sseTransport) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	session := newSSESession(w, flusher)
+	if token := bearerToken(r); token != "" {
+		session.fixToken(token)
+	}
+	t.addSession(session)
+	defer t.removeSession(session.id)
+
+	endpoint := fmt.Sprintf("%s/message?sessionId=%s", t.baseURL, session.id)
+	if err := session.send("endpoint", []byte(endpoint)); err != nil {
+		return
+	}
+
+	select {
+	case <-r.Context().Done():
+	case <-session.done:
+	}
+}
+
+// handleMessage dispatches a JSON-RPC message posted by a client. The session,
+// and the bearer token presented when it connected or first initialized,
+// identify the client to the tool handlers.
+func (t *sseTransport) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONRPCError(w, nil, mcp.INVALID_REQUEST, "Method not allowed")
+		return
+	}
+
+	sessionID := r.URL.Query().Get("sessionId")
+	if sessionID == "" {
+		writeJSONRPCError(w, nil, mcp.INVALID_PARAMS, "Missing sessionId")
+		return
+	}
+
+	sess, ok := t.session(sessionID)
+	if !ok {
+		writeJSONRPCError(w, nil, mcp.INVALID_PARAMS, "Invalid session ID")
+		return
+	}
+
+	var rawMessage json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&rawMessage); err != nil {
+		writeJSONRPCError(w, nil, mcp.PARSE_ERROR, "Parse error")
+		return
+	}
+
+	var envelope struct {
+		Method string          `json:"method"`
+		ID     json.RawMessage `json:"id"`
+		Params json.RawMessage `json:"params"`
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rawMessage, &envelope); err != nil {
+		writeJSONRPCError(w, nil, mcp.PARSE_ERROR, "Parse error")
+		return
+	}
+
+	// A message without a method is the client's response to a server request
+	if envelope.Method == "" && len(envelope.ID) > 0 {
+		var id string
+		_ = json.Unmarshal(envelope.ID, &id)
+
+		response := peerResponse{result: envelope.Result}
+		if envelope.Error != nil {
+			response.err = fmt.Errorf("client error %d: %s", envelope.Error.Code, envelope.Error.Message)
+		}
+		if !sess.resolve(id, response) {
+			t.logger.Debug("Ignoring response to unknown request %s from session %s", envelope.ID, sessionID)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if envelope.Method == "initialize" {
+		sess.fixToken(bearerToken(r))
+		sess.setCapabilities(envelope.Params)
+	}
+
+	ctx := session.NewContext(r.Context(), session.Info{
+		ID:     sessionID,
+		Token:  sess.bearer(),
+		Peer:   sess,
+		Tenant: sess.tenantName(),
+	})
+	response := t.handler.HandleMessage(ctx, rawMessage)
+
+	// Notifications have no response
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	eventData, err := json.Marshal(response)
+	if err != nil {
+		writeJSONRPCError(w, nil, mcp.INTERNAL_ERROR, "Failed to encode response")
+		return
+	}
+	if err := sess.send("message", eventData); err != nil {
+		t.logger.Warn("Error sending response to session %s: %v", sessionID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if _, err := w.Write(eventData); err != nil {
+		t.logger.Warn("Error writing HTTP response: %v", err)
+	}
+}
+
+// bearerToken returns the bearer token from the Authorization header, if any
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// writeJSONRPCError writes a JSON-RPC error as the HTTP response
+func writeJSONRPCError(w http.ResponseWriter, id interface{}, code int, message string) {
+	response := mcp.JSONRPCError{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      id,
+	}
+	response.Error.Code = code
+	response.Error.Message = message
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,403 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+	"github.com/moguyn/mcp-go-filesystem/internal/metrics"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvent reads a single SSE event from reader and returns its type and data
+func readEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			return event, data
+		}
+	}
+}
+
+func newTestTransport(t *testing.T) (*sseTransport, *httptest.Server, *metrics.Metrics) {
+	m := metrics.New()
+	mcpServer := server.NewMCPServer("test", "1.0.0")
+	transport := newSSETransport(mcpServer, "", m, logging.DefaultLogger("test"))
+
+	mux := http.NewServeMux()
+	transport.register(mux)
+	testServer := httptest.NewServer(mux)
+	transport.baseURL = testServer.URL
+	t.Cleanup(testServer.Close)
+
+	return transport, testServer, m
+}
+
+func TestSSETransportSessionLifecycle(t *testing.T) {
+	transport, testServer, m := newTestTransport(t)
+	closed := make(chan string, 1)
+	transport.onClose = func(id string) { closed <- id }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testServer.URL+"/sse", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	event, endpoint := readEvent(t, reader)
+	assert.Equal(t, "endpoint", event)
+	assert.Contains(t, endpoint, "/message?sessionId=")
+	assert.Equal(t, 1, transport.sessionCount())
+	assert.Equal(t, float64(1), m.SSESessions.Value())
+
+	// Send a ping and expect the response on both the HTTP response and the stream
+	body := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	postResp, err := http.Post(endpoint, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	postResp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, postResp.StatusCode)
+
+	event, data := readEvent(t, reader)
+	assert.Equal(t, "message", event)
+	assert.Contains(t, data, `"id":1`)
+
+	// Disconnecting removes the session
+	cancel()
+	assert.Eventually(t, func() bool {
+		return transport.sessionCount() == 0 && m.SSESessions.Value() == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, strings.HasSuffix(endpoint, "sessionId="+<-closed))
+}
+
+func TestSSETransportRejectsBadMessages(t *testing.T) {
+	_, testServer, _ := newTestTransport(t)
+
+	// Missing session ID
+	resp, err := http.Post(testServer.URL+"/message", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Unknown session ID
+	resp, err = http.Post(testServer.URL+"/message?sessionId=unknown", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Wrong method on the SSE endpoint
+	resp, err = http.Post(testServer.URL+"/sse", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestSSETransportCloseAll(t *testing.T) {
+	transport, testServer, m := newTestTransport(t)
+
+	resp, err := http.Get(testServer.URL + "/sse")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	readEvent(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, 1, transport.sessionCount())
+
+	transport.closeAll()
+	assert.Equal(t, 0, transport.sessionCount())
+	assert.Equal(t, float64(0), m.SSESessions.Value())
+}
+
+// keyRecorder records the accounting key of every message it handles
+type keyRecorder struct {
+	keys chan string
+}
+
+func (k *keyRecorder) HandleMessage(ctx context.Context, _ json.RawMessage) mcp.JSONRPCMessage {
+	k.keys <- session.KeyFromContext(ctx)
+	return nil
+}
+
+func TestSSETransportFixesToken(t *testing.T) {
+	recorder := &keyRecorder{keys: make(chan string, 10)}
+	transport := newSSETransport(recorder, "", metrics.New(), logging.DefaultLogger("test"))
+	mux := http.NewServeMux()
+	transport.register(mux)
+	testServer := httptest.NewServer(mux)
+	transport.baseURL = testServer.URL
+	t.Cleanup(testServer.Close)
+
+	// connect opens a session presenting token and returns its message endpoint
+	connect := func(token string) string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, testServer.URL+"/sse", nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		_, endpoint := readEvent(t, bufio.NewReader(resp.Body))
+		return endpoint
+	}
+	// keyOf posts a message with token and returns the key it was handled under
+	keyOf := func(endpoint, token, method string) string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(`{"jsonrpc":"2.0","method":"`+method+`"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return <-recorder.keys
+	}
+
+	// A token presented when connecting identifies the session
+	endpoint := connect("first")
+	key := keyOf(endpoint, "first", "initialize")
+	assert.Equal(t, session.Info{Token: "first"}.Key(), key)
+	assert.Equal(t, key, keyOf(endpoint, "random-1", "ping"), "later tokens are ignored")
+
+	// Otherwise the token of the first initialize request does
+	endpoint = connect("")
+	key = keyOf(endpoint, "second", "initialize")
+	assert.Equal(t, session.Info{Token: "second"}.Key(), key)
+	assert.Equal(t, key, keyOf(endpoint, "third", "initialize"))
+	assert.Equal(t, key, keyOf(endpoint, "random-2", "ping"))
+}
+
+func TestBearerToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/message", nil)
+	assert.Equal(t, "", bearerToken(req))
+
+	req.Header.Set("Authorization", "Bearer abc123")
+	assert.Equal(t, "abc123", bearerToken(req))
+
+	req.Header.Set("Authorization", "Basic abc123")
+	assert.Equal(t, "", bearerToken(req))
+}
+
+func TestSSETransportPeerRequests(t *testing.T) {
+	transport, testServer, _ := newTestTransport(t)
+
+	resp, err := http.Get(testServer.URL + "/sse")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	_, endpoint := readEvent(t, reader)
+
+	// Capabilities are recorded from the initialize request
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{"elicitation":{},"roots":{"listChanged":true}},"clientInfo":{"name":"test","version":"1.0"}}}`
+	postResp, err := http.Post(endpoint, "application/json", strings.NewReader(initialize))
+	require.NoError(t, err)
+	postResp.Body.Close()
+	readEvent(t, reader)
+
+	sessionID := endpoint[strings.Index(endpoint, "sessionId=")+len("sessionId="):]
+	sess, ok := transport.session(sessionID)
+	require.True(t, ok)
+	assert.True(t, sess.Supports("elicitation"))
+	assert.True(t, sess.Supports("roots"))
+	assert.False(t, sess.Supports("sampling"))
+
+	// A server request is delivered on the stream and resolved by the client's response
+	type outcome struct {
+		result string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := sess.Request(context.Background(), "roots/list", nil)
+		done <- outcome{string(result), err}
+	}()
+
+	event, data := readEvent(t, reader)
+	assert.Equal(t, "message", event)
+	assert.Contains(t, data, `"method":"roots/list"`)
+	assert.Contains(t, data, `"id":"server-1"`)
+
+	postResp, err = http.Post(endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":"server-1","result":{"roots":[]}}`))
+	require.NoError(t, err)
+	postResp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, postResp.StatusCode)
+
+	got := <-done
+	require.NoError(t, got.err)
+	assert.JSONEq(t, `{"roots":[]}`, got.result)
+
+	// Error responses fail the request
+	go func() {
+		result, err := sess.Request(context.Background(), "elicitation/create", nil)
+		done <- outcome{string(result), err}
+	}()
+	readEvent(t, reader)
+	postResp, err = http.Post(endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":"server-2","error":{"code":-1,"message":"no"}}`))
+	require.NoError(t, err)
+	postResp.Body.Close()
+	assert.Error(t, (<-done).err)
+
+	// Requests are abandoned when the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = sess.Request(ctx, "roots/list", nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSSETransportNotify(t *testing.T) {
+	transport, testServer, _ := newTestTransport(t)
+
+	resp, err := http.Get(testServer.URL + "/sse")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	readEvent(t, reader)
+
+	transport.notify("notifications/tools/list_changed")
+	event, data := readEvent(t, reader)
+	assert.Equal(t, "message", event)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`, data)
+}
+
+func TestSSEClientRoots(t *testing.T) {
+	base := t.TempDir()
+	dirA := filepath.Join(base, "a")
+	require.NoError(t, os.MkdirAll(dirA, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "b"), 0755))
+
+	s := NewServer(parseConfig(t, "--client-roots", base))
+	s.initialize()
+	transport := newSSETransport(s, "", s.metrics, s.logger)
+	transport.onClose = s.provider.EndSession
+
+	mux := http.NewServeMux()
+	transport.register(mux)
+	testServer := httptest.NewServer(mux)
+	transport.baseURL = testServer.URL
+	defer testServer.Close()
+
+	resp, err := http.Get(testServer.URL + "/sse")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	_, endpoint := readEvent(t, reader)
+
+	post := func(body string) {
+		t.Helper()
+		postResp, err := http.Post(endpoint, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		postResp.Body.Close()
+	}
+
+	post(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{"roots":{"listChanged":true}},"clientInfo":{"name":"test","version":"1.0"}}}`)
+	readEvent(t, reader)
+
+	// Once initialized, the server asks the client for its roots
+	post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	_, data := readEvent(t, reader)
+	assert.Contains(t, data, `"method":"roots/list"`)
+	rootURI := "file://" + filepath.ToSlash(dirA)
+	if !strings.HasPrefix(rootURI, "file:///") {
+		rootURI = "file:///" + filepath.ToSlash(dirA)
+	}
+	post(fmt.Sprintf(`{"jsonrpc":"2.0","id":"server-1","result":{"roots":[{"uri":%q}]}}`, rootURI))
+
+	post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"list_allowed_directories","arguments":{}}}`)
+	_, data = readEvent(t, reader)
+	var response struct {
+		Result mcp.CallToolResult `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(data), &response))
+	var directories []string
+	require.NoError(t, json.Unmarshal([]byte(response.Result.Content[0].(map[string]any)["text"].(string)), &directories))
+	assert.Equal(t, []string{dirA}, directories)
+
+	// Sessions without a client keep every allowed directory
+	assert.Equal(t, []string{base}, s.provider.ListAllowedDirectories())
+}
+
+func TestSSETenants(t *testing.T) {
+	serverDir := t.TempDir()
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	tenantA := filepath.Join(t.TempDir(), "a.conf")
+	require.NoError(t, os.WriteFile(tenantA, []byte(dirA+"\n--token=secret\n"), 0600))
+	tenantB := filepath.Join(t.TempDir(), "b.conf")
+	require.NoError(t, os.WriteFile(tenantB, []byte(dirB+"\n"), 0600))
+
+	s := NewServer(parseConfig(t, "--tenant=a="+tenantA, "--tenant=b="+tenantB, serverDir))
+	s.initialize()
+	transport := newSSETransport(s, "", s.metrics, s.logger)
+	transport.onClose = s.provider.EndSession
+
+	mux := http.NewServeMux()
+	transport.register(mux)
+	testServer := httptest.NewServer(mux)
+	transport.baseURL = testServer.URL
+	defer testServer.Close()
+
+	// listDirectories opens a session, initializes it with params and returns
+	// the directories the session may access
+	listDirectories := func(token, params string) []string {
+		t.Helper()
+		resp, err := http.Get(testServer.URL + "/sse")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		reader := bufio.NewReader(resp.Body)
+		_, endpoint := readEvent(t, reader)
+
+		post := func(body string) {
+			t.Helper()
+			req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(body))
+			require.NoError(t, err)
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			postResp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			postResp.Body.Close()
+		}
+
+		post(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":` + params + `}`)
+		readEvent(t, reader)
+		post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+		post(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"list_allowed_directories","arguments":{}}}`)
+		_, data := readEvent(t, reader)
+
+		var response struct {
+			Result mcp.CallToolResult `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(data), &response))
+		text := response.Result.Content[0].(map[string]any)["text"].(string)
+		var directories []string
+		require.NoError(t, json.Unmarshal([]byte(text), &directories), text)
+		return directories
+	}
+
+	initialize := `{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}`
+	named := `{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1.0"},"_meta":{"tenant":"b"}}`
+
+	assert.Equal(t, []string{dirA}, listDirectories("secret", initialize), "the token selects its tenant")
+	assert.Equal(t, []string{dirB}, listDirectories("", named), "tenants without tokens are selected by name")
+	assert.Equal(t, []string{serverDir}, listDirectories("", initialize), "other sessions get the server's directories")
+}
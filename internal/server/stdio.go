@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+)
+
+// stdioTransport serves the MCP protocol over standard input and output, one
+// JSON-RPC message per line. Unlike ServeStdio from mcp-go it passes messages
+// to a handler, so that a reload can replace the MCP server behind it, and it
+// can send notifications to the client.
+type stdioTransport struct {
+	handler messageHandler
+	logger  *logging.Logger
+
+	mu  sync.Mutex // Serializes writes to out
+	out io.Writer
+}
+
+// newStdioTransport creates a transport passing client messages to handler and
+// writing to out
+func newStdioTransport(handler messageHandler, out io.Writer, logger *logging.Logger) *stdioTransport {
+	return &stdioTransport{
+		handler: handler,
+		logger:  logger,
+		out:     out,
+	}
+}
+
+// serve handles the messages read from in until it is closed or ctx is done
+func (t *stdioTransport) serve(ctx context.Context, in io.Reader) error {
+	lines := make(chan []byte)
+	errs := make(chan error, 1)
+
+	// Read in the background so that cancelling ctx does not wait for input
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case line := <-lines:
+			response := t.handler.HandleMessage(ctx, json.RawMessage(line))
+			// Notifications have no response
+			if response == nil {
+				continue
+			}
+			if err := t.write(response); err != nil {
+				t.logger.Warn("Error writing response: %v", err)
+			}
+		}
+	}
+}
+
+// notify sends a notification to the client
+func (t *stdioTransport) notify(method string) {
+	err := t.write(struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+	}{mcp.JSONRPC_VERSION, method})
+	if err != nil {
+		t.logger.Warn("Error sending %s: %v", method, err)
+	}
+}
+
+// write sends a message to the client as one line
+func (t *stdioTransport) write(message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.out.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStdioTransport(t *testing.T) {
+	out := &syncBuffer{}
+	transport := newStdioTransport(server.NewMCPServer("test", "1.0.0"), out, logging.DefaultLogger("test"))
+
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}` + "\n\n" +
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	require.NoError(t, transport.serve(context.Background(), in))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2, "notifications get no response")
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, lines[0])
+	assert.Contains(t, lines[1], `"id":2`)
+
+	transport.notify("notifications/tools/list_changed")
+	assert.True(t, strings.HasSuffix(out.String(), `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`+"\n"))
+}
+
+func TestStdioTransportStops(t *testing.T) {
+	transport := newStdioTransport(server.NewMCPServer("test", "1.0.0"), io.Discard, logging.DefaultLogger("test"))
+	in, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- transport.serve(ctx, in) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("serve did not return after the context was cancelled")
+	}
+}
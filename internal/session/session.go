@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Info identifies the client on whose behalf a request is handled
+type Info struct {
+	ID    string // Transport session ID
+	Token string // Bearer token presented by the client, if any
+	Peer  Peer   // Connection back to the client, nil if the transport has none
+
+	// Tenant named by the client when it initialized, if any
+	Tenant string
+}
+
+// Peer sends requests from the server to a connected client
+type Peer interface {
+	// Supports reports whether the client advertised the named capability
+	// when it initialized (e.g. "elicitation" or "roots")
+	Supports(capability string) bool
+	// Request sends a JSON-RPC request to the client and waits for its result
+	Request(ctx context.Context, method string, params any) (json.RawMessage, error)
+}
+
+// Key returns the identity used for per-client accounting. Clients presenting the
+// same token share a key across sessions; the token itself is never exposed.
+func (i Info) Key() string {
+	if i.Token != "" {
+		sum := sha256.Sum256([]byte(i.Token))
+		return "token:" + hex.EncodeToString(sum[:8])
+	}
+	if i.ID != "" {
+		return "session:" + i.ID
+	}
+	return "default"
+}
+
+// contextKey is the context key for session information
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying info
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the session information stored in ctx, if any
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(contextKey{}).(Info)
+	return info, ok
+}
+
+// KeyFromContext returns the accounting key of the session stored in ctx,
+// or "default" when the request carries no session (e.g. stdio mode)
+func KeyFromContext(ctx context.Context) string {
+	info, _ := FromContext(ctx)
+	return info.Key()
+}
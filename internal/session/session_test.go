@@ -0,0 +1,35 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfoKey(t *testing.T) {
+	assert.Equal(t, "default", Info{}.Key())
+	assert.Equal(t, "session:abc", Info{ID: "abc"}.Key())
+
+	tokenKey := Info{ID: "abc", Token: "secret"}.Key()
+	assert.True(t, strings.HasPrefix(tokenKey, "token:"))
+	assert.NotContains(t, tokenKey, "secret")
+
+	// The same token maps to the same key regardless of session
+	assert.Equal(t, tokenKey, Info{ID: "def", Token: "secret"}.Key())
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+
+	_, ok := FromContext(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, "default", KeyFromContext(ctx))
+
+	ctx = NewContext(ctx, Info{ID: "abc"})
+	info, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", info.ID)
+	assert.Equal(t, "session:abc", KeyFromContext(ctx))
+}
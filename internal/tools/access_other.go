@@ -0,0 +1,11 @@
+//go:build !unix
+
+package tools
+
+import "os"
+
+// canWrite reports whether the process may write to the existing file or directory at path
+func canWrite(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().Perm()&0200 != 0
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package tools
+
+import "syscall"
+
+// writeOK is the access(2) mode bit for write permission
+const writeOK = 0x2
+
+// canWrite reports whether the process may write to the existing file or directory at path
+func canWrite(path string) bool {
+	return syscall.Access(path, writeOK) == nil
+}
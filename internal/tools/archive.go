@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// Archive formats
+const (
+	ArchiveZip   = "zip"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+)
+
+// Archive entry types
+const (
+	entryFile     = "file"
+	entryDir      = "directory"
+	entrySymlink  = "symlink"
+	entryHardlink = "hardlink"
+)
+
+// maxLinkSize is the longest symbolic link target read from a zip entry
+const maxLinkSize = 4096
+
+// ArchiveLimits protects extraction against decompression bombs. Zero disables a limit.
+type ArchiveLimits struct {
+	MaxTotalSize int64   // Maximum total uncompressed size of the entries of an archive
+	MaxEntries   int     // Maximum number of entries in an archive
+	MaxRatio     float64 // Maximum ratio of the uncompressed size to the archive's size
+}
+
+// DefaultArchiveLimits returns the limits applied unless configured otherwise
+func DefaultArchiveLimits() ArchiveLimits {
+	return ArchiveLimits{
+		MaxTotalSize: 1 << 30,
+		MaxEntries:   10000,
+		MaxRatio:     100,
+	}
+}
+
+// archiveHeader is an archive entry independent of the archive format
+type archiveHeader struct {
+	name     string
+	kind     string // One of the entry types, empty for unsupported entries
+	size     int64
+	mode     fs.FileMode
+	modTime  time.Time
+	linkname string
+}
+
+// archiveFormat returns the format of the archive at path: format if it is
+// not empty, otherwise the one its extension names
+func archiveFormat(path, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case ArchiveZip, "jar":
+		return ArchiveZip, nil
+	case ArchiveTar:
+		return ArchiveTar, nil
+	case ArchiveTarGz, "tgz":
+		return ArchiveTarGz, nil
+	case "":
+	default:
+		return "", fmt.Errorf("%w: unknown archive format %q", errors.ErrInvalidArgument, format)
+	}
+
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".jar"):
+		return ArchiveZip, nil
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz, nil
+	}
+	return "", fmt.Errorf("%w: cannot tell the archive format of %s, pass format", errors.ErrInvalidArgument, path)
+}
+
+// archiveEntryPath checks the name of an archive entry and returns it as a
+// clean slash-separated relative path, or "" for the archive root. Absolute
+// names and names with ".." components are refused.
+func archiveEntryPath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%w: archive entry %q has an absolute path", errors.ErrInvalidPath, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: archive entry %q leaves the destination", errors.ErrInvalidPath, name)
+		}
+	}
+
+	clean := path.Clean(name)
+	if clean == "." {
+		return "", nil
+	}
+	return clean, nil
+}
+
+// walkArchive calls fn for each entry of the archive at validPath. r reads the
+// content of a file entry and is only valid during the call. fn may return
+// fs.SkipAll to stop early.
+func walkArchive(fsys Backend, validPath, format string, fn func(h archiveHeader, r io.Reader) error) error {
+	var err error
+	if format == ArchiveZip {
+		err = walkZip(fsys, validPath, fn)
+	} else {
+		err = walkTar(fsys, validPath, format == ArchiveTarGz, fn)
+	}
+	if err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkZip walks the entries of a zip archive
+func walkZip(fsys Backend, validPath string, fn func(h archiveHeader, r io.Reader) error) error {
+	file, err := fsys.Open(validPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+	}
+
+	for _, f := range zr.File {
+		h := archiveHeader{name: f.Name, mode: f.Mode(), modTime: f.Modified}
+		switch {
+		case f.Mode().IsDir() || strings.HasSuffix(f.Name, "/"):
+			h.kind = entryDir
+		case f.Mode()&fs.ModeSymlink != 0:
+			h.kind = entrySymlink
+		case f.Mode().IsRegular():
+			h.kind = entryFile
+			h.size = int64(f.UncompressedSize64) // #nosec G115 - sizes above 8 EiB are rejected as a limit
+		}
+
+		if h.kind != entryFile && h.kind != entrySymlink {
+			if err := fn(h, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := walkZipFile(f, h, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkZipFile passes a zip file or symbolic link entry with its content to fn
+func walkZipFile(f *zip.File, h archiveHeader, fn func(h archiveHeader, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+	}
+	defer rc.Close()
+
+	if h.kind == entrySymlink {
+		target, err := io.ReadAll(io.LimitReader(rc, maxLinkSize))
+		if err != nil {
+			return fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+		}
+		h.linkname = string(target)
+		return fn(h, nil)
+	}
+	return fn(h, rc)
+}
+
+// walkTar walks the entries of a tar archive, optionally gzip-compressed
+func walkTar(fsys Backend, validPath string, compressed bool, fn func(h archiveHeader, r io.Reader) error) error {
+	file, err := fsys.Open(validPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+		}
+
+		h := archiveHeader{name: hdr.Name, mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime, linkname: hdr.Linkname}
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA: //nolint:staticcheck // TypeRegA is still written by old tools
+			h.kind = entryFile
+			h.size = hdr.Size
+		case tar.TypeDir:
+			h.kind = entryDir
+		case tar.TypeSymlink:
+			h.kind = entrySymlink
+		case tar.TypeLink:
+			h.kind = entryHardlink
+		}
+
+		if err := fn(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveSource is a file, directory or symbolic link to add to an archive
+type archiveSource struct {
+	name     string // Slash-separated name in the archive
+	path     string // Validated path on disk
+	info     fs.FileInfo
+	linkname string
+}
+
+// writeArchive writes sources to w in the given format
+func writeArchive(fsys Backend, w io.Writer, format string, sources []archiveSource) error {
+	if format == ArchiveZip {
+		return writeZip(fsys, w, sources)
+	}
+
+	if format == ArchiveTarGz {
+		gz := gzip.NewWriter(w)
+		if err := writeTar(fsys, gz, sources); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	return writeTar(fsys, w, sources)
+}
+
+// writeZip writes sources as a zip archive
+func writeZip(fsys Backend, w io.Writer, sources []archiveSource) error {
+	zw := zip.NewWriter(w)
+	for _, src := range sources {
+		hdr, err := zip.FileInfoHeader(src.info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = src.name
+		if src.info.IsDir() {
+			hdr.Name += "/"
+		} else if src.info.Mode().IsRegular() {
+			hdr.Method = zip.Deflate
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case src.linkname != "":
+			_, err = io.WriteString(fw, src.linkname)
+		case src.info.Mode().IsRegular():
+			err = copyFileTo(fsys, fw, src.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTar writes sources as a tar archive
+func writeTar(fsys Backend, w io.Writer, sources []archiveSource) error {
+	tw := tar.NewWriter(w)
+	for _, src := range sources {
+		hdr, err := tar.FileInfoHeader(src.info, src.linkname)
+		if err != nil {
+			return err
+		}
+		hdr.Name = src.name
+		if src.info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if src.info.Mode().IsRegular() {
+			if err := copyFileTo(fsys, tw, src.path); err != nil {
+				return err
+			}
+		}
+	}
+	return tw.Close()
+}
+
+// copyFileTo copies the content of the file at validPath to w
+func copyFileTo(fsys Backend, w io.Writer, validPath string) error {
+	file, err := fsys.Open(validPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
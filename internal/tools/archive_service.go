@@ -0,0 +1,828 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+)
+
+// ArchiveService implements ArchiveManager
+type ArchiveService struct {
+	allowedDirs []string
+	logger      *logging.Logger
+	validator   *PathValidatorImpl
+	files       *FileService // Applies the write limits and quotas
+	fsys        Backend
+}
+
+// NewArchiveService creates a new ArchiveService with the default archive limits
+func NewArchiveService(allowedDirs []string) *ArchiveService {
+	files := NewFileService(allowedDirs)
+	return &ArchiveService{
+		allowedDirs: allowedDirs,
+		logger:      logging.DefaultLogger("archive_service"),
+		validator:   files.validator,
+		files:       files,
+		fsys:        OSBackend{},
+	}
+}
+
+// ArchiveEntry is a file, directory or link added to or extracted from an archive
+type ArchiveEntry struct {
+	Name   string `json:"name"` // Name in the archive
+	Path   string `json:"path"` // Path on disk
+	Type   string `json:"type"` // "file", "directory", "symlink" or "hardlink"
+	Size   int64  `json:"size,omitempty"`
+	Target string `json:"target,omitempty"` // Link target
+}
+
+// ArchiveResult reports what an archive operation did
+type ArchiveResult struct {
+	Archive     string         `json:"archive"`
+	Format      string         `json:"format"`
+	Destination string         `json:"destination,omitempty"`
+	Files       int            `json:"files"`
+	Directories int            `json:"directories"`
+	Links       int            `json:"links"`
+	Bytes       int64          `json:"bytes"` // Uncompressed size of the files
+	ArchiveSize int64          `json:"archive_size"`
+	Overwritten int            `json:"overwritten,omitempty"`
+	Entries     []ArchiveEntry `json:"entries"`
+}
+
+// count adds an entry to the result's totals
+func (r *ArchiveResult) count(entry ArchiveEntry) {
+	switch entry.Type {
+	case entryFile:
+		r.Files++
+		r.Bytes += entry.Size
+	case entryDir:
+		r.Directories++
+	default:
+		r.Links++
+	}
+	r.Entries = append(r.Entries, entry)
+}
+
+// createRequest is a validated create_archive call
+type createRequest struct {
+	validPath string
+	format    string
+	exists    bool
+	sources   []archiveSource
+	result    *ArchiveResult
+}
+
+// prepareCreate validates the archive path and collects the entries of a new archive
+func (s *ArchiveService) prepareCreate(archivePath string, sources []string, format string, overwrite bool) (*createRequest, error) {
+	validPath, err := s.validator.ValidateWritePath(archivePath)
+	if err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+
+	format, err = archiveFormat(validPath, format)
+	if err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+
+	if len(sources) == 0 {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, fmt.Errorf("%w: no sources", errors.ErrInvalidArgument))
+	}
+
+	req := &createRequest{
+		validPath: validPath,
+		format:    format,
+		result:    &ArchiveResult{Archive: validPath, Format: format, Entries: []ArchiveEntry{}},
+	}
+	if info, err := s.fsys.Stat(validPath); err == nil {
+		if info.IsDir() || !overwrite {
+			return nil, errors.NewFileSystemError("create_archive", archivePath, fmt.Errorf("%w: %s already exists", errors.ErrInvalidOperation, validPath))
+		}
+		req.exists = true
+	}
+
+	names := make(map[string]string)
+	for _, source := range sources {
+		matches, err := s.expandSource(source)
+		if err != nil {
+			return nil, errors.NewFileSystemError("create_archive", source, err)
+		}
+		for _, match := range matches {
+			if err := s.collectSource(req, match, names); err != nil {
+				return nil, errors.NewFileSystemError("create_archive", match, err)
+			}
+		}
+	}
+
+	return req, nil
+}
+
+// expandSource validates a source path or glob and returns the paths it names
+func (s *ArchiveService) expandSource(source string) ([]string, error) {
+	if !strings.ContainsAny(source, "*?[") {
+		validPath, err := s.validator.ValidatePath(source)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.fsys.Lstat(validPath); err != nil {
+			if os.IsNotExist(err) {
+				return nil, errors.ErrFileNotFound
+			}
+			return nil, err
+		}
+		return []string{validPath}, nil
+	}
+
+	pattern, err := filepath.Abs(ExpandHome(source))
+	if err != nil {
+		return nil, err
+	}
+	matches, err := glob(s.fsys, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+	}
+	if len(matches) == 0 {
+		return nil, errors.ErrFileNotFound
+	}
+
+	validPaths := make([]string, 0, len(matches))
+	for _, match := range matches {
+		validPath, err := s.validator.ValidatePath(match)
+		if err != nil {
+			return nil, err
+		}
+		validPaths = append(validPaths, validPath)
+	}
+	return validPaths, nil
+}
+
+// collectSource adds the file, link or directory tree at validPath to the
+// archive. Entries are named relative to the source's parent directory, the
+// path policy's hidden entries and the archive itself are skipped and symbolic
+// links are stored rather than followed. names maps the entry names added so
+// far to their paths.
+func (s *ArchiveService) collectSource(req *createRequest, validPath string, names map[string]string) error {
+	base := filepath.Dir(validPath)
+	return walkDir(s.fsys, validPath, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entryPath == req.validPath || !s.validator.Permits(entryPath, ReadAccess) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, entryPath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if existing, ok := names[name]; ok {
+			if existing == entryPath {
+				return nil // Named by more than one source
+			}
+			return fmt.Errorf("%w: %s and %s would both be stored as %s", errors.ErrInvalidArgument, existing, entryPath, name)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		src := archiveSource{name: name, path: entryPath, info: info}
+		entry := ArchiveEntry{Name: name, Path: entryPath}
+		switch {
+		case info.IsDir():
+			entry.Type = entryDir
+		case info.Mode()&fs.ModeSymlink != 0:
+			if src.linkname, err = s.fsys.Readlink(entryPath); err != nil {
+				return err
+			}
+			entry.Type = entrySymlink
+			entry.Target = src.linkname
+		case info.Mode().IsRegular():
+			entry.Type = entryFile
+			entry.Size = info.Size()
+		default:
+			return nil // Devices, sockets and pipes cannot be archived
+		}
+
+		names[name] = entryPath
+		req.sources = append(req.sources, src)
+		req.result.count(entry)
+		return nil
+	})
+}
+
+// CreateArchive writes the files, directories and symbolic links named by
+// sources, which are paths or glob patterns, into a new zip, tar or tar.gz
+// archive at archivePath. format defaults to the one the archive's extension
+// names. An existing archive is only replaced if overwrite is set.
+func (s *ArchiveService) CreateArchive(archivePath string, sources []string, format string, overwrite bool) (*ArchiveResult, error) {
+	req, err := s.prepareCreate(archivePath, sources, format, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(req.validPath)
+	if err := s.fsys.MkdirAll(dir, 0750); err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+
+	// Write to a temporary file so that a failure leaves no partial archive behind
+	tmp, err := s.fsys.CreateTemp(dir, ".archive-*")
+	if err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+	defer func() { _ = s.fsys.Remove(tmp.Name()) }()
+
+	if err := writeArchive(s.fsys, tmp, req.format, req.sources); err != nil {
+		tmp.Close()
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+
+	info, err := s.fsys.Stat(tmp.Name())
+	if err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+	change, err := s.files.checkWrite(req.validPath, info.Size(), info.Size())
+	if err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+
+	if err := s.fsys.Rename(tmp.Name(), req.validPath); err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+	s.files.commitUsage(change)
+
+	req.result.ArchiveSize = info.Size()
+	return req.result, nil
+}
+
+// PlanCreateArchive validates the creation of an archive and describes it without writing
+func (s *ArchiveService) PlanCreateArchive(archivePath string, sources []string, format string, overwrite bool) (*Change, error) {
+	req, err := s.prepareCreate(archivePath, sources, format, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWritable(s.fsys, req.validPath); err != nil {
+		return nil, errors.NewFileSystemError("create_archive", archivePath, err)
+	}
+
+	result := req.result
+	change := &Change{
+		Operation:   "create_archive",
+		Path:        req.validPath,
+		Action:      "create",
+		Files:       result.Files,
+		BytesAfter:  result.Bytes,
+		Description: fmt.Sprintf("Create %s archive %s with %d files, %d directories and %d links (%d bytes uncompressed)", req.format, req.validPath, result.Files, result.Directories, result.Links, result.Bytes),
+	}
+	if req.exists {
+		change.Action = "overwrite"
+		if info, err := s.fsys.Stat(req.validPath); err == nil {
+			change.BytesBefore = info.Size()
+		}
+	}
+	return change, nil
+}
+
+// extractEntry is a validated archive entry to extract
+type extractEntry struct {
+	ArchiveEntry
+	mode      fs.FileMode
+	overwrite bool // An existing file is replaced
+}
+
+// extractRequest is a validated extract_archive call
+type extractRequest struct {
+	validArchive string
+	validDest    string
+	format       string
+	archiveSize  int64
+	entries      map[string]*extractEntry // By entry name
+	order        []string
+	total        int64
+	overwritten  int
+}
+
+// prepareExtract validates an archive and every entry's destination before
+// anything is extracted. Entries must stay inside the destination: absolute
+// names, ".." components, symbolic links pointing outside it and hard links
+// to anything but an earlier file of the archive are refused, as are archives
+// exceeding the archive limits or the write limits and quotas.
+func (s *ArchiveService) prepareExtract(archivePath, destination, format string, overwrite bool) (*extractRequest, error) {
+	validArchive, err := s.validator.ValidatePath(archivePath)
+	if err != nil {
+		return nil, errors.NewFileSystemError("extract_archive", archivePath, err)
+	}
+	info, err := s.fsys.Stat(validArchive)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewFileSystemError("extract_archive", archivePath, errors.ErrFileNotFound)
+		}
+		return nil, errors.NewFileSystemError("extract_archive", archivePath, err)
+	}
+	if info.IsDir() {
+		return nil, errors.NewFileSystemError("extract_archive", archivePath, errors.ErrInvalidOperation)
+	}
+
+	format, err = archiveFormat(validArchive, format)
+	if err != nil {
+		return nil, errors.NewFileSystemError("extract_archive", archivePath, err)
+	}
+
+	validDest, err := s.validator.ValidateWritePath(destination)
+	if err != nil {
+		return nil, errors.NewFileSystemError("extract_archive", destination, err)
+	}
+	if destInfo, err := s.fsys.Stat(validDest); err == nil && !destInfo.IsDir() {
+		return nil, errors.NewFileSystemError("extract_archive", destination, errors.ErrInvalidOperation)
+	}
+
+	req := &extractRequest{
+		validArchive: validArchive,
+		validDest:    validDest,
+		format:       format,
+		archiveSize:  info.Size(),
+		entries:      make(map[string]*extractEntry),
+	}
+	err = walkArchive(s.fsys, validArchive, format, func(h archiveHeader, _ io.Reader) error {
+		return s.addExtractEntry(req, h, overwrite)
+	})
+	if err != nil {
+		return nil, errors.NewFileSystemError("extract_archive", archivePath, err)
+	}
+
+	// Nothing may be extracted below a link or a file of the archive
+	for _, name := range req.order {
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if entry, ok := req.entries[parent]; ok && entry.Type != entryDir {
+				return nil, errors.NewFileSystemError("extract_archive", archivePath, fmt.Errorf("%w: archive entry %q is below %q, which is not a directory", errors.ErrInvalidPath, name, parent))
+			}
+		}
+	}
+
+	if maxRatio := s.validator.ArchiveLimits().MaxRatio; maxRatio > 0 && req.archiveSize > 0 {
+		ratio := float64(req.total) / float64(req.archiveSize)
+		if ratio > maxRatio {
+			return nil, errors.NewFileSystemError("extract_archive", archivePath, errors.NewQuotaError("archive_max_ratio", int64(maxRatio), int64(ratio)))
+		}
+	}
+
+	if err := s.checkQuota(req); err != nil {
+		return nil, errors.NewFileSystemError("extract_archive", destination, err)
+	}
+
+	return req, nil
+}
+
+// addExtractEntry validates one archive entry and adds it to req
+func (s *ArchiveService) addExtractEntry(req *extractRequest, h archiveHeader, overwrite bool) error {
+	limits, writes := s.validator.ArchiveLimits(), s.validator.WriteLimits()
+	if limits.MaxEntries > 0 && len(req.order) >= limits.MaxEntries {
+		return errors.NewQuotaError("archive_max_entries", int64(limits.MaxEntries), int64(len(req.order)+1))
+	}
+
+	name, err := archiveEntryPath(h.name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		if h.kind == entryDir {
+			return nil
+		}
+		return fmt.Errorf("%w: archive entry %q has no name", errors.ErrInvalidPath, h.name)
+	}
+	if h.kind == "" {
+		return fmt.Errorf("%w: archive entry %q has an unsupported type", errors.ErrInvalidArgument, h.name)
+	}
+	if existing, ok := req.entries[name]; ok {
+		if existing.Type == entryDir && h.kind == entryDir {
+			return nil
+		}
+		return fmt.Errorf("%w: archive entry %q appears twice", errors.ErrInvalidArgument, h.name)
+	}
+
+	target, err := s.validator.ValidateWritePath(filepath.Join(req.validDest, filepath.FromSlash(name)))
+	if err != nil {
+		return fmt.Errorf("archive entry %q: %w", h.name, err)
+	}
+
+	entry := &extractEntry{
+		ArchiveEntry: ArchiveEntry{Name: name, Path: target, Type: h.kind},
+		mode:         h.mode,
+	}
+	switch h.kind {
+	case entryFile:
+		entry.Size = h.size
+		req.total += h.size
+		if limits.MaxTotalSize > 0 && (h.size < 0 || req.total > limits.MaxTotalSize) {
+			return errors.NewQuotaError("archive_max_size", limits.MaxTotalSize, req.total)
+		}
+		if max := writes.MaxWriteSize; max > 0 && h.size > max {
+			return errors.NewQuotaError("max_write_size", max, h.size)
+		}
+		if max := writes.MaxFileSize; max > 0 && h.size > max {
+			return errors.NewQuotaError("max_file_size", max, h.size)
+		}
+	case entrySymlink:
+		if err := s.checkLinkTarget(req.validDest, target, h); err != nil {
+			return err
+		}
+		entry.Target = h.linkname
+	case entryHardlink:
+		linked, err := archiveEntryPath(h.linkname)
+		if err != nil {
+			return err
+		}
+		if source, ok := req.entries[linked]; !ok || source.Type != entryFile {
+			return fmt.Errorf("%w: hard link %q does not point to an earlier file of the archive", errors.ErrInvalidPath, h.name)
+		}
+		entry.Target = linked
+	}
+
+	if existing, err := s.fsys.Lstat(target); err == nil {
+		switch {
+		case existing.IsDir() && h.kind == entryDir:
+		case existing.IsDir():
+			return fmt.Errorf("%w: %s is a directory", errors.ErrInvalidOperation, target)
+		case !overwrite:
+			return fmt.Errorf("%w: %s already exists", errors.ErrInvalidOperation, target)
+		default:
+			entry.overwrite = true
+			req.overwritten++
+		}
+	}
+
+	req.entries[name] = entry
+	req.order = append(req.order, name)
+	return nil
+}
+
+// checkLinkTarget refuses symbolic link entries whose target is absolute,
+// leaves the destination directory or is a path the policy denies
+func (s *ArchiveService) checkLinkTarget(validDest, target string, h archiveHeader) error {
+	linkname := strings.ReplaceAll(h.linkname, "\\", "/")
+	if linkname == "" || strings.HasPrefix(linkname, "/") || filepath.IsAbs(h.linkname) || (len(linkname) >= 2 && linkname[1] == ':') {
+		return fmt.Errorf("%w: symbolic link %q has an absolute target", errors.ErrInvalidPath, h.name)
+	}
+
+	resolved := filepath.Join(filepath.Dir(target), filepath.FromSlash(linkname))
+	if !within(validDest, resolved) {
+		return fmt.Errorf("%w: symbolic link %q points outside the destination", errors.ErrInvalidPath, h.name)
+	}
+	if !s.validator.Permits(resolved, ReadAccess) || !s.validator.Permits(resolved, WriteAccess) {
+		return fmt.Errorf("%w: symbolic link %q points to %s", errors.ErrPathDenied, h.name, resolved)
+	}
+	return nil
+}
+
+// within reports whether path is dir or below it
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// checkQuota checks that the extracted files fit in the destination root's quota
+func (s *ArchiveService) checkQuota(req *extractRequest) error {
+	limits := s.validator.WriteLimits()
+	if s.files.usage == nil || !limits.hasQuota() {
+		return nil
+	}
+	root, ok := s.files.usage.RootFor(req.validDest)
+	if !ok {
+		return nil
+	}
+
+	var files int64
+	for _, entry := range req.entries {
+		if entry.Type == entryFile || entry.Type == entryHardlink {
+			files++
+		}
+	}
+
+	usage := s.files.usage.Usage(root)
+	if limits.QuotaBytes > 0 && usage.Bytes+req.total > limits.QuotaBytes {
+		return errors.NewQuotaError("quota_bytes", limits.QuotaBytes, usage.Bytes+req.total)
+	}
+	if limits.QuotaFiles > 0 && usage.Files+files > limits.QuotaFiles {
+		return errors.NewQuotaError("quota_files", limits.QuotaFiles, usage.Files+files)
+	}
+	return nil
+}
+
+// extraction is an extract_archive call in progress
+type extraction struct {
+	fsys     Backend
+	req      *extractRequest
+	realDest string   // Destination with symbolic links resolved
+	created  []string // Files and directories created, to remove on failure
+	written  int64
+}
+
+// ExtractArchive extracts a zip, tar or tar.gz archive into destination.
+// Every entry is validated before anything is written, and entries are
+// re-checked while they are extracted so that neither a changed archive nor
+// symbolic links already on disk can lead outside the destination. Existing
+// files are only replaced if overwrite is set. If extraction fails, the files
+// and directories it created are removed again.
+func (s *ArchiveService) ExtractArchive(archivePath, destination, format string, overwrite bool) (*ArchiveResult, error) {
+	req, err := s.prepareExtract(archivePath, destination, format, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &extraction{fsys: s.fsys, req: req}
+	if err := x.mkdirAll(req.validDest); err != nil {
+		return nil, errors.NewFileSystemError("extract_archive", destination, err)
+	}
+
+	// The destination may itself be reached through a symbolic link, which
+	// must not lead out of its allowed directory
+	root, _ := s.validator.rootFor(req.validDest)
+	realRoot, err := s.fsys.EvalSymlinks(root)
+	if err == nil {
+		x.realDest, err = s.fsys.EvalSymlinks(req.validDest)
+	}
+	if err != nil {
+		x.rollback()
+		return nil, errors.NewFileSystemError("extract_archive", destination, err)
+	}
+	if !within(realRoot, x.realDest) {
+		x.rollback()
+		return nil, errors.NewFileSystemError("extract_archive", destination, errors.ErrPathNotAllowed)
+	}
+
+	if err := x.run(); err != nil {
+		x.rollback()
+		if s.files.usage != nil {
+			s.files.usage.InvalidatePath(req.validDest)
+		}
+		return nil, errors.NewFileSystemError("extract_archive", archivePath, err)
+	}
+	if s.files.usage != nil {
+		s.files.usage.InvalidatePath(req.validDest)
+	}
+
+	result := &ArchiveResult{
+		Archive:     req.validArchive,
+		Format:      req.format,
+		Destination: req.validDest,
+		ArchiveSize: req.archiveSize,
+		Overwritten: req.overwritten,
+		Entries:     make([]ArchiveEntry, 0, len(req.order)),
+	}
+	for _, name := range req.order {
+		result.count(req.entries[name].ArchiveEntry)
+	}
+	return result, nil
+}
+
+// run extracts directories and files, then hard links and finally symbolic
+// links, so that no entry is written through a link of the archive
+func (x *extraction) run() error {
+	var hardlinks, symlinks []*extractEntry
+	err := walkArchive(x.fsys, x.req.validArchive, x.req.format, func(h archiveHeader, r io.Reader) error {
+		name, err := archiveEntryPath(h.name)
+		if err != nil {
+			return err
+		}
+		entry, ok := x.req.entries[name]
+		if name == "" || !ok {
+			return nil
+		}
+		if entry.Type != h.kind {
+			return fmt.Errorf("%w: archive changed during extraction", errors.ErrInvalidOperation)
+		}
+
+		switch h.kind {
+		case entryDir:
+			return x.mkdirAll(entry.Path)
+		case entryFile:
+			return x.writeFile(entry, r)
+		case entryHardlink:
+			hardlinks = append(hardlinks, entry)
+		case entrySymlink:
+			if entry.Target != h.linkname {
+				return fmt.Errorf("%w: archive changed during extraction", errors.ErrInvalidOperation)
+			}
+			symlinks = append(symlinks, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range hardlinks {
+		if err := x.link(entry); err != nil {
+			return err
+		}
+	}
+	for _, entry := range symlinks {
+		if err := x.symlink(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDir makes sure a directory entries are written to, or its nearest
+// existing ancestor, resolves to a location inside the destination
+func (x *extraction) checkDir(dir string) error {
+	for {
+		real, err := x.fsys.EvalSymlinks(dir)
+		if err == nil {
+			if x.realDest != "" && !within(x.realDest, real) {
+				return fmt.Errorf("%w: %s leads outside the destination", errors.ErrPathNotAllowed, dir)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+}
+
+// mkdirAll creates a directory and its missing parents, recording the ones it created
+func (x *extraction) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := x.fsys.Lstat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	if err := x.checkDir(dir); err != nil {
+		return err
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := x.fsys.Mkdir(missing[i], 0750); err != nil && !os.IsExist(err) {
+			return err
+		}
+		x.created = append(x.created, missing[i])
+	}
+	return nil
+}
+
+// prepareTarget creates the parent of an entry and removes a file it replaces
+func (x *extraction) prepareTarget(entry *extractEntry) error {
+	if err := x.mkdirAll(filepath.Dir(entry.Path)); err != nil {
+		return err
+	}
+	if err := x.checkDir(filepath.Dir(entry.Path)); err != nil {
+		return err
+	}
+
+	if _, err := x.fsys.Lstat(entry.Path); err == nil {
+		if !entry.overwrite {
+			return fmt.Errorf("%w: %s already exists", errors.ErrInvalidOperation, entry.Path)
+		}
+		// Remove rather than truncate, in case it is a link
+		if err := x.fsys.Remove(entry.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile extracts a file entry, refusing content beyond the size its header announced
+func (x *extraction) writeFile(entry *extractEntry, r io.Reader) error {
+	if err := x.prepareTarget(entry); err != nil {
+		return err
+	}
+
+	perm := entry.mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	file, err := x.fsys.OpenFile(entry.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	x.created = append(x.created, entry.Path)
+
+	n, err := io.Copy(file, io.LimitReader(r, entry.Size+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n != entry.Size {
+		return fmt.Errorf("%w: archive entry %q does not match its declared size", errors.ErrInvalidArgument, entry.Name)
+	}
+
+	x.written += n
+	if x.written > x.req.total {
+		return fmt.Errorf("%w: archive changed during extraction", errors.ErrInvalidOperation)
+	}
+	return nil
+}
+
+// link extracts a hard link entry, copying the file where hard links are not supported
+func (x *extraction) link(entry *extractEntry) error {
+	if err := x.prepareTarget(entry); err != nil {
+		return err
+	}
+
+	source := x.req.entries[entry.Target].Path
+	if err := x.fsys.Link(source, entry.Path); err != nil {
+		if err := copyFile(x.fsys, source, entry.Path); err != nil {
+			return err
+		}
+	}
+	x.created = append(x.created, entry.Path)
+	return nil
+}
+
+// symlink extracts a symbolic link entry and checks where it leads
+func (x *extraction) symlink(entry *extractEntry) error {
+	if err := x.prepareTarget(entry); err != nil {
+		return err
+	}
+
+	if err := x.fsys.Symlink(filepath.FromSlash(strings.ReplaceAll(entry.Target, "\\", "/")), entry.Path); err != nil {
+		return err
+	}
+	x.created = append(x.created, entry.Path)
+
+	if real, err := x.fsys.EvalSymlinks(entry.Path); err == nil && !within(x.realDest, real) {
+		return fmt.Errorf("%w: symbolic link %q points outside the destination", errors.ErrPathNotAllowed, entry.Name)
+	}
+	return nil
+}
+
+// rollback removes what the extraction created, deepest first
+func (x *extraction) rollback() {
+	sort.SliceStable(x.created, func(i, j int) bool {
+		return len(x.created[i]) > len(x.created[j])
+	})
+	for _, path := range x.created {
+		_ = x.fsys.Remove(path)
+	}
+}
+
+// copyFile copies the content of one validated path to a new file at another
+func copyFile(fsys Backend, source, destination string) error {
+	file, err := fsys.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = copyFileTo(fsys, file, source)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// PlanExtractArchive validates the extraction of an archive and describes it without writing
+func (s *ArchiveService) PlanExtractArchive(archivePath, destination, format string, overwrite bool) (*Change, error) {
+	req, err := s.prepareExtract(archivePath, destination, format, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWritable(s.fsys, req.validDest); err != nil {
+		return nil, errors.NewFileSystemError("extract_archive", destination, err)
+	}
+
+	files := 0
+	for _, entry := range req.entries {
+		if entry.Type != entryDir {
+			files++
+		}
+	}
+
+	change := &Change{
+		Operation:   "extract_archive",
+		Path:        req.validArchive,
+		Destination: req.validDest,
+		Action:      "create",
+		Files:       files,
+		BytesAfter:  req.total,
+		Description: fmt.Sprintf("Extract %d entries (%d bytes) from %s into %s", len(req.order), req.total, req.validArchive, req.validDest),
+	}
+	if req.overwritten > 0 {
+		change.Action = "overwrite"
+		change.Description += fmt.Sprintf(", replacing %d existing files", req.overwritten)
+	}
+	return change, nil
+}
@@ -0,0 +1,315 @@
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tarEntry is an entry of a test tar archive
+type tarEntry struct {
+	header tar.Header
+	body   string
+}
+
+// writeTestTar writes a tar archive with hand-made headers
+func writeTestTar(t *testing.T, path string, entries ...tarEntry) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(testTar(t, entries...)), 0644))
+}
+
+// testTar returns a tar archive with hand-made headers
+func testTar(t *testing.T, entries ...tarEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		hdr := entry.header
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		hdr.Size = int64(len(entry.body))
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(entry.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.String()
+}
+
+// writeTestZip writes a zip archive of files with the given names and contents
+func writeTestZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(testZip(t, files)), 0644))
+}
+
+// testZip returns a zip archive of files with the given names and contents
+func testZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.String()
+}
+
+func TestArchiveService_RoundTrip(t *testing.T) {
+	for _, format := range []string{ArchiveZip, ArchiveTar, ArchiveTarGz} {
+		t.Run(format, func(t *testing.T) {
+			root := newUsageTree(t, map[string]int{
+				"src/main.go":     10,
+				"src/pkg/util.go": 20,
+				"notes.txt":       5,
+				"notes.md":        7,
+			})
+			service := NewArchiveService([]string{root})
+			symlinks := os.Symlink("main.go", filepath.Join(root, "src", "link")) == nil
+
+			archive := filepath.Join(root, "out", "backup."+format)
+			result, err := service.CreateArchive(archive, []string{filepath.Join(root, "src"), filepath.Join(root, "notes.*")}, "", false)
+			require.NoError(t, err)
+			assert.Equal(t, format, result.Format)
+			assert.Equal(t, 4, result.Files)
+			assert.Equal(t, 2, result.Directories)
+			assert.Equal(t, int64(42), result.Bytes)
+			assert.NotZero(t, result.ArchiveSize)
+			if symlinks {
+				assert.Equal(t, 1, result.Links)
+			}
+
+			_, err = service.CreateArchive(archive, []string{filepath.Join(root, "src")}, "", false)
+			assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+
+			dest := filepath.Join(root, "restored")
+			result, err = service.ExtractArchive(archive, dest, "", false)
+			require.NoError(t, err)
+			assert.Equal(t, 4, result.Files)
+			assert.Equal(t, int64(42), result.Bytes)
+			assert.Equal(t, dest, result.Destination)
+
+			data, err := os.ReadFile(filepath.Join(dest, "src", "pkg", "util.go"))
+			require.NoError(t, err)
+			assert.Len(t, data, 20)
+			assert.FileExists(t, filepath.Join(dest, "notes.md"))
+			if symlinks {
+				target, err := os.Readlink(filepath.Join(dest, "src", "link"))
+				require.NoError(t, err)
+				assert.Equal(t, "main.go", target)
+			}
+
+			// Existing files are only replaced on request
+			_, err = service.ExtractArchive(archive, dest, "", false)
+			assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+			result, err = service.ExtractArchive(archive, dest, "", true)
+			require.NoError(t, err)
+			assert.Equal(t, 4+result.Links, result.Overwritten)
+		})
+	}
+}
+
+func TestArchiveService_ExtractRefusesEscapes(t *testing.T) {
+	root := t.TempDir()
+	service := NewArchiveService([]string{root})
+	dest := filepath.Join(root, "dest")
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		want    error
+	}{
+		{"parent traversal", []tarEntry{{header: tar.Header{Name: "ok.txt"}, body: "ok"}, {header: tar.Header{Name: "a/../../evil.txt"}, body: "x"}}, errors.ErrInvalidPath},
+		{"absolute path", []tarEntry{{header: tar.Header{Name: "/tmp/evil.txt"}, body: "x"}}, errors.ErrInvalidPath},
+		{"windows path", []tarEntry{{header: tar.Header{Name: "..\\evil.txt"}, body: "x"}}, errors.ErrInvalidPath},
+		{"symlink outside", []tarEntry{{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}}}, errors.ErrInvalidPath},
+		{"absolute symlink", []tarEntry{{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}}}, errors.ErrInvalidPath},
+		{"write through symlink", []tarEntry{
+			{header: tar.Header{Name: "sub", Typeflag: tar.TypeDir, Mode: 0755}},
+			{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "sub"}},
+			{header: tar.Header{Name: "link/x.txt"}, body: "x"},
+		}, errors.ErrInvalidPath},
+		{"hardlink outside", []tarEntry{{header: tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"}}}, errors.ErrInvalidPath},
+		{"hardlink to later entry", []tarEntry{
+			{header: tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: "file"}},
+			{header: tar.Header{Name: "file"}, body: "x"},
+		}, errors.ErrInvalidPath},
+		{"device", []tarEntry{{header: tar.Header{Name: "null", Typeflag: tar.TypeChar}}}, errors.ErrInvalidArgument},
+		{"duplicate", []tarEntry{{header: tar.Header{Name: "a"}, body: "1"}, {header: tar.Header{Name: "./a"}, body: "2"}}, errors.ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := filepath.Join(root, "bad.tar")
+			writeTestTar(t, archive, tt.entries...)
+
+			_, err := service.ExtractArchive(archive, dest, "", false)
+			assert.ErrorIs(t, err, tt.want)
+			assert.NoDirExists(t, dest, "nothing is extracted from a refused archive")
+		})
+	}
+
+	t.Run("zip slip", func(t *testing.T) {
+		archive := filepath.Join(root, "slip.zip")
+		writeTestZip(t, archive, map[string]string{"../../evil.txt": "x"})
+
+		_, err := service.ExtractArchive(archive, dest, "", false)
+		assert.ErrorIs(t, err, errors.ErrInvalidPath)
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(root), "evil.txt"))
+	})
+
+	t.Run("existing symlink in destination", func(t *testing.T) {
+		outside := t.TempDir()
+		require.NoError(t, os.MkdirAll(dest, 0755))
+		defer os.RemoveAll(dest)
+		if err := os.Symlink(outside, filepath.Join(dest, "out")); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+
+		archive := filepath.Join(root, "through.tar")
+		writeTestTar(t, archive, tarEntry{header: tar.Header{Name: "first.txt"}, body: "1"}, tarEntry{header: tar.Header{Name: "out/evil.txt"}, body: "x"})
+
+		_, err := service.ExtractArchive(archive, dest, "", false)
+		assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+		assert.NoFileExists(t, filepath.Join(outside, "evil.txt"))
+		assert.NoFileExists(t, filepath.Join(dest, "first.txt"), "a failed extraction is rolled back")
+	})
+
+	t.Run("path policy", func(t *testing.T) {
+		policy, err := NewPathPolicy([]PolicyRule{{Pattern: "**/.env", Write: true}})
+		require.NoError(t, err)
+		service := NewArchiveService([]string{root})
+		service.validator.policy = policy
+
+		archive := filepath.Join(root, "env.tar")
+		writeTestTar(t, archive, tarEntry{header: tar.Header{Name: "app/.env"}, body: "KEY=1"})
+
+		_, err = service.ExtractArchive(archive, dest, "", false)
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+	})
+
+	t.Run("symlink to denied path", func(t *testing.T) {
+		policy, err := NewPathPolicy([]PolicyRule{{Pattern: ".env", Read: true, Write: true}})
+		require.NoError(t, err)
+		service := NewArchiveService([]string{root})
+		service.validator.policy = policy
+		require.NoError(t, os.MkdirAll(dest, 0755))
+		defer os.RemoveAll(dest)
+		require.NoError(t, os.WriteFile(filepath.Join(dest, ".env"), []byte("KEY=1"), 0644))
+
+		archive := filepath.Join(root, "leak.tar")
+		writeTestTar(t, archive, tarEntry{header: tar.Header{Name: "leak", Typeflag: tar.TypeSymlink, Linkname: ".env"}})
+
+		_, err = service.ExtractArchive(archive, dest, "", false)
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+		_, err = os.Lstat(filepath.Join(dest, "leak"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestArchiveService_ExtractLimits(t *testing.T) {
+	root := t.TempDir()
+	dest := filepath.Join(root, "dest")
+
+	archive := filepath.Join(root, "bomb.zip")
+	writeTestZip(t, archive, map[string]string{
+		"a.txt": string(make([]byte, 1<<20)),
+		"b.txt": "b",
+		"c.txt": "c",
+	})
+
+	tests := []struct {
+		name   string
+		limits ArchiveLimits
+	}{
+		{"ratio", ArchiveLimits{MaxRatio: 100}},
+		{"total size", ArchiveLimits{MaxTotalSize: 1 << 19}},
+		{"entries", ArchiveLimits{MaxEntries: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewArchiveService([]string{root})
+			service.validator.archives = tt.limits
+
+			_, err := service.ExtractArchive(archive, dest, "", false)
+			assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+			assert.NoDirExists(t, dest)
+		})
+	}
+
+	t.Run("write limits", func(t *testing.T) {
+		service := NewArchiveService([]string{root})
+		service.validator.archives = ArchiveLimits{}
+		service.validator.writes = WriteLimits{MaxFileSize: 1024}
+
+		_, err := service.ExtractArchive(archive, dest, "", false)
+		assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		service := NewArchiveService([]string{root})
+		service.validator.archives = ArchiveLimits{}
+
+		result, err := service.ExtractArchive(archive, dest, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Files)
+	})
+}
+
+func TestServiceProvider_Archives(t *testing.T) {
+	root := newUsageTree(t, map[string]int{"docs/a.txt": 3, "docs/b.txt": 4})
+	provider := NewServiceProvider([]string{root})
+	archive := filepath.Join(root, "docs.tgz")
+
+	result, err := callTool(provider.handleCreateArchive, context.Background(), map[string]interface{}{
+		"path": archive, "sources": []interface{}{filepath.Join(root, "docs")}, "dry_run": true,
+	})
+	require.NoError(t, err)
+	change := decodeDryRun(t, result)
+	assert.Equal(t, "create", change.Action)
+	assert.Equal(t, 2, change.Files)
+	assert.NoFileExists(t, archive)
+
+	_, err = callTool(provider.handleCreateArchive, context.Background(), map[string]interface{}{
+		"path": archive, "sources": `["` + filepath.ToSlash(filepath.Join(root, "docs")) + `"]`,
+	})
+	require.NoError(t, err)
+
+	result, err = callTool(provider.handleExtractArchive, context.Background(), map[string]interface{}{
+		"path": archive, "destination": filepath.Join(root, "copy"), "dry_run": true,
+	})
+	require.NoError(t, err)
+	change = decodeDryRun(t, result)
+	assert.Equal(t, int64(7), change.BytesAfter)
+	assert.NoDirExists(t, filepath.Join(root, "copy"))
+
+	result, err = callTool(provider.handleExtractArchive, context.Background(), map[string]interface{}{
+		"path": archive, "destination": filepath.Join(root, "copy"),
+	})
+	require.NoError(t, err)
+	var report ArchiveResult
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report))
+	assert.Equal(t, ArchiveTarGz, report.Format)
+	assert.Equal(t, 2, report.Files)
+	assert.FileExists(t, filepath.Join(root, "copy", "docs", "b.txt"))
+
+	_, err = callTool(provider.handleCreateArchive, context.Background(), map[string]interface{}{
+		"path": filepath.Join(root, "x.rar"), "sources": `["docs"]`,
+	})
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+}
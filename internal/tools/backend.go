@@ -0,0 +1,336 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// Backend kinds an allowed directory can be bound to
+const (
+	BackendOS      = "os"
+	BackendMemory  = "memory"
+	BackendOverlay = "overlay"
+)
+
+// Backend is the storage the services read and write through. Paths are
+// absolute and already validated; errors are *fs.PathError values wrapping
+// fs.ErrNotExist, fs.ErrExist and the like, as returned by the os package.
+type Backend interface {
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	CreateTemp(dir, pattern string) (File, error)
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Chmod(name string, mode fs.FileMode) error
+	Link(oldname, newname string) error
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	EvalSymlinks(name string) (string, error)
+
+	// Writable reports whether the existing file or directory at name may be written
+	Writable(name string) bool
+}
+
+// File is a file opened through a Backend
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Seeker
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+}
+
+// OSBackend stores files on the local filesystem
+type OSBackend struct{}
+
+func (OSBackend) Open(name string) (File, error) {
+	return os.Open(name) // #nosec G304 - paths are validated by the services
+}
+
+func (OSBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm) // #nosec G304 - paths are validated by the services
+}
+
+func (OSBackend) CreateTemp(dir, pattern string) (File, error) {
+	return os.CreateTemp(dir, pattern)
+}
+
+func (OSBackend) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OSBackend) Lstat(name string) (fs.FileInfo, error)       { return os.Lstat(name) }
+func (OSBackend) ReadDir(name string) ([]fs.DirEntry, error)   { return os.ReadDir(name) }
+func (OSBackend) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSBackend) Remove(name string) error                     { return os.Remove(name) }
+func (OSBackend) RemoveAll(name string) error                  { return os.RemoveAll(name) }
+func (OSBackend) Mkdir(name string, perm fs.FileMode) error    { return os.Mkdir(name, perm) }
+func (OSBackend) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+func (OSBackend) Chmod(name string, mode fs.FileMode) error    { return os.Chmod(name, mode) }
+func (OSBackend) Link(oldname, newname string) error           { return os.Link(oldname, newname) }
+func (OSBackend) Symlink(oldname, newname string) error        { return os.Symlink(oldname, newname) }
+func (OSBackend) Readlink(name string) (string, error)         { return os.Readlink(name) }
+func (OSBackend) EvalSymlinks(name string) (string, error)     { return filepath.EvalSymlinks(name) }
+func (OSBackend) Writable(name string) bool                    { return canWrite(name) }
+
+// BackendBinding binds an allowed directory to a backend kind
+type BackendBinding struct {
+	Root  string
+	Kind  string
+	Upper string // Directory holding the changes of an overlay, "" to keep them in memory
+}
+
+// Validate checks that the binding names a known backend
+func (b BackendBinding) Validate() error {
+	switch {
+	case b.Kind != BackendOS && b.Kind != BackendMemory && b.Kind != BackendOverlay:
+		return fmt.Errorf("unknown backend %q for %s (available: %s, %s, %s)", b.Kind, b.Root, BackendOS, BackendMemory, BackendOverlay)
+	case b.Upper != "" && b.Kind != BackendOverlay:
+		return fmt.Errorf("only the %s backend keeps changes in an upper directory", BackendOverlay)
+	case b.Upper != "" && (within(b.Root, b.Upper) || within(b.Upper, b.Root)):
+		return fmt.Errorf("the upper directory of the overlay of %s must be outside it", b.Root)
+	}
+	return nil
+}
+
+// WithBackends stores the allowed directories of the bindings in their
+// backends; other paths stay on the local filesystem
+func WithBackends(bindings []BackendBinding) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.backends = bindings
+	}
+}
+
+// hasOverlays reports whether an allowed directory is stored in an overlay
+func (p *ServiceProvider) hasOverlays() bool {
+	return slices.ContainsFunc(p.backends, func(b BackendBinding) bool {
+		return b.Kind == BackendOverlay
+	})
+}
+
+// newBackend creates the backend serving the bound directories
+func newBackend(bindings []BackendBinding) (Backend, error) {
+	if len(bindings) == 0 {
+		return OSBackend{}, nil
+	}
+
+	mounts := &backendMounts{}
+	for _, binding := range bindings {
+		if err := binding.Validate(); err != nil {
+			return nil, err
+		}
+		var backend Backend = OSBackend{}
+		switch {
+		case binding.Kind == BackendMemory:
+			backend = NewMemoryBackend(binding.Root)
+		case binding.Kind == BackendOverlay && binding.Upper == "":
+			backend = NewOverlayBackend(binding.Root, NewMemoryBackend(binding.Root), binding.Root)
+		case binding.Kind == BackendOverlay:
+			backend = NewOverlayBackend(binding.Root, OSBackend{}, binding.Upper)
+		}
+		mounts.mounts = append(mounts.mounts, backendMount{root: filepath.Clean(binding.Root), backend: backend})
+	}
+	return mounts, nil
+}
+
+// backendMount is a directory stored in a backend
+type backendMount struct {
+	root    string
+	backend Backend
+}
+
+// backendMounts routes each path to the backend of the most specific mounted
+// directory containing it, and other paths to the local filesystem
+type backendMounts struct {
+	mounts []backendMount
+}
+
+// backend returns the backend storing path
+func (m *backendMounts) backend(path string) Backend {
+	var best *backendMount
+	for i, mount := range m.mounts {
+		if within(mount.root, path) && (best == nil || len(mount.root) > len(best.root)) {
+			best = &m.mounts[i]
+		}
+	}
+	if best == nil {
+		return OSBackend{}
+	}
+	return best.backend
+}
+
+func (m *backendMounts) Open(name string) (File, error) { return m.backend(name).Open(name) }
+func (m *backendMounts) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return m.backend(name).OpenFile(name, flag, perm)
+}
+func (m *backendMounts) CreateTemp(dir, pattern string) (File, error) {
+	return m.backend(dir).CreateTemp(dir, pattern)
+}
+func (m *backendMounts) Stat(name string) (fs.FileInfo, error)  { return m.backend(name).Stat(name) }
+func (m *backendMounts) Lstat(name string) (fs.FileInfo, error) { return m.backend(name).Lstat(name) }
+func (m *backendMounts) ReadDir(name string) ([]fs.DirEntry, error) {
+	return m.backend(name).ReadDir(name)
+}
+func (m *backendMounts) Remove(name string) error    { return m.backend(name).Remove(name) }
+func (m *backendMounts) RemoveAll(name string) error { return m.backend(name).RemoveAll(name) }
+func (m *backendMounts) Mkdir(name string, perm fs.FileMode) error {
+	return m.backend(name).Mkdir(name, perm)
+}
+func (m *backendMounts) MkdirAll(name string, perm fs.FileMode) error {
+	return m.backend(name).MkdirAll(name, perm)
+}
+func (m *backendMounts) Chmod(name string, mode fs.FileMode) error {
+	return m.backend(name).Chmod(name, mode)
+}
+func (m *backendMounts) Link(oldname, newname string) error {
+	backend := m.backend(oldname)
+	if backend != m.backend(newname) {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname,
+			Err: fmt.Errorf("%w: source and destination are on different storage backends", errors.ErrInvalidOperation)}
+	}
+	return backend.Link(oldname, newname)
+}
+func (m *backendMounts) Symlink(oldname, newname string) error {
+	return m.backend(newname).Symlink(oldname, newname)
+}
+func (m *backendMounts) Readlink(name string) (string, error) { return m.backend(name).Readlink(name) }
+func (m *backendMounts) EvalSymlinks(name string) (string, error) {
+	return m.backend(name).EvalSymlinks(name)
+}
+func (m *backendMounts) Writable(name string) bool { return m.backend(name).Writable(name) }
+
+// Rename moves a file within one backend; moving between backends fails
+func (m *backendMounts) Rename(oldpath, newpath string) error {
+	backend := m.backend(oldpath)
+	if backend != m.backend(newpath) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath,
+			Err: fmt.Errorf("%w: source and destination are on different storage backends", errors.ErrInvalidOperation)}
+	}
+	return backend.Rename(oldpath, newpath)
+}
+
+// readFile reads a whole file from a backend
+func readFile(fsys Backend, name string) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// glob returns the paths in a backend matching pattern, as filepath.Glob does
+func glob(fsys Backend, pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !hasMeta(pattern) {
+		if _, err := fsys.Lstat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := filepath.Split(pattern)
+	dir = filepath.Clean(dir)
+	dirs := []string{dir}
+	if hasMeta(dir) && dir != pattern {
+		var err error
+		if dirs, err = glob(fsys, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []string
+	for _, d := range dirs {
+		entries, err := fsys.ReadDir(d)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if ok, _ := filepath.Match(file, entry.Name()); ok {
+				matches = append(matches, filepath.Join(d, entry.Name()))
+			}
+		}
+	}
+	return matches, nil
+}
+
+// hasMeta reports whether a path contains glob metacharacters
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
+
+// walkDir walks the tree rooted at root in a backend like filepath.WalkDir:
+// in lexical order, without following symbolic links, calling fn again with
+// the error for a directory that cannot be read
+func walkDir(fsys Backend, root string, fn fs.WalkDirFunc) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDirEntry(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDirEntry implements walkDir for one entry
+func walkDirEntry(fsys Backend, path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		// Report the error, letting fn skip the directory
+		if err = fn(path, d, err); err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return compareNames(a.Name(), b.Name())
+	})
+	for _, entry := range entries {
+		if err := walkDirEntry(fsys, filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// compareNames orders names as os.ReadDir does
+func compareNames(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
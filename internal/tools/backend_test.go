@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendBinding_Validate(t *testing.T) {
+	assert.NoError(t, BackendBinding{Root: "/data", Kind: BackendOS}.Validate())
+	assert.NoError(t, BackendBinding{Root: "/data", Kind: BackendMemory}.Validate())
+	assert.Error(t, BackendBinding{Root: "/data", Kind: "s3"}.Validate())
+
+	_, err := newBackend([]BackendBinding{{Root: "/data", Kind: "s3"}})
+	assert.Error(t, err)
+
+	fsys, err := newBackend(nil)
+	require.NoError(t, err)
+	assert.Equal(t, OSBackend{}, fsys)
+}
+
+func TestBackendMounts_Routing(t *testing.T) {
+	disk := t.TempDir()
+	scratch := filepath.Join(t.TempDir(), "scratch")
+	fsys, err := newBackend([]BackendBinding{{Root: scratch, Kind: BackendMemory}})
+	require.NoError(t, err)
+
+	file, err := fsys.OpenFile(filepath.Join(scratch, "a.txt"), os.O_WRONLY|os.O_CREATE, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("memory"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	data, err := readFile(fsys, filepath.Join(scratch, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "memory", string(data))
+	assert.NoDirExists(t, scratch)
+
+	// Paths outside the bound directory stay on disk
+	require.NoError(t, fsys.MkdirAll(filepath.Join(disk, "sub"), 0755))
+	assert.DirExists(t, filepath.Join(disk, "sub"))
+
+	err = fsys.Rename(filepath.Join(scratch, "a.txt"), filepath.Join(disk, "a.txt"))
+	assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+	err = fsys.Link(filepath.Join(scratch, "a.txt"), filepath.Join(disk, "a.txt"))
+	assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+
+	require.NoError(t, fsys.Rename(filepath.Join(scratch, "a.txt"), filepath.Join(scratch, "b.txt")))
+	_, err = fsys.Stat(filepath.Join(scratch, "b.txt"))
+	assert.NoError(t, err)
+}
+
+func TestBackendMounts_NestedRoots(t *testing.T) {
+	base := t.TempDir()
+	inner := filepath.Join(base, "inner")
+	fsys, err := newBackend([]BackendBinding{
+		{Root: base, Kind: BackendOS},
+		{Root: inner, Kind: BackendMemory},
+	})
+	require.NoError(t, err)
+
+	mounts := fsys.(*backendMounts)
+	assert.Equal(t, OSBackend{}, mounts.backend(filepath.Join(base, "a.txt")))
+	assert.IsType(t, &MemoryBackend{}, mounts.backend(filepath.Join(inner, "a.txt")))
+	assert.Equal(t, OSBackend{}, mounts.backend(filepath.Join(t.TempDir(), "other")))
+}
+
+func TestWalkDirAndGlob(t *testing.T) {
+	root := "/work"
+	fsys := NewMemoryBackend(root)
+	for _, name := range []string{"b.txt", "a/x.go", "a/y.txt", "c/z.go"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, fsys.MkdirAll(filepath.Dir(path), 0755))
+		file, err := fsys.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+
+	var visited []string
+	err := walkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		require.NoError(t, err)
+		if d.IsDir() && d.Name() == "c" {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(root, path)
+		visited = append(visited, filepath.ToSlash(rel))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{".", "a", "a/x.go", "a/y.txt", "b.txt"}, visited)
+
+	matches, err := glob(fsys, filepath.Join(root, "*", "*.go"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "a", "x.go"), filepath.Join(root, "c", "z.go")}, matches)
+
+	matches, err = glob(fsys, filepath.Join(root, "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "b.txt")}, matches)
+
+	matches, err = glob(fsys, filepath.Join(root, "missing.txt"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	err = walkDir(fsys, filepath.Join(root, "missing"), func(path string, d fs.DirEntry, err error) error {
+		return err
+	})
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServiceProvider_MemoryBackend(t *testing.T) {
+	scratch := filepath.Join(t.TempDir(), "scratch")
+	provider := NewServiceProvider([]string{scratch}, WithBackends([]BackendBinding{{Root: scratch, Kind: BackendMemory}}))
+	ctx := context.Background()
+
+	_, err := callTool(provider.handleCreateDirectory, ctx, map[string]interface{}{"path": filepath.Join(scratch, "docs")})
+	require.NoError(t, err)
+	_, err = callTool(provider.handleWriteFile, ctx, map[string]interface{}{
+		"path": filepath.Join(scratch, "docs", "notes.txt"), "content": "remember the milk",
+	})
+	require.NoError(t, err)
+
+	result, err := callTool(provider.handleReadFile, ctx, map[string]interface{}{"path": filepath.Join(scratch, "docs", "notes.txt")})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "remember the milk")
+
+	result, err = callTool(provider.handleListDirectory, ctx, map[string]interface{}{"path": filepath.Join(scratch, "docs")})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "notes.txt")
+
+	_, err = callTool(provider.handleMoveFile, ctx, map[string]interface{}{
+		"source_path":      filepath.Join(scratch, "docs", "notes.txt"),
+		"destination_path": filepath.Join(scratch, "notes.txt"),
+	})
+	require.NoError(t, err)
+
+	result, err = callTool(provider.handleSearchFiles, ctx, map[string]interface{}{"path": scratch, "query": "milk"})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, filepath.Join(scratch, "notes.txt"))
+
+	archive := filepath.Join(scratch, "backup.zip")
+	_, err = callTool(provider.handleCreateArchive, ctx, map[string]interface{}{
+		"path": archive, "sources": []interface{}{filepath.Join(scratch, "notes.txt")},
+	})
+	require.NoError(t, err)
+	_, err = callTool(provider.handleExtractArchive, ctx, map[string]interface{}{
+		"path": archive, "destination": filepath.Join(scratch, "restored"),
+	})
+	require.NoError(t, err)
+
+	result, err = callTool(provider.handleReadFile, ctx, map[string]interface{}{"path": archive + "!/notes.txt"})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "remember the milk")
+
+	_, err = callTool(provider.handleDeleteFile, ctx, map[string]interface{}{"path": filepath.Join(scratch, "notes.txt")})
+	require.NoError(t, err)
+	_, err = callTool(provider.handleGetFileInfo, ctx, map[string]interface{}{"path": filepath.Join(scratch, "notes.txt")})
+	assert.Error(t, err)
+
+	result, err = callTool(provider.handleReadFile, ctx, map[string]interface{}{"path": filepath.Join(scratch, "restored", "notes.txt")})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "remember the milk")
+
+	// Nothing reached the local filesystem
+	assert.NoDirExists(t, scratch)
+}
@@ -0,0 +1,534 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// maxBatchOperations caps the number of operations in one apply_batch call
+const maxBatchOperations = 1000
+
+// BatchOperation is one operation of an apply_batch call. Op is the name of the
+// tool the operation corresponds to and the other fields are its arguments.
+type BatchOperation struct {
+	Op              string     `json:"op"` // "write_file", "edit_file", "edit_lines", "move_file", "copy_file", "delete_file" or "create_directory"
+	Path            string     `json:"path,omitempty"`
+	Content         string     `json:"content,omitempty"`
+	Append          bool       `json:"append,omitempty"`
+	StartLine       int        `json:"start_line,omitempty"`
+	EndLine         int        `json:"end_line,omitempty"`
+	Edits           []LineEdit `json:"edits,omitempty"`
+	SourcePath      string     `json:"source_path,omitempty"`
+	DestinationPath string     `json:"destination_path,omitempty"`
+}
+
+// BatchResult reports the outcome of one operation of a batch
+type BatchResult struct {
+	Index  int     `json:"index"`
+	Op     string  `json:"op"`
+	Path   string  `json:"path"`
+	Status string  `json:"status"` // "planned", "invalid", "skipped", "applied", "failed" or "rolled_back"
+	Error  string  `json:"error,omitempty"`
+	Change *Change `json:"change,omitempty"`
+}
+
+// batchResponse is the result of an apply_batch call
+type batchResponse struct {
+	Status         string        `json:"status"` // "applied", "rolled_back", "invalid" or "dry_run"
+	Results        []BatchResult `json:"results"`
+	RollbackErrors []string      `json:"rollback_errors,omitempty"`
+}
+
+// batchStep is a batch operation with the paths it reads and changes
+type batchStep struct {
+	op      BatchOperation
+	inputs  []string // Valid paths that must exist before the operation
+	outputs []string // Valid paths the operation creates, modifies or removes
+	change  *Change
+	err     error
+}
+
+// path returns the path an operation is reported under
+func (op BatchOperation) path() string {
+	if op.Path != "" {
+		return op.Path
+	}
+	return op.SourcePath
+}
+
+// parseBatchOperations decodes the operations argument
+func parseBatchOperations(arg interface{}) ([]BatchOperation, error) {
+	var ops []BatchOperation
+	if err := decodeJSONArgument(arg, &ops); err != nil {
+		return nil, errors.NewFileSystemError("apply_batch", "", err)
+	}
+	if len(ops) == 0 || len(ops) > maxBatchOperations {
+		return nil, errors.NewFileSystemError("apply_batch", "", fmt.Errorf("%w: a batch needs 1 to %d operations", errors.ErrInvalidArgument, maxBatchOperations))
+	}
+	return ops, nil
+}
+
+// decodeJSONArgument decodes a tool argument given either as JSON or as a
+// string holding JSON
+func decodeJSONArgument(arg interface{}, v any) error {
+	var data []byte
+	switch value := arg.(type) {
+	case nil:
+		return errors.ErrInvalidArgument
+	case string:
+		data = []byte(value)
+	default:
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+	}
+	return nil
+}
+
+// resolveBatchStep validates the paths of an operation
+func (p *ServiceProvider) resolveBatchStep(op BatchOperation) (*batchStep, error) {
+	step := &batchStep{op: op}
+
+	write := func(path string) (string, error) {
+		if path == "" {
+			return "", errors.NewFileSystemError(op.Op, "", errors.ErrInvalidArgument)
+		}
+		validPath, err := p.validator.ValidateWritePath(path)
+		if err != nil {
+			return "", errors.NewFileSystemError(op.Op, path, err)
+		}
+		return validPath, nil
+	}
+
+	switch op.Op {
+	case "write_file", "create_directory":
+		validPath, err := write(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		step.outputs = []string{validPath}
+	case "edit_file", "edit_lines", "delete_file":
+		validPath, err := write(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		step.inputs = []string{validPath}
+		step.outputs = []string{validPath}
+	case "move_file":
+		validSource, err := write(op.SourcePath)
+		if err != nil {
+			return nil, err
+		}
+		validDest, err := write(op.DestinationPath)
+		if err != nil {
+			return nil, err
+		}
+		step.inputs = []string{validSource}
+		step.outputs = []string{validSource, validDest}
+	case "copy_file":
+		if op.SourcePath == "" {
+			return nil, errors.NewFileSystemError(op.Op, "", errors.ErrInvalidArgument)
+		}
+		validSource, err := p.validator.ValidatePath(op.SourcePath)
+		if err != nil {
+			return nil, errors.NewFileSystemError(op.Op, op.SourcePath, err)
+		}
+		validDest, err := write(op.DestinationPath)
+		if err != nil {
+			return nil, err
+		}
+		step.inputs = []string{validSource}
+		step.outputs = []string{validDest}
+	default:
+		return nil, errors.NewFileSystemError("apply_batch", op.Op, fmt.Errorf("%w: unknown operation %q", errors.ErrInvalidArgument, op.Op))
+	}
+
+	return step, nil
+}
+
+// planBatchOperation validates one operation against the disk and describes it
+func (p *ServiceProvider) planBatchOperation(op BatchOperation) (*Change, error) {
+	switch op.Op {
+	case "write_file":
+		return p.fileWriter.PlanWriteFile(op.Path, op.Content, op.Append)
+	case "edit_file":
+		return p.fileWriter.PlanEditFile(op.Path, op.Content, op.StartLine, op.EndLine)
+	case "edit_lines":
+		return p.fileWriter.PlanEditLines(op.Path, op.Edits)
+	case "move_file":
+		return p.fileManager.PlanMoveFile(op.SourcePath, op.DestinationPath)
+	case "copy_file":
+		return p.fileManager.PlanCopyFile(op.SourcePath, op.DestinationPath)
+	case "delete_file":
+		return p.fileManager.PlanDeleteFile(op.Path)
+	default:
+		return p.directoryService.PlanCreateDirectory(op.Path)
+	}
+}
+
+// applyBatchOperation applies one operation
+func (p *ServiceProvider) applyBatchOperation(op BatchOperation) error {
+	switch op.Op {
+	case "write_file":
+		return p.fileWriter.WriteFile(op.Path, op.Content, op.Append)
+	case "edit_file":
+		return p.fileWriter.EditFile(op.Path, op.Content, op.StartLine, op.EndLine)
+	case "edit_lines":
+		return p.fileWriter.EditLines(op.Path, op.Edits)
+	case "move_file":
+		return p.fileManager.MoveFile(op.SourcePath, op.DestinationPath)
+	case "copy_file":
+		return p.fileManager.CopyFile(op.SourcePath, op.DestinationPath)
+	case "delete_file":
+		return p.fileManager.DeleteFile(op.Path)
+	default:
+		return p.directoryService.CreateDirectory(op.Path)
+	}
+}
+
+// planBatch validates every operation of a batch before any is applied. An
+// operation reading a path changed by an earlier operation cannot be checked
+// against the disk; its paths are validated now and the rest when it is applied.
+func (p *ServiceProvider) planBatch(ops []BatchOperation) ([]*batchStep, bool) {
+	steps := make([]*batchStep, len(ops))
+	exists := make(map[string]bool) // Paths changed by earlier operations and whether they will exist
+	valid := true
+
+	for i, op := range ops {
+		step, err := p.resolveBatchStep(op)
+		if err != nil {
+			steps[i] = &batchStep{op: op, err: err}
+			valid = false
+			continue
+		}
+		steps[i] = step
+
+		dependent := false
+		for _, input := range step.inputs {
+			if present, ok := exists[input]; ok {
+				dependent = true
+				if !present {
+					step.err = errors.NewFileSystemError(op.Op, input, errors.ErrFileNotFound)
+				}
+			}
+		}
+
+		switch {
+		case step.err != nil:
+		case dependent:
+			step.change = &Change{
+				Operation:   op.Op,
+				Path:        step.outputs[0],
+				Action:      "pending",
+				Description: "Depends on an earlier operation in the batch and is checked when applied",
+			}
+		default:
+			step.change, step.err = p.planBatchOperation(op)
+		}
+		if step.err != nil {
+			valid = false
+			continue
+		}
+
+		for _, output := range step.outputs {
+			exists[output] = true
+		}
+		switch op.Op {
+		case "delete_file", "move_file":
+			exists[step.inputs[0]] = false
+		}
+	}
+
+	return steps, valid
+}
+
+// batchPreview describes a batch for confirmation, or returns nil if no
+// operation in it is covered by the confirmation policy
+func (p *ServiceProvider) batchPreview(steps []*batchStep) *OperationPreview {
+	preview := &OperationPreview{Tool: "apply_batch", Files: []string{}}
+	confirm := false
+
+	for _, step := range steps {
+		change := step.change
+		switch {
+		case step.op.Op == "delete_file":
+			_, required := p.requiresConfirmation("delete_file", step.op.Path)
+			confirm = confirm || required
+		case step.op.Op == "write_file" && change.Action == "overwrite":
+			_, required := p.requiresConfirmation("write_file", step.op.Path)
+			confirm = confirm || required
+		case (step.op.Op == "move_file" || step.op.Op == "copy_file") && change.Destination != "":
+			if info, err := p.fsys.Stat(change.Destination); err == nil && !info.IsDir() {
+				_, required := p.requiresConfirmation(step.op.Op, step.op.DestinationPath)
+				confirm = confirm || required
+			}
+		}
+
+		preview.FileCount += change.Files
+		preview.TotalBytes += change.BytesBefore
+		if len(preview.Files) < maxPreviewFiles {
+			preview.Files = append(preview.Files, change.Path)
+		}
+	}
+
+	if !confirm {
+		return nil
+	}
+	preview.Description = fmt.Sprintf("Apply a batch of %d operation(s)", len(steps))
+	return preview
+}
+
+// applyBatch applies validated operations in order. If one fails, every change
+// made so far is undone from the staged originals.
+func (p *ServiceProvider) applyBatch(steps []*batchStep) (*mcp.CallToolResult, error) {
+	staging := &batchStaging{fsys: p.fsys, staged: make(map[string]bool)}
+	defer staging.cleanup()
+
+	response := batchResponse{Status: "applied", Results: make([]BatchResult, len(steps))}
+	written := 0
+	for i, step := range steps {
+		response.Results[i] = BatchResult{Index: i, Op: step.op.Op, Path: step.op.path(), Status: "skipped", Change: step.change}
+	}
+
+	for i, step := range steps {
+		err := staging.stage(step.outputs)
+		if err == nil {
+			err = p.applyBatchOperation(step.op)
+		}
+		if err != nil {
+			response.Status = "rolled_back"
+			response.Results[i].Status = "failed"
+			response.Results[i].Error = err.Error()
+			for j := 0; j < i; j++ {
+				response.Results[j].Status = "rolled_back"
+			}
+
+			for _, rollbackErr := range staging.rollback() {
+				response.RollbackErrors = append(response.RollbackErrors, rollbackErr.Error())
+			}
+			for _, entry := range staging.entries {
+				p.usage.InvalidatePath(entry.path)
+			}
+			if len(response.RollbackErrors) > 0 {
+				p.logger.Error("Batch rollback incomplete: %v", response.RollbackErrors)
+			}
+			return p.batchResult(response)
+		}
+
+		response.Results[i].Status = "applied"
+		written += len(step.op.Content)
+		for _, edit := range step.op.Edits {
+			written += len(edit.Content)
+		}
+	}
+
+	p.metrics.BytesWritten.Add(float64(written), "apply_batch")
+	return p.batchResult(response)
+}
+
+// batchResult turns a batch response into a tool result, reported as an error
+// unless the batch was applied or planned. Secrets are redacted from the diffs.
+func (p *ServiceProvider) batchResult(response batchResponse) (*mcp.CallToolResult, error) {
+	redactions := 0
+	for _, result := range response.Results {
+		redactions += p.redactChange(result.Change)
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, errors.NewFileSystemError("apply_batch", "", err)
+	}
+
+	if response.Status == "applied" || response.Status == "dry_run" {
+		return p.withRedactionReport(mcp.NewToolResultText(string(data)), "apply_batch", redactions), nil
+	}
+	return p.withRedactionReport(mcp.NewToolResultError(string(data)), "apply_batch", redactions), nil
+}
+
+func (p *ServiceProvider) handleApplyBatch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ops, err := parseBatchOperations(request.Params.Arguments["operations"])
+	if err != nil {
+		return nil, err
+	}
+
+	steps, valid := p.planBatch(ops)
+	if !valid || p.isDryRun(request) {
+		response := batchResponse{Status: "dry_run", Results: make([]BatchResult, len(steps))}
+		if !valid {
+			response.Status = "invalid"
+		}
+		for i, step := range steps {
+			result := BatchResult{Index: i, Op: step.op.Op, Path: step.op.path(), Status: "planned", Change: step.change}
+			switch {
+			case step.err != nil:
+				result.Status = "invalid"
+				result.Error = step.err.Error()
+			case !valid:
+				result.Status = "skipped"
+			}
+			response.Results[i] = result
+		}
+		return p.batchResult(response)
+	}
+
+	if preview := p.batchPreview(steps); preview != nil {
+		// The disk may change while waiting, so the batch is validated again
+		return p.awaitConfirmation(ctx, "apply_batch", "", preview, func() (*mcp.CallToolResult, error) {
+			steps, valid := p.planBatch(ops)
+			if !valid {
+				for _, step := range steps {
+					if step.err != nil {
+						return nil, step.err
+					}
+				}
+			}
+			return p.applyBatch(steps)
+		})
+	}
+
+	return p.applyBatch(steps)
+}
+
+// stagedPath records the state of a path before a batch changed it
+type stagedPath struct {
+	path    string
+	existed bool
+	backup  string      // Copy of the original file, empty if path was not a file
+	mode    fs.FileMode // Mode of the original file
+	created []string    // Missing ancestor directories, deepest first
+}
+
+// batchStaging keeps the originals of the paths changed by a batch so that the
+// batch can be rolled back. The originals are kept in a local temporary
+// directory, whatever backend stores the paths.
+type batchStaging struct {
+	fsys    Backend
+	dir     string
+	entries []stagedPath
+	staged  map[string]bool
+}
+
+// stage records the current state of each path not already staged
+func (b *batchStaging) stage(paths []string) error {
+	for _, path := range paths {
+		if b.staged[path] {
+			continue
+		}
+
+		entry := stagedPath{path: path}
+		info, err := b.fsys.Stat(path)
+		switch {
+		case err == nil:
+			entry.existed = true
+			if info.Mode().IsRegular() {
+				if entry.backup, err = b.backup(path); err != nil {
+					return errors.NewFileSystemError("apply_batch", path, err)
+				}
+				entry.mode = info.Mode().Perm()
+			}
+		case os.IsNotExist(err):
+			for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+				if _, err := b.fsys.Stat(dir); err == nil {
+					break
+				}
+				entry.created = append(entry.created, dir)
+			}
+		default:
+			return errors.NewFileSystemError("apply_batch", path, err)
+		}
+
+		b.entries = append(b.entries, entry)
+		b.staged[path] = true
+	}
+	return nil
+}
+
+// backup copies a file into the staging directory and returns the copy's path
+func (b *batchStaging) backup(path string) (string, error) {
+	if b.dir == "" {
+		dir, err := os.MkdirTemp("", "mcp-fs-batch-")
+		if err != nil {
+			return "", err
+		}
+		b.dir = dir
+	}
+
+	backup := filepath.Join(b.dir, fmt.Sprintf("%d", len(b.entries)))
+	return backup, copyContents(b.fsys, path, backup, 0600)
+}
+
+// rollback restores every staged path, most recent first, and returns the
+// errors of paths it could not restore
+func (b *batchStaging) rollback() []error {
+	var errs []error
+	for i := len(b.entries) - 1; i >= 0; i-- {
+		entry := b.entries[i]
+
+		var err error
+		switch {
+		case entry.backup != "":
+			err = copyContents(b.fsys, entry.backup, entry.path, entry.mode)
+		case !entry.existed:
+			if err = b.fsys.Remove(entry.path); os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			errs = append(errs, errors.NewFileSystemError("apply_batch", entry.path, err))
+			continue
+		}
+
+		for _, dir := range entry.created {
+			if err := b.fsys.Remove(dir); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, errors.NewFileSystemError("apply_batch", dir, err))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// cleanup removes the staging directory
+func (b *batchStaging) cleanup() {
+	if b.dir != "" {
+		_ = os.RemoveAll(b.dir)
+	}
+}
+
+// copyContents copies the file at src to dst, creating or truncating dst and
+// setting its mode
+func copyContents(fsys Backend, src, dst string, mode fs.FileMode) error {
+	source, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := fsys.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	destination, err := fsys.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destination, source); err != nil {
+		destination.Close()
+		return err
+	}
+	if err := destination.Close(); err != nil {
+		return err
+	}
+	return fsys.Chmod(dst, mode)
+}
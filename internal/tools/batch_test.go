@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBatchTree(t *testing.T) string {
+	tmpDir := t.TempDir()
+	writeTree(t, tmpDir, map[string]string{"keep.txt": "one\ntwo\n", "old.txt": "old", "move.txt": "move"})
+	require.NoError(t, os.Chmod(filepath.Join(tmpDir, "old.txt"), 0600))
+	return tmpDir
+}
+
+func callBatch(t *testing.T, provider *ServiceProvider, ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, batchResponse) {
+	result, err := callTool(provider.handleApplyBatch, ctx, args)
+	require.NoError(t, err)
+
+	var response batchResponse
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response))
+	return result, response
+}
+
+func batchStatuses(response batchResponse) []string {
+	statuses := make([]string, len(response.Results))
+	for i, result := range response.Results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
+
+func readString(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestParseBatchOperations(t *testing.T) {
+	ops, err := parseBatchOperations(`[{"op": "delete_file", "path": "/a"}]`)
+	require.NoError(t, err)
+	assert.Equal(t, []BatchOperation{{Op: "delete_file", Path: "/a"}}, ops)
+
+	ops, err = parseBatchOperations([]interface{}{map[string]interface{}{"op": "create_directory", "path": "/b"}})
+	require.NoError(t, err)
+	assert.Equal(t, "create_directory", ops[0].Op)
+
+	_, err = parseBatchOperations(`[]`)
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+	_, err = parseBatchOperations(`{`)
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+	_, err = parseBatchOperations(42)
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+}
+
+func TestApplyBatch(t *testing.T) {
+	tmpDir := newBatchTree(t)
+	provider := NewServiceProvider([]string{tmpDir})
+
+	ops, err := json.Marshal([]BatchOperation{
+		{Op: "create_directory", Path: filepath.Join(tmpDir, "pkg")},
+		{Op: "write_file", Path: filepath.Join(tmpDir, "pkg", "new.txt"), Content: "a\nb"},
+		{Op: "edit_file", Path: filepath.Join(tmpDir, "pkg", "new.txt"), Content: "B", StartLine: 2, EndLine: 2},
+		{Op: "edit_file", Path: filepath.Join(tmpDir, "keep.txt"), Content: "TWO", StartLine: 2, EndLine: 2},
+		{Op: "move_file", SourcePath: filepath.Join(tmpDir, "move.txt"), DestinationPath: filepath.Join(tmpDir, "pkg", "moved.txt")},
+		{Op: "copy_file", SourcePath: filepath.Join(tmpDir, "pkg", "moved.txt"), DestinationPath: filepath.Join(tmpDir, "copy.txt")},
+		{Op: "delete_file", Path: filepath.Join(tmpDir, "old.txt")},
+	})
+	require.NoError(t, err)
+
+	result, response := callBatch(t, provider, context.Background(), map[string]interface{}{"operations": string(ops)})
+	assert.False(t, result.IsError)
+	assert.Equal(t, "applied", response.Status)
+	assert.Equal(t, []string{"applied", "applied", "applied", "applied", "applied", "applied", "applied"}, batchStatuses(response))
+	assert.Equal(t, "pending", response.Results[2].Change.Action)
+
+	assert.Equal(t, "a\nB", readString(t, filepath.Join(tmpDir, "pkg", "new.txt")))
+	assert.Equal(t, "one\nTWO\n", readString(t, filepath.Join(tmpDir, "keep.txt")))
+	assert.Equal(t, "move", readString(t, filepath.Join(tmpDir, "pkg", "moved.txt")))
+	assert.Equal(t, "move", readString(t, filepath.Join(tmpDir, "copy.txt")))
+	assert.NoFileExists(t, filepath.Join(tmpDir, "move.txt"))
+	assert.NoFileExists(t, filepath.Join(tmpDir, "old.txt"))
+}
+
+func TestApplyBatch_Invalid(t *testing.T) {
+	tmpDir := newBatchTree(t)
+	provider := NewServiceProvider([]string{tmpDir})
+
+	tests := []struct {
+		name     string
+		ops      []BatchOperation
+		statuses []string
+	}{
+		{
+			name: "outside allowed directories",
+			ops: []BatchOperation{
+				{Op: "write_file", Path: filepath.Join(tmpDir, "new.txt"), Content: "x"},
+				{Op: "write_file", Path: filepath.Join(t.TempDir(), "x.txt"), Content: "x"},
+			},
+			statuses: []string{"skipped", "invalid"},
+		},
+		{
+			name: "missing file",
+			ops: []BatchOperation{
+				{Op: "write_file", Path: filepath.Join(tmpDir, "new.txt"), Content: "x"},
+				{Op: "delete_file", Path: filepath.Join(tmpDir, "missing.txt")},
+			},
+			statuses: []string{"skipped", "invalid"},
+		},
+		{
+			name: "removed by an earlier operation",
+			ops: []BatchOperation{
+				{Op: "write_file", Path: filepath.Join(tmpDir, "new.txt"), Content: "x"},
+				{Op: "move_file", SourcePath: filepath.Join(tmpDir, "old.txt"), DestinationPath: filepath.Join(tmpDir, "other.txt")},
+				{Op: "edit_file", Path: filepath.Join(tmpDir, "old.txt"), Content: "x", StartLine: 1, EndLine: 1},
+			},
+			statuses: []string{"skipped", "skipped", "invalid"},
+		},
+		{
+			name:     "unknown operation",
+			ops:      []BatchOperation{{Op: "chmod", Path: filepath.Join(tmpDir, "old.txt")}},
+			statuses: []string{"invalid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := json.Marshal(tt.ops)
+			require.NoError(t, err)
+
+			result, response := callBatch(t, provider, context.Background(), map[string]interface{}{"operations": string(ops)})
+			assert.True(t, result.IsError)
+			assert.Equal(t, "invalid", response.Status)
+			assert.Equal(t, tt.statuses, batchStatuses(response))
+			assert.NoFileExists(t, filepath.Join(tmpDir, "new.txt"))
+			assert.FileExists(t, filepath.Join(tmpDir, "old.txt"))
+		})
+	}
+}
+
+func TestApplyBatch_Rollback(t *testing.T) {
+	tmpDir := newBatchTree(t)
+	provider := NewServiceProvider([]string{tmpDir})
+
+	// The last edit depends on the write before it, so its line range is only
+	// checked when it is applied
+	ops, err := json.Marshal([]BatchOperation{
+		{Op: "write_file", Path: filepath.Join(tmpDir, "keep.txt"), Content: "replaced"},
+		{Op: "delete_file", Path: filepath.Join(tmpDir, "old.txt")},
+		{Op: "move_file", SourcePath: filepath.Join(tmpDir, "move.txt"), DestinationPath: filepath.Join(tmpDir, "a", "b", "moved.txt")},
+		{Op: "create_directory", Path: filepath.Join(tmpDir, "dir", "sub")},
+		{Op: "write_file", Path: filepath.Join(tmpDir, "new.txt"), Content: "new"},
+		{Op: "edit_file", Path: filepath.Join(tmpDir, "new.txt"), Content: "x", StartLine: 5, EndLine: 5},
+	})
+	require.NoError(t, err)
+
+	result, response := callBatch(t, provider, context.Background(), map[string]interface{}{"operations": string(ops)})
+	assert.True(t, result.IsError)
+	assert.Equal(t, "rolled_back", response.Status)
+	assert.Equal(t, []string{"rolled_back", "rolled_back", "rolled_back", "rolled_back", "rolled_back", "failed"}, batchStatuses(response))
+	assert.Contains(t, response.Results[5].Error, "invalid argument")
+	assert.Empty(t, response.RollbackErrors)
+
+	assert.Equal(t, "one\ntwo\n", readString(t, filepath.Join(tmpDir, "keep.txt")))
+	assert.Equal(t, "old", readString(t, filepath.Join(tmpDir, "old.txt")))
+	assert.Equal(t, "move", readString(t, filepath.Join(tmpDir, "move.txt")))
+	info, err := os.Stat(filepath.Join(tmpDir, "old.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"keep.txt", "old.txt", "move.txt"}, names)
+}
+
+func TestApplyBatch_DryRun(t *testing.T) {
+	tmpDir := newBatchTree(t)
+	provider := NewServiceProvider([]string{tmpDir})
+
+	ops, err := json.Marshal([]BatchOperation{
+		{Op: "write_file", Path: filepath.Join(tmpDir, "keep.txt"), Content: "one\nthree\n"},
+		{Op: "delete_file", Path: filepath.Join(tmpDir, "old.txt")},
+	})
+	require.NoError(t, err)
+
+	result, response := callBatch(t, provider, context.Background(), map[string]interface{}{"operations": string(ops), "dry_run": true})
+	assert.False(t, result.IsError)
+	assert.Equal(t, "dry_run", response.Status)
+	assert.Equal(t, []string{"planned", "planned"}, batchStatuses(response))
+	assert.Contains(t, response.Results[0].Change.Diff, "-two\n+three\n")
+	assert.Equal(t, "one\ntwo\n", readString(t, filepath.Join(tmpDir, "keep.txt")))
+	assert.FileExists(t, filepath.Join(tmpDir, "old.txt"))
+}
+
+func TestApplyBatch_Confirmation(t *testing.T) {
+	tmpDir := newBatchTree(t)
+	provider := NewServiceProvider([]string{tmpDir}, WithConfirmationPolicy(ConfirmationPolicy{
+		Rules: []ConfirmationRule{{Tool: "delete_file"}},
+	}))
+	ctx := session.NewContext(context.Background(), session.Info{ID: "one"})
+
+	ops, err := json.Marshal([]BatchOperation{
+		{Op: "write_file", Path: filepath.Join(tmpDir, "new.txt"), Content: "new"},
+		{Op: "delete_file", Path: filepath.Join(tmpDir, "old.txt")},
+	})
+	require.NoError(t, err)
+
+	result, err := callTool(provider.handleApplyBatch, ctx, map[string]interface{}{"operations": string(ops)})
+	require.NoError(t, err)
+	pending := decodePending(t, result)
+	assert.Equal(t, "apply_batch", pending.Preview.Tool)
+	assert.Equal(t, 2, pending.Preview.FileCount)
+	assert.FileExists(t, filepath.Join(tmpDir, "old.txt"))
+	assert.NoFileExists(t, filepath.Join(tmpDir, "new.txt"))
+
+	result, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.NoFileExists(t, filepath.Join(tmpDir, "old.txt"))
+	assert.FileExists(t, filepath.Join(tmpDir, "new.txt"))
+}
+
+func TestApplyBatch_ConfirmTransfers(t *testing.T) {
+	tmpDir := newBatchTree(t)
+	provider := NewServiceProvider([]string{tmpDir}, WithConfirmationPolicy(ConfirmationPolicy{
+		Rules: []ConfirmationRule{{Tool: "move_file"}},
+	}))
+	ctx := context.Background()
+
+	// Moves to a new file need no confirmation
+	ops, err := json.Marshal([]BatchOperation{
+		{Op: "move_file", SourcePath: filepath.Join(tmpDir, "move.txt"), DestinationPath: filepath.Join(tmpDir, "moved.txt")},
+	})
+	require.NoError(t, err)
+	_, response := callBatch(t, provider, ctx, map[string]interface{}{"operations": string(ops)})
+	assert.Equal(t, "applied", response.Status)
+
+	// Moves replacing a file do
+	ops, err = json.Marshal([]BatchOperation{
+		{Op: "move_file", SourcePath: filepath.Join(tmpDir, "moved.txt"), DestinationPath: filepath.Join(tmpDir, "old.txt")},
+	})
+	require.NoError(t, err)
+	result, err := callTool(provider.handleApplyBatch, ctx, map[string]interface{}{"operations": string(ops)})
+	require.NoError(t, err)
+	pending := decodePending(t, result)
+	assert.Equal(t, int64(3), pending.Preview.TotalBytes)
+	content, err := os.ReadFile(filepath.Join(tmpDir, "old.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(content))
+}
@@ -0,0 +1,336 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// maxCompareSize is the largest file whose lines are compared; larger files
+// in compared directories are only compared byte by byte
+const maxCompareSize = 16 * 1024 * 1024
+
+// compareChunkSize is how much of each file is compared at a time
+const compareChunkSize = 64 * 1024
+
+// DiffOptions controls how files and directories are compared
+type DiffOptions struct {
+	Context          int  // Lines of context around each change
+	IgnoreWhitespace bool // Treat lines differing only in whitespace as equal
+	IncludeDiffs     bool // When comparing directories, include the diff of each changed file
+}
+
+// FileDiff describes a file that differs between two directories
+type FileDiff struct {
+	Path   string `json:"path"` // Relative to the compared directories
+	Diff   string `json:"diff,omitempty"`
+	Binary bool   `json:"binary,omitempty"` // The files differ but are not text
+}
+
+// DiffResult is the outcome of comparing two files or two directories
+type DiffResult struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Type      string `json:"type"` // "file" or "directory"
+	Identical bool   `json:"identical"`
+	// Set when comparing files
+	Diff   string `json:"diff,omitempty"`
+	Binary bool   `json:"binary,omitempty"`
+	// Set when comparing directories, with paths relative to them
+	Added     []string   `json:"added,omitempty"`
+	Removed   []string   `json:"removed,omitempty"`
+	Changed   []FileDiff `json:"changed,omitempty"`
+	Unchanged int        `json:"unchanged,omitempty"`
+}
+
+// Diff compares two files, producing a unified diff, or two directories,
+// listing the files added, removed and changed below them. Both paths must be
+// readable; files inside archives can be compared too. Files and directories
+// the path policy hides are left out of directory comparisons.
+func (s *FileService) Diff(fromPath, toPath string, opts DiffOptions) (*DiffResult, error) {
+	fromDir, err := s.isDirectory(fromPath)
+	if err != nil {
+		return nil, errors.NewFileSystemError("diff", fromPath, err)
+	}
+	toDir, err := s.isDirectory(toPath)
+	if err != nil {
+		return nil, errors.NewFileSystemError("diff", toPath, err)
+	}
+	if fromDir != toDir {
+		return nil, errors.NewFileSystemError("diff", toPath, errors.ErrInvalidOperation)
+	}
+
+	if fromDir {
+		return s.diffDirectories(fromPath, toPath, opts)
+	}
+
+	from, err := s.readContent(fromPath)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.readContent(toPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(from) > maxCompareSize || len(to) > maxCompareSize {
+		return nil, errors.NewFileSystemError("diff", fromPath, fmt.Errorf("%w: files larger than %d bytes cannot be diffed", errors.ErrInvalidArgument, maxCompareSize))
+	}
+
+	result := &DiffResult{From: fromPath, To: toPath, Type: "file"}
+	result.Diff, result.Binary = diffContent(fromPath, toPath, from, to, opts)
+	result.Identical = result.Diff == "" && !result.Binary
+	return result, nil
+}
+
+// isDirectory validates a path to compare and reports whether it is a directory
+func (s *FileService) isDirectory(path string) (bool, error) {
+	if isVirtualPath(path) {
+		return false, nil
+	}
+
+	validPath, err := s.validator.ValidatePath(path)
+	if err != nil {
+		return false, err
+	}
+	info, err := s.fsys.Stat(validPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, errors.ErrFileNotFound
+		}
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+// diffContent returns the unified diff between two file contents, or reports
+// that they differ but are binary
+func diffContent(fromName, toName string, from, to []byte, opts DiffOptions) (string, bool) {
+	if bytes.Equal(from, to) {
+		return "", false
+	}
+	if isBinary(from[:min(len(from), sniffSize)]) || isBinary(to[:min(len(to), sniffSize)]) {
+		return "", true
+	}
+
+	fromText, _ := decodeText(from)
+	toText, _ := decodeText(to)
+	if !opts.IgnoreWhitespace {
+		return unifiedDiff(fromName, toName, fromText, toText, opts.Context), false
+	}
+	ops := diffLinesIgnoringSpace(splitLines(fromText), splitLines(toText))
+	return formatUnified(fromName, toName, ops, opts.Context), false
+}
+
+// diffDirectories compares the files below two directories
+func (s *FileService) diffDirectories(fromPath, toPath string, opts DiffOptions) (*DiffResult, error) {
+	validFrom, _ := s.validator.ValidatePath(fromPath)
+	validTo, _ := s.validator.ValidatePath(toPath)
+
+	fromFiles, err := s.listFiles(validFrom)
+	if err != nil {
+		return nil, errors.NewFileSystemError("diff", fromPath, err)
+	}
+	toFiles, err := s.listFiles(validTo)
+	if err != nil {
+		return nil, errors.NewFileSystemError("diff", toPath, err)
+	}
+
+	result := &DiffResult{From: fromPath, To: toPath, Type: "directory"}
+	for rel := range fromFiles {
+		if _, ok := toFiles[rel]; !ok {
+			result.Removed = append(result.Removed, rel)
+		}
+	}
+	for rel := range toFiles {
+		if _, ok := fromFiles[rel]; !ok {
+			result.Added = append(result.Added, rel)
+		}
+	}
+
+	for rel, fromInfo := range fromFiles {
+		toInfo, ok := toFiles[rel]
+		if !ok {
+			continue
+		}
+		change, err := compareEntries(s.fsys, validFrom, validTo, rel, fromInfo, toInfo, opts)
+		if err != nil {
+			return nil, errors.NewFileSystemError("diff", filepath.Join(fromPath, rel), err)
+		}
+		if change == nil {
+			result.Unchanged++
+			continue
+		}
+		if opts.IncludeDiffs && !change.Binary && fromInfo.Mode().IsRegular() && toInfo.Mode().IsRegular() {
+			from, to := filepath.Join(validFrom, filepath.FromSlash(rel)), filepath.Join(validTo, filepath.FromSlash(rel))
+			change.Diff, change.Binary, err = diffFiles(s.fsys, filepath.Join(fromPath, filepath.FromSlash(rel)), filepath.Join(toPath, filepath.FromSlash(rel)), from, to, opts)
+			if err != nil {
+				return nil, errors.NewFileSystemError("diff", filepath.Join(fromPath, rel), err)
+			}
+		}
+		result.Changed = append(result.Changed, *change)
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Slice(result.Changed, func(i, j int) bool { return result.Changed[i].Path < result.Changed[j].Path })
+	result.Identical = len(result.Added) == 0 && len(result.Removed) == 0 && len(result.Changed) == 0
+	return result, nil
+}
+
+// listFiles returns the files and symbolic links below a directory that the
+// path policy allows reading, by slash-separated relative path
+func (s *FileService) listFiles(root string) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := walkDir(s.fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && !s.validator.Permits(path, ReadAccess) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || (!d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	return files, err
+}
+
+// compareEntries compares a file present in both directories and returns how
+// it changed, or nil if it did not
+func compareEntries(fsys Backend, fromRoot, toRoot, rel string, fromInfo, toInfo fs.FileInfo, opts DiffOptions) (*FileDiff, error) {
+	fromPath := filepath.Join(fromRoot, filepath.FromSlash(rel))
+	toPath := filepath.Join(toRoot, filepath.FromSlash(rel))
+	change := &FileDiff{Path: rel}
+
+	fromLink := fromInfo.Mode()&fs.ModeSymlink != 0
+	toLink := toInfo.Mode()&fs.ModeSymlink != 0
+	if fromLink || toLink {
+		if fromLink != toLink {
+			return change, nil
+		}
+		fromTarget, err := fsys.Readlink(fromPath)
+		if err != nil {
+			return nil, err
+		}
+		toTarget, err := fsys.Readlink(toPath)
+		if err != nil {
+			return nil, err
+		}
+		if fromTarget == toTarget {
+			return nil, nil
+		}
+		return change, nil
+	}
+
+	if !opts.IgnoreWhitespace && fromInfo.Size() != toInfo.Size() {
+		return change, nil
+	}
+	same, err := sameContent(fsys, fromPath, toPath)
+	if err != nil {
+		return nil, err
+	}
+	if same {
+		return nil, nil
+	}
+	if !opts.IgnoreWhitespace {
+		return change, nil
+	}
+
+	// Files differing only in whitespace are unchanged
+	diff, binary, err := diffFiles(fsys, fromPath, toPath, fromPath, toPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if diff == "" && !binary {
+		return nil, nil
+	}
+	change.Binary = binary
+	return change, nil
+}
+
+// diffFiles diffs two files on disk, reported as fromName and toName. Files
+// larger than maxCompareSize are not diffed.
+func diffFiles(fsys Backend, fromName, toName, fromPath, toPath string, opts DiffOptions) (string, bool, error) {
+	fromInfo, err := fsys.Stat(fromPath)
+	if err != nil {
+		return "", false, err
+	}
+	toInfo, err := fsys.Stat(toPath)
+	if err != nil {
+		return "", false, err
+	}
+	if fromInfo.Size() > maxCompareSize || toInfo.Size() > maxCompareSize {
+		return "", false, nil
+	}
+
+	from, err := readFile(fsys, fromPath)
+	if err != nil {
+		return "", false, err
+	}
+	to, err := readFile(fsys, toPath)
+	if err != nil {
+		return "", false, err
+	}
+	diff, binary := diffContent(fromName, toName, from, to, opts)
+	return diff, binary, nil
+}
+
+// sameContent reports whether two files have the same bytes
+func sameContent(fsys Backend, a, b string) (bool, error) {
+	fa, err := fsys.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := fsys.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	return sameBytes(fa, fb)
+}
+
+// sameBytes reports whether two readers yield the same bytes
+func sameBytes(fa, fb io.Reader) (bool, error) {
+	bufA := make([]byte, compareChunkSize)
+	bufB := make([]byte, compareChunkSize)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !doneA {
+			return false, errA
+		}
+		if errB != nil && !doneB {
+			return false, errB
+		}
+		if doneA || doneB {
+			return doneA == doneB, nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileService_DiffFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.txt":    "one\ntwo\nthree\n",
+		"b.txt":    "one\n  two\t\nfour\n",
+		"c.txt":    "one\ntwo\nthree\n",
+		"img.bin":  "\x00\x01\x02",
+		"img2.bin": "\x00\x01\x03",
+	})
+	service := NewFileService([]string{root})
+	a, b := filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt")
+
+	result, err := service.Diff(a, b, DiffOptions{Context: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "file", result.Type)
+	assert.False(t, result.Identical)
+	assert.Equal(t, "--- "+a+"\n+++ "+b+"\n@@ -1,3 +1,3 @@\n one\n-two\n-three\n+  two\t\n+four\n", result.Diff)
+
+	result, err = service.Diff(a, b, DiffOptions{Context: 0, IgnoreWhitespace: true})
+	require.NoError(t, err)
+	assert.Equal(t, "--- "+a+"\n+++ "+b+"\n@@ -3 +3 @@\n-three\n+four\n", result.Diff)
+
+	result, err = service.Diff(a, filepath.Join(root, "c.txt"), DiffOptions{Context: 3})
+	require.NoError(t, err)
+	assert.True(t, result.Identical)
+	assert.Empty(t, result.Diff)
+
+	result, err = service.Diff(filepath.Join(root, "img.bin"), filepath.Join(root, "img2.bin"), DiffOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Binary)
+	assert.False(t, result.Identical)
+
+	t.Run("inside archives", func(t *testing.T) {
+		archives := newArchiveTree(t)
+		service := NewFileService([]string{archives})
+		result, err := service.Diff(filepath.Join(archives, "lib.tar.gz")+"!/lib/a.txt", filepath.Join(archives, "app.zip")+"!/README", DiffOptions{Context: 3})
+		require.NoError(t, err)
+		assert.Contains(t, result.Diff, "-alpha\n+read me\n")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := service.Diff(a, root, DiffOptions{})
+		assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+
+		_, err = service.Diff(a, filepath.Join(root, "missing.txt"), DiffOptions{})
+		assert.ErrorIs(t, err, errors.ErrFileNotFound)
+
+		_, err = service.Diff(a, filepath.Join(t.TempDir(), "outside.txt"), DiffOptions{})
+		assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+	})
+}
+
+func TestFileService_DiffDirectories(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"v1/same.txt":       "same\n",
+		"v1/spaces.txt":     "a b\n",
+		"v1/changed.txt":    "old\n",
+		"v1/removed.txt":    "gone\n",
+		"v1/sub/deep.txt":   "deep\n",
+		"v2/same.txt":       "same\n",
+		"v2/spaces.txt":     "a  b\n",
+		"v2/changed.txt":    "new\n",
+		"v2/added/file.txt": "hello\n",
+		"v2/sub/deep.txt":   "deeper\n",
+	})
+	service := NewFileService([]string{root})
+	v1, v2 := filepath.Join(root, "v1"), filepath.Join(root, "v2")
+
+	result, err := service.Diff(v1, v2, DiffOptions{Context: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "directory", result.Type)
+	assert.False(t, result.Identical)
+	assert.Equal(t, []string{"added/file.txt"}, result.Added)
+	assert.Equal(t, []string{"removed.txt"}, result.Removed)
+	require.Len(t, result.Changed, 3)
+	assert.Equal(t, "changed.txt", result.Changed[0].Path)
+	assert.Empty(t, result.Changed[0].Diff, "diffs are only included on request")
+	assert.Equal(t, "spaces.txt", result.Changed[1].Path)
+	assert.Equal(t, "sub/deep.txt", result.Changed[2].Path)
+	assert.Equal(t, 1, result.Unchanged)
+
+	result, err = service.Diff(v1, v2, DiffOptions{Context: 3, IgnoreWhitespace: true, IncludeDiffs: true})
+	require.NoError(t, err)
+	require.Len(t, result.Changed, 2)
+	assert.Equal(t, 2, result.Unchanged)
+	from, to := filepath.Join(v1, "changed.txt"), filepath.Join(v2, "changed.txt")
+	assert.Equal(t, "--- "+from+"\n+++ "+to+"\n@@ -1 +1 @@\n-old\n+new\n", result.Changed[0].Diff)
+
+	result, err = service.Diff(v1, v1, DiffOptions{})
+	require.NoError(t, err)
+	assert.True(t, result.Identical)
+	assert.Equal(t, 5, result.Unchanged)
+}
+
+func TestServiceProvider_HandleDiff(t *testing.T) {
+	root, provider := newPolicyProvider(t, []PolicyRule{{Pattern: "**/secrets/**", Read: true}})
+	writeTree(t, root, map[string]string{
+		"copy/main.go":         "package main // token",
+		"copy/secrets/key.txt": "other",
+	})
+
+	result, err := callTool(provider.handleDiff, context.Background(), map[string]interface{}{
+		"from_path": filepath.Join(root, "main.go"),
+		"to_path":   filepath.Join(root, "copy", "main.go"),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "are identical")
+
+	// Directories the policy hides are not compared
+	result, err = callTool(provider.handleDiff, context.Background(), map[string]interface{}{
+		"from_path": root,
+		"to_path":   filepath.Join(root, "copy"),
+	})
+	require.NoError(t, err)
+	var diff DiffResult
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &diff))
+	assert.NotContains(t, diff.Removed, "secrets/key.txt")
+	assert.NotContains(t, diff.Added, "copy/secrets/key.txt")
+	assert.Contains(t, diff.Removed, ".env")
+
+	_, err = callTool(provider.handleDiff, context.Background(), map[string]interface{}{
+		"from_path": filepath.Join(root, "main.go"),
+		"to_path":   filepath.Join(root, "secrets", "key.txt"),
+	})
+	assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+	_, err = callTool(provider.handleDiff, context.Background(), map[string]interface{}{
+		"from_path": filepath.Join(root, "main.go"),
+		"to_path":   filepath.Join(root, ".env"),
+		"context":   float64(-1),
+	})
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+}
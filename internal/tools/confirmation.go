@@ -0,0 +1,426 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+)
+
+// DefaultConfirmationTimeout is how long a pending operation waits for confirmation
+const DefaultConfirmationTimeout = 5 * time.Minute
+
+// maxPreviewFiles caps the number of paths listed in an operation preview
+const maxPreviewFiles = 20
+
+// confirmableTools are the tools that can be made to require confirmation
+var confirmableTools = []string{"delete_file", "delete_directory", "write_file", "move_file", "copy_file", "overlay_commit", "overlay_discard"}
+
+// ConfirmationRule requires confirmation for a tool, optionally only under one
+// allowed directory
+type ConfirmationRule struct {
+	Tool string
+	Root string // Allowed directory the rule applies to, empty for all of them
+}
+
+// ConfirmationPolicy decides which destructive operations need to be confirmed
+// before they run. Recursive directory deletes, file deletes, and writes, moves
+// and copies that overwrite an existing file can require confirmation.
+type ConfirmationPolicy struct {
+	Rules   []ConfirmationRule
+	Timeout time.Duration
+}
+
+// Enabled reports whether any operation requires confirmation
+func (c ConfirmationPolicy) Enabled() bool {
+	return len(c.Rules) > 0
+}
+
+// Validate checks that every rule names a tool that supports confirmation
+func (c ConfirmationPolicy) Validate() error {
+	for _, rule := range c.Rules {
+		if !slices.Contains(confirmableTools, rule.Tool) {
+			return fmt.Errorf("tool %s does not support confirmation (supported: %s)", rule.Tool, strings.Join(confirmableTools, ", "))
+		}
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid confirmation timeout: %s", c.Timeout)
+	}
+	return nil
+}
+
+// Requires reports whether calls to tool on paths under root need confirmation
+func (c ConfirmationPolicy) Requires(tool, root string) bool {
+	for _, rule := range c.Rules {
+		if rule.Tool == tool && (rule.Root == "" || filepath.Clean(rule.Root) == root) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeout returns the confirmation timeout, applying the default
+func (c ConfirmationPolicy) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultConfirmationTimeout
+}
+
+// OperationPreview describes what a destructive operation would change
+type OperationPreview struct {
+	Tool        string   `json:"tool"`
+	Description string   `json:"description"`
+	Files       []string `json:"files"`
+	FileCount   int      `json:"file_count"`
+	TotalBytes  int64    `json:"total_bytes"`
+}
+
+// pendingOperation is an operation waiting for confirmation
+type pendingOperation struct {
+	id      string
+	owner   string
+	preview OperationPreview
+	expires time.Time
+	execute func() (*mcp.CallToolResult, error)
+}
+
+// pendingConfirmation is the response to a call that needs confirmation
+type pendingConfirmation struct {
+	Status      string           `json:"status"`
+	OperationID string           `json:"operation_id"`
+	Preview     OperationPreview `json:"preview"`
+	ExpiresAt   time.Time        `json:"expires_at"`
+	Message     string           `json:"message"`
+}
+
+// confirmations holds the operations waiting for confirmation
+type confirmations struct {
+	policy  ConfirmationPolicy
+	now     func() time.Time
+	mu      sync.Mutex
+	pending map[string]*pendingOperation
+}
+
+// newConfirmations creates an empty set of pending operations
+func newConfirmations(policy ConfirmationPolicy) *confirmations {
+	return &confirmations{
+		policy:  policy,
+		now:     time.Now,
+		pending: make(map[string]*pendingOperation),
+	}
+}
+
+// add stores an operation until it is confirmed or expires
+func (c *confirmations) add(owner string, preview OperationPreview, execute func() (*mcp.CallToolResult, error)) *pendingOperation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune()
+	op := &pendingOperation{
+		id:      uuid.New().String(),
+		owner:   owner,
+		preview: preview,
+		expires: c.now().Add(c.policy.timeout()),
+		execute: execute,
+	}
+	c.pending[op.id] = op
+	return op
+}
+
+// take removes and returns the operation with the given id if it belongs to owner
+func (c *confirmations) take(id, owner string) (*pendingOperation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	op, ok := c.pending[id]
+	if !ok || op.owner != owner {
+		return nil, errors.NewFileSystemError("confirm_operation", id, errors.ErrInvalidArgument)
+	}
+	delete(c.pending, id)
+
+	if !c.now().Before(op.expires) {
+		return nil, errors.NewFileSystemError("confirm_operation", id, fmt.Errorf("operation expired: %w", errors.ErrInvalidOperation))
+	}
+	return op, nil
+}
+
+// prune drops expired operations; the caller must hold the lock
+func (c *confirmations) prune() {
+	now := c.now()
+	for id, op := range c.pending {
+		if !now.Before(op.expires) {
+			delete(c.pending, id)
+		}
+	}
+}
+
+// WithConfirmationPolicy makes destructive operations wait for confirmation
+func WithConfirmationPolicy(policy ConfirmationPolicy) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.confirmations = newConfirmations(policy)
+	}
+}
+
+// confirm runs execute straight away unless the confirmation policy covers the
+// call. Otherwise it asks the client to confirm through elicitation if the
+// client supports it, or returns a pending operation for confirm_operation.
+// preview returns nil when the call is not destructive (e.g. a write creating a
+// new file, or a delete of a missing file that execute reports). If the preview
+// fails, the operation is refused rather than run unconfirmed.
+func (p *ServiceProvider) confirm(ctx context.Context, tool, path string, preview func(validPath string) (*OperationPreview, error), execute func() (*mcp.CallToolResult, error)) (*mcp.CallToolResult, error) {
+	validPath, ok := p.requiresConfirmation(tool, path)
+	if !ok {
+		return execute()
+	}
+
+	op, err := preview(validPath)
+	if err != nil {
+		return nil, errors.NewFileSystemError(tool, path, err)
+	}
+	if op == nil {
+		return execute()
+	}
+	op.Tool = tool
+
+	return p.awaitConfirmation(ctx, tool, path, op, execute)
+}
+
+// requiresConfirmation reports whether the confirmation policy covers a call of
+// tool on path, and returns the validated path
+func (p *ServiceProvider) requiresConfirmation(tool, path string) (string, bool) {
+	if p.confirmations == nil || !p.confirmations.policy.Enabled() {
+		return "", false
+	}
+
+	validPath, err := p.validator.ValidateWritePath(path)
+	if err != nil {
+		return "", false
+	}
+	root, _ := p.validator.rootFor(validPath)
+	return validPath, p.confirmations.policy.Requires(tool, root)
+}
+
+// awaitConfirmation asks the client to confirm an operation through elicitation
+// if the client supports it, or stores it as a pending operation for
+// confirm_operation
+func (p *ServiceProvider) awaitConfirmation(ctx context.Context, tool, path string, op *OperationPreview, execute func() (*mcp.CallToolResult, error)) (*mcp.CallToolResult, error) {
+	info, _ := session.FromContext(ctx)
+	if info.Peer != nil && info.Peer.Supports("elicitation") {
+		approved, err := p.elicitConfirmation(ctx, info.Peer, op)
+		if err == nil {
+			if !approved {
+				return mcp.NewToolResultError(fmt.Sprintf("Operation declined: %s", op.Description)), nil
+			}
+			return execute()
+		}
+		p.logger.Warn("Elicitation failed, falling back to confirm_operation: %v", err)
+	}
+
+	pending := p.confirmations.add(info.Key(), *op, execute)
+	response, err := json.Marshal(pendingConfirmation{
+		Status:      "pending_confirmation",
+		OperationID: pending.id,
+		Preview:     pending.preview,
+		ExpiresAt:   pending.expires,
+		Message:     "This operation requires confirmation. Call confirm_operation with the operation_id to proceed.",
+	})
+	if err != nil {
+		return nil, errors.NewFileSystemError(tool, path, err)
+	}
+	return mcp.NewToolResultText(string(response)), nil
+}
+
+// elicitConfirmation asks the user through the client whether to run an operation
+func (p *ServiceProvider) elicitConfirmation(ctx context.Context, peer session.Peer, op *OperationPreview) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.confirmations.policy.timeout())
+	defer cancel()
+
+	message := fmt.Sprintf("%s (%d file(s), %d bytes). Proceed?", op.Description, op.FileCount, op.TotalBytes)
+	raw, err := peer.Request(ctx, "elicitation/create", map[string]any{
+		"message": message,
+		"requestedSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"confirm": map[string]any{
+					"type":        "boolean",
+					"title":       "Confirm",
+					"description": message,
+				},
+			},
+			"required": []string{"confirm"},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var result struct {
+		Action  string `json:"action"`
+		Content struct {
+			Confirm bool `json:"confirm"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return false, err
+	}
+	return result.Action == "accept" && result.Content.Confirm, nil
+}
+
+func (p *ServiceProvider) handleConfirmOperation(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, ok := request.Params.Arguments["operation_id"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("confirm_operation", "", errors.ErrInvalidArgument)
+	}
+
+	approve := true
+	if approveArg, ok := request.Params.Arguments["approve"].(bool); ok {
+		approve = approveArg
+	}
+
+	op, err := p.confirmations.take(id, session.KeyFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if !approve {
+		return mcp.NewToolResultText(fmt.Sprintf("Operation cancelled: %s", op.preview.Description)), nil
+	}
+	return op.execute()
+}
+
+// previewDeleteFile describes the deletion of a file
+func (p *ServiceProvider) previewDeleteFile(validPath string) (*OperationPreview, error) {
+	info, err := p.fsys.Stat(validPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil || info.IsDir() {
+		return nil, err
+	}
+
+	return &OperationPreview{
+		Description: fmt.Sprintf("Delete file %s", validPath),
+		Files:       []string{validPath},
+		FileCount:   1,
+		TotalBytes:  info.Size(),
+	}, nil
+}
+
+// previewDeleteDirectory describes the recursive deletion of a directory
+func (p *ServiceProvider) previewDeleteDirectory(validPath string) (*OperationPreview, error) {
+	if _, err := p.fsys.Lstat(validPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	preview := &OperationPreview{
+		Description: fmt.Sprintf("Recursively delete directory %s", validPath),
+		Files:       []string{},
+	}
+
+	err := walkDir(p.fsys, validPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		preview.FileCount++
+		if len(preview.Files) < maxPreviewFiles {
+			preview.Files = append(preview.Files, path)
+		}
+		if info, err := d.Info(); err == nil {
+			preview.TotalBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
+
+// previewOverwrite describes a write replacing an existing file, or returns nil
+// if the write creates a new file
+func (p *ServiceProvider) previewOverwrite(newSize int) func(validPath string) (*OperationPreview, error) {
+	return func(validPath string) (*OperationPreview, error) {
+		info, err := p.fsys.Stat(validPath)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil || info.IsDir() {
+			return nil, err
+		}
+
+		return &OperationPreview{
+			Description: fmt.Sprintf("Overwrite %s (%d bytes) with %d bytes", validPath, info.Size(), newSize),
+			Files:       []string{validPath},
+			FileCount:   1,
+			TotalBytes:  info.Size(),
+		}, nil
+	}
+}
+
+// previewTransfer describes a move or copy of sourcePath replacing an existing
+// file, or returns nil if it creates a new file. A source that is invalid or
+// missing is left for the transfer to report.
+func (p *ServiceProvider) previewTransfer(sourcePath string) func(validPath string) (*OperationPreview, error) {
+	return func(validPath string) (*OperationPreview, error) {
+		validSource, err := p.validator.ValidatePath(sourcePath)
+		if err != nil {
+			return nil, nil
+		}
+		info, err := p.fsys.Stat(validSource)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return p.previewOverwrite(int(info.Size()))(validPath)
+	}
+}
+
+// previewOverlay describes committing or discarding, as verb says, the changes
+// of the overlay containing a path
+func (p *ServiceProvider) previewOverlay(verb string) func(validPath string) (*OperationPreview, error) {
+	return func(validPath string) (*OperationPreview, error) {
+		overlay, ok := overlayFor(p.fsys, validPath)
+		if !ok {
+			return nil, nil
+		}
+		changes, err := overlay.Changes()
+		if err != nil || len(changes) == 0 {
+			return nil, err
+		}
+
+		preview := &OperationPreview{
+			Description: fmt.Sprintf("%s %d overlay change(s) to %s", verb, len(changes), overlay.Root()),
+			Files:       []string{},
+			FileCount:   len(changes),
+		}
+		for _, change := range changes {
+			path := filepath.Join(overlay.Root(), filepath.FromSlash(change.Path))
+			if len(preview.Files) < maxPreviewFiles {
+				preview.Files = append(preview.Files, path)
+			}
+			if info, err := overlay.Lstat(path); err == nil && change.Type == "file" {
+				preview.TotalBytes += info.Size()
+			}
+		}
+		return preview, nil
+	}
+}
@@ -0,0 +1,306 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePeer answers server requests with a canned result
+type fakePeer struct {
+	capabilities map[string]bool
+	result       string
+	err          error
+	requests     []string
+}
+
+func (f *fakePeer) Supports(capability string) bool {
+	return f.capabilities[capability]
+}
+
+func (f *fakePeer) Request(_ context.Context, method string, _ any) (json.RawMessage, error) {
+	f.requests = append(f.requests, method)
+	return json.RawMessage(f.result), f.err
+}
+
+func newConfirmationProvider(t *testing.T, rules ...ConfirmationRule) (string, *ServiceProvider) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "dir", "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "dir", "a.txt"), []byte("12345"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "dir", "sub", "b.txt"), []byte("123"), 0644))
+
+	return tmpDir, NewServiceProvider([]string{tmpDir}, WithConfirmationPolicy(ConfirmationPolicy{Rules: rules}))
+}
+
+func callTool(handler ToolHandler, ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = args
+	return handler(ctx, request)
+}
+
+func decodePending(t *testing.T, result *mcp.CallToolResult) pendingConfirmation {
+	var pending pendingConfirmation
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &pending))
+	require.Equal(t, "pending_confirmation", pending.Status)
+	return pending
+}
+
+func TestConfirmationPolicy(t *testing.T) {
+	assert.False(t, ConfirmationPolicy{}.Enabled())
+	assert.NoError(t, ConfirmationPolicy{Rules: []ConfirmationRule{{Tool: "delete_file"}}}.Validate())
+	err := ConfirmationPolicy{Rules: []ConfirmationRule{{Tool: "read_file"}}}.Validate()
+	require.Error(t, err)
+	for _, tool := range confirmableTools {
+		assert.Contains(t, err.Error(), tool)
+	}
+	assert.Error(t, ConfirmationPolicy{Timeout: -time.Second}.Validate())
+
+	policy := ConfirmationPolicy{Rules: []ConfirmationRule{
+		{Tool: "delete_file"},
+		{Tool: "write_file", Root: "/repo/"},
+	}}
+	assert.True(t, policy.Requires("delete_file", "/anything"))
+	assert.True(t, policy.Requires("write_file", "/repo"))
+	assert.False(t, policy.Requires("write_file", "/other"))
+	assert.False(t, policy.Requires("delete_directory", "/repo"))
+	assert.Equal(t, DefaultConfirmationTimeout, policy.timeout())
+}
+
+func TestConfirmOperation_DeleteFile(t *testing.T) {
+	tmpDir, provider := newConfirmationProvider(t, ConfirmationRule{Tool: "delete_file"})
+	file := filepath.Join(tmpDir, "file.txt")
+	ctx := session.NewContext(context.Background(), session.Info{ID: "one"})
+
+	result, err := callTool(provider.handleDeleteFile, ctx, map[string]interface{}{"path": file})
+	require.NoError(t, err)
+	pending := decodePending(t, result)
+	assert.Equal(t, "delete_file", pending.Preview.Tool)
+	assert.Equal(t, []string{file}, pending.Preview.Files)
+	assert.Equal(t, int64(5), pending.Preview.TotalBytes)
+	assert.FileExists(t, file)
+
+	// Another session cannot confirm the operation
+	other := session.NewContext(context.Background(), session.Info{ID: "two"})
+	_, err = callTool(provider.handleConfirmOperation, other, map[string]interface{}{"operation_id": pending.OperationID})
+	assert.True(t, errors.IsInvalidArgument(err))
+	assert.FileExists(t, file)
+
+	// Confirming runs the operation exactly once
+	result, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "File deleted successfully")
+	assert.NoFileExists(t, file)
+
+	_, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID})
+	assert.True(t, errors.IsInvalidArgument(err))
+
+	_, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{})
+	assert.True(t, errors.IsInvalidArgument(err))
+}
+
+func TestConfirmOperation_CancelAndExpiry(t *testing.T) {
+	tmpDir, provider := newConfirmationProvider(t, ConfirmationRule{Tool: "delete_file"})
+	file := filepath.Join(tmpDir, "file.txt")
+	ctx := context.Background()
+
+	result, err := callTool(provider.handleDeleteFile, ctx, map[string]interface{}{"path": file})
+	require.NoError(t, err)
+	pending := decodePending(t, result)
+
+	result, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID, "approve": false})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "Operation cancelled")
+	assert.FileExists(t, file)
+
+	now := time.Now()
+	provider.confirmations.now = func() time.Time { return now }
+	result, err = callTool(provider.handleDeleteFile, ctx, map[string]interface{}{"path": file})
+	require.NoError(t, err)
+	pending = decodePending(t, result)
+
+	now = now.Add(DefaultConfirmationTimeout)
+	_, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID})
+	assert.True(t, errors.IsInvalidOperation(err))
+	assert.FileExists(t, file)
+}
+
+func TestConfirmOperation_DeleteDirectory(t *testing.T) {
+	tmpDir, provider := newConfirmationProvider(t, ConfirmationRule{Tool: "delete_directory"})
+	dir := filepath.Join(tmpDir, "dir")
+	ctx := context.Background()
+
+	// Non-recursive deletes of empty directories run straight away
+	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "empty"), 0755))
+	result, err := callTool(provider.handleDeleteDirectory, ctx, map[string]interface{}{"path": filepath.Join(tmpDir, "empty")})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "Directory deleted successfully")
+
+	result, err = callTool(provider.handleDeleteDirectory, ctx, map[string]interface{}{"path": dir, "recursive": true})
+	require.NoError(t, err)
+	pending := decodePending(t, result)
+	assert.Equal(t, 2, pending.Preview.FileCount)
+	assert.Equal(t, int64(8), pending.Preview.TotalBytes)
+	assert.DirExists(t, dir)
+
+	_, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID})
+	require.NoError(t, err)
+	assert.NoDirExists(t, dir)
+}
+
+func TestConfirmOperation_WriteFile(t *testing.T) {
+	tmpDir, provider := newConfirmationProvider(t, ConfirmationRule{Tool: "write_file", Root: "/somewhere/else"})
+	file := filepath.Join(tmpDir, "file.txt")
+	ctx := context.Background()
+
+	// Rules scoped to another directory do not apply
+	result, err := callTool(provider.handleWriteFile, ctx, map[string]interface{}{"path": file, "content": "one"})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "File written successfully")
+
+	tmpDir, provider = newConfirmationProvider(t, ConfirmationRule{Tool: "write_file"})
+	provider.confirmations.policy.Rules[0].Root = tmpDir
+	file = filepath.Join(tmpDir, "file.txt")
+
+	// New files and appends do not need confirmation
+	result, err = callTool(provider.handleWriteFile, ctx, map[string]interface{}{"path": filepath.Join(tmpDir, "new.txt"), "content": "new"})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "File written successfully")
+	result, err = callTool(provider.handleWriteFile, ctx, map[string]interface{}{"path": file, "content": "!", "append": true})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "File written successfully")
+
+	// Overwrites do
+	result, err = callTool(provider.handleWriteFile, ctx, map[string]interface{}{"path": file, "content": "replaced"})
+	require.NoError(t, err)
+	pending := decodePending(t, result)
+	assert.Equal(t, int64(6), pending.Preview.TotalBytes)
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "hello!", string(content))
+
+	_, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID})
+	require.NoError(t, err)
+	content, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "replaced", string(content))
+}
+
+func TestConfirmOperation_Transfers(t *testing.T) {
+	tmpDir, provider := newConfirmationProvider(t, ConfirmationRule{Tool: "move_file"}, ConfirmationRule{Tool: "copy_file"})
+	file := filepath.Join(tmpDir, "file.txt")
+	target := filepath.Join(tmpDir, "dir", "a.txt")
+	ctx := context.Background()
+
+	// Transfers to a new file run straight away
+	result, err := callTool(provider.handleCopyFile, ctx, map[string]interface{}{"source_path": file, "destination_path": filepath.Join(tmpDir, "copy.txt")})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "File copied successfully")
+
+	// Transfers replacing a file wait for confirmation
+	for _, handler := range []ToolHandler{provider.handleCopyFile, provider.handleMoveFile} {
+		result, err = callTool(handler, ctx, map[string]interface{}{"source_path": file, "destination_path": target})
+		require.NoError(t, err)
+		pending := decodePending(t, result)
+		assert.Equal(t, []string{target}, pending.Preview.Files)
+		assert.Equal(t, int64(5), pending.Preview.TotalBytes)
+		assert.Contains(t, pending.Preview.Description, "with 5 bytes")
+	}
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "12345", string(content))
+	assert.FileExists(t, file)
+}
+
+func TestConfirmOperation_PreviewFailure(t *testing.T) {
+	tmpDir, provider := newConfirmationProvider(t, ConfirmationRule{Tool: "delete_directory"})
+	executed := false
+
+	// An operation whose preview fails is refused, never run unconfirmed
+	_, err := provider.confirm(context.Background(), "delete_directory", filepath.Join(tmpDir, "dir"),
+		func(string) (*OperationPreview, error) { return nil, errors.ErrPermissionDenied },
+		func() (*mcp.CallToolResult, error) {
+			executed = true
+			return mcp.NewToolResultText("deleted"), nil
+		})
+	assert.True(t, errors.IsPermissionDenied(err))
+	assert.False(t, executed)
+	assert.DirExists(t, filepath.Join(tmpDir, "dir"))
+
+	// Missing targets are left for the operation to report
+	_, err = callTool(provider.handleDeleteDirectory, context.Background(), map[string]interface{}{"path": filepath.Join(tmpDir, "missing"), "recursive": true})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestConfirmOperation_Elicitation(t *testing.T) {
+	tests := []struct {
+		name        string
+		peer        *fakePeer
+		wantDeleted bool
+		wantError   bool
+		wantPending bool
+	}{
+		{
+			name:        "accepted",
+			peer:        &fakePeer{capabilities: map[string]bool{"elicitation": true}, result: `{"action":"accept","content":{"confirm":true}}`},
+			wantDeleted: true,
+		},
+		{
+			name:      "accepted without confirming",
+			peer:      &fakePeer{capabilities: map[string]bool{"elicitation": true}, result: `{"action":"accept","content":{"confirm":false}}`},
+			wantError: true,
+		},
+		{
+			name:      "declined",
+			peer:      &fakePeer{capabilities: map[string]bool{"elicitation": true}, result: `{"action":"decline"}`},
+			wantError: true,
+		},
+		{
+			name:        "request failed",
+			peer:        &fakePeer{capabilities: map[string]bool{"elicitation": true}, err: fmt.Errorf("boom")},
+			wantPending: true,
+		},
+		{
+			name:        "not supported",
+			peer:        &fakePeer{},
+			wantPending: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, provider := newConfirmationProvider(t, ConfirmationRule{Tool: "delete_file"})
+			file := filepath.Join(tmpDir, "file.txt")
+			ctx := session.NewContext(context.Background(), session.Info{ID: "one", Peer: tt.peer})
+
+			result, err := callTool(provider.handleDeleteFile, ctx, map[string]interface{}{"path": file})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantError, result.IsError)
+
+			if tt.wantPending {
+				decodePending(t, result)
+			}
+			if tt.wantDeleted {
+				assert.NoFileExists(t, file)
+			} else {
+				assert.FileExists(t, file)
+			}
+			if tt.peer.capabilities["elicitation"] {
+				assert.Equal(t, []string{"elicitation/create"}, tt.peer.requests)
+			} else {
+				assert.Empty(t, tt.peer.requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxEditDistance bounds the work spent finding a minimal diff. Inputs that
+// differ by more lines than this are reported as one replaced block.
+const maxEditDistance = 4096
+
+// diffKind marks a line as kept, removed or added
+type diffKind byte
+
+const (
+	diffEqual  diffKind = ' '
+	diffDelete diffKind = '-'
+	diffInsert diffKind = '+'
+)
+
+// diffOp is one line of a line-based diff
+type diffOp struct {
+	kind diffKind
+	text string
+}
+
+// splitLines splits text into lines, each keeping its line terminator
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a line diff turning a into b
+func diffLines(a, b []string) []diffOp {
+	// Common prefix and suffix need no search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{diffEqual, line})
+	}
+	return ops
+}
+
+// diffLinesIgnoringSpace computes a line diff turning a into b in which lines
+// differing only in whitespace are equal. Equal lines keep the text of a.
+func diffLinesIgnoringSpace(a, b []string) []diffOp {
+	keyed := diffLines(stripSpace(a), stripSpace(b))
+
+	ops := make([]diffOp, 0, len(keyed))
+	i, j := 0, 0
+	for _, op := range keyed {
+		switch op.kind {
+		case diffEqual:
+			ops = append(ops, diffOp{diffEqual, a[i]})
+			i++
+			j++
+		case diffDelete:
+			ops = append(ops, diffOp{diffDelete, a[i]})
+			i++
+		case diffInsert:
+			ops = append(ops, diffOp{diffInsert, b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// stripSpace returns lines with all whitespace, including line terminators, removed
+func stripSpace(lines []string) []string {
+	stripped := make([]string, len(lines))
+	for i, line := range lines {
+		stripped[i] = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	}
+	return stripped
+}
+
+// myersDiff finds a shortest edit script with Myers' O(ND) algorithm
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(a, b)
+	}
+
+	maxD := n + m
+	if maxD > maxEditDistance {
+		maxD = maxEditDistance
+	}
+
+	// trace[d] holds the furthest x reached on each diagonal k in [-d, d] after d edits
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				snapshot := make([]int, 2*d+1)
+				copy(snapshot, v[offset-d:offset+d+1])
+				trace = append(trace, snapshot)
+				return backtrack(a, b, trace)
+			}
+		}
+
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+	}
+
+	// Too different to be worth a minimal diff
+	return replaceAll(a, b)
+}
+
+// backtrack walks the Myers trace from the end to recover the edit script
+func backtrack(a, b []string, trace [][]int) []diffOp {
+	x, y := len(a), len(b)
+	var reversed []diffOp
+
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffOp{diffEqual, a[x]})
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, diffOp{diffInsert, b[y]})
+		} else {
+			x--
+			reversed = append(reversed, diffOp{diffDelete, a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, diffOp{diffEqual, a[x]})
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+// replaceAll reports every line of a as removed and every line of b as added
+func replaceAll(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, diffOp{diffDelete, line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{diffInsert, line})
+	}
+	return ops
+}
+
+// unifiedDiff formats the difference between two texts as a unified diff with
+// the given number of context lines. It returns "" if the texts are equal.
+func unifiedDiff(fromName, toName, from, to string, context int) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+	return formatUnified(fromName, toName, ops, context)
+}
+
+// formatUnified formats a line diff as a unified diff
+func formatUnified(fromName, toName string, ops []diffOp, context int) string {
+	if context < 0 {
+		context = 0
+	}
+
+	var b strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change
+		first := start
+		for first < len(ops) && ops[first].kind == diffEqual {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind == diffEqual {
+				continue
+			}
+			if i-last-1 > 2*context {
+				break
+			}
+			last = i
+		}
+
+		hunkStart := max(first-context, start)
+		hunkEnd := min(last+context+1, len(ops))
+
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&b, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+
+	return b.String()
+}
+
+// writeHunk writes ops[start:end] as one unified diff hunk
+func writeHunk(b *strings.Builder, ops []diffOp, start, end int) {
+	// Line numbers of the hunk start in each file
+	fromLine, toLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != diffInsert {
+			fromLine++
+		}
+		if op.kind != diffDelete {
+			toLine++
+		}
+	}
+
+	fromCount, toCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != diffInsert {
+			fromCount++
+		}
+		if op.kind != diffDelete {
+			toCount++
+		}
+	}
+
+	// An empty range is numbered after the line preceding it
+	if fromCount == 0 {
+		fromLine--
+	}
+	if toCount == 0 {
+		toLine--
+	}
+
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+	for _, op := range ops[start:end] {
+		b.WriteByte(byte(op.kind))
+		b.WriteString(op.text)
+		if !strings.HasSuffix(op.text, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a line range for a hunk header
+func hunkRange(line, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
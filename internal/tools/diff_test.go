@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLines(t *testing.T) {
+	assert.Nil(t, splitLines(""))
+	assert.Equal(t, []string{"a\n", "b\n"}, splitLines("a\nb\n"))
+	assert.Equal(t, []string{"a\r\n", "b"}, splitLines("a\r\nb"))
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      string
+		wantEdits int
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 0},
+		{"insert", "a\nc\n", "a\nb\nc\n", 1},
+		{"delete", "a\nb\nc\n", "a\nc\n", 1},
+		{"replace", "a\nb\nc\n", "a\nx\nc\n", 2},
+		{"from empty", "", "a\nb\n", 2},
+		{"to empty", "a\nb\n", "", 2},
+		{"interleaved", "a\nb\nc\nd\ne\n", "b\nc\nx\ne\nf\n", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := diffLines(splitLines(tt.a), splitLines(tt.b))
+
+			edits := 0
+			var from, to strings.Builder
+			for _, op := range ops {
+				if op.kind != diffEqual {
+					edits++
+				}
+				if op.kind != diffInsert {
+					from.WriteString(op.text)
+				}
+				if op.kind != diffDelete {
+					to.WriteString(op.text)
+				}
+			}
+
+			// Applying the script must reproduce both inputs
+			assert.Equal(t, tt.a, from.String())
+			assert.Equal(t, tt.b, to.String())
+			assert.Equal(t, tt.wantEdits, edits)
+		})
+	}
+}
+
+func TestDiffLines_TooDifferent(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxEditDistance; i++ {
+		a = append(a, "a\n")
+		b = append(b, "b\n")
+	}
+
+	ops := diffLines(a, b)
+	assert.Len(t, ops, 2*maxEditDistance)
+	assert.Equal(t, diffDelete, ops[0].kind)
+	assert.Equal(t, diffInsert, ops[len(ops)-1].kind)
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.Empty(t, unifiedDiff("a", "b", "same\n", "same\n", 3))
+
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	to := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n"
+
+	assert.Equal(t, `--- a.txt
++++ b.txt
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -9,4 +9,4 @@
+ 9
+ 10
+ 11
+-12
++twelve
+`, unifiedDiff("a.txt", "b.txt", from, to, 3))
+
+	// Changes within twice the context share a hunk
+	merged := unifiedDiff("a.txt", "b.txt", from, to, 4)
+	assert.Equal(t, 1, strings.Count(merged, "@@ -"))
+	assert.Contains(t, merged, "@@ -1,12 +1,12 @@\n")
+
+	// Empty ranges are numbered after the preceding line
+	assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1 @@\n+new\n", unifiedDiff("a", "b", "", "new\n", 3))
+	assert.Equal(t, "--- a\n+++ b\n@@ -1,2 +1 @@\n x\n-y\n", unifiedDiff("a", "b", "x\ny\n", "x\n", 3))
+
+	// Missing final newlines are marked
+	assert.Equal(t, "--- a\n+++ b\n@@ -1 +1 @@\n-x\n\\ No newline at end of file\n+x\n", unifiedDiff("a", "b", "x", "x\n", 3))
+}
+
+func TestDiffLinesIgnoringSpace(t *testing.T) {
+	ops := diffLinesIgnoringSpace(splitLines("if x {\n\treturn\n}\n"), splitLines("if x  {\n    return\nnext\n}\n"))
+	// Equal lines keep the text of the original
+	assert.Equal(t, []diffOp{
+		{diffEqual, "if x {\n"},
+		{diffEqual, "\treturn\n"},
+		{diffInsert, "next\n"},
+		{diffEqual, "}\n"},
+	}, ops)
+}
@@ -121,24 +121,35 @@ func handleDirectoryTree(request mcp.CallToolRequest, allowedDirectories []strin
 
 // buildDirectoryTree builds a directory tree
 func buildDirectoryTree(rootPath string, maxDepth int) ([]TreeEntry, error) {
+	return buildFilteredDirectoryTree(OSBackend{}, rootPath, maxDepth, nil)
+}
+
+// buildFilteredDirectoryTree builds a directory tree, leaving out the entries for
+// which include returns false. A nil include keeps every entry.
+func buildFilteredDirectoryTree(fsys Backend, rootPath string, maxDepth int, include func(path string) bool) ([]TreeEntry, error) {
 	if maxDepth <= 0 {
 		return []TreeEntry{}, nil
 	}
 
-	entries, err := os.ReadDir(rootPath)
+	entries, err := fsys.ReadDir(rootPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
 	result := make([]TreeEntry, 0, len(entries))
 	for _, entry := range entries {
+		entryPath := filepath.Join(rootPath, entry.Name())
+		if include != nil && !include(entryPath) {
+			continue
+		}
+
 		entryType := "file"
 		var children []TreeEntry
 
 		if entry.IsDir() {
 			entryType = "directory"
 			if maxDepth > 1 {
-				children, err = buildDirectoryTree(filepath.Join(rootPath, entry.Name()), maxDepth-1)
+				children, err = buildFilteredDirectoryTree(fsys, entryPath, maxDepth-1, include)
 				if err != nil {
 					// Log the error but continue with other entries
 					children = []TreeEntry{}
@@ -1,9 +1,13 @@
 package tools
 
 import (
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"time"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/moguyn/mcp-go-filesystem/internal/errors"
 	"github.com/moguyn/mcp-go-filesystem/internal/logging"
@@ -13,131 +17,414 @@ import (
 type DirectoryService struct {
 	allowedDirs []string
 	logger      *logging.Logger
-	validator   PathValidator
+	validator   *PathValidatorImpl
+	usage       *UsageTracker
+	fsys        Backend
 }
 
 // NewDirectoryService creates a new DirectoryService
 func NewDirectoryService(allowedDirs []string) *DirectoryService {
-	validator := &PathValidatorImpl{
-		allowedDirs: allowedDirs,
-	}
-
 	return &DirectoryService{
 		allowedDirs: allowedDirs,
 		logger:      logging.DefaultLogger("directory_service"),
-		validator:   validator,
+		validator:   newPathValidator(allowedDirs),
+		fsys:        OSBackend{},
 	}
 }
 
 // CreateDirectory creates a new directory
 func (s *DirectoryService) CreateDirectory(path string) error {
 	// Validate path
-	validPath, err := s.validator.ValidatePath(path)
+	validPath, err := s.validator.ValidateWritePath(path)
 	if err != nil {
 		return errors.NewFileSystemError("create_directory", path, err)
 	}
 
 	// Create the directory
-	if err := os.MkdirAll(validPath, 0750); err != nil {
+	if err := s.fsys.MkdirAll(validPath, 0750); err != nil {
 		return errors.NewFileSystemError("create_directory", path, err)
 	}
 
 	return nil
 }
 
+// Sort keys and orders for directory listings
+const (
+	SortByName    = "name"
+	SortBySize    = "size"
+	SortByModTime = "mtime"
+	OrderAsc      = "asc"
+	OrderDesc     = "desc"
+)
+
+// Entry types a directory listing can be filtered to
+const (
+	EntryTypeFile      = "file"
+	EntryTypeDirectory = "directory"
+	EntryTypeSymlink   = "symlink"
+)
+
+// ListOptions selects, sorts and paginates the entries of a directory listing.
+// The zero value lists every entry except hidden ones, sorted by name.
+type ListOptions struct {
+	SortBy     string // SortByName (default), SortBySize or SortByModTime
+	Order      string // OrderAsc (default) or OrderDesc
+	Type       string // Only list entries of this type, if not empty
+	Pattern    string // Only list entries whose name matches this glob, if not empty
+	ShowHidden bool   // List entries whose name starts with a dot
+	Limit      int    // Maximum number of entries to return, 0 for no limit
+	Cursor     string // NextCursor of the previous page, empty for the first page
+}
+
+// DirectoryPage is one page of a directory listing
+type DirectoryPage struct {
+	Entries    []FileInfo `json:"entries"`
+	Total      int        `json:"total"`                 // Number of entries matching the filters
+	NextCursor string     `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// Validate checks the sort key, order, type, pattern and limit
+func (o ListOptions) Validate() error {
+	switch o.SortBy {
+	case "", SortByName, SortBySize, SortByModTime:
+	default:
+		return fmt.Errorf("%w: unknown sort key %q", errors.ErrInvalidArgument, o.SortBy)
+	}
+	switch o.Order {
+	case "", OrderAsc, OrderDesc:
+	default:
+		return fmt.Errorf("%w: unknown order %q", errors.ErrInvalidArgument, o.Order)
+	}
+	switch o.Type {
+	case "", EntryTypeFile, EntryTypeDirectory, EntryTypeSymlink:
+	default:
+		return fmt.Errorf("%w: unknown entry type %q", errors.ErrInvalidArgument, o.Type)
+	}
+	if _, err := filepath.Match(o.Pattern, ""); err != nil {
+		return fmt.Errorf("%w: invalid pattern %q", errors.ErrInvalidArgument, o.Pattern)
+	}
+	if o.Limit < 0 {
+		return fmt.Errorf("%w: negative limit", errors.ErrInvalidArgument)
+	}
+	return nil
+}
+
+// offset returns the position of the first entry of the page the cursor points to
+func (o ListOptions) offset() (int, error) {
+	if o.Cursor == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(o.Cursor)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("%w: invalid cursor %q", errors.ErrInvalidArgument, o.Cursor)
+	}
+	return offset, nil
+}
+
+// matches reports whether a directory entry passes the hidden, type and pattern filters
+func (o ListOptions) matches(entry fs.DirEntry) bool {
+	name := entry.Name()
+	if !o.ShowHidden && strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	switch o.Type {
+	case EntryTypeFile:
+		if !entry.Type().IsRegular() {
+			return false
+		}
+	case EntryTypeDirectory:
+		if !entry.IsDir() {
+			return false
+		}
+	case EntryTypeSymlink:
+		if entry.Type()&fs.ModeSymlink == 0 {
+			return false
+		}
+	}
+
+	if o.Pattern != "" {
+		if ok, _ := filepath.Match(o.Pattern, name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // ListDirectory lists the contents of a directory
 func (s *DirectoryService) ListDirectory(path string) ([]FileInfo, error) {
+	page, err := s.ListDirectoryPage(path, ListOptions{ShowHidden: true})
+	if err != nil {
+		return nil, err
+	}
+	return page.Entries, nil
+}
+
+// listedEntry is a directory entry that passed the filters of a listing
+type listedEntry struct {
+	name string
+	info fs.FileInfo
+}
+
+// ListDirectoryPage lists the entries of a directory that match opts, sorted
+// and paginated as opts asks
+func (s *DirectoryService) ListDirectoryPage(path string, opts ListOptions) (*DirectoryPage, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.NewFileSystemError("list_directory", path, err)
+	}
+	offset, err := opts.offset()
+	if err != nil {
+		return nil, errors.NewFileSystemError("list_directory", path, err)
+	}
+
+	// Directories inside archives are listed from the archive's index
+	vp, virtual, err := resolveVirtualPath(s.fsys, s.validator, path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("list_directory", path, err)
+	}
+
+	var validPath string
+	var listed []listedEntry
+	if virtual {
+		validPath = path
+		listed, err = s.listArchive(path, vp, opts)
+	} else {
+		validPath, listed, err = s.listDirectory(path, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sortEntries(listed, opts.SortBy, opts.Order == OrderDesc)
+
+	page := &DirectoryPage{Total: len(listed)}
+	if offset > len(listed) {
+		offset = len(listed)
+	}
+	end := len(listed)
+	if opts.Limit > 0 && offset+opts.Limit < end {
+		end = offset + opts.Limit
+		page.NextCursor = strconv.Itoa(end)
+	}
+
+	page.Entries = make([]FileInfo, 0, end-offset)
+	for _, entry := range listed[offset:end] {
+		if info, ok := entry.info.(*archiveFileInfo); ok {
+			page.Entries = append(page.Entries, describeArchiveEntry(filepath.Join(path, entry.name), info))
+			continue
+		}
+		page.Entries = append(page.Entries, describeFile(s.fsys, filepath.Join(validPath, entry.name), filepath.Join(path, entry.name), entry.info))
+	}
+
+	return page, nil
+}
+
+// listDirectory validates a directory on disk and returns its entries that match opts
+func (s *DirectoryService) listDirectory(path string, opts ListOptions) (string, []listedEntry, error) {
 	// Validate path
 	validPath, err := s.validator.ValidatePath(path)
 	if err != nil {
-		return nil, errors.NewFileSystemError("list_directory", path, err)
+		return "", nil, errors.NewFileSystemError("list_directory", path, err)
 	}
 
 	// Check if the path exists and is a directory
-	info, err := os.Stat(validPath)
+	info, err := s.fsys.Stat(validPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, errors.NewFileSystemError("list_directory", path, errors.ErrDirectoryNotFound)
+			return "", nil, errors.NewFileSystemError("list_directory", path, errors.ErrDirectoryNotFound)
 		}
-		return nil, errors.NewFileSystemError("list_directory", path, err)
+		return "", nil, errors.NewFileSystemError("list_directory", path, err)
 	}
 	if !info.IsDir() {
-		return nil, errors.NewFileSystemError("list_directory", path, errors.ErrInvalidOperation)
+		return "", nil, errors.NewFileSystemError("list_directory", path, errors.ErrInvalidOperation)
 	}
 
 	// Read the directory
-	entries, err := os.ReadDir(validPath)
+	entries, err := s.fsys.ReadDir(validPath)
 	if err != nil {
-		return nil, errors.NewFileSystemError("list_directory", path, err)
+		return "", nil, errors.NewFileSystemError("list_directory", path, err)
 	}
 
-	// Convert entries to FileInfo
-	result := make([]FileInfo, 0, len(entries))
+	// Filter entries before describing them, which needs more system calls
+	listed := make([]listedEntry, 0, len(entries))
 	for _, entry := range entries {
+		// Hide entries the path policy does not allow reading
+		if !s.validator.Permits(filepath.Join(validPath, entry.Name()), ReadAccess) {
+			continue
+		}
+		if !opts.matches(entry) {
+			continue
+		}
+
 		entryInfo, err := entry.Info()
 		if err != nil {
 			s.logger.Warn("Error getting info for %s: %v", entry.Name(), err)
 			continue
 		}
 
-		fileInfo := FileInfo{
-			Name:    entry.Name(),
-			Path:    filepath.Join(path, entry.Name()),
-			Size:    entryInfo.Size(),
-			IsDir:   entry.IsDir(),
-			ModTime: entryInfo.ModTime().Format(time.RFC3339),
-		}
+		listed = append(listed, listedEntry{name: entry.Name(), info: entryInfo})
+	}
 
-		if !entry.IsDir() {
-			fileInfo.Extension = filepath.Ext(entry.Name())
-		}
+	return validPath, listed, nil
+}
 
-		result = append(result, fileInfo)
+// listArchive returns the entries of a directory inside an archive that match opts
+func (s *DirectoryService) listArchive(path string, vp *virtualPath, opts ListOptions) ([]listedEntry, error) {
+	index, err := vp.index(s.validator.ArchiveLimits())
+	if err != nil {
+		return nil, errors.NewFileSystemError("list_directory", path, err)
 	}
 
-	return result, nil
+	dir, ok := index[vp.inner]
+	if !ok {
+		return nil, errors.NewFileSystemError("list_directory", path, errors.ErrDirectoryNotFound)
+	}
+	if !dir.IsDir() {
+		return nil, errors.NewFileSystemError("list_directory", path, errors.ErrInvalidOperation)
+	}
+
+	var listed []listedEntry
+	for _, name := range index.children(vp.inner) {
+		info := index[name]
+		if !vp.permits(s.validator, name) || !opts.matches(fs.FileInfoToDirEntry(info)) {
+			continue
+		}
+		listed = append(listed, listedEntry{name: info.name, info: info})
+	}
+	return listed, nil
 }
 
-// DeleteDirectory deletes a directory
-func (s *DirectoryService) DeleteDirectory(path string, recursive bool) error {
+// sortEntries sorts listed entries by key ("name", "size" or "mtime"),
+// breaking ties by name
+func sortEntries(entries []listedEntry, key string, descending bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if descending {
+			a, b = b, a
+		}
+
+		switch key {
+		case SortBySize:
+			if a.info.Size() != b.info.Size() {
+				return a.info.Size() < b.info.Size()
+			}
+		case SortByModTime:
+			if !a.info.ModTime().Equal(b.info.ModTime()) {
+				return a.info.ModTime().Before(b.info.ModTime())
+			}
+		}
+		return a.name < b.name
+	})
+}
+
+// prepareDeleteDirectory validates the deletion of a directory
+func (s *DirectoryService) prepareDeleteDirectory(path string, recursive bool) (string, error) {
 	// Validate path
-	validPath, err := s.validator.ValidatePath(path)
+	validPath, err := s.validator.ValidateWritePath(path)
 	if err != nil {
-		return errors.NewFileSystemError("delete_directory", path, err)
+		return "", errors.NewFileSystemError("delete_directory", path, err)
 	}
 
 	// Check if the path exists and is a directory
-	info, err := os.Stat(validPath)
+	info, err := s.fsys.Stat(validPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return errors.NewFileSystemError("delete_directory", path, errors.ErrDirectoryNotFound)
+			return "", errors.NewFileSystemError("delete_directory", path, errors.ErrDirectoryNotFound)
 		}
-		return errors.NewFileSystemError("delete_directory", path, err)
+		return "", errors.NewFileSystemError("delete_directory", path, err)
 	}
 	if !info.IsDir() {
-		return errors.NewFileSystemError("delete_directory", path, errors.ErrInvalidOperation)
+		return "", errors.NewFileSystemError("delete_directory", path, errors.ErrInvalidOperation)
 	}
 
-	// If not recursive, check if the directory is empty
 	if !recursive {
-		entries, err := os.ReadDir(validPath)
+		// If not recursive, check if the directory is empty
+		entries, err := s.fsys.ReadDir(validPath)
 		if err != nil {
-			return errors.NewFileSystemError("delete_directory", path, err)
+			return "", errors.NewFileSystemError("delete_directory", path, err)
 		}
 		if len(entries) > 0 {
-			return errors.NewFileSystemError("delete_directory", path, errors.ErrInvalidOperation)
+			return "", errors.NewFileSystemError("delete_directory", path, errors.ErrInvalidOperation)
 		}
+	} else if denied := s.firstWriteDenied(validPath); denied != "" {
+		// Refuse to delete anything the path policy protects
+		return "", errors.NewFileSystemError("delete_directory", denied, errors.ErrPathDenied)
+	}
+
+	return validPath, nil
+}
+
+// DeleteDirectory deletes a directory
+func (s *DirectoryService) DeleteDirectory(path string, recursive bool) error {
+	validPath, err := s.prepareDeleteDirectory(path, recursive)
+	if err != nil {
+		return err
+	}
 
+	if !recursive {
 		// Delete the empty directory
-		if err := os.Remove(validPath); err != nil {
-			return errors.NewFileSystemError("delete_directory", path, err)
-		}
-	} else {
-		// Delete the directory and all its contents
-		if err := os.RemoveAll(validPath); err != nil {
+		if err := s.fsys.Remove(validPath); err != nil {
 			return errors.NewFileSystemError("delete_directory", path, err)
 		}
+		return nil
+	}
+
+	// Delete the directory and all its contents
+	if err := s.fsys.RemoveAll(validPath); err != nil {
+		return errors.NewFileSystemError("delete_directory", path, err)
+	}
+
+	// The removed files no longer count against the quota
+	if s.usage != nil {
+		s.usage.InvalidatePath(validPath)
 	}
 
 	return nil
 }
+
+// DirectoryTree returns the tree of entries below a directory, up to maxDepth levels deep
+func (s *DirectoryService) DirectoryTree(path string, maxDepth int) ([]TreeEntry, error) {
+	// Validate path
+	validPath, err := s.validator.ValidatePath(path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("directory_tree", path, err)
+	}
+
+	// Check if the path exists and is a directory
+	info, err := s.fsys.Stat(validPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewFileSystemError("directory_tree", path, errors.ErrDirectoryNotFound)
+		}
+		return nil, errors.NewFileSystemError("directory_tree", path, err)
+	}
+	if !info.IsDir() {
+		return nil, errors.NewFileSystemError("directory_tree", path, errors.ErrInvalidOperation)
+	}
+
+	tree, err := buildFilteredDirectoryTree(s.fsys, validPath, maxDepth, func(entryPath string) bool {
+		return s.validator.Permits(entryPath, ReadAccess)
+	})
+	if err != nil {
+		return nil, errors.NewFileSystemError("directory_tree", path, err)
+	}
+
+	return tree, nil
+}
+
+// firstWriteDenied returns the first path below dir that the path policy does
+// not allow writing, or an empty string if everything may be removed
+func (s *DirectoryService) firstWriteDenied(dir string) string {
+	denied := ""
+	_ = walkDir(s.fsys, dir, func(entryPath string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !s.validator.Permits(entryPath, WriteAccess) {
+			denied = entryPath
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return denied
+}
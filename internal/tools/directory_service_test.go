@@ -4,8 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewDirectoryService(t *testing.T) {
@@ -244,3 +247,81 @@ func TestDirectoryService_DeleteDirectory(t *testing.T) {
 		})
 	}
 }
+
+func TestDirectoryService_ListDirectoryPage(t *testing.T) {
+	tmpDir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"b.go", "a.txt", "c.go", ".hidden"} {
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, 10*(i+1)), 0644))
+		// a.txt is the newest, b.go the oldest
+		mtime := now.Add(time.Duration(i) * time.Hour)
+		if name == "a.txt" {
+			mtime = now.Add(10 * time.Hour)
+		}
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "dir"), 0755))
+	service := NewDirectoryService([]string{tmpDir})
+
+	names := func(page *DirectoryPage) []string {
+		result := make([]string, 0, len(page.Entries))
+		for _, entry := range page.Entries {
+			result = append(result, entry.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		opts  ListOptions
+		want  []string
+		total int
+	}{
+		{"default hides dotfiles", ListOptions{}, []string{"a.txt", "b.go", "c.go", "dir"}, 4},
+		{"show hidden", ListOptions{ShowHidden: true}, []string{".hidden", "a.txt", "b.go", "c.go", "dir"}, 5},
+		{"name descending", ListOptions{Order: OrderDesc}, []string{"dir", "c.go", "b.go", "a.txt"}, 4},
+		{"size", ListOptions{SortBy: SortBySize, Type: EntryTypeFile}, []string{"b.go", "a.txt", "c.go"}, 3},
+		{"mtime descending", ListOptions{SortBy: SortByModTime, Order: OrderDesc, Pattern: "*.*"}, []string{"a.txt", "c.go", "b.go"}, 3},
+		{"directories", ListOptions{Type: EntryTypeDirectory}, []string{"dir"}, 1},
+		{"pattern", ListOptions{Pattern: "*.go"}, []string{"b.go", "c.go"}, 2},
+		{"first page", ListOptions{Limit: 2}, []string{"a.txt", "b.go"}, 4},
+		{"last page", ListOptions{Limit: 2, Cursor: "2"}, []string{"c.go", "dir"}, 4},
+		{"past the end", ListOptions{Limit: 2, Cursor: "10"}, []string{}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.ListDirectoryPage(tmpDir, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, names(page))
+			assert.Equal(t, tt.total, page.Total)
+		})
+	}
+
+	// Following next_cursor visits every entry once
+	var all []string
+	opts := ListOptions{ShowHidden: true, Limit: 2}
+	for {
+		page, err := service.ListDirectoryPage(tmpDir, opts)
+		require.NoError(t, err)
+		all = append(all, names(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{".hidden", "a.txt", "b.go", "c.go", "dir"}, all)
+
+	for _, opts := range []ListOptions{
+		{SortBy: "color"},
+		{Order: "up"},
+		{Type: "socket"},
+		{Pattern: "["},
+		{Limit: -1},
+		{Cursor: "abc"},
+	} {
+		_, err := service.ListDirectoryPage(tmpDir, opts)
+		assert.ErrorIs(t, err, errors.ErrInvalidArgument, "%+v", opts)
+	}
+}
@@ -0,0 +1,295 @@
+package tools
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// Defaults for disk usage reports
+const (
+	defaultUsageDepth = 1
+	defaultUsageTop   = 10
+)
+
+// DiskUsageOptions controls how much detail a disk usage report contains. The
+// whole directory is always walked; the options only limit what is reported.
+type DiskUsageOptions struct {
+	MaxDepth int      // Levels of children to break down (default 1)
+	Top      int      // Number of largest files to list and of children to report per directory (default 10)
+	Exclude  []string // Glob patterns, relative to the walked directory, of entries to leave out
+}
+
+// DiskUsageEntry is the aggregated size of a file or directory
+type DiskUsageEntry struct {
+	Name     string           `json:"name"`
+	Path     string           `json:"path"`
+	IsDir    bool             `json:"is_dir"`
+	Size     int64            `json:"size"`
+	Files    int64            `json:"files"`
+	Dirs     int64            `json:"dirs,omitempty"`
+	Children []DiskUsageEntry `json:"children,omitempty"` // Largest first
+	// Number of children left out of Children, and their total size
+	OtherCount int   `json:"other_count,omitempty"`
+	OtherSize  int64 `json:"other_size,omitempty"`
+}
+
+// FileSize is the size of a single file
+type FileSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ExtensionUsage is the total size of the files with one extension
+type ExtensionUsage struct {
+	Extension string `json:"extension"` // Lower case, "" for files without one
+	Size      int64  `json:"size"`
+	Files     int64  `json:"files"`
+}
+
+// DiskUsageReport describes what is taking space under a directory
+type DiskUsageReport struct {
+	DiskUsageEntry
+	LargestFiles []FileSize       `json:"largest_files"`
+	Extensions   []ExtensionUsage `json:"extensions"` // Largest first
+	Skipped      int              `json:"skipped,omitempty"`
+}
+
+// fileHeap is a min-heap of files by size, used to keep the largest ones
+type fileHeap []FileSize
+
+func (h fileHeap) Len() int           { return len(h) }
+func (h fileHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h fileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x any)        { *h = append(*h, x.(FileSize)) }
+func (h *fileHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// usageWalker walks a directory tree, descending into subdirectories
+// concurrently while a worker slot is free
+type usageWalker struct {
+	ctx       context.Context
+	fsys      Backend
+	validator PathValidator
+	exclude   *PathPolicy
+	root      string
+	opts      DiskUsageOptions
+	workers   chan struct{}
+
+	mu         sync.Mutex
+	largest    fileHeap
+	extensions map[string]*ExtensionUsage
+	skipped    int
+}
+
+// DiskUsage walks a directory and reports the aggregated size and file count
+// of its children down to opts.MaxDepth, its largest files and its usage by
+// file extension. Entries the path policy hides or opts.Exclude matches are
+// left out, symbolic links are counted but not followed, and unreadable
+// directories are skipped. The walk stops when ctx is cancelled.
+func (s *DirectoryService) DiskUsage(ctx context.Context, path string, opts DiskUsageOptions) (*DiskUsageReport, error) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultUsageDepth
+	}
+	if opts.Top <= 0 {
+		opts.Top = defaultUsageTop
+	}
+
+	rules := make([]PolicyRule, 0, len(opts.Exclude))
+	for _, pattern := range opts.Exclude {
+		rules = append(rules, PolicyRule{Pattern: pattern, Read: true})
+	}
+	exclude, err := NewPathPolicy(rules)
+	if err != nil {
+		return nil, errors.NewFileSystemError("disk_usage", path, fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err))
+	}
+
+	// Validate path
+	validPath, err := s.validator.ValidatePath(path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("disk_usage", path, err)
+	}
+
+	// Check if the path exists and is a directory
+	info, err := s.fsys.Stat(validPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewFileSystemError("disk_usage", path, errors.ErrDirectoryNotFound)
+		}
+		return nil, errors.NewFileSystemError("disk_usage", path, err)
+	}
+	if !info.IsDir() {
+		return nil, errors.NewFileSystemError("disk_usage", path, errors.ErrInvalidOperation)
+	}
+
+	w := &usageWalker{
+		ctx:        ctx,
+		fsys:       s.fsys,
+		validator:  s.validator,
+		exclude:    exclude,
+		root:       validPath,
+		opts:       opts,
+		workers:    make(chan struct{}, runtime.GOMAXPROCS(0)),
+		extensions: make(map[string]*ExtensionUsage),
+	}
+	entry := w.walkDir(validPath, path, 0)
+	if err := ctx.Err(); err != nil {
+		return nil, errors.NewFileSystemError("disk_usage", path, err)
+	}
+
+	report := &DiskUsageReport{DiskUsageEntry: entry, Skipped: w.skipped}
+	report.Name = filepath.Base(validPath)
+
+	report.LargestFiles = make([]FileSize, len(w.largest))
+	copy(report.LargestFiles, w.largest)
+	sort.Slice(report.LargestFiles, func(i, j int) bool {
+		return report.LargestFiles[i].Size > report.LargestFiles[j].Size
+	})
+
+	report.Extensions = make([]ExtensionUsage, 0, len(w.extensions))
+	for _, usage := range w.extensions {
+		report.Extensions = append(report.Extensions, *usage)
+	}
+	sort.Slice(report.Extensions, func(i, j int) bool {
+		a, b := report.Extensions[i], report.Extensions[j]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Extension < b.Extension
+	})
+
+	return report, nil
+}
+
+// walkDir aggregates the directory at dir, reported as path, which is depth
+// levels below the root
+func (w *usageWalker) walkDir(dir, path string, depth int) DiskUsageEntry {
+	result := DiskUsageEntry{Name: filepath.Base(dir), Path: path, IsDir: true}
+
+	entries, err := w.fsys.ReadDir(dir)
+	if err != nil {
+		w.skip()
+		return result
+	}
+
+	children := make([]DiskUsageEntry, len(entries))
+	included := make([]bool, len(entries))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		if w.ctx.Err() != nil {
+			break
+		}
+
+		entryPath := filepath.Join(dir, entry.Name())
+		if !w.includes(entryPath) {
+			continue
+		}
+		included[i] = true
+		childPath := filepath.Join(path, entry.Name())
+
+		if !entry.IsDir() {
+			children[i] = w.file(entry, entryPath, childPath)
+			continue
+		}
+
+		select {
+		case w.workers <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-w.workers }()
+				children[i] = w.walkDir(entryPath, childPath, depth+1)
+			}(i)
+		default:
+			children[i] = w.walkDir(entryPath, childPath, depth+1)
+		}
+	}
+	wg.Wait()
+
+	reported := make([]DiskUsageEntry, 0, len(children))
+	for i, child := range children {
+		if !included[i] {
+			continue
+		}
+		result.Size += child.Size
+		result.Files += child.Files
+		if child.IsDir {
+			result.Dirs += child.Dirs + 1
+		}
+		reported = append(reported, child)
+	}
+
+	if depth < w.opts.MaxDepth {
+		sort.SliceStable(reported, func(i, j int) bool {
+			return reported[i].Size > reported[j].Size
+		})
+		if len(reported) > w.opts.Top {
+			for _, other := range reported[w.opts.Top:] {
+				result.OtherCount++
+				result.OtherSize += other.Size
+			}
+			reported = reported[:w.opts.Top]
+		}
+		result.Children = reported
+	}
+	return result
+}
+
+// file records a file in the largest files and extension breakdown
+func (w *usageWalker) file(entry os.DirEntry, entryPath, path string) DiskUsageEntry {
+	info, err := entry.Info()
+	if err != nil {
+		w.skip()
+		return DiskUsageEntry{Name: entry.Name(), Path: path}
+	}
+	size := info.Size()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.largest) < w.opts.Top {
+		heap.Push(&w.largest, FileSize{Path: path, Size: size})
+	} else if size > w.largest[0].Size {
+		w.largest[0] = FileSize{Path: path, Size: size}
+		heap.Fix(&w.largest, 0)
+	}
+
+	ext := strings.ToLower(filepath.Ext(entryPath))
+	usage, ok := w.extensions[ext]
+	if !ok {
+		usage = &ExtensionUsage{Extension: ext}
+		w.extensions[ext] = usage
+	}
+	usage.Size += size
+	usage.Files++
+
+	return DiskUsageEntry{Name: entry.Name(), Path: path, Size: size, Files: 1}
+}
+
+// includes reports whether an entry is neither hidden by the path policy nor excluded
+func (w *usageWalker) includes(entryPath string) bool {
+	if !w.validator.Permits(entryPath, ReadAccess) {
+		return false
+	}
+	rel, err := filepath.Rel(w.root, entryPath)
+	return err == nil && w.exclude.Permits(w.root, rel, ReadAccess)
+}
+
+// skip counts an entry that could not be read
+func (w *usageWalker) skip() {
+	w.mu.Lock()
+	w.skipped++
+	w.mu.Unlock()
+}
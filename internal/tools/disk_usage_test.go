@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUsageTree creates files of the given sizes below a new temporary directory
+func newUsageTree(t *testing.T, files map[string]int) string {
+	t.Helper()
+	root := t.TempDir()
+	contents := make(map[string]string, len(files))
+	for name, size := range files {
+		contents[name] = string(make([]byte, size))
+	}
+	writeTree(t, root, contents)
+	return root
+}
+
+func TestDirectoryService_DiskUsage(t *testing.T) {
+	root := newUsageTree(t, map[string]int{
+		"big.bin":               500,
+		"src/main.go":           100,
+		"src/util.go":           50,
+		"src/pkg/deep.go":       30,
+		"docs/readme.MD":        20,
+		"node_modules/x/lib.js": 1000,
+		"README":                5,
+	})
+	service := NewDirectoryService([]string{root})
+
+	report, err := service.DiskUsage(context.Background(), root, DiskUsageOptions{Top: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1705), report.Size)
+	assert.Equal(t, int64(7), report.Files)
+	assert.Equal(t, int64(5), report.Dirs)
+
+	// Children are sorted by size and cut to the top 3
+	require.Len(t, report.Children, 3)
+	assert.Equal(t, "node_modules", report.Children[0].Name)
+	assert.Equal(t, "big.bin", report.Children[1].Name)
+	assert.Equal(t, "src", report.Children[2].Name)
+	assert.Equal(t, int64(180), report.Children[2].Size)
+	assert.Equal(t, int64(3), report.Children[2].Files)
+	assert.Nil(t, report.Children[2].Children, "only one level is broken down by default")
+	assert.Equal(t, 2, report.OtherCount)
+	assert.Equal(t, int64(25), report.OtherSize)
+
+	assert.Equal(t, []FileSize{
+		{Path: filepath.Join(root, "node_modules", "x", "lib.js"), Size: 1000},
+		{Path: filepath.Join(root, "big.bin"), Size: 500},
+		{Path: filepath.Join(root, "src", "main.go"), Size: 100},
+	}, report.LargestFiles)
+
+	assert.Equal(t, []ExtensionUsage{
+		{Extension: ".js", Size: 1000, Files: 1},
+		{Extension: ".bin", Size: 500, Files: 1},
+		{Extension: ".go", Size: 180, Files: 3},
+		{Extension: ".md", Size: 20, Files: 1},
+		{Extension: "", Size: 5, Files: 1},
+	}, report.Extensions)
+
+	t.Run("depth and exclude", func(t *testing.T) {
+		report, err := service.DiskUsage(context.Background(), root, DiskUsageOptions{
+			MaxDepth: 2,
+			Exclude:  []string{"node_modules", "*.bin"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(205), report.Size)
+		require.NotEmpty(t, report.Children)
+		src := report.Children[0]
+		assert.Equal(t, "src", src.Name)
+		require.Len(t, src.Children, 3)
+		assert.Equal(t, "main.go", src.Children[0].Name)
+		assert.Nil(t, src.Children[2].Children)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := service.DiskUsage(ctx, root, DiskUsageOptions{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := service.DiskUsage(context.Background(), filepath.Join(root, "big.bin"), DiskUsageOptions{})
+		assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+
+		_, err = service.DiskUsage(context.Background(), filepath.Join(root, "missing"), DiskUsageOptions{})
+		assert.ErrorIs(t, err, errors.ErrDirectoryNotFound)
+
+		_, err = service.DiskUsage(context.Background(), root, DiskUsageOptions{Exclude: []string{"["}})
+		assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+	})
+}
+
+func TestServiceProvider_DiskUsage(t *testing.T) {
+	tmpDir, provider := newPolicyProvider(t, []PolicyRule{{Pattern: "secrets", Read: true}})
+
+	result, err := callTool(provider.handleDiskUsage, context.Background(), map[string]interface{}{
+		"path": tmpDir, "exclude": `["vendor"]`,
+	})
+	require.NoError(t, err)
+
+	// Denied and excluded entries are not counted
+	var report DiskUsageReport
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &report))
+	assert.Equal(t, int64(2), report.Files)
+	assert.Equal(t, int64(30), report.Size)
+	assert.Len(t, report.Children, 2)
+
+	_, err = callTool(provider.handleDiskUsage, context.Background(), map[string]interface{}{
+		"path": tmpDir, "exclude": "vendor",
+	})
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+}
@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"encoding/json"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// dryRunResponse is the result of a mutating tool call made in dry-run mode
+type dryRunResponse struct {
+	DryRun bool    `json:"dry_run"`
+	Change *Change `json:"change"`
+}
+
+// WithDryRun makes every mutating tool validate and describe its change without
+// applying it, as if each call passed dry_run=true
+func WithDryRun(dryRun bool) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.dryRun = dryRun
+	}
+}
+
+// isDryRun reports whether a call should only describe its change
+func (p *ServiceProvider) isDryRun(request mcp.CallToolRequest) bool {
+	if p.dryRun {
+		return true
+	}
+	dryRun, _ := request.Params.Arguments["dry_run"].(bool)
+	return dryRun
+}
+
+// dryRunResult returns a function turning the outcome of a Plan method into the
+// tool result, with secrets redacted from its diff
+func (p *ServiceProvider) dryRunResult(op, path string) func(*Change, error) (*mcp.CallToolResult, error) {
+	return func(change *Change, err error) (*mcp.CallToolResult, error) {
+		if err != nil {
+			return nil, err
+		}
+
+		redactions := p.redactChange(change)
+		response, err := json.Marshal(dryRunResponse{DryRun: true, Change: change})
+		if err != nil {
+			return nil, errors.NewFileSystemError(op, path, err)
+		}
+		return p.withRedactionReport(mcp.NewToolResultText(string(response)), op, redactions), nil
+	}
+}
+
+// redactChange redacts secrets from the diff of a change and returns how many
+// were redacted
+func (p *ServiceProvider) redactChange(change *Change) int {
+	if change == nil {
+		return 0
+	}
+	var redactions int
+	change.Diff, redactions = p.redactor.Redact(change.Diff)
+	return redactions
+}
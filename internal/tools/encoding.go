@@ -0,0 +1,301 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// Text encodings the file service detects and writes
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF8BOM = "utf-8-bom"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin-1"
+)
+
+// Line ending styles. LineEndingMixed and LineEndingNone are only detected,
+// never written.
+const (
+	LineEndingLF    = "lf"
+	LineEndingCRLF  = "crlf"
+	LineEndingCR    = "cr"
+	LineEndingMixed = "mixed"
+	LineEndingNone  = "none"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// formatSampleSize is how much of a file is read to detect its format before
+// writing to it
+const formatSampleSize = 64 * 1024
+
+// TextFormat is the encoding and line ending style of a text file
+type TextFormat struct {
+	Encoding   string `json:"encoding"`
+	LineEnding string `json:"line_ending"`
+}
+
+// Validate checks that the format names an encoding and a line ending that
+// can be written. Empty fields are allowed and mean "keep the current one".
+func (f TextFormat) Validate() error {
+	switch f.Encoding {
+	case "", EncodingUTF8, EncodingUTF8BOM, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1:
+	default:
+		return fmt.Errorf("%w: unknown encoding %q", errors.ErrInvalidArgument, f.Encoding)
+	}
+	switch f.LineEnding {
+	case "", LineEndingLF, LineEndingCRLF, LineEndingCR:
+	default:
+		return fmt.Errorf("%w: unknown line ending %q", errors.ErrInvalidArgument, f.LineEnding)
+	}
+	return nil
+}
+
+// plain reports whether the format is UTF-8 without a BOM and with LF or no
+// line endings, which is how text is exchanged with clients
+func (f TextFormat) plain() bool {
+	return f.Encoding == EncodingUTF8 && (f.LineEnding == LineEndingLF || f.LineEnding == LineEndingNone)
+}
+
+// decodeText detects the encoding of data and returns its text as UTF-8 along
+// with the detected format. A byte order mark selects UTF-8 or UTF-16; data
+// that is not valid UTF-8 is read as Latin-1.
+func decodeText(data []byte) (string, TextFormat) {
+	var format TextFormat
+	var text string
+
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		format.Encoding = EncodingUTF8BOM
+		text = string(data[len(bomUTF8):])
+	case bytes.HasPrefix(data, bomUTF16LE):
+		format.Encoding = EncodingUTF16LE
+		text = decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian)
+	case bytes.HasPrefix(data, bomUTF16BE):
+		format.Encoding = EncodingUTF16BE
+		text = decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian)
+	case utf8.Valid(data):
+		format.Encoding = EncodingUTF8
+		text = string(data)
+	default:
+		format.Encoding = EncodingLatin1
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	format.LineEnding = detectLineEndings(text)
+	return text, format
+}
+
+// detectFileFormat detects the format of the file at validPath from its first
+// formatSampleSize bytes
+func detectFileFormat(fsys Backend, validPath string) (TextFormat, error) {
+	file, err := fsys.Open(validPath)
+	if err != nil {
+		return TextFormat{}, err
+	}
+	defer file.Close()
+
+	sample := make([]byte, formatSampleSize)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return TextFormat{}, err
+	}
+	sample = sample[:n]
+
+	// Do not let a character cut off by the end of the sample look like invalid UTF-8
+	if n == formatSampleSize {
+		if i := bytes.LastIndexByte(sample, '\n'); i > 0 {
+			sample = sample[:i+1]
+		}
+	}
+
+	_, format := decodeText(sample)
+	return format, nil
+}
+
+// decodeUTF16 decodes UTF-16 data without its byte order mark
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// encodeText encodes UTF-8 text in the given encoding, with a byte order mark
+// for UTF-8 BOM and UTF-16 unless bom is false
+func encodeText(text, encoding string, bom bool) ([]byte, error) {
+	switch encoding {
+	case "", EncodingUTF8:
+		return []byte(text), nil
+	case EncodingUTF8BOM:
+		if !bom {
+			return []byte(text), nil
+		}
+		return append(append([]byte{}, bomUTF8...), text...), nil
+	case EncodingUTF16LE, EncodingUTF16BE:
+		var order binary.AppendByteOrder = binary.LittleEndian
+		prefix := bomUTF16LE
+		if encoding == EncodingUTF16BE {
+			order, prefix = binary.BigEndian, bomUTF16BE
+		}
+
+		units := utf16.Encode([]rune(text))
+		data := make([]byte, 0, len(prefix)+2*len(units))
+		if bom {
+			data = append(data, prefix...)
+		}
+		for _, unit := range units {
+			data = order.AppendUint16(data, unit)
+		}
+		return data, nil
+	case EncodingLatin1:
+		data := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xFF {
+				return nil, fmt.Errorf("%w: %q cannot be encoded in latin-1", errors.ErrInvalidArgument, r)
+			}
+			data = append(data, byte(r))
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown encoding %q", errors.ErrInvalidArgument, encoding)
+	}
+}
+
+// detectLineEndings returns the line ending style of text
+func detectLineEndings(text string) string {
+	crlf := strings.Count(text, "\r\n")
+	lf := strings.Count(text, "\n") - crlf
+	cr := strings.Count(text, "\r") - crlf
+
+	styles := 0
+	style := LineEndingNone
+	for _, count := range []struct {
+		n     int
+		style string
+	}{{lf, LineEndingLF}, {crlf, LineEndingCRLF}, {cr, LineEndingCR}} {
+		if count.n > 0 {
+			styles++
+			style = count.style
+		}
+	}
+	if styles > 1 {
+		return LineEndingMixed
+	}
+	return style
+}
+
+// convertLineEndings rewrites every line break in text in the given style.
+// Other styles leave text unchanged.
+func convertLineEndings(text, style string) string {
+	var eol string
+	switch style {
+	case LineEndingLF:
+		eol = "\n"
+	case LineEndingCRLF:
+		eol = "\r\n"
+	case LineEndingCR:
+		eol = "\r"
+	default:
+		return text
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	if eol == "\n" {
+		return text
+	}
+	return strings.ReplaceAll(text, "\n", eol)
+}
+
+// prepareConvert validates converting a file to another encoding or line
+// ending style and computes the converted content
+func (s *FileService) prepareConvert(path string, format TextFormat) (req *editRequest, current, target TextFormat, err error) {
+	if err := format.Validate(); err != nil {
+		return nil, current, target, errors.NewFileSystemError("convert_file", path, err)
+	}
+
+	// Validate path
+	validPath, err := s.validator.ValidateWritePath(path)
+	if err != nil {
+		return nil, current, target, errors.NewFileSystemError("convert_file", path, err)
+	}
+
+	fileContent, current, oldSize, err := readForEdit(s.fsys, "convert_file", path, validPath)
+	if err != nil {
+		return nil, current, target, err
+	}
+
+	target = current
+	if format.Encoding != "" {
+		target.Encoding = format.Encoding
+	}
+	if format.LineEnding != "" {
+		target.LineEnding = format.LineEnding
+	}
+
+	newContent := convertLineEndings(fileContent, target.LineEnding)
+	req, err = s.encodeEdit("convert_file", path, validPath, fileContent, newContent, target.Encoding, oldSize, len(newContent))
+	if err != nil {
+		return nil, current, target, err
+	}
+	return req, current, target, nil
+}
+
+// ConvertFile rewrites a file in another encoding or line ending style. Empty
+// fields of format keep the file's current encoding or line endings.
+func (s *FileService) ConvertFile(path string, format TextFormat) error {
+	req, _, _, err := s.prepareConvert(path, format)
+	if err != nil {
+		return err
+	}
+
+	if err := writeContent(s.fsys, req.validPath, string(req.data), false); err != nil {
+		return errors.NewFileSystemError("convert_file", path, err)
+	}
+	s.commitUsage(req.change)
+
+	return nil
+}
+
+// PlanConvertFile validates a conversion and describes it without writing
+func (s *FileService) PlanConvertFile(path string, format TextFormat) (*Change, error) {
+	req, current, target, err := s.prepareConvert(path, format)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWritable(s.fsys, req.validPath); err != nil {
+		return nil, errors.NewFileSystemError("convert_file", path, err)
+	}
+
+	change := &Change{
+		Operation:   "convert_file",
+		Path:        req.validPath,
+		Action:      "modify",
+		Files:       1,
+		BytesBefore: req.oldSize,
+		BytesAfter:  int64(len(req.data)),
+		Description: fmt.Sprintf("Convert %s from %s (%s line endings) to %s (%s line endings)", req.validPath, current.Encoding, current.LineEnding, target.Encoding, target.LineEnding),
+	}
+	if current == target {
+		change.Action = "none"
+	}
+	return change, nil
+}
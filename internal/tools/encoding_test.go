@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		text   string
+		format TextFormat
+	}{
+		{"utf-8", []byte("héllo\n"), "héllo\n", TextFormat{EncodingUTF8, LineEndingLF}},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFhi\r\n"), "hi\r\n", TextFormat{EncodingUTF8BOM, LineEndingCRLF}},
+		{"utf-16le", []byte("\xFF\xFEh\x00\xE9\x00\n\x00"), "hé\n", TextFormat{EncodingUTF16LE, LineEndingLF}},
+		{"utf-16be", []byte("\xFE\xFF\x00h\x00\xE9\x00\r"), "hé\r", TextFormat{EncodingUTF16BE, LineEndingCR}},
+		{"latin-1", []byte("caf\xE9"), "café", TextFormat{EncodingLatin1, LineEndingNone}},
+		{"empty", nil, "", TextFormat{EncodingUTF8, LineEndingNone}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, format := decodeText(tt.data)
+			assert.Equal(t, tt.text, text)
+			assert.Equal(t, tt.format, format)
+
+			// Encoding the text again gives back the original bytes
+			data, err := encodeText(text, format.Encoding, true)
+			require.NoError(t, err)
+			assert.Equal(t, string(tt.data), string(data))
+		})
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	data, err := encodeText("hé", EncodingUTF16BE, false)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x00h\x00\xE9"), data)
+
+	data, err = encodeText("😀", EncodingUTF16LE, true)
+	require.NoError(t, err)
+	text, _ := decodeText(data)
+	assert.Equal(t, "😀", text)
+
+	_, err = encodeText("€", EncodingLatin1, true)
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+
+	_, err = encodeText("a", "ebcdic", true)
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+}
+
+func TestLineEndings(t *testing.T) {
+	assert.Equal(t, LineEndingLF, detectLineEndings("a\nb\n"))
+	assert.Equal(t, LineEndingCRLF, detectLineEndings("a\r\nb\r\n"))
+	assert.Equal(t, LineEndingCR, detectLineEndings("a\rb"))
+	assert.Equal(t, LineEndingMixed, detectLineEndings("a\r\nb\n"))
+	assert.Equal(t, LineEndingNone, detectLineEndings("a"))
+
+	assert.Equal(t, "a\r\nb\r\nc\r\n", convertLineEndings("a\nb\r\nc\r", LineEndingCRLF))
+	assert.Equal(t, "a\nb\nc\n", convertLineEndings("a\nb\r\nc\r", LineEndingLF))
+	assert.Equal(t, "a\rb\r", convertLineEndings("a\r\nb\n", LineEndingCR))
+	assert.Equal(t, "a\r\nb\n", convertLineEndings("a\r\nb\n", LineEndingMixed))
+}
+
+func TestTextFormat_Validate(t *testing.T) {
+	assert.NoError(t, TextFormat{}.Validate())
+	assert.NoError(t, TextFormat{EncodingUTF16LE, LineEndingCRLF}.Validate())
+	assert.ErrorIs(t, TextFormat{Encoding: "utf-32"}.Validate(), errors.ErrInvalidArgument)
+	assert.ErrorIs(t, TextFormat{LineEnding: LineEndingMixed}.Validate(), errors.ErrInvalidArgument)
+}
+
+func TestFileService_PreservesFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+
+	t.Run("crlf edit", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "crlf.txt")
+		require.NoError(t, os.WriteFile(path, []byte("a\r\nb\r\nc\r\n"), 0644))
+
+		require.NoError(t, service.EditFile(path, "x\ny", 2, 2))
+		assert.Equal(t, "a\r\nx\r\ny\r\nc\r\n", readString(t, path))
+	})
+
+	t.Run("crlf write", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "crlf.txt")
+		require.NoError(t, service.WriteFile(path, "one\ntwo\n", false))
+		assert.Equal(t, "one\r\ntwo\r\n", readString(t, path))
+	})
+
+	t.Run("utf-16 edit and append", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "utf16.txt")
+		data, err := encodeText("a\r\nb\r\n", EncodingUTF16LE, true)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		content, format, err := service.ReadFileFormat(path)
+		require.NoError(t, err)
+		assert.Equal(t, "a\r\nb\r\n", content)
+		assert.Equal(t, TextFormat{EncodingUTF16LE, LineEndingCRLF}, format)
+
+		require.NoError(t, service.EditLines(path, []LineEdit{{Action: "insert", StartLine: -1, Content: "ü"}}))
+		require.NoError(t, service.WriteFile(path, "z\n", true))
+
+		want, err := encodeText("a\r\nb\r\nü\r\nz\r\n", EncodingUTF16LE, true)
+		require.NoError(t, err)
+		assert.Equal(t, string(want), readString(t, path))
+	})
+
+	t.Run("latin-1", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "latin1.txt")
+		require.NoError(t, os.WriteFile(path, []byte("caf\xE9\n"), 0644))
+
+		content, err := service.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "café\n", content)
+
+		require.NoError(t, service.EditFile(path, "déjà vu", 1, 1))
+		assert.Equal(t, "d\xE9j\xE0 vu\n", readString(t, path))
+
+		err = service.EditFile(path, "€", 1, 1)
+		assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+		assert.Equal(t, "d\xE9j\xE0 vu\n", readString(t, path))
+	})
+
+	t.Run("new files are utf-8", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "new.txt")
+		require.NoError(t, service.WriteFile(path, "é\r\n", false))
+		assert.Equal(t, "é\r\n", readString(t, path))
+	})
+}
+
+func TestFileService_ConvertFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+	path := filepath.Join(tmpDir, "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("caf\xE9\r\nbar\r\n"), 0644))
+
+	change, err := service.PlanConvertFile(path, TextFormat{Encoding: EncodingUTF8})
+	require.NoError(t, err)
+	assert.Equal(t, "modify", change.Action)
+	assert.Contains(t, change.Description, "latin-1 (crlf line endings) to utf-8 (crlf line endings)")
+	assert.Equal(t, "caf\xE9\r\nbar\r\n", readString(t, path))
+
+	require.NoError(t, service.ConvertFile(path, TextFormat{Encoding: EncodingUTF8, LineEnding: LineEndingLF}))
+	assert.Equal(t, "café\nbar\n", readString(t, path))
+
+	change, err = service.PlanConvertFile(path, TextFormat{LineEnding: LineEndingLF})
+	require.NoError(t, err)
+	assert.Equal(t, "none", change.Action)
+
+	require.NoError(t, service.ConvertFile(path, TextFormat{Encoding: EncodingUTF8BOM}))
+	assert.Equal(t, "\xEF\xBB\xBFcafé\nbar\n", readString(t, path))
+
+	err = service.ConvertFile(path, TextFormat{LineEnding: "nel"})
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+
+	err = service.ConvertFile(filepath.Join(tmpDir, "missing.txt"), TextFormat{Encoding: EncodingUTF8})
+	assert.ErrorIs(t, err, errors.ErrFileNotFound)
+}
+
+func TestServiceProvider_FormatTools(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("\xFF\xFEa\x00\r\x00\n\x00"), 0644))
+	provider := NewServiceProvider([]string{tmpDir})
+	ctx := context.Background()
+
+	result, err := callTool(provider.handleReadFile, ctx, map[string]interface{}{"path": path})
+	require.NoError(t, err)
+	require.Len(t, result.Content, 2)
+	assert.Equal(t, "a\r\n", result.Content[0].(mcp.TextContent).Text)
+	assert.Contains(t, result.Content[1].(mcp.TextContent).Text, "File encoding: utf-16le, line endings: crlf")
+
+	result, err = callTool(provider.handleConvertFile, ctx, map[string]interface{}{
+		"path": path, "encoding": "utf-8", "line_ending": "lf", "dry_run": true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "convert_file", decodeDryRun(t, result).Operation)
+
+	_, err = callTool(provider.handleConvertFile, ctx, map[string]interface{}{
+		"path": path, "encoding": "utf-8", "line_ending": "lf",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "a\n", readString(t, path))
+
+	// Plain UTF-8 files are not annotated
+	result, err = callTool(provider.handleReadFile, ctx, map[string]interface{}{"path": path})
+	require.NoError(t, err)
+	assert.Len(t, result.Content, 1)
+
+	_, err = callTool(provider.handleConvertFile, ctx, map[string]interface{}{"path": path})
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+}
@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"crypto/md5"  // #nosec G501 - offered for checksums, not security
+	"crypto/sha1" // #nosec G505 - offered for checksums, not security
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// maxLineCountSize is the largest file whose lines GetFileInfo counts
+const maxLineCountSize = 16 * 1024 * 1024
+
+// sniffSize is how much of a file is read to detect its MIME type
+const sniffSize = 512
+
+// hashAlgorithms are the content hashes GetFileInfo can compute
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// describeFile builds the metadata of the file at validPath, reported as path,
+// from the result of Lstat. The file's content is not read.
+func describeFile(fsys Backend, validPath, path string, info os.FileInfo) FileInfo {
+	fileInfo := FileInfo{
+		Name:        filepath.Base(validPath),
+		Path:        path,
+		Size:        info.Size(),
+		IsDir:       info.IsDir(),
+		ModTime:     info.ModTime().Format(time.RFC3339),
+		Mode:        info.Mode().String(),
+		Permissions: fmt.Sprintf("%04o", info.Mode().Perm()),
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		fileInfo.IsSymlink = true
+		if target, err := fsys.Readlink(validPath); err == nil {
+			fileInfo.SymlinkTarget = target
+		}
+	}
+
+	if !info.IsDir() {
+		fileInfo.Extension = filepath.Ext(validPath)
+		fileInfo.MimeType = mime.TypeByExtension(fileInfo.Extension)
+	}
+
+	addSysInfo(&fileInfo, info)
+	return fileInfo
+}
+
+// formatFileTime formats an access or creation time, which is zero when the
+// platform does not record it
+func formatFileTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// GetFileInfo returns the metadata of a file or directory. For regular files
+// it also detects the MIME type and, for text files, the encoding, line ending
+// style and line count. A symbolic link is described itself, not its target.
+// hashAlgorithm, if not empty, names a content hash to compute.
+func (s *FileService) GetFileInfo(path, hashAlgorithm string) (*FileInfo, error) {
+	newHash, ok := hashAlgorithms[hashAlgorithm]
+	if hashAlgorithm != "" && !ok {
+		return nil, errors.NewFileSystemError("get_file_info", path, fmt.Errorf("%w: unknown hash algorithm %q", errors.ErrInvalidArgument, hashAlgorithm))
+	}
+
+	// Validate path
+	validPath, err := s.validator.ValidatePath(path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("get_file_info", path, err)
+	}
+
+	info, err := s.fsys.Lstat(validPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NewFileSystemError("get_file_info", path, errors.ErrFileNotFound)
+		}
+		return nil, errors.NewFileSystemError("get_file_info", path, err)
+	}
+
+	fileInfo := describeFile(s.fsys, validPath, path, info)
+	if !info.Mode().IsRegular() {
+		return &fileInfo, nil
+	}
+
+	if err := addContentInfo(s.fsys, &fileInfo, validPath, info.Size()); err != nil {
+		return nil, errors.NewFileSystemError("get_file_info", path, err)
+	}
+
+	if newHash != nil {
+		sum, err := hashFile(s.fsys, validPath, newHash())
+		if err != nil {
+			return nil, errors.NewFileSystemError("get_file_info", path, err)
+		}
+		fileInfo.Hash = sum
+		fileInfo.HashAlgorithm = hashAlgorithm
+	}
+
+	return &fileInfo, nil
+}
+
+// addContentInfo sniffs the MIME type of a regular file and, if it is text no
+// larger than maxLineCountSize, adds its format and line count. Lines are
+// counted as the line tools number them.
+func addContentInfo(fsys Backend, fileInfo *FileInfo, validPath string, size int64) error {
+	file, err := fsys.Open(validPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sample := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	sniffed := http.DetectContentType(sample[:n])
+	if fileInfo.MimeType == "" {
+		fileInfo.MimeType = sniffed
+	}
+
+	if !strings.HasPrefix(sniffed, "text/") || size > maxLineCountSize {
+		return nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	text, format := decodeText(data)
+	lines := len(splitLines(text))
+	fileInfo.LineCount = &lines
+	fileInfo.Encoding = format.Encoding
+	fileInfo.LineEnding = format.LineEnding
+	return nil
+}
+
+// hashFile returns the hex-encoded hash of the content of a file
+func hashFile(fsys Backend, validPath string, h hash.Hash) (string, error) {
+	file, err := fsys.Open(validPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileService_GetFileInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+
+	path := filepath.Join(tmpDir, "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("one\r\ntwo\r\nthree"), 0640))
+
+	info, err := service.GetFileInfo(path, "sha256")
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", info.Name)
+	assert.Equal(t, int64(15), info.Size)
+	assert.Equal(t, ".txt", info.Extension)
+	assert.Equal(t, "text/plain; charset=utf-8", info.MimeType)
+	require.NotNil(t, info.LineCount)
+	assert.Equal(t, 3, *info.LineCount)
+	assert.Equal(t, EncodingUTF8, info.Encoding)
+	assert.Equal(t, LineEndingCRLF, info.LineEnding)
+	assert.Equal(t, "sha256", info.HashAlgorithm)
+	assert.Equal(t, "5536758151607bb81ce8d6f49189b2e84763da9ea84965ab7327e704dae415eb", info.Hash)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, "0640", info.Permissions)
+		assert.Equal(t, "-rw-r-----", info.Mode)
+		assert.NotEmpty(t, info.Owner)
+		assert.NotZero(t, info.Inode)
+		assert.Equal(t, uint64(1), info.Links)
+	}
+
+	t.Run("binary file", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "blob")
+		require.NoError(t, os.WriteFile(path, []byte{0x00, 0x01, 0x02}, 0644))
+
+		info, err := service.GetFileInfo(path, "")
+		require.NoError(t, err)
+		assert.Equal(t, "application/octet-stream", info.MimeType)
+		assert.Nil(t, info.LineCount)
+		assert.Empty(t, info.Hash)
+	})
+
+	t.Run("empty text file", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "empty.md")
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+
+		info, err := service.GetFileInfo(path, "md5")
+		require.NoError(t, err)
+		require.NotNil(t, info.LineCount)
+		assert.Equal(t, 0, *info.LineCount)
+		assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", info.Hash)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		info, err := service.GetFileInfo(tmpDir, "sha256")
+		require.NoError(t, err)
+		assert.True(t, info.IsDir)
+		assert.Empty(t, info.MimeType)
+		assert.Empty(t, info.Hash)
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		link := filepath.Join(tmpDir, "link")
+		if err := os.Symlink("notes.txt", link); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+
+		info, err := service.GetFileInfo(link, "sha256")
+		require.NoError(t, err)
+		assert.True(t, info.IsSymlink)
+		assert.Equal(t, "notes.txt", info.SymlinkTarget)
+		assert.Empty(t, info.Hash)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := service.GetFileInfo(filepath.Join(tmpDir, "missing"), "")
+		assert.ErrorIs(t, err, errors.ErrFileNotFound)
+
+		_, err = service.GetFileInfo(path, "crc32")
+		assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+
+		_, err = service.GetFileInfo("/etc/passwd", "")
+		assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+	})
+}
+
+func TestServiceProvider_GetFileInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "data.json")
+	require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+	provider := NewServiceProvider([]string{tmpDir})
+
+	result, err := callTool(provider.handleGetFileInfo, context.Background(), map[string]interface{}{
+		"path": path, "hash": "sha1",
+	})
+	require.NoError(t, err)
+
+	var info FileInfo
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &info))
+	assert.Equal(t, "data.json", info.Name)
+	assert.Equal(t, "application/json", info.MimeType)
+	assert.Equal(t, "sha1", info.HashAlgorithm)
+	require.NotNil(t, info.LineCount)
+	assert.Equal(t, 1, *info.LineCount)
+
+	// Directory listings carry the metadata that needs no reading
+	result, err = callTool(provider.handleListDirectory, context.Background(), map[string]interface{}{"path": tmpDir})
+	require.NoError(t, err)
+	var page DirectoryPage
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &page))
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, "application/json", page.Entries[0].MimeType)
+	assert.NotEmpty(t, page.Entries[0].Permissions)
+	assert.Nil(t, page.Entries[0].LineCount)
+}
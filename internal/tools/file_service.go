@@ -1,10 +1,12 @@
 package tools
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/moguyn/mcp-go-filesystem/internal/errors"
 	"github.com/moguyn/mcp-go-filesystem/internal/logging"
@@ -14,40 +16,77 @@ import (
 type FileService struct {
 	allowedDirs []string
 	logger      *logging.Logger
-	validator   PathValidator
+	validator   *PathValidatorImpl // Also holds the write and archive limits
+	usage       *UsageTracker
+	fsys        Backend
 }
 
 // NewFileService creates a new FileService
 func NewFileService(allowedDirs []string) *FileService {
-	validator := &PathValidatorImpl{
-		allowedDirs: allowedDirs,
-	}
-
 	return &FileService{
 		allowedDirs: allowedDirs,
 		logger:      logging.DefaultLogger("file_service"),
-		validator:   validator,
+		validator:   newPathValidator(allowedDirs),
+		fsys:        OSBackend{},
 	}
 }
 
-// ReadFile reads the content of a file
+// ReadFile reads the content of a file as UTF-8 text
 func (s *FileService) ReadFile(path string) (string, error) {
+	content, _, err := s.ReadFileFormat(path)
+	return content, err
+}
+
+// ReadFileFormat reads the content of a file as UTF-8 text and returns the
+// file's detected encoding and line ending style. Files inside archives, such
+// as /repo/app.zip!/config/app.yaml, are read without extracting them, and
+// .gz files are decompressed.
+func (s *FileService) ReadFileFormat(path string) (string, TextFormat, error) {
+	data, err := s.readContent(path)
+	if err != nil {
+		return "", TextFormat{}, err
+	}
+
+	content, format := decodeText(data)
+	return content, format, nil
+}
+
+// readContent reads the content of a file, of a file inside an archive or,
+// decompressed, of a .gz file
+func (s *FileService) readContent(path string) ([]byte, error) {
+	vp, ok, err := resolveVirtualPath(s.fsys, s.validator, path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("read_file", path, err)
+	}
+	if ok {
+		data, err := vp.readEntry(vp.inner, s.validator.ArchiveLimits())
+		if err != nil {
+			return nil, errors.NewFileSystemError("read_file", path, err)
+		}
+		return data, nil
+	}
+
 	// Validate path
 	validPath, err := s.validator.ValidatePath(path)
 	if err != nil {
-		return "", errors.NewFileSystemError("read_file", path, err)
+		return nil, errors.NewFileSystemError("read_file", path, err)
 	}
 
 	// Read file
-	content, err := os.ReadFile(validPath) // #nosec G304 - path is validated by ValidatePath
+	var data []byte
+	if isGzipFile(validPath) {
+		data, err = readGzipFile(s.fsys, validPath, s.validator.ArchiveLimits())
+	} else {
+		data, err = readFile(s.fsys, validPath)
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
-			return "", errors.NewFileSystemError("read_file", path, errors.ErrFileNotFound)
+			return nil, errors.NewFileSystemError("read_file", path, errors.ErrFileNotFound)
 		}
-		return "", errors.NewFileSystemError("read_file", path, err)
+		return nil, errors.NewFileSystemError("read_file", path, err)
 	}
 
-	return string(content), nil
+	return data, nil
 }
 
 // ReadMultipleFiles reads the content of multiple files
@@ -55,7 +94,7 @@ func (s *FileService) ReadMultipleFiles(paths []string) ([]FileContent, error) {
 	results := make([]FileContent, 0, len(paths))
 
 	for _, path := range paths {
-		content, err := s.ReadFile(path)
+		content, format, err := s.ReadFileFormat(path)
 		fileContent := FileContent{
 			Path: path,
 		}
@@ -64,6 +103,8 @@ func (s *FileService) ReadMultipleFiles(paths []string) ([]FileContent, error) {
 			fileContent.Error = err.Error()
 		} else {
 			fileContent.Content = content
+			fileContent.Encoding = format.Encoding
+			fileContent.LineEnding = format.LineEnding
 		}
 
 		results = append(results, fileContent)
@@ -72,18 +113,83 @@ func (s *FileService) ReadMultipleFiles(paths []string) ([]FileContent, error) {
 	return results, nil
 }
 
-// WriteFile writes content to a file
-func (s *FileService) WriteFile(path, content string, append bool) error {
+// writeRequest is a validated write that is ready to be applied
+type writeRequest struct {
+	validPath string
+	exists    bool
+	oldSize   int64
+	newSize   int64
+	text      string // Content with the file's line endings
+	data      []byte // Text in the file's encoding
+	change    *usageChange
+}
+
+// prepareWrite validates a write and checks it against size limits and quotas.
+// Content written to an existing file is converted to its encoding and line
+// ending style.
+func (s *FileService) prepareWrite(path, content string, append bool) (*writeRequest, error) {
 	// Validate path
-	validPath, err := s.validator.ValidatePath(path)
+	validPath, err := s.validator.ValidateWritePath(path)
 	if err != nil {
+		return nil, errors.NewFileSystemError("write_file", path, err)
+	}
+
+	req := &writeRequest{validPath: validPath, text: content}
+	format := TextFormat{Encoding: EncodingUTF8}
+	if info, err := s.fsys.Stat(validPath); err == nil {
+		if info.IsDir() {
+			return nil, errors.NewFileSystemError("write_file", path, errors.ErrInvalidOperation)
+		}
+		req.exists = true
+		req.oldSize = info.Size()
+
+		if format, err = detectFileFormat(s.fsys, validPath); err != nil {
+			return nil, errors.NewFileSystemError("write_file", path, err)
+		}
+		req.text = convertLineEndings(content, format.LineEnding)
+	}
+
+	// Appended text continues the file, so it does not start with a byte order mark
+	req.data, err = encodeText(req.text, format.Encoding, !append || req.oldSize == 0)
+	if err != nil {
+		return nil, errors.NewFileSystemError("write_file", path, err)
+	}
+	req.newSize = int64(len(req.data))
+	if append {
+		req.newSize += req.oldSize
+	}
+
+	// Check size limits and quotas before any bytes hit the disk
+	req.change, err = s.checkWrite(validPath, int64(len(req.data)), req.newSize)
+	if err != nil {
+		return nil, errors.NewFileSystemError("write_file", path, err)
+	}
+
+	return req, nil
+}
+
+// WriteFile writes content to a file, keeping the encoding and line ending
+// style of an existing file
+func (s *FileService) WriteFile(path, content string, append bool) error {
+	req, err := s.prepareWrite(path, content, append)
+	if err != nil {
+		return err
+	}
+
+	if err := writeContent(s.fsys, req.validPath, string(req.data), append); err != nil {
 		return errors.NewFileSystemError("write_file", path, err)
 	}
+	s.commitUsage(req.change)
 
+	return nil
+}
+
+// writeContent writes content to validPath, creating parent directories as needed
+func writeContent(fsys Backend, validPath, content string, append bool) error {
 	// Create parent directories if they don't exist
 	dir := filepath.Dir(validPath)
-	if err := os.MkdirAll(dir, 0750); err != nil {
-		return errors.NewFileSystemError("write_file", path, err)
+	if err := fsys.MkdirAll(dir, 0750); err != nil {
+		return err
 	}
 
 	// Open file with appropriate flags
@@ -94,169 +200,286 @@ func (s *FileService) WriteFile(path, content string, append bool) error {
 		flag |= os.O_TRUNC
 	}
 
-	file, err := os.OpenFile(validPath, flag, 0600) // #nosec G304 - path is validated by ValidatePath
+	file, err := fsys.OpenFile(validPath, flag, 0600)
 	if err != nil {
-		return errors.NewFileSystemError("write_file", path, err)
+		return err
 	}
 	defer file.Close()
 
 	// Write content
-	if _, err := file.WriteString(content); err != nil {
-		return errors.NewFileSystemError("write_file", path, err)
+	_, err = io.WriteString(file, content)
+	return err
+}
+
+// editRequest is a validated edit that is ready to be applied
+type editRequest struct {
+	validPath  string
+	oldContent string // File content before the edit, as UTF-8
+	newContent string // File content after the edit, as UTF-8
+	oldSize    int64
+	data       []byte // New content in the file's encoding
+	change     *usageChange
+}
+
+// readForEdit reads a file to be edited as UTF-8 text and detects its format
+func readForEdit(fsys Backend, op, path, validPath string) (string, TextFormat, int64, error) {
+	data, err := readFile(fsys, validPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", TextFormat{}, 0, errors.NewFileSystemError(op, path, errors.ErrFileNotFound)
+		}
+		return "", TextFormat{}, 0, errors.NewFileSystemError(op, path, err)
 	}
 
-	return nil
+	text, format := decodeText(data)
+	return text, format, int64(len(data)), nil
 }
 
-// EditFile edits a portion of a file
-func (s *FileService) EditFile(path, content string, startLine, endLine int) error {
+// prepareEdit validates an edit and computes the edited file content
+func (s *FileService) prepareEdit(path, content string, startLine, endLine int) (*editRequest, error) {
 	// Validate path
-	validPath, err := s.validator.ValidatePath(path)
+	validPath, err := s.validator.ValidateWritePath(path)
 	if err != nil {
-		return errors.NewFileSystemError("edit_file", path, err)
+		return nil, errors.NewFileSystemError("edit_file", path, err)
 	}
 
 	// Read the entire file
-	fileBytes, err := os.ReadFile(validPath) // #nosec G304 - path is validated by ValidatePath
+	fileContent, format, oldSize, err := readForEdit(s.fsys, "edit_file", path, validPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return errors.NewFileSystemError("edit_file", path, errors.ErrFileNotFound)
-		}
-		return errors.NewFileSystemError("edit_file", path, err)
+		return nil, err
+	}
+
+	// Lines are edited with LF endings and converted back afterwards
+	lineEnding := format.LineEnding
+	if lineEnding != LineEndingCRLF && lineEnding != LineEndingCR {
+		lineEnding = ""
+	}
+	if lineEnding != "" {
+		fileContent = convertLineEndings(fileContent, LineEndingLF)
+		content = convertLineEndings(content, LineEndingLF)
 	}
-	fileContent := string(fileBytes)
 
 	// Split the file into lines
 	lines := strings.Split(fileContent, "\n")
 
 	// Validate line numbers
 	if startLine < 1 || startLine > len(lines) {
-		return errors.NewFileSystemError("edit_file", path, errors.ErrInvalidArgument)
+		return nil, errors.NewFileSystemError("edit_file", path, errors.ErrInvalidArgument)
 	}
 	if endLine < startLine || endLine > len(lines) {
-		return errors.NewFileSystemError("edit_file", path, errors.ErrInvalidArgument)
+		return nil, errors.NewFileSystemError("edit_file", path, errors.ErrInvalidArgument)
 	}
 
 	// Replace the specified lines
 	newLines := strings.Split(content, "\n")
-	lines = append(append(lines[:startLine-1], newLines...), lines[endLine:]...)
+	lines = append(append(lines[:startLine-1:startLine-1], newLines...), lines[endLine:]...)
 
 	// Join the lines back together
-	newContent := strings.Join(lines, "\n")
+	newContent := convertLineEndings(strings.Join(lines, "\n"), lineEnding)
+	if lineEnding != "" {
+		fileContent = convertLineEndings(fileContent, lineEnding)
+	}
+
+	return s.encodeEdit("edit_file", path, validPath, fileContent, newContent, format.Encoding, oldSize, len(content))
+}
+
+// encodeEdit encodes edited content in the file's encoding and checks it
+// against size limits and quotas
+func (s *FileService) encodeEdit(op, path, validPath, oldContent, newContent, encoding string, oldSize int64, writeSize int) (*editRequest, error) {
+	data, err := encodeText(newContent, encoding, true)
+	if err != nil {
+		return nil, errors.NewFileSystemError(op, path, err)
+	}
+
+	// Check size limits and quotas before any bytes hit the disk
+	change, err := s.checkWrite(validPath, int64(writeSize), int64(len(data)))
+	if err != nil {
+		return nil, errors.NewFileSystemError(op, path, err)
+	}
+
+	return &editRequest{
+		validPath:  validPath,
+		oldContent: oldContent,
+		newContent: newContent,
+		oldSize:    oldSize,
+		data:       data,
+		change:     change,
+	}, nil
+}
+
+// EditFile edits a portion of a file, keeping its encoding and line ending style
+func (s *FileService) EditFile(path, content string, startLine, endLine int) error {
+	req, err := s.prepareEdit(path, content, startLine, endLine)
+	if err != nil {
+		return err
+	}
 
 	// Write the file
-	return s.WriteFile(path, newContent, false)
+	if err := writeContent(s.fsys, req.validPath, string(req.data), false); err != nil {
+		return errors.NewFileSystemError("edit_file", path, err)
+	}
+	s.commitUsage(req.change)
+
+	return nil
 }
 
-// DeleteFile deletes a file
-func (s *FileService) DeleteFile(path string) error {
+// prepareDelete validates the deletion of a file
+func (s *FileService) prepareDelete(path string) (string, os.FileInfo, error) {
 	// Validate path
-	validPath, err := s.validator.ValidatePath(path)
+	validPath, err := s.validator.ValidateWritePath(path)
 	if err != nil {
-		return errors.NewFileSystemError("delete_file", path, err)
+		return "", nil, errors.NewFileSystemError("delete_file", path, err)
 	}
 
 	// Check if the path exists and is a file
-	info, err := os.Stat(validPath)
+	info, err := s.fsys.Stat(validPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return errors.NewFileSystemError("delete_file", path, errors.ErrFileNotFound)
+			return "", nil, errors.NewFileSystemError("delete_file", path, errors.ErrFileNotFound)
 		}
-		return errors.NewFileSystemError("delete_file", path, err)
+		return "", nil, errors.NewFileSystemError("delete_file", path, err)
 	}
 	if info.IsDir() {
-		return errors.NewFileSystemError("delete_file", path, errors.ErrInvalidOperation)
+		return "", nil, errors.NewFileSystemError("delete_file", path, errors.ErrInvalidOperation)
+	}
+
+	return validPath, info, nil
+}
+
+// DeleteFile deletes a file
+func (s *FileService) DeleteFile(path string) error {
+	validPath, info, err := s.prepareDelete(path)
+	if err != nil {
+		return err
 	}
 
 	// Delete the file
-	if err := os.Remove(validPath); err != nil {
+	if err := s.fsys.Remove(validPath); err != nil {
 		return errors.NewFileSystemError("delete_file", path, err)
 	}
+	s.releaseUsage(validPath, info.Size())
 
 	return nil
 }
 
-// MoveFile moves a file from one location to another
-func (s *FileService) MoveFile(sourcePath, destinationPath string) error {
+// transferRequest is a validated move or copy that is ready to be applied
+type transferRequest struct {
+	validSource string
+	validDest   string
+	info        os.FileInfo
+	overwrite   bool
+	destSize    int64
+	crossRoot   bool
+	change      *usageChange
+}
+
+// prepareTransfer validates moving or copying a file. Moves need write access to
+// the source; moves within an allowed directory do not change its usage.
+func (s *FileService) prepareTransfer(op, sourcePath, destinationPath string) (*transferRequest, error) {
 	// Validate source path
-	validSourcePath, err := s.validator.ValidatePath(sourcePath)
+	validateSource := s.validator.ValidatePath
+	if op == "move_file" {
+		validateSource = s.validator.ValidateWritePath
+	}
+	validSourcePath, err := validateSource(sourcePath)
 	if err != nil {
-		return errors.NewFileSystemError("move_file", sourcePath, err)
+		return nil, errors.NewFileSystemError(op, sourcePath, err)
 	}
 
 	// Validate destination path
-	validDestPath, err := s.validator.ValidatePath(destinationPath)
+	validDestPath, err := s.validator.ValidateWritePath(destinationPath)
 	if err != nil {
-		return errors.NewFileSystemError("move_file", destinationPath, err)
+		return nil, errors.NewFileSystemError(op, destinationPath, err)
 	}
 
 	// Check if the source exists and is a file
-	info, err := os.Stat(validSourcePath)
+	info, err := s.fsys.Stat(validSourcePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return errors.NewFileSystemError("move_file", sourcePath, errors.ErrFileNotFound)
+			return nil, errors.NewFileSystemError(op, sourcePath, errors.ErrFileNotFound)
 		}
-		return errors.NewFileSystemError("move_file", sourcePath, err)
+		return nil, errors.NewFileSystemError(op, sourcePath, err)
 	}
 	if info.IsDir() {
-		return errors.NewFileSystemError("move_file", sourcePath, errors.ErrInvalidOperation)
+		return nil, errors.NewFileSystemError(op, sourcePath, errors.ErrInvalidOperation)
+	}
+
+	req := &transferRequest{
+		validSource: validSourcePath,
+		validDest:   validDestPath,
+		info:        info,
+	}
+	if destInfo, err := s.fsys.Stat(validDestPath); err == nil {
+		req.overwrite = true
+		req.destSize = destInfo.Size()
+	}
+
+	// Check size limits and quotas before any bytes hit the disk. Moving into
+	// another allowed directory counts against that directory's quota.
+	switch {
+	case op == "copy_file":
+		req.change, err = s.checkWrite(validDestPath, info.Size(), info.Size())
+	case s.crossesRoots(validSourcePath, validDestPath):
+		req.crossRoot = true
+		req.change, err = s.checkWrite(validDestPath, 0, info.Size())
+	}
+	if err != nil {
+		return nil, errors.NewFileSystemError(op, destinationPath, err)
+	}
+
+	return req, nil
+}
+
+// MoveFile moves a file from one location to another
+func (s *FileService) MoveFile(sourcePath, destinationPath string) error {
+	req, err := s.prepareTransfer("move_file", sourcePath, destinationPath)
+	if err != nil {
+		return err
 	}
 
 	// Create parent directories if they don't exist
-	destDir := filepath.Dir(validDestPath)
-	if err := os.MkdirAll(destDir, 0750); err != nil {
+	destDir := filepath.Dir(req.validDest)
+	if err := s.fsys.MkdirAll(destDir, 0750); err != nil {
 		return errors.NewFileSystemError("move_file", destinationPath, err)
 	}
 
 	// Move the file
-	if err := os.Rename(validSourcePath, validDestPath); err != nil {
+	if err := s.fsys.Rename(req.validSource, req.validDest); err != nil {
 		return errors.NewFileSystemError("move_file", sourcePath, err)
 	}
 
+	if req.crossRoot {
+		s.commitUsage(req.change)
+		s.releaseUsage(req.validSource, req.info.Size())
+	} else if req.overwrite && s.usage != nil {
+		s.usage.InvalidatePath(req.validDest)
+	}
+
 	return nil
 }
 
 // CopyFile copies a file from one location to another
 func (s *FileService) CopyFile(sourcePath, destinationPath string) error {
-	// Validate source path
-	validSourcePath, err := s.validator.ValidatePath(sourcePath)
+	req, err := s.prepareTransfer("copy_file", sourcePath, destinationPath)
 	if err != nil {
-		return errors.NewFileSystemError("copy_file", sourcePath, err)
-	}
-
-	// Validate destination path
-	validDestPath, err := s.validator.ValidatePath(destinationPath)
-	if err != nil {
-		return errors.NewFileSystemError("copy_file", destinationPath, err)
-	}
-
-	// Check if the source exists and is a file
-	info, err := os.Stat(validSourcePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return errors.NewFileSystemError("copy_file", sourcePath, errors.ErrFileNotFound)
-		}
-		return errors.NewFileSystemError("copy_file", sourcePath, err)
-	}
-	if info.IsDir() {
-		return errors.NewFileSystemError("copy_file", sourcePath, errors.ErrInvalidOperation)
+		return err
 	}
 
 	// Create parent directories if they don't exist
-	destDir := filepath.Dir(validDestPath)
-	if err := os.MkdirAll(destDir, 0750); err != nil {
+	destDir := filepath.Dir(req.validDest)
+	if err := s.fsys.MkdirAll(destDir, 0750); err != nil {
 		return errors.NewFileSystemError("copy_file", destinationPath, err)
 	}
 
 	// Open source file
-	source, err := os.Open(validSourcePath) // #nosec G304 - path is validated by ValidatePath
+	source, err := s.fsys.Open(req.validSource)
 	if err != nil {
 		return errors.NewFileSystemError("copy_file", sourcePath, err)
 	}
 	defer source.Close()
 
 	// Create destination file
-	destination, err := os.Create(validDestPath) // #nosec G304 - path is validated by ValidatePath
+	destination, err := s.fsys.OpenFile(req.validDest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return errors.NewFileSystemError("copy_file", destinationPath, err)
 	}
@@ -268,20 +491,206 @@ func (s *FileService) CopyFile(sourcePath, destinationPath string) error {
 	}
 
 	// Preserve file mode
-	if err := os.Chmod(validDestPath, info.Mode()); err != nil {
+	if err := s.fsys.Chmod(req.validDest, req.info.Mode()); err != nil {
 		return errors.NewFileSystemError("copy_file", destinationPath, err)
 	}
+	s.commitUsage(req.change)
 
 	return nil
 }
 
-// PathValidatorImpl implements PathValidator interface
+// PathValidatorImpl implements PathValidator interface. It is the access policy
+// shared by all services of a provider: the allowed directories, the path
+// rules and the limits on writes and archives. Update replaces them together,
+// so a request sees either the old or the new policy, never a mix.
 type PathValidatorImpl struct {
+	mu          sync.RWMutex
 	allowedDirs []string
+	policy      *PathPolicy
+	writes      WriteLimits
+	archives    ArchiveLimits // Bound reads inside archives and of .gz files
+	workDir     string        // Relative paths are resolved against it, if set
+	fsys        Backend       // Storage symbolic links are followed in, nil to not follow them
+
+	// A scoped validator confines its parent's policy to the scope directories
+	parent *PathValidatorImpl
+	scope  []string
+}
+
+// newPathValidator creates a validator for the given directories with the
+// default archive limits
+func newPathValidator(allowedDirs []string) *PathValidatorImpl {
+	return &PathValidatorImpl{
+		allowedDirs: allowedDirs,
+		archives:    DefaultArchiveLimits(),
+	}
+}
+
+// scoped returns a validator allowing only the paths allowed by v that are
+// inside one of dirs. The rules and limits of v, and any update to them, apply
+// to it; rules and quotas stay attached to v's allowed directories.
+func (v *PathValidatorImpl) scoped(dirs []string) *PathValidatorImpl {
+	return &PathValidatorImpl{parent: v, scope: dirs}
+}
+
+// inScope reports whether a normalized path is inside a scope directory
+func (v *PathValidatorImpl) inScope(normalizedPath string) bool {
+	for _, dir := range v.scope {
+		if within(dir, normalizedPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update replaces the allowed directories, path policy, limits and working directory
+func (v *PathValidatorImpl) Update(allowedDirs []string, policy *PathPolicy, writes WriteLimits, archives ArchiveLimits, workDir string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.allowedDirs = allowedDirs
+	v.policy = policy
+	v.writes = writes
+	v.archives = archives
+	v.workDir = workDir
+}
+
+// AllowedDirs returns the allowed directories
+func (v *PathValidatorImpl) AllowedDirs() []string {
+	if v.parent != nil {
+		return intersectDirs(v.scope, v.parent.AllowedDirs())
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.allowedDirs
+}
+
+// WriteLimits returns the write size limits and quotas
+func (v *PathValidatorImpl) WriteLimits() WriteLimits {
+	if v.parent != nil {
+		return v.parent.WriteLimits()
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.writes
+}
+
+// ArchiveLimits returns the limits on reading and extracting archives
+func (v *PathValidatorImpl) ArchiveLimits() ArchiveLimits {
+	if v.parent != nil {
+		return v.parent.ArchiveLimits()
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.archives
+}
+
+// WorkDir returns the directory relative paths are resolved against, or "" for
+// the process's working directory
+func (v *PathValidatorImpl) WorkDir() string {
+	if v.parent != nil {
+		return v.parent.WorkDir()
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.workDir
 }
 
-// ValidatePath validates that a path is within the allowed directories
+// ValidatePath validates that a path is within the allowed directories and readable under the path policy
 func (v *PathValidatorImpl) ValidatePath(requestedPath string) (string, error) {
+	return v.validate(requestedPath, ReadAccess)
+}
+
+// ValidateWritePath validates that a path is within the allowed directories and writable under the path policy
+func (v *PathValidatorImpl) ValidateWritePath(requestedPath string) (string, error) {
+	return v.validate(requestedPath, WriteAccess)
+}
+
+// Permits reports whether the path policy allows access to an already validated path
+func (v *PathValidatorImpl) Permits(validPath string, access Access) bool {
+	if v.parent != nil {
+		return v.inScope(validPath) && v.parent.Permits(validPath, access)
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.permits(validPath, access)
+}
+
+// permits implements Permits; the caller holds the lock. The rules must allow
+// the path both as named and after following symbolic links, so that a link
+// cannot reach a file they deny.
+func (v *PathValidatorImpl) permits(validPath string, access Access) bool {
+	root, ok := v.findRoot(validPath)
+	if !ok {
+		return false
+	}
+	if v.policy.Empty() {
+		return true
+	}
+
+	rel, err := filepath.Rel(root, validPath)
+	if err != nil || !v.policy.Permits(root, rel, access) {
+		return false
+	}
+
+	resolved, ok := v.resolve(validPath)
+	if !ok || resolved == validPath {
+		return true
+	}
+	// The allowed directories may themselves be reached through links
+	root, realRoot := "", ""
+	for _, dir := range v.allowedDirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		dir = filepath.Clean(abs)
+		real, err := v.fsys.EvalSymlinks(dir)
+		if err != nil {
+			real = dir
+		}
+		if within(real, resolved) && len(real) > len(realRoot) {
+			root, realRoot = dir, real
+		}
+	}
+	if root == "" {
+		// Links leaving the allowed directories are not governed by their rules
+		return true
+	}
+	rel, err = filepath.Rel(realRoot, resolved)
+	return err == nil && v.policy.Permits(root, rel, access)
+}
+
+// resolve returns the path a path refers to after following symbolic links,
+// including a final link to a file that does not exist yet, or false if the
+// path does not exist
+func (v *PathValidatorImpl) resolve(path string) (string, bool) {
+	if v.fsys == nil {
+		return "", false
+	}
+	if resolved, err := v.fsys.EvalSymlinks(path); err == nil {
+		return resolved, true
+	}
+
+	info, err := v.fsys.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
+	target, err := v.fsys.Readlink(path)
+	if err != nil {
+		return "", false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	dir, err := v.fsys.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, filepath.Base(target)), true
+}
+
+// validate normalizes a path, confines it to the allowed directories and applies the path policy
+func (v *PathValidatorImpl) validate(requestedPath string, access Access) (string, error) {
 	// Check for invalid characters in the path
 	if strings.ContainsRune(requestedPath, 0) {
 		return "", errors.ErrInvalidPath
@@ -289,13 +698,59 @@ func (v *PathValidatorImpl) ValidatePath(requestedPath string) (string, error) {
 
 	// Normalize the path
 	expandedPath := ExpandHome(requestedPath)
+	if workDir := v.WorkDir(); workDir != "" && !filepath.IsAbs(expandedPath) {
+		expandedPath = filepath.Join(workDir, expandedPath)
+	}
 	absPath, err := filepath.Abs(expandedPath)
 	if err != nil {
 		return "", err
 	}
 	normalizedPath := filepath.Clean(absPath)
 
+	if v.parent != nil {
+		if !v.inScope(normalizedPath) {
+			return "", errors.ErrPathNotAllowed
+		}
+		return v.parent.validate(normalizedPath, access)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
 	// Check if the path is within any of the allowed directories
+	if _, ok := v.findRoot(normalizedPath); !ok {
+		return "", errors.ErrPathNotAllowed
+	}
+
+	// Entries inside archives can be read but not written
+	if access == WriteAccess && isVirtualPath(normalizedPath) {
+		return "", fmt.Errorf("%w: archive contents are read-only", errors.ErrInvalidOperation)
+	}
+
+	// Apply the allow and deny rules of the containing directory
+	if !v.permits(normalizedPath, access) {
+		return "", errors.ErrPathDenied
+	}
+
+	return normalizedPath, nil
+}
+
+// rootFor returns the most specific allowed directory containing a normalized path
+func (v *PathValidatorImpl) rootFor(normalizedPath string) (string, bool) {
+	if v.parent != nil {
+		if !v.inScope(normalizedPath) {
+			return "", false
+		}
+		return v.parent.rootFor(normalizedPath)
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.findRoot(normalizedPath)
+}
+
+// findRoot implements rootFor; the caller holds the lock
+func (v *PathValidatorImpl) findRoot(normalizedPath string) (string, bool) {
+	best := ""
 	for _, allowedDir := range v.allowedDirs {
 		// Normalize the allowed directory
 		allowedDirAbs, err := filepath.Abs(allowedDir)
@@ -306,9 +761,11 @@ func (v *PathValidatorImpl) ValidatePath(requestedPath string) (string, error) {
 
 		// Check if the path is the allowed directory or a subdirectory
 		if normalizedPath == allowedDirNormalized || strings.HasPrefix(normalizedPath, allowedDirNormalized+string(filepath.Separator)) {
-			return normalizedPath, nil
+			if len(allowedDirNormalized) > len(best) {
+				best = allowedDirNormalized
+			}
 		}
 	}
 
-	return "", errors.ErrPathNotAllowed
+	return best, best != ""
 }
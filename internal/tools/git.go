@@ -0,0 +1,234 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// gitTimeout bounds how long a git command may run
+const gitTimeout = 30 * time.Second
+
+// maxGitOutput is the most output read from a git command
+const maxGitOutput = 16 * 1024 * 1024
+
+// maxGitError is the most of a git command's error output kept for its error message
+const maxGitError = 4096
+
+// gitSafeArgs disable the repository settings that make git run other programs:
+// hooks, file system monitors, external diff drivers, pagers and signing
+// programs. Filter drivers cannot be turned off by name, so runGit refuses
+// repositories that define any.
+var gitSafeArgs = []string{
+	"-c", "core.hooksPath=" + os.DevNull,
+	"-c", "core.fsmonitor=false",
+	"-c", "core.pager=cat",
+	"-c", "diff.external=",
+	"-c", "commit.gpgSign=false",
+	"-c", "tag.gpgSign=false",
+	"-c", "log.showSignature=false",
+}
+
+// gitEnv is added to the environment of git commands. Only the repository's
+// own configuration is read, pathspecs are literal so that paths cannot be
+// read as globs or magic signatures, and read-only commands do not take the
+// index lock.
+var gitEnv = []string{
+	"GIT_CONFIG_NOSYSTEM=1",
+	"GIT_CONFIG_GLOBAL=" + os.DevNull,
+	"GIT_TERMINAL_PROMPT=0",
+	"GIT_OPTIONAL_LOCKS=0",
+	"GIT_LITERAL_PATHSPECS=1",
+	"GIT_PAGER=cat",
+	"LC_ALL=C",
+}
+
+// cappedBuffer keeps at most max bytes written to it and records whether more were written
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// runGit runs git with args in dir and returns its output
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("%w: git is not installed", errors.ErrInvalidOperation)
+	}
+	if err := checkGitFilters(ctx, dir); err != nil {
+		return nil, err
+	}
+	return execGit(ctx, dir, args...)
+}
+
+// gitFilterCommands are the settings of a filter driver naming a program
+var gitFilterCommands = []string{".clean", ".smudge", ".process"}
+
+// checkGitFilters refuses to run git in a repository whose configuration
+// defines filter drivers, whose programs git runs on the files it reads and
+// writes. Any client able to write to the repository could plant one.
+func checkGitFilters(ctx context.Context, dir string) error {
+	out, err := execGit(ctx, dir, "config", "--list", "--null")
+	if err != nil {
+		return err
+	}
+	for _, entry := range splitNull(out) {
+		key, _, _ := strings.Cut(entry, "\n")
+		name, ok := strings.CutPrefix(key, "filter.")
+		if !ok {
+			continue
+		}
+		for _, suffix := range gitFilterCommands {
+			if driver, ok := strings.CutSuffix(name, suffix); ok {
+				return fmt.Errorf("%w: the repository configures the git filter driver %q, which git tools do not run", errors.ErrPermissionDenied, driver)
+			}
+		}
+	}
+	return nil
+}
+
+// execGit runs git with args in dir and returns its output
+func execGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", append(append([]string{}, gitSafeArgs...), args...)...) // #nosec G204 - arguments are validated by the callers
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), gitEnv...)
+	stdout := &cappedBuffer{max: maxGitOutput}
+	stderr := &cappedBuffer{max: maxGitError}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%w: git %s timed out", errors.ErrInvalidOperation, args[0])
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("%w: git %s: %s", errors.ErrInvalidOperation, args[0], message)
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("%w: git %s output is larger than %d bytes", errors.ErrInvalidArgument, args[0], maxGitOutput)
+	}
+	return stdout.Bytes(), nil
+}
+
+// checkRevision refuses revisions git could read as options or that are not a
+// single argument
+func checkRevision(rev string) error {
+	if rev == "" || strings.HasPrefix(rev, "-") || strings.ContainsAny(rev, " \t\r\n\x00") {
+		return fmt.Errorf("%w: invalid revision %q", errors.ErrInvalidArgument, rev)
+	}
+	return nil
+}
+
+// splitNull splits NUL-terminated git output into its fields
+func splitNull(out []byte) []string {
+	text := strings.TrimSuffix(string(out), "\x00")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\x00")
+}
+
+// gitChangeNames maps the status letters of git's porcelain output to words
+var gitChangeNames = map[byte]string{
+	'M': "modified",
+	'T': "type_changed",
+	'A': "added",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'U': "unmerged",
+	'?': "untracked",
+}
+
+// parseGitStatus parses the output of git status --porcelain=v2 --branch -z
+func parseGitStatus(out []byte) *GitStatus {
+	status := &GitStatus{Files: []GitFileStatus{}}
+	fields := splitNull(out)
+	for i := 0; i < len(fields); i++ {
+		record := fields[i]
+		switch {
+		case strings.HasPrefix(record, "# branch.oid "):
+			if oid := strings.TrimPrefix(record, "# branch.oid "); oid != "(initial)" {
+				status.Commit = oid
+			}
+		case strings.HasPrefix(record, "# branch.head "):
+			if head := strings.TrimPrefix(record, "# branch.head "); head != "(detached)" {
+				status.Branch = head
+			}
+		case strings.HasPrefix(record, "# branch.upstream "):
+			status.Upstream = strings.TrimPrefix(record, "# branch.upstream ")
+		case strings.HasPrefix(record, "# branch.ab "):
+			_, _ = fmt.Sscanf(strings.TrimPrefix(record, "# branch.ab "), "+%d -%d", &status.Ahead, &status.Behind)
+		case strings.HasPrefix(record, "1 "), strings.HasPrefix(record, "2 "), strings.HasPrefix(record, "u "):
+			// <kind> <XY> and 6, 7 or 8 more fields, then the path
+			skip := map[byte]int{'1': 9, '2': 10, 'u': 11}[record[0]]
+			parts := strings.SplitN(record, " ", skip)
+			if len(parts) < skip || len(parts[1]) != 2 {
+				continue
+			}
+			file := GitFileStatus{
+				Path:     parts[skip-1],
+				Staged:   gitChangeNames[parts[1][0]],
+				Unstaged: gitChangeNames[parts[1][1]],
+			}
+			if record[0] == 'u' {
+				file.Conflicted = true
+			}
+			if record[0] == '2' && i+1 < len(fields) {
+				i++
+				file.OrigPath = fields[i]
+			}
+			status.Files = append(status.Files, file)
+		case strings.HasPrefix(record, "? "):
+			status.Files = append(status.Files, GitFileStatus{Path: record[2:], Unstaged: "untracked"})
+		}
+	}
+	return status
+}
+
+// gitLogFormat separates the fields of a commit with unit separators and
+// commits with record separators
+const gitLogFormat = "--format=%H%x1f%an%x1f%ae%x1f%aI%x1f%s%x1e"
+
+// parseGitLog parses the output of git log with gitLogFormat
+func parseGitLog(out []byte) []GitCommit {
+	commits := []GitCommit{}
+	for _, record := range strings.Split(string(out), "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		commits = append(commits, GitCommit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Email:   fields[2],
+			Date:    fields[3],
+			Subject: fields[4],
+		})
+	}
+	return commits
+}
@@ -0,0 +1,396 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+)
+
+// defaultGitLogLimit is how many commits git_log returns unless asked for more
+const defaultGitLogLimit = 20
+
+// maxGitLogLimit is the most commits git_log returns
+const maxGitLogLimit = 1000
+
+// GitService provides read access to, and commits in, the git repositories
+// whose worktrees are inside the allowed directories. It runs the git binary,
+// so it only sees repositories stored on the local filesystem.
+type GitService struct {
+	allowedDirs []string
+	logger      *logging.Logger
+	validator   *PathValidatorImpl
+}
+
+// NewGitService creates a new GitService
+func NewGitService(allowedDirs []string) *GitService {
+	return &GitService{
+		allowedDirs: allowedDirs,
+		logger:      logging.DefaultLogger("git_service"),
+		validator:   newPathValidator(allowedDirs),
+	}
+}
+
+// GitStatus is the state of a repository's worktree and index
+type GitStatus struct {
+	Root     string          `json:"root"`
+	Branch   string          `json:"branch,omitempty"` // Empty when HEAD is detached
+	Commit   string          `json:"commit,omitempty"` // Empty before the first commit
+	Upstream string          `json:"upstream,omitempty"`
+	Ahead    int             `json:"ahead,omitempty"`
+	Behind   int             `json:"behind,omitempty"`
+	Clean    bool            `json:"clean"`
+	Files    []GitFileStatus `json:"files"`
+}
+
+// GitFileStatus is a changed, untracked or conflicted file
+type GitFileStatus struct {
+	Path       string `json:"path"`                // Relative to the repository root
+	OrigPath   string `json:"orig_path,omitempty"` // Path before a rename or copy
+	Staged     string `json:"staged,omitempty"`    // Change in the index: "modified", "added", "deleted", "renamed", ...
+	Unstaged   string `json:"unstaged,omitempty"`  // Change in the worktree, or "untracked"
+	Conflicted bool   `json:"conflicted,omitempty"`
+}
+
+// GitCommit describes a commit
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"` // RFC 3339
+	Subject string `json:"subject"`
+}
+
+// GitDiffOptions selects what git_diff compares
+type GitDiffOptions struct {
+	From    string // Revision to compare from, HEAD by default
+	To      string // Revision to compare to; the worktree, or the index if Staged, when empty
+	Staged  bool   // Compare the index instead of the worktree
+	Context int    // Lines of context around each change
+}
+
+// GitLogOptions selects the commits git_log returns
+type GitLogOptions struct {
+	Revision string // Revision to start from, HEAD by default
+	Limit    int
+	Skip     int
+}
+
+// gitRepo is a repository located from a path inside its worktree
+type gitRepo struct {
+	root     string // Validated path of the worktree's top level
+	pathspec string // Slash-separated path relative to root, "" for the whole worktree
+}
+
+// repo locates the repository containing path. Its whole worktree must be
+// inside the allowed directories.
+func (s *GitService) repo(ctx context.Context, p string) (*gitRepo, error) {
+	validPath, err := s.validator.ValidatePath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// The path itself may be gone from the worktree, as for git_show
+	dir := validPath
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, errors.ErrDirectoryNotFound
+		}
+		dir = parent
+	}
+
+	out, err := runGit(ctx, dir, "rev-parse", "--show-prefix")
+	if errors.IsPermissionDenied(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not inside a git worktree", errors.ErrInvalidArgument, p)
+	}
+
+	// Walk up from dir by the components of its path inside the worktree
+	root := dir
+	prefix := strings.TrimSuffix(strings.TrimSpace(string(out)), "/")
+	if prefix != "" {
+		for range strings.Split(prefix, "/") {
+			root = filepath.Dir(root)
+		}
+	}
+	if _, err := s.validator.ValidatePath(root); err != nil {
+		return nil, fmt.Errorf("%w: the repository at %s is not inside an allowed directory", errors.ErrPathNotAllowed, root)
+	}
+	if out, err := runGit(ctx, root, "rev-parse", "--show-prefix"); err != nil || strings.TrimSpace(string(out)) != "" {
+		return nil, fmt.Errorf("%w: cannot locate the repository of %s through symbolic links", errors.ErrInvalidArgument, p)
+	}
+
+	rel, err := filepath.Rel(root, validPath)
+	if err != nil {
+		return nil, err
+	}
+	repo := &gitRepo{root: root}
+	if rel != "." {
+		repo.pathspec = filepath.ToSlash(rel)
+	}
+	return repo, nil
+}
+
+// permits reports whether the path policy allows access to a path relative to the repository root
+func (s *GitService) permits(repo *gitRepo, rel string, access Access) bool {
+	return s.validator.Permits(filepath.Join(repo.root, filepath.FromSlash(rel)), access)
+}
+
+// pathspecArgs returns the arguments limiting a command to the repository's pathspec
+func (repo *gitRepo) pathspecArgs() []string {
+	if repo.pathspec == "" {
+		return []string{"--"}
+	}
+	return []string{"--", repo.pathspec}
+}
+
+// Status returns the branch of the repository containing path and the
+// changed and untracked files below path. Files the path policy hides are
+// left out.
+func (s *GitService) Status(ctx context.Context, p string) (*GitStatus, error) {
+	repo, err := s.repo(ctx, p)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_status", p, err)
+	}
+
+	args := append([]string{"status", "--porcelain=v2", "--branch", "--untracked-files=all", "-z"}, repo.pathspecArgs()...)
+	out, err := runGit(ctx, repo.root, args...)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_status", p, err)
+	}
+
+	status := parseGitStatus(out)
+	status.Root = repo.root
+	files := status.Files[:0]
+	for _, file := range status.Files {
+		if s.permits(repo, file.Path, ReadAccess) && (file.OrigPath == "" || s.permits(repo, file.OrigPath, ReadAccess)) {
+			files = append(files, file)
+		}
+	}
+	status.Files = files
+	status.Clean = len(files) == 0
+	return status, nil
+}
+
+// Diff returns a unified diff of the changes below path: by default between
+// HEAD and the worktree, or between two revisions. Untracked files are not
+// included, and neither are files the path policy hides.
+func (s *GitService) Diff(ctx context.Context, p string, opts GitDiffOptions) (string, error) {
+	from := opts.From
+	if from == "" {
+		if opts.To != "" {
+			return "", errors.NewFileSystemError("git_diff", p, fmt.Errorf("%w: to requires from", errors.ErrInvalidArgument))
+		}
+		from = "HEAD"
+	}
+	revisions := []string{from}
+	if opts.To != "" {
+		revisions = append(revisions, opts.To)
+	}
+	for _, rev := range revisions {
+		if err := checkRevision(rev); err != nil {
+			return "", errors.NewFileSystemError("git_diff", p, err)
+		}
+	}
+
+	repo, err := s.repo(ctx, p)
+	if err != nil {
+		return "", errors.NewFileSystemError("git_diff", p, err)
+	}
+
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--no-textconv", "--no-renames", "-U" + strconv.Itoa(max(opts.Context, 0))}
+	if opts.Staged {
+		args = append(args, "--cached")
+	}
+	args = append(args, revisions...)
+
+	// List the changed files first so that the diff leaves out those the policy hides
+	out, err := runGit(ctx, repo.root, append(append(append([]string{}, args...), "--name-only", "-z"), repo.pathspecArgs()...)...)
+	if err != nil {
+		return "", errors.NewFileSystemError("git_diff", p, err)
+	}
+	names := splitNull(out)
+	permitted := make([]string, 0, len(names))
+	for _, name := range names {
+		if s.permits(repo, name, ReadAccess) {
+			permitted = append(permitted, name)
+		}
+	}
+	if len(permitted) == 0 {
+		return "", nil
+	}
+
+	pathspec := repo.pathspecArgs()
+	if len(permitted) < len(names) {
+		pathspec = append([]string{"--"}, permitted...)
+	}
+	out, err = runGit(ctx, repo.root, append(args, pathspec...)...)
+	if err != nil {
+		return "", errors.NewFileSystemError("git_diff", p, err)
+	}
+	return string(out), nil
+}
+
+// Log returns the commits that changed path, newest first
+func (s *GitService) Log(ctx context.Context, p string, opts GitLogOptions) ([]GitCommit, error) {
+	revision := opts.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+	if err := checkRevision(revision); err != nil {
+		return nil, errors.NewFileSystemError("git_log", p, err)
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultGitLogLimit
+	}
+	limit = min(limit, maxGitLogLimit)
+
+	repo, err := s.repo(ctx, p)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_log", p, err)
+	}
+
+	args := []string{"log", "--no-color", gitLogFormat, "--max-count=" + strconv.Itoa(limit), "--skip=" + strconv.Itoa(max(opts.Skip, 0)), revision}
+	out, err := runGit(ctx, repo.root, append(args, repo.pathspecArgs()...)...)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_log", p, err)
+	}
+	return parseGitLog(out), nil
+}
+
+// Show returns the content of a file at a revision. The file need not exist in
+// the worktree.
+func (s *GitService) Show(ctx context.Context, p, revision string) (string, error) {
+	if err := checkRevision(revision); err != nil {
+		return "", errors.NewFileSystemError("git_show", p, err)
+	}
+
+	repo, err := s.repo(ctx, p)
+	if err != nil {
+		return "", errors.NewFileSystemError("git_show", p, err)
+	}
+	if repo.pathspec == "" {
+		return "", errors.NewFileSystemError("git_show", p, fmt.Errorf("%w: path must be a file inside the repository", errors.ErrInvalidArgument))
+	}
+
+	out, err := runGit(ctx, repo.root, "cat-file", "blob", revision+":"+repo.pathspec)
+	if err != nil {
+		return "", errors.NewFileSystemError("git_show", p, err)
+	}
+	content, _ := decodeText(out)
+	return content, nil
+}
+
+// stagedFiles returns the paths of the files staged in the repository, relative to its root
+func (s *GitService) stagedFiles(ctx context.Context, repo *gitRepo) ([]string, error) {
+	out, err := runGit(ctx, repo.root, "diff", "--cached", "--no-renames", "--name-only", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return splitNull(out), nil
+}
+
+// prepareCommit checks that the staged changes of the repository containing
+// path can be committed: something is staged, the repository's files are
+// inside its worktree and the path policy allows writing every staged file
+func (s *GitService) prepareCommit(ctx context.Context, p, message string) (*gitRepo, []string, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, nil, fmt.Errorf("%w: message is required", errors.ErrInvalidArgument)
+	}
+
+	repo, err := s.repo(ctx, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.validator.ValidateWritePath(repo.root); err != nil {
+		return nil, nil, err
+	}
+
+	// Commits write to the git directory, which a worktree's .git file can place anywhere
+	out, err := runGit(ctx, repo.root, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return nil, nil, err
+	}
+	realRoot, err := filepath.EvalSymlinks(repo.root)
+	if err != nil {
+		return nil, nil, err
+	}
+	gitDir, err := filepath.EvalSymlinks(filepath.FromSlash(strings.TrimSpace(string(out))))
+	if err != nil || !within(realRoot, gitDir) {
+		return nil, nil, fmt.Errorf("%w: the git directory of %s is outside its worktree", errors.ErrPathNotAllowed, repo.root)
+	}
+
+	staged, err := s.stagedFiles(ctx, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(staged) == 0 {
+		return nil, nil, fmt.Errorf("%w: nothing is staged", errors.ErrInvalidOperation)
+	}
+	for _, name := range staged {
+		if !s.permits(repo, name, WriteAccess) {
+			return nil, nil, fmt.Errorf("%w: %s", errors.ErrPathDenied, name)
+		}
+	}
+	return repo, staged, nil
+}
+
+// Commit commits the changes staged in the repository containing path. Hooks
+// are not run.
+func (s *GitService) Commit(ctx context.Context, p, message string) (*GitCommit, error) {
+	repo, _, err := s.prepareCommit(ctx, p, message)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_commit", p, err)
+	}
+
+	if _, err := runGit(ctx, repo.root, "commit", "--quiet", "--message="+message); err != nil {
+		return nil, errors.NewFileSystemError("git_commit", p, err)
+	}
+
+	out, err := runGit(ctx, repo.root, "log", "--no-color", gitLogFormat, "--max-count=1", "HEAD", "--")
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_commit", p, err)
+	}
+	commits := parseGitLog(out)
+	if len(commits) == 0 {
+		return nil, errors.NewFileSystemError("git_commit", p, errors.ErrInvalidOperation)
+	}
+	s.logger.Info("Committed %s in %s", commits[0].Hash, repo.root)
+	return &commits[0], nil
+}
+
+// PlanCommit describes the commit Commit would make without making it
+func (s *GitService) PlanCommit(ctx context.Context, p, message string) (*Change, error) {
+	repo, staged, err := s.prepareCommit(ctx, p, message)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_commit", p, err)
+	}
+
+	shown := staged
+	if len(shown) > maxPreviewFiles {
+		shown = shown[:maxPreviewFiles]
+	}
+	description := fmt.Sprintf("Commit %d staged file(s): %s", len(staged), strings.Join(shown, ", "))
+	if len(shown) < len(staged) {
+		description += ", ..."
+	}
+	return &Change{
+		Operation:   "git_commit",
+		Path:        repo.root,
+		Action:      "commit",
+		Files:       len(staged),
+		Description: description,
+	}, nil
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGitStatus(t *testing.T) {
+	out := "# branch.oid 1234abcd\x00# branch.head main\x00# branch.upstream origin/main\x00# branch.ab +2 -1\x00" +
+		"1 M. N... 100644 100644 100644 aaaa bbbb src/main.go\x00" +
+		"1 .D N... 100644 100644 000000 aaaa aaaa old file.txt\x00" +
+		"2 R. N... 100644 100644 100644 aaaa aaaa R100 new.go\x00orig.go\x00" +
+		"u UU N... 100644 100644 100644 100644 aaaa bbbb cccc conflict.txt\x00" +
+		"? notes.md\x00"
+
+	status := parseGitStatus([]byte(out))
+	assert.Equal(t, "main", status.Branch)
+	assert.Equal(t, "1234abcd", status.Commit)
+	assert.Equal(t, "origin/main", status.Upstream)
+	assert.Equal(t, 2, status.Ahead)
+	assert.Equal(t, 1, status.Behind)
+	assert.Equal(t, []GitFileStatus{
+		{Path: "src/main.go", Staged: "modified"},
+		{Path: "old file.txt", Unstaged: "deleted"},
+		{Path: "new.go", OrigPath: "orig.go", Staged: "renamed"},
+		{Path: "conflict.txt", Staged: "unmerged", Unstaged: "unmerged", Conflicted: true},
+		{Path: "notes.md", Unstaged: "untracked"},
+	}, status.Files)
+
+	status = parseGitStatus([]byte("# branch.oid (initial)\x00# branch.head (detached)\x00"))
+	assert.Empty(t, status.Commit)
+	assert.Empty(t, status.Branch)
+	assert.Empty(t, status.Files)
+}
+
+func TestParseGitLog(t *testing.T) {
+	out := "abc\x1fAda\x1fada@example.com\x1f2024-01-02T03:04:05+00:00\x1fFirst line\x1e\n" +
+		"def\x1fBob\x1fbob@example.com\x1f2024-01-01T00:00:00+00:00\x1fInitial commit\x1e\n"
+
+	commits := parseGitLog([]byte(out))
+	require.Len(t, commits, 2)
+	assert.Equal(t, GitCommit{Hash: "abc", Author: "Ada", Email: "ada@example.com", Date: "2024-01-02T03:04:05+00:00", Subject: "First line"}, commits[0])
+	assert.Equal(t, "def", commits[1].Hash)
+	assert.Empty(t, parseGitLog(nil))
+}
+
+func TestCheckRevision(t *testing.T) {
+	for _, rev := range []string{"HEAD", "HEAD~2", "main", "v1.0.0", "abc123", "origin/main^{tree}"} {
+		assert.NoError(t, checkRevision(rev), rev)
+	}
+	for _, rev := range []string{"", "--output=/tmp/x", "-p", "main two", "a\nb"} {
+		assert.ErrorIs(t, checkRevision(rev), errors.ErrInvalidArgument, rev)
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 4}
+	n, err := b.Write([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.False(t, b.truncated)
+
+	n, err = b.Write([]byte("def"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n, "writes past the cap are accepted and dropped")
+	assert.True(t, b.truncated)
+	assert.Equal(t, "abcd", b.String())
+}
+
+func TestRunGit_Errors(t *testing.T) {
+	requireGit(t)
+
+	_, err := runGit(context.Background(), t.TempDir(), "rev-parse", "--show-prefix")
+	assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+	assert.Contains(t, err.Error(), "not a git repository")
+}
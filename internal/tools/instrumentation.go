@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// instrument wraps a tool handler so that every call is recorded in the provider metrics
+func (p *ServiceProvider) instrument(name string, handler ToolHandler) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := handler(ctx, request)
+
+		p.metrics.ToolCalls.Inc(name)
+		p.metrics.ToolDuration.Observe(time.Since(start).Seconds(), name)
+		if err != nil {
+			p.metrics.ToolErrors.Inc(name, errors.Kind(err))
+		} else if result != nil && result.IsError {
+			p.metrics.ToolErrors.Inc(name, "tool_error")
+		}
+
+		return result, err
+	}
+}
+
+// CheckAllowedDirectories verifies that every allowed directory still exists and can be opened
+func (p *ServiceProvider) CheckAllowedDirectories() error {
+	for _, dir := range p.ListAllowedDirectories() {
+		info, err := p.fsys.Stat(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return errors.NewFileSystemError("check_allowed_directories", dir, errors.ErrDirectoryNotFound)
+			}
+			return errors.NewFileSystemError("check_allowed_directories", dir, err)
+		}
+		if !info.IsDir() {
+			return errors.NewFileSystemError("check_allowed_directories", dir, fmt.Errorf("not a directory"))
+		}
+
+		f, err := p.fsys.Open(dir)
+		if err != nil {
+			return errors.NewFileSystemError("check_allowed_directories", dir, err)
+		}
+		f.Close()
+	}
+
+	return nil
+}
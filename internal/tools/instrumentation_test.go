@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentRecordsCallsAndErrors(t *testing.T) {
+	tmpDir, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	m := metrics.New()
+	provider := NewServiceProvider([]string{tmpDir}, WithMetrics(m))
+	assert.Same(t, m, provider.Metrics())
+
+	handler := provider.instrument("read_file", provider.handleReadFile)
+
+	// Successful read
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{
+		"path": filepath.Join(tmpDir, "test.txt"),
+	}
+	_, err := handler(context.Background(), request)
+	assert.NoError(t, err)
+
+	// Missing file
+	request.Params.Arguments = map[string]interface{}{
+		"path": filepath.Join(tmpDir, "missing.txt"),
+	}
+	_, err = handler(context.Background(), request)
+	assert.Error(t, err)
+
+	// Path outside the allowed directories
+	request.Params.Arguments = map[string]interface{}{
+		"path": "/etc/passwd",
+	}
+	_, err = handler(context.Background(), request)
+	assert.Error(t, err)
+
+	assert.Equal(t, float64(3), m.ToolCalls.Value("read_file"))
+	assert.Equal(t, float64(1), m.ToolErrors.Value("read_file", "not_found"))
+	assert.Equal(t, float64(1), m.ToolErrors.Value("read_file", "path_not_allowed"))
+	assert.Equal(t, uint64(3), m.ToolDuration.Count("read_file"))
+	assert.Equal(t, float64(len("test content")), m.BytesRead.Value("read_file"))
+}
+
+func TestHandlersRecordBytesWritten(t *testing.T) {
+	tmpDir, provider, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{
+		"path":    filepath.Join(tmpDir, "written.txt"),
+		"content": "hello",
+	}
+	_, err := provider.handleWriteFile(context.Background(), request)
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(5), provider.Metrics().BytesWritten.Value("write_file"))
+}
+
+func TestCheckAllowedDirectories(t *testing.T) {
+	tmpDir, provider, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	assert.NoError(t, provider.CheckAllowedDirectories())
+
+	// A directory that disappears makes the provider unready
+	removed := filepath.Join(tmpDir, "testdir")
+	provider = NewServiceProvider([]string{tmpDir, removed})
+	assert.NoError(t, provider.CheckAllowedDirectories())
+	assert.NoError(t, os.Remove(removed))
+	assert.Error(t, provider.CheckAllowedDirectories())
+
+	// A file is not a valid allowed directory
+	provider = NewServiceProvider([]string{filepath.Join(tmpDir, "test.txt")})
+	assert.Error(t, provider.CheckAllowedDirectories())
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/ratelimit"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+)
+
+// expensiveRetryAfter is the retry hint returned when the concurrency cap is reached
+const expensiveRetryAfter = 250 * time.Millisecond
+
+// limits holds the rate limiters and concurrency cap applied to tool calls
+type limits struct {
+	client    *ratelimit.Limiter
+	tools     map[string]*ratelimit.Limiter
+	expensive *ratelimit.Semaphore
+}
+
+// newLimits builds the limiters described by cfg
+func newLimits(cfg ratelimit.Config) *limits {
+	l := &limits{
+		client:    ratelimit.NewLimiter(cfg.Client),
+		tools:     make(map[string]*ratelimit.Limiter, len(cfg.Tools)),
+		expensive: ratelimit.NewSemaphore(cfg.MaxConcurrentExpensive),
+	}
+	for tool, rule := range cfg.Tools {
+		l.tools[tool] = ratelimit.NewLimiter(rule)
+	}
+	return l
+}
+
+// WithRateLimits applies per-client and per-tool rate limits and the cap on
+// concurrent expensive operations
+func WithRateLimits(cfg ratelimit.Config) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.rateLimits = cfg
+		p.limits = newLimits(cfg)
+	}
+}
+
+// rateLimitResult is the structured body of a rate limited tool result
+type rateLimitResult struct {
+	Error        string `json:"error"`
+	Message      string `json:"message"`
+	Scope        string `json:"scope"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+// wrap applies the provider middleware to a tool handler: rate limiting, metrics
+// and conversion of rate limit errors into structured tool errors
+func (p *ServiceProvider) wrap(name string, handler ToolHandler) server.ToolHandlerFunc {
+	instrumented := p.instrument(name, p.limit(name, handler))
+
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := instrumented(ctx, request)
+
+		if rateErr, ok := errors.AsRateLimitError(err); ok {
+			body, _ := json.Marshal(rateLimitResult{
+				Error:        "rate_limited",
+				Message:      rateErr.Error(),
+				Scope:        rateErr.Scope,
+				RetryAfterMs: rateErr.RetryAfter.Milliseconds(),
+			})
+			return mcp.NewToolResultError(string(body)), nil
+		}
+
+		return result, err
+	}
+}
+
+// limit wraps a tool handler with the configured rate limits and concurrency cap
+func (p *ServiceProvider) limit(name string, handler ToolHandler) ToolHandler {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		p.mu.RLock()
+		l := p.limits
+		p.mu.RUnlock()
+		if l == nil {
+			return handler(ctx, request)
+		}
+
+		key := session.KeyFromContext(ctx)
+
+		if ok, wait := l.client.Allow(key); !ok {
+			return nil, errors.NewFileSystemError(name, "", errors.NewRateLimitError("client", wait))
+		}
+
+		if limiter, exists := l.tools[name]; exists {
+			if ok, wait := limiter.Allow(key); !ok {
+				return nil, errors.NewFileSystemError(name, "", errors.NewRateLimitError("tool:"+name, wait))
+			}
+		}
+
+		if isExpensive(name, request) {
+			if !l.expensive.TryAcquire() {
+				return nil, errors.NewFileSystemError(name, "", errors.NewRateLimitError("concurrency", expensiveRetryAfter))
+			}
+			defer l.expensive.Release()
+		}
+
+		return handler(ctx, request)
+	}
+}
+
+// isExpensive reports whether a call counts against the cap on concurrent expensive operations
+func isExpensive(name string, request mcp.CallToolRequest) bool {
+	switch name {
+	case "search_files", "directory_tree", "disk_usage", "diff", "git_status", "git_diff", "apply_batch", "create_archive", "extract_archive":
+		return true
+	case "delete_directory":
+		recursive, _ := request.Params.Arguments["recursive"].(bool)
+		return recursive
+	default:
+		return false
+	}
+}
@@ -0,0 +1,134 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/ratelimit"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func listAllowedRequest() mcp.CallToolRequest {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{}
+	return request
+}
+
+func decodeRateLimitResult(t *testing.T, result *mcp.CallToolResult) rateLimitResult {
+	assert.True(t, result.IsError)
+	textContent, ok := result.Content[0].(mcp.TextContent)
+	assert.True(t, ok)
+
+	var body rateLimitResult
+	assert.NoError(t, json.Unmarshal([]byte(textContent.Text), &body))
+	return body
+}
+
+func TestWrapWithoutLimits(t *testing.T) {
+	provider := NewServiceProvider([]string{"/tmp"})
+	handler := provider.wrap("list_allowed_directories", provider.handleListAllowedDirectories)
+
+	for i := 0; i < 10; i++ {
+		result, err := handler(context.Background(), listAllowedRequest())
+		assert.NoError(t, err)
+		assert.False(t, result.IsError)
+	}
+}
+
+func TestWrapClientRateLimit(t *testing.T) {
+	provider := NewServiceProvider([]string{"/tmp"}, WithRateLimits(ratelimit.Config{
+		Client: ratelimit.Rule{Rate: 0.001, Burst: 2},
+	}))
+	handler := provider.wrap("list_allowed_directories", provider.handleListAllowedDirectories)
+
+	alice := session.NewContext(context.Background(), session.Info{ID: "alice"})
+	bob := session.NewContext(context.Background(), session.Info{ID: "bob"})
+
+	for i := 0; i < 2; i++ {
+		result, err := handler(alice, listAllowedRequest())
+		assert.NoError(t, err)
+		assert.False(t, result.IsError)
+	}
+
+	result, err := handler(alice, listAllowedRequest())
+	assert.NoError(t, err)
+	body := decodeRateLimitResult(t, result)
+	assert.Equal(t, "rate_limited", body.Error)
+	assert.Equal(t, "client", body.Scope)
+	assert.Greater(t, body.RetryAfterMs, int64(0))
+
+	// Another session has its own budget
+	result, err = handler(bob, listAllowedRequest())
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	assert.Equal(t, float64(1), provider.Metrics().ToolErrors.Value("list_allowed_directories", "rate_limited"))
+}
+
+func TestWrapToolRateLimit(t *testing.T) {
+	provider := NewServiceProvider([]string{"/tmp"}, WithRateLimits(ratelimit.Config{
+		Tools: map[string]ratelimit.Rule{
+			"list_allowed_directories": {Rate: 0.001, Burst: 1},
+		},
+	}))
+	limited := provider.wrap("list_allowed_directories", provider.handleListAllowedDirectories)
+
+	result, err := limited(context.Background(), listAllowedRequest())
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	result, err = limited(context.Background(), listAllowedRequest())
+	assert.NoError(t, err)
+	assert.Equal(t, "tool:list_allowed_directories", decodeRateLimitResult(t, result).Scope)
+}
+
+func TestWrapConcurrencyCap(t *testing.T) {
+	tmpDir, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	provider := NewServiceProvider([]string{tmpDir}, WithRateLimits(ratelimit.Config{
+		MaxConcurrentExpensive: 1,
+	}))
+	handler := provider.wrap("search_files", provider.handleSearchFiles)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{
+		"query": "test",
+		"path":  tmpDir,
+	}
+
+	// With the only slot taken, expensive calls are rejected
+	assert.True(t, provider.limits.expensive.TryAcquire())
+	result, err := handler(context.Background(), request)
+	assert.NoError(t, err)
+	body := decodeRateLimitResult(t, result)
+	assert.Equal(t, "concurrency", body.Scope)
+	assert.Equal(t, expensiveRetryAfter.Milliseconds(), body.RetryAfterMs)
+
+	// Once released, the call goes through and frees its slot afterwards
+	provider.limits.expensive.Release()
+	result, err = handler(context.Background(), request)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, 0, provider.limits.expensive.InUse())
+}
+
+func TestIsExpensive(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{}
+	assert.True(t, isExpensive("search_files", request))
+	assert.True(t, isExpensive("directory_tree", request))
+	assert.True(t, isExpensive("disk_usage", request))
+	assert.True(t, isExpensive("diff", request))
+	assert.True(t, isExpensive("git_diff", request))
+	assert.True(t, isExpensive("apply_batch", request))
+	assert.True(t, isExpensive("extract_archive", request))
+	assert.False(t, isExpensive("delete_directory", request))
+	assert.False(t, isExpensive("read_file", request))
+
+	request.Params.Arguments["recursive"] = true
+	assert.True(t, isExpensive("delete_directory", request))
+}
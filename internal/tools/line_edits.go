@@ -0,0 +1,182 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// Line edit actions
+const (
+	lineReplace = "replace"
+	lineInsert  = "insert"
+	lineDelete  = "delete"
+)
+
+// lineSpan is a validated edit as the range of lines it replaces. An insert
+// replaces the empty range after the line it inserts after (end == start-1).
+type lineSpan struct {
+	start, end int
+	lines      []string
+}
+
+// detectLineEnding returns the terminator of the first line of content, or
+// "\n" if content has a single line
+func detectLineEnding(content string) string {
+	if i := strings.IndexByte(content, '\n'); i > 0 && content[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// contentLines splits the content of an edit into lines ending with eol. A
+// final line break does not start another line.
+func contentLines(content, eol string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.TrimSuffix(content, "\n")
+
+	lines := strings.Split(content, "\n")
+	for i := range lines {
+		lines[i] += eol
+	}
+	return lines
+}
+
+// lineSpans validates edits against a file of total lines and returns them as
+// spans sorted by position
+func lineSpans(edits []LineEdit, total int, eol string) ([]lineSpan, error) {
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("%w: no edits", errors.ErrInvalidArgument)
+	}
+
+	spans := make([]lineSpan, 0, len(edits))
+	for _, edit := range edits {
+		var span lineSpan
+		switch edit.Action {
+		case "", lineReplace, lineDelete:
+			if edit.StartLine < 1 || edit.EndLine < edit.StartLine || edit.EndLine > total {
+				return nil, fmt.Errorf("%w: lines %d-%d are not within the file (%d lines)", errors.ErrInvalidArgument, edit.StartLine, edit.EndLine, total)
+			}
+			span = lineSpan{start: edit.StartLine, end: edit.EndLine}
+			if edit.Action != lineDelete {
+				span.lines = contentLines(edit.Content, eol)
+			}
+		case lineInsert:
+			after := edit.StartLine
+			if after == -1 {
+				after = total
+			}
+			if after < 0 || after > total {
+				return nil, fmt.Errorf("%w: cannot insert after line %d (%d lines)", errors.ErrInvalidArgument, edit.StartLine, total)
+			}
+			span = lineSpan{start: after + 1, end: after, lines: contentLines(edit.Content, eol)}
+		default:
+			return nil, fmt.Errorf("%w: unknown line edit action %q", errors.ErrInvalidArgument, edit.Action)
+		}
+		spans = append(spans, span)
+	}
+
+	// Inserts at the same position keep their order
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end < spans[j].end
+	})
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start <= spans[i-1].end {
+			return nil, fmt.Errorf("%w: line edits overlap at line %d", errors.ErrInvalidArgument, spans[i].start)
+		}
+	}
+
+	return spans, nil
+}
+
+// applyLineEdits applies edits to content from the bottom of the file up, so
+// that every edit's line numbers refer to the original content. New lines use
+// the file's line ending and the file keeps or lacks a final line break as
+// before; an empty file gets one.
+func applyLineEdits(content string, edits []LineEdit) (string, error) {
+	eol := detectLineEnding(content)
+	lines := splitLines(content)
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+
+	spans, err := lineSpans(edits, len(lines), eol)
+	if err != nil {
+		return "", err
+	}
+
+	// The old last line may no longer be last
+	if n := len(lines); n > 0 && !strings.HasSuffix(lines[n-1], "\n") {
+		lines[n-1] += eol
+	}
+
+	for i := len(spans) - 1; i >= 0; i-- {
+		span := spans[i]
+		tail := append(append([]string{}, span.lines...), lines[span.end:]...)
+		lines = append(lines[:span.start-1], tail...)
+	}
+
+	if n := len(lines); n > 0 && !trailingNewline {
+		lines[n-1] = strings.TrimSuffix(strings.TrimSuffix(lines[n-1], "\n"), "\r")
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// prepareEditLines validates line edits and computes the edited file content
+func (s *FileService) prepareEditLines(path string, edits []LineEdit) (*editRequest, error) {
+	// Validate path
+	validPath, err := s.validator.ValidateWritePath(path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("edit_lines", path, err)
+	}
+
+	fileContent, format, oldSize, err := readForEdit(s.fsys, "edit_lines", path, validPath)
+	if err != nil {
+		return nil, err
+	}
+
+	newContent, err := applyLineEdits(fileContent, edits)
+	if err != nil {
+		return nil, errors.NewFileSystemError("edit_lines", path, err)
+	}
+
+	writeSize := 0
+	for _, edit := range edits {
+		writeSize += len(edit.Content)
+	}
+	return s.encodeEdit("edit_lines", path, validPath, fileContent, newContent, format.Encoding, oldSize, writeSize)
+}
+
+// EditLines applies several line edits to a file in one write. Inserts,
+// deletions and replacements may be mixed but must not overlap.
+func (s *FileService) EditLines(path string, edits []LineEdit) error {
+	req, err := s.prepareEditLines(path, edits)
+	if err != nil {
+		return err
+	}
+
+	if err := writeContent(s.fsys, req.validPath, string(req.data), false); err != nil {
+		return errors.NewFileSystemError("edit_lines", path, err)
+	}
+	s.commitUsage(req.change)
+
+	return nil
+}
+
+// PlanEditLines validates line edits and describes them, with a diff, without writing
+func (s *FileService) PlanEditLines(path string, edits []LineEdit) (*Change, error) {
+	req, err := s.prepareEditLines(path, edits)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWritable(s.fsys, req.validPath); err != nil {
+		return nil, errors.NewFileSystemError("edit_lines", path, err)
+	}
+
+	change := s.contentChange("edit_lines", req)
+	change.Description = fmt.Sprintf("Apply %d line edit(s) to %s", len(edits), req.validPath)
+	return change, nil
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyLineEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edits   []LineEdit
+		want    string
+	}{
+		{
+			name:    "insert at start",
+			content: "a\nb\n",
+			edits:   []LineEdit{{Action: "insert", StartLine: 0, Content: "x"}},
+			want:    "x\na\nb\n",
+		},
+		{
+			name:    "insert at end",
+			content: "a\nb\n",
+			edits:   []LineEdit{{Action: "insert", StartLine: -1, Content: "x\ny\n"}},
+			want:    "a\nb\nx\ny\n",
+		},
+		{
+			name:    "insert at end without final newline",
+			content: "a\nb",
+			edits:   []LineEdit{{Action: "insert", StartLine: 2, Content: "x"}},
+			want:    "a\nb\nx",
+		},
+		{
+			name:    "insert into empty file",
+			content: "",
+			edits:   []LineEdit{{Action: "insert", StartLine: -1, Content: "x"}},
+			want:    "x\n",
+		},
+		{
+			name:    "delete",
+			content: "a\nb\nc\n",
+			edits:   []LineEdit{{Action: "delete", StartLine: 2, EndLine: 2}},
+			want:    "a\nc\n",
+		},
+		{
+			name:    "delete last line without final newline",
+			content: "a\nb\nc",
+			edits:   []LineEdit{{Action: "delete", StartLine: 3, EndLine: 3}},
+			want:    "a\nb",
+		},
+		{
+			name:    "delete everything",
+			content: "a\nb\n",
+			edits:   []LineEdit{{Action: "delete", StartLine: 1, EndLine: 2}},
+			want:    "",
+		},
+		{
+			name:    "preserves CRLF",
+			content: "a\r\nb\r\n",
+			edits:   []LineEdit{{StartLine: 1, EndLine: 1, Content: "x\ny"}},
+			want:    "x\r\ny\r\nb\r\n",
+		},
+		{
+			name:    "multiple ranges refer to the original lines",
+			content: "1\n2\n3\n4\n5\n",
+			edits: []LineEdit{
+				{Action: "delete", StartLine: 1, EndLine: 1},
+				{StartLine: 3, EndLine: 3, Content: "three\nTHREE"},
+				{Action: "insert", StartLine: 3, Content: "after 3"},
+				{Action: "insert", StartLine: -1, Content: "end"},
+			},
+			want: "2\nthree\nTHREE\nafter 3\n4\n5\nend\n",
+		},
+		{
+			name:    "inserts at the same line keep their order",
+			content: "a\n",
+			edits: []LineEdit{
+				{Action: "insert", StartLine: 1, Content: "x"},
+				{Action: "insert", StartLine: 1, Content: "y"},
+			},
+			want: "a\nx\ny\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyLineEdits(tt.content, tt.edits)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApplyLineEdits_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits []LineEdit
+	}{
+		{"no edits", nil},
+		{"past the end", []LineEdit{{StartLine: 3, EndLine: 4}}},
+		{"reversed range", []LineEdit{{Action: "delete", StartLine: 2, EndLine: 1}}},
+		{"insert past the end", []LineEdit{{Action: "insert", StartLine: 4}}},
+		{"insert before the start", []LineEdit{{Action: "insert", StartLine: -2}}},
+		{"unknown action", []LineEdit{{Action: "move", StartLine: 1, EndLine: 1}}},
+		{"overlap", []LineEdit{{StartLine: 1, EndLine: 2}, {Action: "delete", StartLine: 2, EndLine: 3}}},
+		{"insert inside a replaced range", []LineEdit{{StartLine: 1, EndLine: 3}, {Action: "insert", StartLine: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyLineEdits("a\nb\nc\n", tt.edits)
+			assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+		})
+	}
+}
+
+func TestServiceProvider_LineTools(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a\r\nb\r\nc"), 0644))
+	provider := NewServiceProvider([]string{tmpDir})
+	ctx := context.Background()
+
+	_, err := callTool(provider.handleInsertLines, ctx, map[string]interface{}{
+		"path": path, "content": "x", "line": float64(1), "position": "before",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "x\r\na\r\nb\r\nc", readString(t, path))
+
+	_, err = callTool(provider.handleInsertLines, ctx, map[string]interface{}{
+		"path": path, "content": "end", "line": float64(-1),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "x\r\na\r\nb\r\nc\r\nend", readString(t, path))
+
+	_, err = callTool(provider.handleDeleteLines, ctx, map[string]interface{}{
+		"path": path, "start_line": float64(2), "end_line": float64(3),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "x\r\nc\r\nend", readString(t, path))
+
+	result, err := callTool(provider.handleEditLines, ctx, map[string]interface{}{
+		"path":    path,
+		"edits":   `[{"start_line": 1, "end_line": 1, "content": "X"}, {"action": "delete", "start_line": 3, "end_line": 3}]`,
+		"dry_run": true,
+	})
+	require.NoError(t, err)
+	change := decodeDryRun(t, result)
+	assert.Equal(t, "edit_lines", change.Operation)
+	assert.Equal(t, "x\r\nc\r\nend", readString(t, path))
+
+	_, err = callTool(provider.handleEditLines, ctx, map[string]interface{}{
+		"path":  path,
+		"edits": `[{"start_line": 1, "end_line": 1, "content": "X"}, {"action": "delete", "start_line": 3, "end_line": 3}]`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "X\r\nc", readString(t, path))
+
+	_, err = callTool(provider.handleInsertLines, ctx, map[string]interface{}{
+		"path": path, "content": "x", "line": float64(1), "position": "middle",
+	})
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+
+	_, err = callTool(provider.handleDeleteLines, ctx, map[string]interface{}{
+		"path": filepath.Join(tmpDir, "missing.txt"), "start_line": float64(1), "end_line": float64(1),
+	})
+	assert.ErrorIs(t, err, errors.ErrFileNotFound)
+}
@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// lineNumberFormat prefixes a line with its 1-indexed number. The number is
+// right-aligned in six columns and separated from the line by a tab.
+const lineNumberFormat = "%6d\t"
+
+// lineOptions selects how file content is returned by the read tools
+type lineOptions struct {
+	numbers   bool
+	startLine int // First line to return, 1-indexed
+	endLine   int // Last line to return, inclusive; 0 for the end of the file
+}
+
+// ranged reports whether the options select part of the file
+func (o lineOptions) ranged() bool {
+	return o.startLine > 1 || o.endLine > 0
+}
+
+// enabled reports whether the content needs to be split into lines
+func (o lineOptions) enabled() bool {
+	return o.numbers || o.ranged()
+}
+
+// parseLineOptions reads the line_numbers, start_line and end_line arguments
+func parseLineOptions(tool string, args map[string]interface{}) (lineOptions, error) {
+	opts := lineOptions{startLine: 1}
+	opts.numbers, _ = args["line_numbers"].(bool)
+
+	if start, ok := args["start_line"].(float64); ok {
+		opts.startLine = int(start)
+	}
+	if end, ok := args["end_line"].(float64); ok {
+		opts.endLine = int(end)
+	}
+
+	if opts.startLine < 1 || opts.endLine < 0 || (opts.endLine > 0 && opts.endLine < opts.startLine) {
+		return opts, errors.NewFileSystemError(tool, "", fmt.Errorf("%w: invalid line range %d-%d", errors.ErrInvalidArgument, opts.startLine, opts.endLine))
+	}
+	return opts, nil
+}
+
+// selectLines returns lines startLine to endLine, 1-indexed and inclusive. An
+// endLine of 0 or past the last line selects up to the last line.
+func selectLines(lines []string, startLine, endLine int) ([]string, error) {
+	total := len(lines)
+	if endLine == 0 || endLine > total {
+		endLine = total
+	}
+	if startLine > total {
+		if total == 0 && startLine == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: start_line %d is past the end of the file (%d lines)", errors.ErrInvalidArgument, startLine, total)
+	}
+
+	return lines[startLine-1 : endLine], nil
+}
+
+// numberLines joins lines, prefixing each with its number starting from first
+func numberLines(lines []string, first int) string {
+	var b strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&b, lineNumberFormat, first+i)
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// formatLines applies the line options to file content, redacting it line by
+// line so that line numbers stay accurate. Lines keep their terminators and
+// are numbered as edit_file numbers them. It returns the formatted content, the
+// number of redactions and the total number of lines.
+func formatLines(content string, opts lineOptions, redactor *Redactor) (string, int, int, error) {
+	// Redact the whole file so that a range starting inside a private key
+	// block is still masked
+	lines, redactions := redactor.RedactLines(splitLines(content))
+	total := len(lines)
+
+	lines, err := selectLines(lines, opts.startLine, opts.endLine)
+	if err != nil {
+		return "", 0, total, err
+	}
+
+	if opts.numbers {
+		return numberLines(lines, opts.startLine), redactions, total, nil
+	}
+	return strings.Join(lines, ""), redactions, total, nil
+}
+
+// withLineRangeReport appends the shown line range to a result for a range read
+func withLineRangeReport(result *mcp.CallToolResult, opts lineOptions, total int) *mcp.CallToolResult {
+	if !opts.ranged() {
+		return result
+	}
+
+	end := opts.endLine
+	if end == 0 || end > total {
+		end = total
+	}
+	result.Content = append(result.Content, mcp.TextContent{
+		Type: "text",
+		Text: fmt.Sprintf("Showing lines %d-%d of %d", opts.startLine, end, total),
+	})
+	return result
+}
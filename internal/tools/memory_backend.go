@@ -0,0 +1,589 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSymlinkHops bounds how many symbolic links a path may traverse
+const maxSymlinkHops = 40
+
+// MemoryBackend stores files in memory. It keeps nothing across restarts,
+// which suits scratch directories and hermetic tests.
+type MemoryBackend struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode // Keyed by clean absolute path
+	temp  int                 // Counter naming temporary files
+}
+
+// memNode is a file, directory or symbolic link of a MemoryBackend
+type memNode struct {
+	mode    fs.FileMode
+	data    []byte
+	target  string // Target of a symbolic link
+	modTime time.Time
+}
+
+// NewMemoryBackend creates an in-memory backend holding the empty directories
+// roots and their parents
+func NewMemoryBackend(roots ...string) *MemoryBackend {
+	m := &MemoryBackend{nodes: make(map[string]*memNode)}
+	for _, root := range roots {
+		for dir := filepath.Clean(root); ; dir = filepath.Dir(dir) {
+			if _, ok := m.nodes[dir]; !ok {
+				m.nodes[dir] = &memNode{mode: fs.ModeDir | 0755, modTime: time.Now()}
+			}
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+	return m
+}
+
+// resolve returns the clean path name refers to, following symbolic links in
+// its parent directories and, when follow is set, in its last element
+func (m *MemoryBackend) resolve(op, name string, follow bool) (string, error) {
+	path, err := m.resolveHops(filepath.Clean(name), follow, 0)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return path, nil
+}
+
+func (m *MemoryBackend) resolveHops(path string, follow bool, hops int) (string, error) {
+	if hops > maxSymlinkHops {
+		return "", fmt.Errorf("too many levels of symbolic links")
+	}
+
+	dir, base := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	if base != "" && dir != path {
+		resolved, err := m.resolveHops(dir, true, hops)
+		if err != nil {
+			return "", err
+		}
+		if node, ok := m.nodes[resolved]; ok && !node.mode.IsDir() {
+			return "", fmt.Errorf("not a directory")
+		}
+		path = filepath.Join(resolved, base)
+	}
+
+	node, ok := m.nodes[path]
+	if !ok || !follow || node.mode&fs.ModeSymlink == 0 {
+		return path, nil
+	}
+	target := node.target
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return m.resolveHops(filepath.Clean(target), true, hops+1)
+}
+
+// lookup returns the node name refers to
+func (m *MemoryBackend) lookup(op, name string, follow bool) (string, *memNode, error) {
+	path, err := m.resolve(op, name, follow)
+	if err != nil {
+		return "", nil, err
+	}
+	node, ok := m.nodes[path]
+	if !ok {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return path, node, nil
+}
+
+// parentDir checks that the parent directory of path exists
+func (m *MemoryBackend) parentDir(op, name, path string) error {
+	parent, ok := m.nodes[filepath.Dir(path)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return nil
+}
+
+// Open opens a file for reading
+func (m *MemoryBackend) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file with the os.OpenFile flags
+func (m *MemoryBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, err := m.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	node, ok := m.nodes[path]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if err := m.parentDir("open", name, path); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[path] = node
+	case node.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if writable && flag&os.O_TRUNC != 0 {
+		node.data = nil
+		node.modTime = time.Now()
+	}
+	return &memFile{backend: m, node: node, name: name, path: path, flag: flag}, nil
+}
+
+// CreateTemp creates a new file in dir named from pattern, replacing its last
+// "*" with a counter
+func (m *MemoryBackend) CreateTemp(dir, pattern string) (File, error) {
+	for {
+		m.mu.Lock()
+		m.temp++
+		n := m.temp
+		m.mu.Unlock()
+
+		name := pattern + fmt.Sprint(n)
+		if i := strings.LastIndex(pattern, "*"); i >= 0 {
+			name = pattern[:i] + fmt.Sprint(n) + pattern[i+1:]
+		}
+		file, err := m.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil || !os.IsExist(err) {
+			return file, err
+		}
+	}
+}
+
+// Stat describes a file, following symbolic links
+func (m *MemoryBackend) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	path, node, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(path), nil
+}
+
+// Lstat describes a file without following a final symbolic link
+func (m *MemoryBackend) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	path, node, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(path), nil
+}
+
+// ReadDir lists a directory sorted by name
+func (m *MemoryBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	path, node, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+
+	var entries []fs.DirEntry
+	for _, child := range m.children(path) {
+		entries = append(entries, fs.FileInfoToDirEntry(m.nodes[child].info(child)))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return compareNames(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// children returns the paths directly inside dir
+func (m *MemoryBackend) children(dir string) []string {
+	var paths []string
+	for path := range m.nodes {
+		if path != dir && filepath.Dir(path) == dir {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// Rename moves a file or directory with everything inside it
+func (m *MemoryBackend) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, node, err := m.lookup("rename", oldpath, false)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*fs.PathError).Err}
+	}
+	to, err := m.resolve("rename", newpath, false)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*fs.PathError).Err}
+	}
+	if from == to {
+		return nil
+	}
+	if err := m.parentDir("rename", newpath, to); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err.(*fs.PathError).Err}
+	}
+	if within(from, to) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fmt.Errorf("invalid argument")}
+	}
+	if existing, ok := m.nodes[to]; ok {
+		switch {
+		case existing.mode.IsDir() && !node.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fmt.Errorf("file exists")}
+		case existing.mode.IsDir() && len(m.children(to)) > 0:
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fmt.Errorf("directory not empty")}
+		case !existing.mode.IsDir() && node.mode.IsDir():
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fmt.Errorf("not a directory")}
+		}
+	}
+
+	moved := make(map[string]*memNode)
+	for path, n := range m.nodes {
+		if within(from, path) {
+			rel, _ := filepath.Rel(from, path)
+			moved[filepath.Join(to, rel)] = n
+			delete(m.nodes, path)
+		}
+	}
+	for path, n := range moved {
+		m.nodes[path] = n
+	}
+	return nil
+}
+
+// Remove deletes a file or an empty directory
+func (m *MemoryBackend) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, node, err := m.lookup("remove", name, false)
+	if err != nil {
+		return err
+	}
+	if node.mode.IsDir() && len(m.children(path)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("directory not empty")}
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+// RemoveAll deletes a path with everything inside it; a missing path is not an error
+func (m *MemoryBackend) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, err := m.resolve("unlinkat", name, false)
+	if err != nil {
+		return nil
+	}
+	for p := range m.nodes {
+		if within(path, p) {
+			delete(m.nodes, p)
+		}
+	}
+	return nil
+}
+
+// Mkdir creates a directory
+func (m *MemoryBackend) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdir(name, perm)
+}
+
+func (m *MemoryBackend) mkdir(name string, perm fs.FileMode) error {
+	path, err := m.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[path]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := m.parentDir("mkdir", name, path); err != nil {
+		return err
+	}
+	m.nodes[path] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+// MkdirAll creates a directory with any missing parents
+func (m *MemoryBackend) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, err := m.resolve("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	if node, ok := m.nodes[path]; ok {
+		if node.mode.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, ok := m.nodes[dir]; ok || filepath.Dir(dir) == dir {
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := m.mkdir(missing[i], perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chmod changes the permission bits of a file
+func (m *MemoryBackend) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, node, err := m.lookup("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode.Type() | mode.Perm()
+	return nil
+}
+
+// Link creates newname as a hard link to the file oldname
+func (m *MemoryBackend) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, node, err := m.lookup("link", oldname, false)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*fs.PathError).Err}
+	}
+	if node.mode.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fmt.Errorf("operation not permitted")}
+	}
+	path, err := m.resolve("link", newname, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[path]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := m.parentDir("link", newname, path); err != nil {
+		return err
+	}
+	m.nodes[path] = node
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname
+func (m *MemoryBackend) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, err := m.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.nodes[path]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := m.parentDir("symlink", newname, path); err != nil {
+		return err
+	}
+	m.nodes[path] = &memNode{mode: fs.ModeSymlink | 0777, target: oldname, modTime: time.Now()}
+	return nil
+}
+
+// Readlink returns the target of a symbolic link
+func (m *MemoryBackend) Readlink(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, node, err := m.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fmt.Errorf("invalid argument")}
+	}
+	return node.target, nil
+}
+
+// EvalSymlinks returns the path name refers to after following symbolic links
+func (m *MemoryBackend) EvalSymlinks(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	path, _, err := m.lookup("lstat", name, true)
+	return path, err
+}
+
+// Writable reports whether the owner may write the file at name
+func (m *MemoryBackend) Writable(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, node, err := m.lookup("stat", name, true)
+	return err == nil && node.mode.Perm()&0200 != 0
+}
+
+// info describes the node at path
+func (n *memNode) info(path string) fs.FileInfo {
+	return memFileInfo{name: filepath.Base(path), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// memFileInfo describes a file of a MemoryBackend
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memFileInfo) Sys() any           { return nil }
+
+// memFile is an open file of a MemoryBackend
+type memFile struct {
+	backend *MemoryBackend
+	node    *memNode
+	name    string
+	path    string
+	flag    int
+	offset  int64
+	closed  bool
+}
+
+func (f *memFile) Name() string { return f.name }
+
+// Stat describes the open file
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.backend.mu.RLock()
+	defer f.backend.mu.RUnlock()
+	return f.node.info(f.path), nil
+}
+
+// Read reads from the current offset
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt reads from off without moving the offset
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", os.O_WRONLY); err != nil {
+		return 0, err
+	}
+	f.backend.mu.RLock()
+	defer f.backend.mu.RUnlock()
+
+	if f.node.mode.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fmt.Errorf("is a directory")}
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes at the current offset, or at the end of files opened for appending
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fmt.Errorf("bad file descriptor")}
+	}
+	if err := f.check("write", 0); err != nil {
+		return 0, err
+	}
+	f.backend.mu.Lock()
+	defer f.backend.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset = end
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+// Seek moves the offset
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek", 0); err != nil {
+		return 0, err
+	}
+	f.backend.mu.RLock()
+	size := int64(len(f.node.data))
+	f.backend.mu.RUnlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fmt.Errorf("invalid argument")}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close closes the file
+func (f *memFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// check fails if the file is closed or was opened with the denied access mode
+func (f *memFile) check(op string, denied int) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if denied != 0 && f.flag&(os.O_WRONLY|os.O_RDWR) == denied {
+		return &fs.PathError{Op: op, Path: f.name, Err: fmt.Errorf("bad file descriptor")}
+	}
+	return nil
+}
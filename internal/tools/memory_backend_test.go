@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeMemoryFile creates a file with content in a MemoryBackend
+func writeMemoryFile(t *testing.T, fsys *MemoryBackend, name, content string) {
+	file, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	require.NoError(t, err)
+	_, err = io.WriteString(file, content)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+func TestMemoryBackend_OpenFile(t *testing.T) {
+	root := "/work"
+	fsys := NewMemoryBackend(root)
+	name := filepath.Join(root, "a.txt")
+
+	_, err := fsys.Open(name)
+	assert.True(t, os.IsNotExist(err))
+	_, err = fsys.OpenFile(filepath.Join(root, "missing", "a.txt"), os.O_WRONLY|os.O_CREATE, 0644)
+	assert.True(t, os.IsNotExist(err))
+
+	writeMemoryFile(t, fsys, name, "hello")
+	_, err = fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	assert.True(t, os.IsExist(err))
+
+	file, err := fsys.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = io.WriteString(file, " world")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	data, err := readFile(fsys, name)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	file, err = fsys.Open(name)
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	n, err := file.ReadAt(buf, 6)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(buf[:n]))
+	_, err = io.WriteString(file, "!")
+	assert.Error(t, err, "file is open read-only")
+	require.NoError(t, file.Close())
+	_, err = file.Read(buf)
+	assert.Error(t, err, "file is closed")
+
+	writeMemoryFile(t, fsys, name, "short")
+	info, err := fsys.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size())
+	assert.Equal(t, os.FileMode(0644), info.Mode())
+
+	_, err = fsys.OpenFile(root, os.O_WRONLY, 0)
+	assert.Error(t, err)
+}
+
+func TestMemoryBackend_Directories(t *testing.T) {
+	root := "/work"
+	fsys := NewMemoryBackend(root)
+
+	info, err := fsys.Stat("/")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir(), "roots are created with their parents")
+
+	require.NoError(t, fsys.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	assert.True(t, os.IsExist(fsys.Mkdir(filepath.Join(root, "a"), 0755)))
+	writeMemoryFile(t, fsys, filepath.Join(root, "a", "b", "c.txt"), "c")
+
+	assert.Error(t, fsys.Remove(filepath.Join(root, "a")), "directory not empty")
+
+	require.NoError(t, fsys.Rename(filepath.Join(root, "a"), filepath.Join(root, "moved")))
+	data, err := readFile(fsys, filepath.Join(root, "moved", "b", "c.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "c", string(data))
+	_, err = fsys.Stat(filepath.Join(root, "a"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Error(t, fsys.Rename(filepath.Join(root, "moved"), filepath.Join(root, "moved", "b", "inside")))
+
+	entries, err := fsys.ReadDir(filepath.Join(root, "moved"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b", entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+
+	require.NoError(t, fsys.RemoveAll(filepath.Join(root, "moved")))
+	require.NoError(t, fsys.RemoveAll(filepath.Join(root, "moved")))
+	entries, err = fsys.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestMemoryBackend_Links(t *testing.T) {
+	root := "/work"
+	fsys := NewMemoryBackend(root)
+	target := filepath.Join(root, "target.txt")
+	writeMemoryFile(t, fsys, target, "shared")
+
+	// Hard links share their content
+	hard := filepath.Join(root, "hard.txt")
+	require.NoError(t, fsys.Link(target, hard))
+	writeMemoryFile(t, fsys, hard, "changed")
+	data, err := readFile(fsys, target)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", string(data))
+	assert.Error(t, fsys.Link(root, filepath.Join(root, "dir-link")))
+
+	// Symbolic links are followed, except by Lstat and Readlink
+	link := filepath.Join(root, "link.txt")
+	require.NoError(t, fsys.Symlink("target.txt", link))
+	data, err = readFile(fsys, link)
+	require.NoError(t, err)
+	assert.Equal(t, "changed", string(data))
+
+	info, err := fsys.Lstat(link)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+	dest, err := fsys.Readlink(link)
+	require.NoError(t, err)
+	assert.Equal(t, "target.txt", dest)
+	resolved, err := fsys.EvalSymlinks(link)
+	require.NoError(t, err)
+	assert.Equal(t, target, resolved)
+
+	loop := filepath.Join(root, "loop")
+	require.NoError(t, fsys.Symlink(loop, loop))
+	_, err = fsys.Stat(loop)
+	assert.Error(t, err)
+}
+
+func TestMemoryBackend_ChmodAndTemp(t *testing.T) {
+	root := "/work"
+	fsys := NewMemoryBackend(root)
+	name := filepath.Join(root, "a.txt")
+	writeMemoryFile(t, fsys, name, "a")
+
+	assert.True(t, fsys.Writable(name))
+	require.NoError(t, fsys.Chmod(name, 0444))
+	assert.False(t, fsys.Writable(name))
+	assert.False(t, fsys.Writable(filepath.Join(root, "missing.txt")))
+
+	first, err := fsys.CreateTemp(root, ".a.txt.*.tmp")
+	require.NoError(t, err)
+	second, err := fsys.CreateTemp(root, ".a.txt.*.tmp")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Name(), second.Name())
+	assert.Regexp(t, `^\.a\.txt\.\d+\.tmp$`, filepath.Base(first.Name()))
+	require.NoError(t, first.Close())
+	require.NoError(t, second.Close())
+}
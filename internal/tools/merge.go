@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict markers written around the regions a merge cannot reconcile
+const (
+	conflictOurs   = "<<<<<<<"
+	conflictSplit  = "======="
+	conflictTheirs = ">>>>>>>"
+)
+
+// MergeConflict is a region changed differently on both sides of a merge.
+// Line numbers are 1-based; a region that adds lines on one side only is
+// located by the line it is inserted before.
+type MergeConflict struct {
+	StartLine  int    `json:"start_line"` // First line of the conflict markers in the merged content
+	EndLine    int    `json:"end_line"`   // Last line of the conflict markers in the merged content
+	BaseLine   int    `json:"base_line"`
+	OursLine   int    `json:"ours_line"`
+	TheirsLine int    `json:"theirs_line"`
+	BaseText   string `json:"base"`
+	OursText   string `json:"ours"`
+	TheirsText string `json:"theirs"`
+}
+
+// MergeResult is the outcome of a three-way merge
+type MergeResult struct {
+	Content   string          `json:"content,omitempty"` // Left out when written to a file
+	Clean     bool            `json:"clean"`
+	Conflicts []MergeConflict `json:"conflicts,omitempty"`
+}
+
+// mergeResponse is the result of the merge_files tool
+type mergeResponse struct {
+	*MergeResult
+	Path   string  `json:"path,omitempty"` // Set when the merged content was written
+	DryRun bool    `json:"dry_run,omitempty"`
+	Change *Change `json:"change,omitempty"`
+}
+
+// merge3 merges the changes made to base in ours and in theirs, line by line.
+// Regions changed the same way on both sides are merged once; regions changed
+// differently are written between conflict markers labelled oursName and
+// theirsName.
+func merge3(base, ours, theirs, oursName, theirsName string) *MergeResult {
+	a, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	matchOurs := matchLines(a, o)
+	matchTheirs := matchLines(a, t)
+
+	var b strings.Builder
+	result := &MergeResult{Clean: true}
+	line := 1 // Next line of the merged content
+	emit := func(lines []string) {
+		for _, l := range lines {
+			b.WriteString(l)
+		}
+		line += len(lines)
+	}
+
+	i, j, k := 0, 0, 0
+	for {
+		// Lines kept on both sides
+		if i < len(a) && matchOurs[i] == j && matchTheirs[i] == k {
+			emit(a[i : i+1])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+
+		// The changed region ends at the next line kept on both sides
+		next := i
+		for next < len(a) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		endOurs, endTheirs := len(o), len(t)
+		if next < len(a) {
+			endOurs, endTheirs = matchOurs[next], matchTheirs[next]
+		}
+
+		baseChunk, oursChunk, theirsChunk := a[i:next], o[j:endOurs], t[k:endTheirs]
+		switch {
+		case slices.Equal(oursChunk, baseChunk):
+			emit(theirsChunk)
+		case slices.Equal(theirsChunk, baseChunk), slices.Equal(oursChunk, theirsChunk):
+			emit(oursChunk)
+		default:
+			conflict := MergeConflict{
+				StartLine:  line,
+				BaseLine:   i + 1,
+				OursLine:   j + 1,
+				TheirsLine: k + 1,
+				BaseText:   strings.Join(baseChunk, ""),
+				OursText:   strings.Join(oursChunk, ""),
+				TheirsText: strings.Join(theirsChunk, ""),
+			}
+			emit([]string{conflictOurs + " " + oursName + "\n"})
+			emit(terminated(oursChunk))
+			emit([]string{conflictSplit + "\n"})
+			emit(terminated(theirsChunk))
+			emit([]string{conflictTheirs + " " + theirsName + "\n"})
+			conflict.EndLine = line - 1
+			result.Conflicts = append(result.Conflicts, conflict)
+			result.Clean = false
+		}
+
+		if next == len(a) {
+			break
+		}
+		i, j, k = next, endOurs, endTheirs
+	}
+
+	result.Content = b.String()
+	return result
+}
+
+// matchLines diffs a against b and returns, for each line of a, the index of
+// the line of b it is kept as, or -1 if it is removed
+func matchLines(a, b []string) []int {
+	match := make([]int, len(a))
+	i, j := 0, 0
+	for _, op := range diffLines(a, b) {
+		switch op.kind {
+		case diffEqual:
+			match[i] = j
+			i++
+			j++
+		case diffDelete:
+			match[i] = -1
+			i++
+		case diffInsert:
+			j++
+		}
+	}
+	return match
+}
+
+// terminated returns lines with a line terminator added to the last one if it
+// has none, so that a conflict marker can follow
+func terminated(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	out := slices.Clone(lines)
+	out[len(out)-1] += "\n"
+	return out
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", "a\nb\n", "a\nb\n"},
+		{"ours only", "a\nb\nc\n", "a\nB\nc\n", "a\nb\nc\n", "a\nB\nc\n"},
+		{"theirs only", "a\nb\nc\n", "a\nb\nc\n", "a\nb\nC\n", "a\nb\nC\n"},
+		{"both sides, different regions", "a\nb\nc\nd\n", "A\nb\nc\nd\n", "a\nb\nc\nD\n", "A\nb\nc\nD\n"},
+		{"same change on both sides", "a\nb\n", "a\nX\n", "a\nX\n", "a\nX\n"},
+		{"insert and delete", "a\nb\nc\n", "a\nb\nnew\nc\n", "b\nc\n", "b\nnew\nc\n"},
+		{"empty base", "", "", "x\n", "x\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := merge3(tt.base, tt.ours, tt.theirs, "ours", "theirs")
+			assert.True(t, result.Clean)
+			assert.Empty(t, result.Conflicts)
+			assert.Equal(t, tt.want, result.Content)
+		})
+	}
+}
+
+func TestMerge3_Conflicts(t *testing.T) {
+	result := merge3("a\nb\nc\nd\n", "a\nours\nc\nD\n", "a\ntheirs\nc\nd\n", "left.txt", "right.txt")
+	assert.False(t, result.Clean)
+	assert.Equal(t, "a\n<<<<<<< left.txt\nours\n=======\ntheirs\n>>>>>>> right.txt\nc\nD\n", result.Content)
+	require.Len(t, result.Conflicts, 1)
+	assert.Equal(t, MergeConflict{
+		StartLine: 2, EndLine: 6,
+		BaseLine: 2, OursLine: 2, TheirsLine: 2,
+		BaseText: "b\n", OursText: "ours\n", TheirsText: "theirs\n",
+	}, result.Conflicts[0])
+
+	// Both sides append different lines, the last without a line terminator
+	result = merge3("a\n", "a\nx", "a\ny\n", "ours", "theirs")
+	require.Len(t, result.Conflicts, 1)
+	assert.Equal(t, "a\n<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n", result.Content)
+	assert.Equal(t, 2, result.Conflicts[0].BaseLine)
+	assert.Equal(t, "x", result.Conflicts[0].OursText)
+}
+
+func TestServiceProvider_HandleMergeFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	base, ours, theirs := filepath.Join(tmpDir, "base.txt"), filepath.Join(tmpDir, "ours.txt"), filepath.Join(tmpDir, "theirs.txt")
+	require.NoError(t, os.WriteFile(base, []byte("one\ntwo\nthree\n"), 0644))
+	require.NoError(t, os.WriteFile(ours, []byte("ONE\ntwo\nthree\n"), 0644))
+	require.NoError(t, os.WriteFile(theirs, []byte("one\ntwo\nTHREE\n"), 0644))
+	provider := NewServiceProvider([]string{tmpDir})
+
+	decode := func(t *testing.T, result *mcp.CallToolResult) mergeResponse {
+		t.Helper()
+		var response mergeResponse
+		require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response))
+		return response
+	}
+
+	t.Run("returns the merge", func(t *testing.T) {
+		result, err := callTool(provider.handleMergeFiles, context.Background(), map[string]interface{}{
+			"base": base, "ours": ours, "theirs_content": "one\ntwo\nthree\nfour\n",
+		})
+		require.NoError(t, err)
+		response := decode(t, result)
+		assert.True(t, response.Clean)
+		assert.Equal(t, "ONE\ntwo\nthree\nfour\n", response.Content)
+		assert.Empty(t, response.Path)
+	})
+
+	t.Run("writes the merge", func(t *testing.T) {
+		args := map[string]interface{}{"base": base, "ours": ours, "theirs": theirs, "output_path": ours, "dry_run": true}
+		result, err := callTool(provider.handleMergeFiles, context.Background(), args)
+		require.NoError(t, err)
+		response := decode(t, result)
+		assert.True(t, response.DryRun)
+		assert.Equal(t, "overwrite", response.Change.Action)
+		assertFileContent(t, ours, "ONE\ntwo\nthree\n")
+
+		delete(args, "dry_run")
+		result, err = callTool(provider.handleMergeFiles, context.Background(), args)
+		require.NoError(t, err)
+		response = decode(t, result)
+		assert.True(t, response.Clean)
+		assert.Equal(t, ours, response.Path)
+		assert.Empty(t, response.Content)
+		assertFileContent(t, ours, "ONE\ntwo\nTHREE\n")
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		output := filepath.Join(tmpDir, "merged.txt")
+		result, err := callTool(provider.handleMergeFiles, context.Background(), map[string]interface{}{
+			"base_content": "x\n", "ours_content": "y\n", "theirs_content": "z\n", "output_path": output,
+		})
+		require.NoError(t, err)
+		response := decode(t, result)
+		assert.False(t, response.Clean)
+		require.Len(t, response.Conflicts, 1)
+		assertFileContent(t, output, "<<<<<<< ours\ny\n=======\nz\n>>>>>>> theirs\n")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := callTool(provider.handleMergeFiles, context.Background(), map[string]interface{}{
+			"base": base, "ours": ours,
+		})
+		assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+
+		_, err = callTool(provider.handleMergeFiles, context.Background(), map[string]interface{}{
+			"base": base, "ours": ours, "theirs": filepath.Join(t.TempDir(), "outside.txt"),
+		})
+		assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+	})
+}
+
+// assertFileContent asserts that the file at path holds content
+func assertFileContent(t *testing.T, path, content string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
@@ -0,0 +1,1122 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// Names recording deletions in the upper layer of an overlay, as in OCI image
+// layers: .wh.<name> deletes name, and a directory holding .wh..wh..opq hides
+// everything the lower layer has inside it
+const (
+	whiteoutPrefix = ".wh."
+	opaqueMarker   = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// Actions of overlay changes
+const (
+	OverlayAdded    = "added"
+	OverlayModified = "modified"
+	OverlayDeleted  = "deleted"
+)
+
+// errLeavesOverlay refuses writes through symbolic links leading out of an overlay
+var errLeavesOverlay = fmt.Errorf("%w: symbolic link leads out of the overlay", errors.ErrInvalidOperation)
+
+// OverlayBackend presents a directory of the local filesystem, the lower
+// layer, as a copy-on-write sandbox that never modifies it. Files are copied
+// into the upper layer before they change and deletions are recorded there as
+// whiteouts, so reads see the directory with the changes applied until they
+// are committed to it or discarded.
+type OverlayBackend struct {
+	mu        sync.RWMutex // Held for writing while the layers change
+	root      string
+	lower     Backend
+	upper     Backend
+	upperRoot string // Directory of the upper layer mirroring root
+}
+
+// OverlayChange is a difference between an overlay and its lower layer
+type OverlayChange struct {
+	Path   string `json:"path"`   // Slash-separated, relative to the overlay's directory
+	Action string `json:"action"` // "added", "modified" or "deleted"
+	Type   string `json:"type"`   // "file", "directory" or "symlink"
+	Diff   string `json:"diff,omitempty"`
+	Binary bool   `json:"binary,omitempty"` // The contents differ but are not text
+}
+
+// NewOverlayBackend creates an overlay of root keeping its changes in the
+// directory upperRoot of upper
+func NewOverlayBackend(root string, upper Backend, upperRoot string) *OverlayBackend {
+	return &OverlayBackend{
+		root:      filepath.Clean(root),
+		lower:     OSBackend{},
+		upper:     upper,
+		upperRoot: filepath.Clean(upperRoot),
+	}
+}
+
+// Root returns the directory the overlay presents
+func (o *OverlayBackend) Root() string {
+	return o.root
+}
+
+// upperPath returns where the upper layer stores the path p of the overlay
+func (o *OverlayBackend) upperPath(p string) string {
+	rel, _ := filepath.Rel(o.root, p)
+	return filepath.Join(o.upperRoot, rel)
+}
+
+// inUpper reports whether the upper layer has an entry at its own path up
+func (o *OverlayBackend) inUpper(up string) bool {
+	_, err := o.upper.Lstat(up)
+	return err == nil
+}
+
+// reserved reports whether p is named like a whiteout
+func (o *OverlayBackend) reserved(p string) bool {
+	return p != o.root && strings.HasPrefix(filepath.Base(p), whiteoutPrefix)
+}
+
+// hidden reports whether the upper layer hides the lower layer's entry at p:
+// p or a directory above it was deleted or replaced
+func (o *OverlayBackend) hidden(p string) bool {
+	for ; p != o.root && within(o.root, p); p = filepath.Dir(p) {
+		parent := o.upperPath(filepath.Dir(p))
+		info, err := o.upper.Lstat(parent)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() || o.inUpper(filepath.Join(parent, opaqueMarker)) || o.inUpper(filepath.Join(parent, whiteoutPrefix+filepath.Base(p))) {
+			return true
+		}
+	}
+	return false
+}
+
+// inLower reports whether the lower layer has an entry at p that nothing but
+// a whiteout of p itself hides
+func (o *OverlayBackend) inLower(p string) bool {
+	if _, err := o.lower.Lstat(p); err != nil {
+		return false
+	}
+	if p == o.root {
+		return true
+	}
+	parent := filepath.Dir(p)
+	if o.hidden(parent) {
+		return false
+	}
+	info, err := o.upper.Lstat(o.upperPath(parent))
+	return err != nil || info.IsDir() && !o.inUpper(filepath.Join(o.upperPath(parent), opaqueMarker))
+}
+
+// lstat describes the entry at the resolved path p of the merged layers
+func (o *OverlayBackend) lstat(p string) (fs.FileInfo, error) {
+	if o.reserved(p) {
+		return nil, fs.ErrNotExist
+	}
+	if info, err := o.upper.Lstat(o.upperPath(p)); err == nil {
+		if p == o.root {
+			return renamedInfo{info, filepath.Base(p)}, nil
+		}
+		return info, nil
+	}
+	if o.hidden(p) {
+		return nil, fs.ErrNotExist
+	}
+	return o.lower.Lstat(p)
+}
+
+// readlink returns the target of the symbolic link at the resolved path p
+func (o *OverlayBackend) readlink(p string) (string, error) {
+	if up := o.upperPath(p); o.inUpper(up) {
+		return o.upper.Readlink(up)
+	}
+	return o.lower.Readlink(p)
+}
+
+// resolve returns the path name refers to, following symbolic links in its
+// parent directories and, when follow is set, in its last element. outside is
+// set when a link leads out of the overlay, leaving the rest of the path to
+// the local filesystem.
+func (o *OverlayBackend) resolve(op, name string, follow bool) (path string, outside bool, err error) {
+	path, err = o.resolveHops(filepath.Clean(name), follow, 0)
+	if err != nil {
+		return "", false, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return path, !within(o.root, path), nil
+}
+
+func (o *OverlayBackend) resolveHops(path string, follow bool, hops int) (string, error) {
+	if hops > maxSymlinkHops {
+		return "", fmt.Errorf("too many levels of symbolic links")
+	}
+	if !within(o.root, path) || path == o.root {
+		return path, nil
+	}
+
+	dir, base := filepath.Split(path)
+	resolved, err := o.resolveHops(filepath.Clean(dir), true, hops)
+	if err != nil || !within(o.root, resolved) {
+		return filepath.Join(resolved, base), err
+	}
+	path = filepath.Join(resolved, base)
+
+	info, err := o.lstat(path)
+	if err != nil || !follow || info.Mode()&fs.ModeSymlink == 0 {
+		return path, nil
+	}
+	target, err := o.readlink(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return o.resolveHops(filepath.Clean(target), true, hops+1)
+}
+
+// existing describes the entry name refers to, failing as os.Lstat would
+func (o *OverlayBackend) existing(op, name, path string) (fs.FileInfo, error) {
+	info, err := o.lstat(path)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
+
+// creatable checks that an entry may be created at the resolved path p
+func (o *OverlayBackend) creatable(op, name, p string) error {
+	if o.reserved(p) {
+		return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%w: names starting with %s are reserved for overlay whiteouts", errors.ErrInvalidArgument, whiteoutPrefix)}
+	}
+	if _, err := o.lstat(p); err == nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	parent, err := o.lstat(filepath.Dir(p))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return nil
+}
+
+// copyUp copies the entry at p, and the directories above it, from the lower
+// layer into the upper one unless it is there already
+func (o *OverlayBackend) copyUp(p string) error {
+	up := o.upperPath(p)
+	if o.inUpper(up) {
+		return nil
+	}
+	if p == o.root {
+		return o.upper.MkdirAll(up, 0700)
+	}
+	if err := o.copyUp(filepath.Dir(p)); err != nil {
+		return err
+	}
+
+	info, err := o.lower.Lstat(p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		if err := o.upper.Mkdir(up, info.Mode().Perm()); err != nil {
+			return err
+		}
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := o.lower.Readlink(p)
+		if err != nil {
+			return err
+		}
+		return o.upper.Symlink(target, up)
+	case info.Mode().IsRegular():
+		if err := o.copyFile(p, up); err != nil {
+			return err
+		}
+	default:
+		return &fs.PathError{Op: "copy", Path: p, Err: fmt.Errorf("%w: only files, directories and symbolic links can change in an overlay", errors.ErrInvalidOperation)}
+	}
+	return o.upper.Chmod(up, info.Mode().Perm())
+}
+
+// copyFile copies the lower layer's file p to up in the upper layer
+func (o *OverlayBackend) copyFile(p, up string) error {
+	src, err := o.lower.Open(p)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := o.upper.OpenFile(up, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		o.upper.Remove(up)
+		return err
+	}
+	return dst.Close()
+}
+
+// addWhiteout records the deletion of the lower layer's entry at p
+func (o *OverlayBackend) addWhiteout(p string) error {
+	return o.addMarker(filepath.Dir(p), whiteoutPrefix+filepath.Base(p))
+}
+
+// addMarker creates an empty file name in the upper layer's copy of dir
+func (o *OverlayBackend) addMarker(dir, name string) error {
+	if err := o.copyUp(dir); err != nil {
+		return err
+	}
+	file, err := o.upper.OpenFile(filepath.Join(o.upperPath(dir), name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// clearWhiteout removes the whiteout of p before an entry is created there
+func (o *OverlayBackend) clearWhiteout(p string) error {
+	err := o.upper.Remove(filepath.Join(o.upperPath(filepath.Dir(p)), whiteoutPrefix+filepath.Base(p)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// hideLowerDir makes the directory the upper layer now has at p opaque if the
+// lower layer has a directory there whose entries would otherwise show
+func (o *OverlayBackend) hideLowerDir(p string) error {
+	if info, err := o.lower.Lstat(p); err != nil || !info.IsDir() || o.hidden(p) {
+		return nil
+	}
+	return o.addMarker(p, opaqueMarker)
+}
+
+// readDir merges the entries of the directory at the resolved path p
+func (o *OverlayBackend) readDir(p string) ([]fs.DirEntry, error) {
+	merged := make(map[string]fs.DirEntry)
+	whiteouts := make(map[string]bool)
+	opaque := false
+	if entries, err := o.upper.ReadDir(o.upperPath(p)); err == nil {
+		for _, entry := range entries {
+			switch name := entry.Name(); {
+			case name == opaqueMarker:
+				opaque = true
+			case strings.HasPrefix(name, whiteoutPrefix):
+				whiteouts[strings.TrimPrefix(name, whiteoutPrefix)] = true
+			default:
+				merged[name] = entry
+			}
+		}
+	}
+	if !opaque && !o.hidden(p) {
+		entries, _ := o.lower.ReadDir(p)
+		for _, entry := range entries {
+			name := entry.Name()
+			if _, ok := merged[name]; !ok && !whiteouts[name] && !strings.HasPrefix(name, whiteoutPrefix) {
+				merged[name] = entry
+			}
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return compareNames(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+// Open opens a file for reading
+func (o *OverlayBackend) Open(name string) (File, error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile opens a file with the os.OpenFile flags, copying it into the upper
+// layer first when it is opened for writing
+func (o *OverlayBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		o.mu.RLock()
+		defer o.mu.RUnlock()
+
+		path, outside, err := o.resolve("open", name, true)
+		if err != nil || outside {
+			if err != nil {
+				return nil, err
+			}
+			return o.lower.OpenFile(path, flag, perm)
+		}
+		if _, err := o.existing("open", name, path); err != nil {
+			return nil, err
+		}
+		if up := o.upperPath(path); o.inUpper(up) {
+			return o.openUpper(name, up, flag, perm)
+		}
+		return o.lower.OpenFile(path, flag, perm)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path, outside, err := o.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if outside {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errLeavesOverlay}
+	}
+
+	info, err := o.lstat(path)
+	switch {
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case err != nil:
+		if err := o.creatable("open", name, path); err != nil {
+			return nil, err
+		}
+		if err := o.copyUp(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+		if err := o.clearWhiteout(path); err != nil {
+			return nil, err
+		}
+	case flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case info.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("is a directory")}
+	default:
+		if err := o.copyUp(path); err != nil {
+			return nil, err
+		}
+	}
+	return o.openUpper(name, o.upperPath(path), flag, perm)
+}
+
+// openUpper opens the upper layer's file up, known as name in the overlay
+func (o *OverlayBackend) openUpper(name, up string, flag int, perm fs.FileMode) (File, error) {
+	file, err := o.upper.OpenFile(up, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return overlayFile{File: file, name: name}, nil
+}
+
+// CreateTemp creates a new temporary file in dir
+func (o *OverlayBackend) CreateTemp(dir, pattern string) (File, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path, outside, err := o.resolve("createtemp", dir, true)
+	if err != nil {
+		return nil, err
+	}
+	if outside {
+		return nil, &fs.PathError{Op: "createtemp", Path: dir, Err: errLeavesOverlay}
+	}
+	info, err := o.existing("createtemp", dir, path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "createtemp", Path: dir, Err: fmt.Errorf("not a directory")}
+	}
+	if err := o.copyUp(path); err != nil {
+		return nil, err
+	}
+
+	file, err := o.upper.CreateTemp(o.upperPath(path), pattern)
+	if err != nil {
+		return nil, err
+	}
+	return overlayFile{File: file, name: filepath.Join(dir, filepath.Base(file.Name()))}, nil
+}
+
+// Stat describes a file, following symbolic links
+func (o *OverlayBackend) Stat(name string) (fs.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	path, outside, err := o.resolve("stat", name, true)
+	if err != nil || outside {
+		if err != nil {
+			return nil, err
+		}
+		return o.lower.Stat(path)
+	}
+	return o.existing("stat", name, path)
+}
+
+// Lstat describes a file without following a final symbolic link
+func (o *OverlayBackend) Lstat(name string) (fs.FileInfo, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	path, outside, err := o.resolve("lstat", name, false)
+	if err != nil || outside {
+		if err != nil {
+			return nil, err
+		}
+		return o.lower.Lstat(path)
+	}
+	return o.existing("lstat", name, path)
+}
+
+// ReadDir lists a directory of the merged layers sorted by name
+func (o *OverlayBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	path, outside, err := o.resolve("open", name, true)
+	if err != nil || outside {
+		if err != nil {
+			return nil, err
+		}
+		return o.lower.ReadDir(path)
+	}
+	info, err := o.existing("open", name, path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return o.readDir(path)
+}
+
+// Rename moves a file or directory. A directory the lower layer has is first
+// copied into the upper layer with everything inside it.
+func (o *OverlayBackend) Rename(oldpath, newpath string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	linkError := func(err error) error {
+		if pathErr, ok := err.(*fs.PathError); ok {
+			err = pathErr.Err
+		}
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	from, fromOutside, err := o.resolve("rename", oldpath, false)
+	if err != nil {
+		return linkError(err)
+	}
+	to, toOutside, err := o.resolve("rename", newpath, false)
+	if err != nil {
+		return linkError(err)
+	}
+	if fromOutside || toOutside {
+		return linkError(errLeavesOverlay)
+	}
+	if from == o.root || to == o.root {
+		return linkError(fmt.Errorf("%w: the overlay's directory cannot be moved", errors.ErrInvalidOperation))
+	}
+
+	info, err := o.existing("rename", oldpath, from)
+	if err != nil {
+		return linkError(err)
+	}
+	if from == to {
+		return nil
+	}
+	if within(from, to) {
+		return linkError(fmt.Errorf("invalid argument"))
+	}
+	if existing, err := o.lstat(to); err == nil {
+		switch {
+		case existing.IsDir() && !info.IsDir():
+			return linkError(fmt.Errorf("file exists"))
+		case !existing.IsDir() && info.IsDir():
+			return linkError(fmt.Errorf("not a directory"))
+		case existing.IsDir():
+			if entries, _ := o.readDir(to); len(entries) > 0 {
+				return linkError(fmt.Errorf("directory not empty"))
+			}
+		}
+		if err := o.upper.RemoveAll(o.upperPath(to)); err != nil {
+			return linkError(err)
+		}
+	} else if err := o.creatable("rename", newpath, to); err != nil {
+		return linkError(err)
+	}
+
+	if err := o.copyUpTree(from, info); err != nil {
+		return linkError(err)
+	}
+	deleted := o.inLower(from)
+	if err := o.copyUp(filepath.Dir(to)); err != nil {
+		return linkError(err)
+	}
+	if err := o.clearWhiteout(to); err != nil {
+		return linkError(err)
+	}
+	if err := o.upper.Rename(o.upperPath(from), o.upperPath(to)); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := o.hideLowerDir(to); err != nil {
+			return linkError(err)
+		}
+	}
+	if deleted {
+		return o.addWhiteout(from)
+	}
+	return nil
+}
+
+// copyUpTree copies the entry at p into the upper layer with everything the
+// merged layers have inside it
+func (o *OverlayBackend) copyUpTree(p string, info fs.FileInfo) error {
+	if err := o.copyUp(p); err != nil || !info.IsDir() {
+		return err
+	}
+	entries, err := o.readDir(p)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := filepath.Join(p, entry.Name())
+		info, err := o.lstat(child)
+		if err != nil {
+			return err
+		}
+		if err := o.copyUpTree(child, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove deletes a file or an empty directory
+func (o *OverlayBackend) Remove(name string) error {
+	return o.remove("remove", name, false)
+}
+
+// RemoveAll deletes a path with everything inside it; a missing path is not an error
+func (o *OverlayBackend) RemoveAll(name string) error {
+	return o.remove("unlinkat", name, true)
+}
+
+// remove deletes name from the upper layer and hides it in the lower one
+func (o *OverlayBackend) remove(op, name string, all bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path, outside, err := o.resolve(op, name, false)
+	if err != nil {
+		return err
+	}
+	if outside {
+		return &fs.PathError{Op: op, Path: name, Err: errLeavesOverlay}
+	}
+	if path == o.root {
+		return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("%w: the overlay's directory cannot be removed", errors.ErrInvalidOperation)}
+	}
+
+	info, err := o.existing(op, name, path)
+	if err != nil {
+		if all {
+			return nil
+		}
+		return err
+	}
+	if info.IsDir() && !all {
+		if entries, _ := o.readDir(path); len(entries) > 0 {
+			return &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("directory not empty")}
+		}
+	}
+
+	if err := o.upper.RemoveAll(o.upperPath(path)); err != nil {
+		return err
+	}
+	if o.inLower(path) {
+		return o.addWhiteout(path)
+	}
+	return nil
+}
+
+// Mkdir creates a directory
+func (o *OverlayBackend) Mkdir(name string, perm fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path, outside, err := o.resolve("mkdir", name, false)
+	if err != nil {
+		return err
+	}
+	if outside {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: errLeavesOverlay}
+	}
+	return o.mkdir(name, path, perm)
+}
+
+// mkdir creates a directory at the resolved path p
+func (o *OverlayBackend) mkdir(name, p string, perm fs.FileMode) error {
+	if err := o.creatable("mkdir", name, p); err != nil {
+		return err
+	}
+	if err := o.copyUp(filepath.Dir(p)); err != nil {
+		return err
+	}
+	if err := o.clearWhiteout(p); err != nil {
+		return err
+	}
+	if err := o.upper.Mkdir(o.upperPath(p), perm); err != nil {
+		return err
+	}
+	return o.hideLowerDir(p)
+}
+
+// MkdirAll creates a directory with any missing parents
+func (o *OverlayBackend) MkdirAll(name string, perm fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path, outside, err := o.resolve("mkdir", name, true)
+	if err != nil {
+		return err
+	}
+	if outside {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: errLeavesOverlay}
+	}
+
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if info, err := o.lstat(dir); err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("not a directory")}
+			}
+			break
+		}
+		missing = append(missing, dir)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := o.mkdir(missing[i], missing[i], perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Chmod changes the permission bits of a file
+func (o *OverlayBackend) Chmod(name string, mode fs.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path, outside, err := o.resolve("chmod", name, true)
+	if err != nil {
+		return err
+	}
+	if outside {
+		return &fs.PathError{Op: "chmod", Path: name, Err: errLeavesOverlay}
+	}
+	if _, err := o.existing("chmod", name, path); err != nil {
+		return err
+	}
+	if err := o.copyUp(path); err != nil {
+		return err
+	}
+	return o.upper.Chmod(o.upperPath(path), mode)
+}
+
+// Link creates newname as a hard link to the file oldname
+func (o *OverlayBackend) Link(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	from, fromOutside, err := o.resolve("link", oldname, false)
+	if err != nil {
+		return err
+	}
+	to, toOutside, err := o.resolve("link", newname, false)
+	if err != nil {
+		return err
+	}
+	if fromOutside || toOutside {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errLeavesOverlay}
+	}
+
+	info, err := o.existing("link", oldname, from)
+	if err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if info.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fmt.Errorf("operation not permitted")}
+	}
+	if err := o.creatable("link", newname, to); err != nil {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err.(*fs.PathError).Err}
+	}
+	if err := o.copyUp(from); err != nil {
+		return err
+	}
+	if err := o.copyUp(filepath.Dir(to)); err != nil {
+		return err
+	}
+	if err := o.clearWhiteout(to); err != nil {
+		return err
+	}
+	return o.upper.Link(o.upperPath(from), o.upperPath(to))
+}
+
+// Symlink creates newname as a symbolic link to oldname
+func (o *OverlayBackend) Symlink(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	path, outside, err := o.resolve("symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	if outside {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: errLeavesOverlay}
+	}
+	if err := o.creatable("symlink", newname, path); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err.(*fs.PathError).Err}
+	}
+	if err := o.copyUp(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := o.clearWhiteout(path); err != nil {
+		return err
+	}
+	return o.upper.Symlink(oldname, o.upperPath(path))
+}
+
+// Readlink returns the target of a symbolic link
+func (o *OverlayBackend) Readlink(name string) (string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	path, outside, err := o.resolve("readlink", name, false)
+	if err != nil || outside {
+		if err != nil {
+			return "", err
+		}
+		return o.lower.Readlink(path)
+	}
+	if _, err := o.existing("readlink", name, path); err != nil {
+		return "", err
+	}
+	return o.readlink(path)
+}
+
+// EvalSymlinks returns the path name refers to after following symbolic links
+func (o *OverlayBackend) EvalSymlinks(name string) (string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	path, outside, err := o.resolve("lstat", name, true)
+	if err != nil || outside {
+		if err != nil {
+			return "", err
+		}
+		return o.lower.EvalSymlinks(path)
+	}
+	if _, err := o.existing("lstat", name, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Writable reports whether the owner may write the file at name
+func (o *OverlayBackend) Writable(name string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	path, outside, err := o.resolve("stat", name, true)
+	if err != nil || outside {
+		return false
+	}
+	info, err := o.lstat(path)
+	return err == nil && info.Mode().Perm()&0200 != 0
+}
+
+// Changes lists the differences between the overlay and its lower layer,
+// sorted by path
+func (o *OverlayBackend) Changes() ([]OverlayChange, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.changes()
+}
+
+// changes implements Changes; the caller holds the lock
+func (o *OverlayBackend) changes() ([]OverlayChange, error) {
+	changes := make(map[string]OverlayChange)
+	deleted := func(p string) {
+		if _, err := o.lstat(p); err == nil {
+			return
+		}
+		if info, err := o.lower.Lstat(p); err == nil {
+			rel, _ := filepath.Rel(o.root, p)
+			changes[p] = OverlayChange{Path: filepath.ToSlash(rel), Action: OverlayDeleted, Type: entryType(info)}
+		}
+	}
+
+	err := walkDir(o.upper, o.upperRoot, func(up string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if up == o.upperRoot {
+			return nil
+		}
+		rel, _ := filepath.Rel(o.upperRoot, up)
+		p := filepath.Join(o.root, rel)
+
+		switch name := d.Name(); {
+		case name == opaqueMarker:
+			entries, _ := o.lower.ReadDir(filepath.Dir(p))
+			for _, entry := range entries {
+				deleted(filepath.Join(filepath.Dir(p), entry.Name()))
+			}
+		case strings.HasPrefix(name, whiteoutPrefix):
+			deleted(filepath.Join(filepath.Dir(p), strings.TrimPrefix(name, whiteoutPrefix)))
+		default:
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			action, err := o.compare(p, up, info)
+			if err != nil {
+				return err
+			}
+			if action != "" {
+				changes[p] = OverlayChange{Path: filepath.ToSlash(rel), Action: action, Type: entryType(info)}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]OverlayChange, 0, len(changes))
+	for _, change := range changes {
+		list = append(list, change)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+// compare returns how the upper layer's entry up, described by info, changes
+// the lower layer's entry at p, or "" if it does not
+func (o *OverlayBackend) compare(p, up string, info fs.FileInfo) (string, error) {
+	lowerInfo, err := o.lower.Lstat(p)
+	if err != nil {
+		return OverlayAdded, nil
+	}
+	if entryType(lowerInfo) != entryType(info) || lowerInfo.Mode().Perm() != info.Mode().Perm() && info.Mode()&fs.ModeSymlink == 0 {
+		return OverlayModified, nil
+	}
+
+	switch {
+	case info.IsDir():
+		return "", nil
+	case info.Mode()&fs.ModeSymlink != 0:
+		from, err := o.lower.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+		to, err := o.upper.Readlink(up)
+		if err != nil || from == to {
+			return "", err
+		}
+		return OverlayModified, nil
+	}
+
+	if lowerInfo.Size() != info.Size() {
+		return OverlayModified, nil
+	}
+	from, err := o.lower.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer from.Close()
+	to, err := o.upper.Open(up)
+	if err != nil {
+		return "", err
+	}
+	defer to.Close()
+	same, err := sameBytes(from, to)
+	if err != nil || same {
+		return "", err
+	}
+	return OverlayModified, nil
+}
+
+// entryType names the kind of a file: "file", "directory" or "symlink"
+func entryType(info fs.FileInfo) string {
+	switch {
+	case info.IsDir():
+		return "directory"
+	case info.Mode()&fs.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return "file"
+	}
+}
+
+// Commit applies the changes to the lower layer, after check has accepted the
+// path of each, and empties the upper layer. Changes applied before a failure
+// stay applied; committing again completes the rest.
+func (o *OverlayBackend) Commit(check func(path string) error) ([]OverlayChange, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	changes, err := o.changes()
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		if err := check(filepath.Join(o.root, filepath.FromSlash(change.Path))); err != nil {
+			return nil, err
+		}
+	}
+
+	var dirs []string
+	for _, change := range changes {
+		p := filepath.Join(o.root, filepath.FromSlash(change.Path))
+		if err := o.apply(p, change); err != nil {
+			return nil, err
+		}
+		if change.Type == "directory" && change.Action != OverlayDeleted {
+			dirs = append(dirs, p)
+		}
+	}
+
+	// Directories get their permissions once nothing more is written inside them
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := o.upper.Lstat(o.upperPath(dirs[i]))
+		if err != nil {
+			return nil, err
+		}
+		if err := o.lower.Chmod(dirs[i], info.Mode().Perm()); err != nil {
+			return nil, err
+		}
+	}
+	return changes, o.reset()
+}
+
+// apply makes the lower layer's entry at p match the change
+func (o *OverlayBackend) apply(p string, change OverlayChange) error {
+	if change.Action == OverlayDeleted {
+		return o.lower.RemoveAll(p)
+	}
+
+	up := o.upperPath(p)
+	if lowerInfo, err := o.lower.Lstat(p); err == nil && (entryType(lowerInfo) != change.Type || change.Type == "symlink") {
+		if err := o.lower.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+
+	switch change.Type {
+	case "directory":
+		if err := o.lower.Mkdir(p, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		return nil
+	case "symlink":
+		target, err := o.upper.Readlink(up)
+		if err != nil {
+			return err
+		}
+		return o.lower.Symlink(target, p)
+	}
+
+	// Replace the file atomically, so that a failure leaves the old content
+	info, err := o.upper.Lstat(up)
+	if err != nil {
+		return err
+	}
+	src, err := o.upper.Open(up)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	temp, err := o.lower.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempName := temp.Name()
+	_, err = io.Copy(temp, src)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = o.lower.Chmod(tempName, info.Mode().Perm())
+	}
+	if err == nil {
+		err = o.lower.Rename(tempName, p)
+	}
+	if err != nil {
+		o.lower.Remove(tempName)
+	}
+	return err
+}
+
+// Discard drops the changes, returning what they were
+func (o *OverlayBackend) Discard() ([]OverlayChange, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	changes, err := o.changes()
+	if err != nil {
+		return nil, err
+	}
+	return changes, o.reset()
+}
+
+// reset empties the upper layer
+func (o *OverlayBackend) reset() error {
+	entries, err := o.upper.ReadDir(o.upperRoot)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := o.upper.RemoveAll(filepath.Join(o.upperRoot, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overlayFile is a file of the upper layer known by its path in the overlay
+type overlayFile struct {
+	File
+	name string
+}
+
+func (f overlayFile) Name() string { return f.name }
+
+// renamedInfo describes a file under another name
+type renamedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i renamedInfo) Name() string { return i.name }
+
+// overlayFor returns the overlay storing path in fsys, if any
+func overlayFor(fsys Backend, path string) (*OverlayBackend, bool) {
+	if mounts, ok := fsys.(*backendMounts); ok {
+		fsys = mounts.backend(path)
+	}
+	overlay, ok := fsys.(*OverlayBackend)
+	return overlay, ok && within(overlay.root, path)
+}
@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+)
+
+// OverlayService shows, applies and drops the changes held by the allowed
+// directories stored in overlays
+type OverlayService struct {
+	allowedDirs []string
+	logger      *logging.Logger
+	validator   *PathValidatorImpl
+	fsys        Backend
+}
+
+// NewOverlayService creates a new OverlayService
+func NewOverlayService(allowedDirs []string) *OverlayService {
+	return &OverlayService{
+		allowedDirs: allowedDirs,
+		logger:      logging.DefaultLogger("overlay_service"),
+		validator:   newPathValidator(allowedDirs),
+		fsys:        OSBackend{},
+	}
+}
+
+// OverlayDiff lists the changes an overlay holds for its directory
+type OverlayDiff struct {
+	Root    string          `json:"root"`
+	Clean   bool            `json:"clean"`
+	Changes []OverlayChange `json:"changes"`
+}
+
+// overlay validates a path and returns the overlay storing it
+func (s *OverlayService) overlay(op, path string, access Access) (*OverlayBackend, string, error) {
+	validate := s.validator.ValidatePath
+	if access == WriteAccess {
+		validate = s.validator.ValidateWritePath
+	}
+	validPath, err := validate(path)
+	if err != nil {
+		return nil, "", errors.NewFileSystemError(op, path, err)
+	}
+
+	overlay, ok := overlayFor(s.fsys, validPath)
+	if !ok {
+		return nil, "", errors.NewFileSystemError(op, path, fmt.Errorf("%w: not inside an overlay directory", errors.ErrInvalidOperation))
+	}
+	return overlay, validPath, nil
+}
+
+// Diff lists the changes the overlay holds below a path, with the diff of
+// each changed text file. Changes the path policy hides are left out.
+func (s *OverlayService) Diff(path string, opts DiffOptions) (*OverlayDiff, error) {
+	overlay, validPath, err := s.overlay("overlay_diff", path, ReadAccess)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := overlay.Changes()
+	if err != nil {
+		return nil, errors.NewFileSystemError("overlay_diff", path, err)
+	}
+
+	result := &OverlayDiff{Root: overlay.Root(), Changes: []OverlayChange{}}
+	for _, change := range changes {
+		changePath := filepath.Join(overlay.Root(), filepath.FromSlash(change.Path))
+		if !within(validPath, changePath) || !s.validator.Permits(changePath, ReadAccess) {
+			continue
+		}
+		if change.Type == "file" {
+			if change.Diff, change.Binary, err = s.diffChange(overlay, changePath, opts); err != nil {
+				return nil, errors.NewFileSystemError("overlay_diff", changePath, err)
+			}
+		}
+		result.Changes = append(result.Changes, change)
+	}
+	result.Clean = len(result.Changes) == 0
+	return result, nil
+}
+
+// diffChange returns the unified diff between the lower layer's and the
+// overlay's versions of a file, either of which may be missing. Files too
+// large to compare get no diff.
+func (s *OverlayService) diffChange(overlay *OverlayBackend, path string, opts DiffOptions) (string, bool, error) {
+	from, ok, err := readVersion(overlay.lower, path)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	to, ok, err := readVersion(overlay, path)
+	if err != nil || !ok {
+		return "", false, err
+	}
+	diff, binary := diffContent(path, path, from, to, opts)
+	return diff, binary, nil
+}
+
+// readVersion reads the file at path, or nothing if it is not a regular file.
+// ok is false when the file is too large to compare.
+func readVersion(fsys Backend, path string) (data []byte, ok bool, err error) {
+	info, err := fsys.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, true, nil
+	}
+	if info.Size() > maxCompareSize {
+		return nil, false, nil
+	}
+	data, err = readFile(fsys, path)
+	return data, err == nil, err
+}
+
+// Commit applies every change the overlay containing path holds to its
+// directory and empties the overlay
+func (s *OverlayService) Commit(path string) (*OverlayDiff, error) {
+	overlay, _, err := s.overlay("overlay_commit", path, WriteAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := overlay.Commit(func(changePath string) error {
+		if _, err := s.validator.ValidateWritePath(changePath); err != nil {
+			return errors.NewFileSystemError("overlay_commit", changePath, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.NewFileSystemError("overlay_commit", path, err)
+	}
+
+	s.logger.Info("Committed %d overlay change(s) to %s", len(changes), overlay.Root())
+	return &OverlayDiff{Root: overlay.Root(), Clean: len(changes) == 0, Changes: changes}, nil
+}
+
+// PlanCommit describes the changes Commit would apply without applying them
+func (s *OverlayService) PlanCommit(path string) (*Change, error) {
+	return s.plan("overlay_commit", "commit", "Apply", path)
+}
+
+// Discard drops every change the overlay containing path holds
+func (s *OverlayService) Discard(path string) (*OverlayDiff, error) {
+	overlay, _, err := s.overlay("overlay_discard", path, WriteAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := overlay.Discard()
+	if err != nil {
+		return nil, errors.NewFileSystemError("overlay_discard", path, err)
+	}
+
+	s.logger.Info("Discarded %d overlay change(s) to %s", len(changes), overlay.Root())
+	return &OverlayDiff{Root: overlay.Root(), Clean: len(changes) == 0, Changes: changes}, nil
+}
+
+// PlanDiscard describes the changes Discard would drop without dropping them
+func (s *OverlayService) PlanDiscard(path string) (*Change, error) {
+	return s.plan("overlay_discard", "discard", "Drop", path)
+}
+
+// plan describes committing or discarding the changes of an overlay
+func (s *OverlayService) plan(op, action, verb, path string) (*Change, error) {
+	overlay, _, err := s.overlay(op, path, WriteAccess)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := overlay.Changes()
+	if err != nil {
+		return nil, errors.NewFileSystemError(op, path, err)
+	}
+
+	shown := make([]string, 0, min(len(changes), maxPreviewFiles))
+	for _, change := range changes[:min(len(changes), maxPreviewFiles)] {
+		shown = append(shown, fmt.Sprintf("%s %s", change.Action, change.Path))
+	}
+	description := fmt.Sprintf("%s %d overlay change(s) to %s", verb, len(changes), overlay.Root())
+	if len(shown) > 0 {
+		description += ": " + strings.Join(shown, ", ")
+	}
+	if len(shown) < len(changes) {
+		description += ", ..."
+	}
+	return &Change{
+		Operation:   op,
+		Path:        overlay.Root(),
+		Action:      action,
+		Files:       len(changes),
+		Description: description,
+	}, nil
+}
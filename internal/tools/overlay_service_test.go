@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newOverlayProvider serves a directory stored in a memory overlay next to a
+// plain one
+func newOverlayProvider(t *testing.T, opts ...ProviderOption) (string, string, *ServiceProvider) {
+	repo := t.TempDir()
+	plain := t.TempDir()
+	writeTree(t, repo, map[string]string{"main.go": "package main\n", "docs/notes.txt": "one\ntwo\n", "old.txt": "old"})
+	opts = append(opts, WithBackends([]BackendBinding{{Root: repo, Kind: BackendOverlay}}))
+	return repo, plain, NewServiceProvider([]string{repo, plain}, opts...)
+}
+
+func decodeOverlayDiff(t *testing.T, result *mcp.CallToolResult) OverlayDiff {
+	var diff OverlayDiff
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &diff))
+	return diff
+}
+
+func TestServiceProvider_Overlay(t *testing.T) {
+	repo, plain, provider := newOverlayProvider(t)
+	ctx := context.Background()
+
+	_, err := callTool(provider.handleWriteFile, ctx, map[string]interface{}{
+		"path": filepath.Join(repo, "docs", "notes.txt"), "content": "one\nthree\n",
+	})
+	require.NoError(t, err)
+	_, err = callTool(provider.handleWriteFile, ctx, map[string]interface{}{
+		"path": filepath.Join(repo, "new.txt"), "content": "new\n",
+	})
+	require.NoError(t, err)
+	_, err = callTool(provider.handleDeleteFile, ctx, map[string]interface{}{"path": filepath.Join(repo, "old.txt")})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(repo, "docs", "notes.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", string(data), "writes stay in the overlay")
+	assert.FileExists(t, filepath.Join(repo, "old.txt"))
+
+	result, err := callTool(provider.handleOverlayDiff, ctx, map[string]interface{}{"path": repo})
+	require.NoError(t, err)
+	diff := decodeOverlayDiff(t, result)
+	assert.Equal(t, repo, diff.Root)
+	assert.False(t, diff.Clean)
+	require.Len(t, diff.Changes, 3)
+	assert.Equal(t, "docs/notes.txt", diff.Changes[0].Path)
+	assert.Equal(t, OverlayModified, diff.Changes[0].Action)
+	assert.Contains(t, diff.Changes[0].Diff, "-two\n+three\n")
+	assert.Equal(t, OverlayAdded, diff.Changes[1].Action)
+	assert.Contains(t, diff.Changes[1].Diff, "+new\n")
+	assert.Equal(t, OverlayDeleted, diff.Changes[2].Action)
+	assert.Contains(t, diff.Changes[2].Diff, "-old")
+
+	result, err = callTool(provider.handleOverlayDiff, ctx, map[string]interface{}{"path": filepath.Join(repo, "docs")})
+	require.NoError(t, err)
+	assert.Len(t, decodeOverlayDiff(t, result).Changes, 1, "changes are limited to the path")
+
+	result, err = callTool(provider.handleOverlayCommit, ctx, map[string]interface{}{"path": repo, "dry_run": true})
+	require.NoError(t, err)
+	change := decodeDryRun(t, result)
+	assert.Equal(t, "commit", change.Action)
+	assert.Equal(t, 3, change.Files)
+	assert.Contains(t, change.Description, "modified docs/notes.txt")
+	assert.FileExists(t, filepath.Join(repo, "old.txt"))
+
+	result, err = callTool(provider.handleOverlayCommit, ctx, map[string]interface{}{"path": repo})
+	require.NoError(t, err)
+	assert.Len(t, decodeOverlayDiff(t, result).Changes, 3)
+	data, err = os.ReadFile(filepath.Join(repo, "docs", "notes.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "one\nthree\n", string(data))
+	assert.FileExists(t, filepath.Join(repo, "new.txt"))
+	assert.NoFileExists(t, filepath.Join(repo, "old.txt"))
+
+	result, err = callTool(provider.handleOverlayDiff, ctx, map[string]interface{}{"path": repo})
+	require.NoError(t, err)
+	assert.True(t, decodeOverlayDiff(t, result).Clean)
+
+	// Discarding drops the changes made since
+	_, err = callTool(provider.handleWriteFile, ctx, map[string]interface{}{
+		"path": filepath.Join(repo, "main.go"), "content": "broken",
+	})
+	require.NoError(t, err)
+	result, err = callTool(provider.handleOverlayDiscard, ctx, map[string]interface{}{"path": repo, "dry_run": true})
+	require.NoError(t, err)
+	assert.Equal(t, "discard", decodeDryRun(t, result).Action)
+	result, err = callTool(provider.handleOverlayDiscard, ctx, map[string]interface{}{"path": repo})
+	require.NoError(t, err)
+	assert.Len(t, decodeOverlayDiff(t, result).Changes, 1)
+	result, err = callTool(provider.handleReadFile, ctx, map[string]interface{}{"path": filepath.Join(repo, "main.go")})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "package main")
+
+	// Directories outside an overlay have no changes to show
+	_, err = callTool(provider.handleOverlayDiff, ctx, map[string]interface{}{"path": plain})
+	assert.True(t, errors.IsInvalidOperation(err))
+	_, err = callTool(provider.handleOverlayCommit, ctx, map[string]interface{}{"path": plain})
+	assert.True(t, errors.IsInvalidOperation(err))
+	_, err = callTool(provider.handleOverlayDiff, ctx, map[string]interface{}{"path": repo, "context": float64(-1)})
+	assert.True(t, errors.IsInvalidArgument(err))
+	_, err = callTool(provider.handleOverlayDiscard, ctx, map[string]interface{}{})
+	assert.True(t, errors.IsInvalidArgument(err))
+}
+
+func TestServiceProvider_OverlayCommitPolicy(t *testing.T) {
+	policy, err := NewPathPolicy([]PolicyRule{{Pattern: "*.lock", Write: true}})
+	require.NoError(t, err)
+	repo, _, provider := newOverlayProvider(t, WithPathPolicy(policy))
+	overlay, ok := overlayFor(provider.fsys, repo)
+	require.True(t, ok)
+
+	// Changes the policy forbids, made before it applied, are never committed
+	writeOverlayFile(t, overlay, filepath.Join(repo, "go.lock"), "pinned")
+	_, err = callTool(provider.handleOverlayCommit, context.Background(), map[string]interface{}{"path": repo})
+	assert.ErrorIs(t, err, errors.ErrPathDenied)
+	assert.NoFileExists(t, filepath.Join(repo, "go.lock"))
+}
+
+func TestConfirmOperation_OverlayCommit(t *testing.T) {
+	repo, _, provider := newOverlayProvider(t, WithConfirmationPolicy(ConfirmationPolicy{
+		Rules: []ConfirmationRule{{Tool: "overlay_commit"}},
+	}))
+	ctx := context.Background()
+
+	_, err := callTool(provider.handleWriteFile, ctx, map[string]interface{}{
+		"path": filepath.Join(repo, "main.go"), "content": "package main\n\nfunc main() {}\n",
+	})
+	require.NoError(t, err)
+
+	result, err := callTool(provider.handleOverlayCommit, ctx, map[string]interface{}{"path": repo})
+	require.NoError(t, err)
+	pending := decodePending(t, result)
+	assert.Equal(t, "overlay_commit", pending.Preview.Tool)
+	assert.Equal(t, []string{filepath.Join(repo, "main.go")}, pending.Preview.Files)
+	assert.Equal(t, int64(29), pending.Preview.TotalBytes)
+
+	_, err = callTool(provider.handleConfirmOperation, ctx, map[string]interface{}{"operation_id": pending.OperationID})
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(repo, "main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "func main")
+}
@@ -0,0 +1,264 @@
+package tools
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// overlayUppers creates an overlay of root for each place its changes can be kept
+func overlayUppers(t *testing.T, root string) map[string]*OverlayBackend {
+	return map[string]*OverlayBackend{
+		"memory": NewOverlayBackend(root, NewMemoryBackend(root), root),
+		"disk":   NewOverlayBackend(root, OSBackend{}, t.TempDir()),
+	}
+}
+
+// writeOverlayFile writes content to a file of a backend
+func writeOverlayFile(t *testing.T, fsys Backend, name, content string) {
+	file, err := fsys.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+// listNames returns the names in a directory of a backend
+func listNames(t *testing.T, fsys Backend, dir string) []string {
+	entries, err := fsys.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestOverlayBackend_CopyOnWrite(t *testing.T) {
+	for name := range overlayUppers(t, t.TempDir()) {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, map[string]string{"a.txt": "a", "docs/b.txt": "b", "docs/c.txt": "c", "old/d.txt": "d"})
+			overlay := overlayUppers(t, root)[name]
+
+			// Changes are visible through the overlay only
+			writeOverlayFile(t, overlay, filepath.Join(root, "a.txt"), "changed")
+			require.NoError(t, overlay.MkdirAll(filepath.Join(root, "new", "sub"), 0755))
+			writeOverlayFile(t, overlay, filepath.Join(root, "new", "sub", "e.txt"), "e")
+			require.NoError(t, overlay.Remove(filepath.Join(root, "docs", "b.txt")))
+			require.NoError(t, overlay.Rename(filepath.Join(root, "old"), filepath.Join(root, "moved")))
+
+			data, err := readFile(overlay, filepath.Join(root, "a.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "changed", string(data))
+			data, err = readFile(overlay, filepath.Join(root, "moved", "d.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "d", string(data))
+			_, err = overlay.Stat(filepath.Join(root, "docs", "b.txt"))
+			assert.True(t, os.IsNotExist(err))
+			_, err = overlay.Stat(filepath.Join(root, "old"))
+			assert.True(t, os.IsNotExist(err))
+
+			assert.Equal(t, []string{"a.txt", "docs", "moved", "new"}, listNames(t, overlay, root))
+			assert.Equal(t, []string{"c.txt"}, listNames(t, overlay, filepath.Join(root, "docs")))
+
+			data, err = os.ReadFile(filepath.Join(root, "a.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "a", string(data), "the lower layer is untouched")
+			assert.FileExists(t, filepath.Join(root, "docs", "b.txt"))
+			assert.DirExists(t, filepath.Join(root, "old"))
+			assert.NoDirExists(t, filepath.Join(root, "new"))
+
+			changes, err := overlay.Changes()
+			require.NoError(t, err)
+			assert.Equal(t, []OverlayChange{
+				{Path: "a.txt", Action: OverlayModified, Type: "file"},
+				{Path: "docs/b.txt", Action: OverlayDeleted, Type: "file"},
+				{Path: "moved", Action: OverlayAdded, Type: "directory"},
+				{Path: "moved/d.txt", Action: OverlayAdded, Type: "file"},
+				{Path: "new", Action: OverlayAdded, Type: "directory"},
+				{Path: "new/sub", Action: OverlayAdded, Type: "directory"},
+				{Path: "new/sub/e.txt", Action: OverlayAdded, Type: "file"},
+				{Path: "old", Action: OverlayDeleted, Type: "directory"},
+			}, changes)
+		})
+	}
+}
+
+func TestOverlayBackend_RecreatedDirectory(t *testing.T) {
+	for name := range overlayUppers(t, t.TempDir()) {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, map[string]string{"dir/a.txt": "a", "dir/b.txt": "b", "same.txt": "same"})
+			overlay := overlayUppers(t, root)[name]
+			dir := filepath.Join(root, "dir")
+
+			require.NoError(t, overlay.RemoveAll(dir))
+			require.NoError(t, overlay.Mkdir(dir, 0755))
+			writeOverlayFile(t, overlay, filepath.Join(dir, "a.txt"), "new a")
+			assert.Equal(t, []string{"a.txt"}, listNames(t, overlay, dir), "the lower directory's entries stay deleted")
+
+			// Rewriting a file with its own content and deleting a new file change nothing
+			writeOverlayFile(t, overlay, filepath.Join(root, "same.txt"), "same")
+			writeOverlayFile(t, overlay, filepath.Join(root, "tmp.txt"), "tmp")
+			require.NoError(t, overlay.Remove(filepath.Join(root, "tmp.txt")))
+
+			changes, err := overlay.Changes()
+			require.NoError(t, err)
+			assert.Equal(t, []OverlayChange{
+				{Path: "dir/a.txt", Action: OverlayModified, Type: "file"},
+				{Path: "dir/b.txt", Action: OverlayDeleted, Type: "file"},
+			}, changes)
+		})
+	}
+}
+
+func TestOverlayBackend_Errors(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	writeTree(t, root, map[string]string{"dir/a.txt": "a"})
+	writeTree(t, outside, map[string]string{"secret.txt": "s"})
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt")))
+	overlay := NewOverlayBackend(root, NewMemoryBackend(root), root)
+
+	_, err := overlay.OpenFile(filepath.Join(root, ".wh.a.txt"), os.O_WRONLY|os.O_CREATE, 0644)
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
+	assert.Error(t, overlay.Remove(filepath.Join(root, "dir")), "directory not empty")
+	assert.Error(t, overlay.Remove(root))
+	assert.True(t, os.IsExist(overlay.Mkdir(filepath.Join(root, "dir"), 0755)))
+	_, err = overlay.OpenFile(filepath.Join(root, "missing", "a.txt"), os.O_WRONLY|os.O_CREATE, 0644)
+	assert.True(t, os.IsNotExist(err))
+
+	// Links leading out of the overlay can be read but not written through
+	data, err := readFile(overlay, filepath.Join(root, "link.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "s", string(data))
+	_, err = overlay.OpenFile(filepath.Join(root, "link.txt"), os.O_WRONLY|os.O_TRUNC, 0)
+	assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+	assert.False(t, overlay.Writable(filepath.Join(root, "link.txt")))
+}
+
+func TestOverlayBackend_Links(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"dir/a.txt": "a"})
+	overlay := NewOverlayBackend(root, NewMemoryBackend(root), root)
+
+	require.NoError(t, overlay.Symlink("dir", filepath.Join(root, "alias")))
+	writeOverlayFile(t, overlay, filepath.Join(root, "alias", "b.txt"), "b")
+	data, err := readFile(overlay, filepath.Join(root, "dir", "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(data), "writes follow links inside the overlay")
+
+	info, err := overlay.Lstat(filepath.Join(root, "alias"))
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&fs.ModeSymlink)
+	resolved, err := overlay.EvalSymlinks(filepath.Join(root, "alias", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "dir", "a.txt"), resolved)
+
+	require.NoError(t, overlay.Link(filepath.Join(root, "dir", "a.txt"), filepath.Join(root, "hard.txt")))
+	writeOverlayFile(t, overlay, filepath.Join(root, "hard.txt"), "shared")
+	data, err = readFile(overlay, filepath.Join(root, "dir", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "shared", string(data))
+}
+
+func TestOverlayBackend_CommitAndDiscard(t *testing.T) {
+	for name := range overlayUppers(t, t.TempDir()) {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			writeTree(t, root, map[string]string{"a.txt": "a", "gone/b.txt": "b", "keep.txt": "keep"})
+			overlay := overlayUppers(t, root)[name]
+
+			writeOverlayFile(t, overlay, filepath.Join(root, "a.txt"), "changed")
+			require.NoError(t, overlay.RemoveAll(filepath.Join(root, "gone")))
+			require.NoError(t, overlay.Mkdir(filepath.Join(root, "new"), 0750))
+			writeOverlayFile(t, overlay, filepath.Join(root, "new", "c.txt"), "c")
+			require.NoError(t, overlay.Symlink("a.txt", filepath.Join(root, "link")))
+			require.NoError(t, overlay.Chmod(filepath.Join(root, "keep.txt"), 0600))
+
+			var checked []string
+			changes, err := overlay.Commit(func(path string) error {
+				checked = append(checked, path)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Len(t, changes, 6)
+			assert.Len(t, checked, 6)
+
+			data, err := os.ReadFile(filepath.Join(root, "a.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "changed", string(data))
+			assert.NoDirExists(t, filepath.Join(root, "gone"))
+			data, err = os.ReadFile(filepath.Join(root, "new", "c.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "c", string(data))
+			info, err := os.Stat(filepath.Join(root, "new"))
+			require.NoError(t, err)
+			assert.Equal(t, fs.FileMode(0750), info.Mode().Perm())
+			target, err := os.Readlink(filepath.Join(root, "link"))
+			require.NoError(t, err)
+			assert.Equal(t, "a.txt", target)
+			info, err = os.Stat(filepath.Join(root, "keep.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, fs.FileMode(0600), info.Mode().Perm())
+
+			changes, err = overlay.Changes()
+			require.NoError(t, err)
+			assert.Empty(t, changes, "committing empties the overlay")
+
+			// Discarding restores the view of the lower layer
+			writeOverlayFile(t, overlay, filepath.Join(root, "a.txt"), "discarded")
+			require.NoError(t, overlay.Remove(filepath.Join(root, "keep.txt")))
+			changes, err = overlay.Discard()
+			require.NoError(t, err)
+			assert.Len(t, changes, 2)
+			data, err = readFile(overlay, filepath.Join(root, "a.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "changed", string(data))
+			_, err = overlay.Stat(filepath.Join(root, "keep.txt"))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestOverlayBackend_CommitCheck(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"a.txt": "a"})
+	overlay := NewOverlayBackend(root, NewMemoryBackend(root), root)
+	writeOverlayFile(t, overlay, filepath.Join(root, "a.txt"), "changed")
+
+	_, err := overlay.Commit(func(string) error { return errors.ErrPathDenied })
+	assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+	data, err := os.ReadFile(filepath.Join(root, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data), "nothing is applied when a change is refused")
+	changes, err := overlay.Changes()
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+}
+
+func TestOverlayBackend_DiskWhiteouts(t *testing.T) {
+	root := t.TempDir()
+	upper := t.TempDir()
+	writeTree(t, root, map[string]string{"dir/a.txt": "a"})
+	overlay := NewOverlayBackend(root, OSBackend{}, upper)
+
+	require.NoError(t, overlay.Remove(filepath.Join(root, "dir", "a.txt")))
+	assert.FileExists(t, filepath.Join(upper, "dir", ".wh.a.txt"))
+	require.NoError(t, overlay.RemoveAll(filepath.Join(root, "dir")))
+	assert.FileExists(t, filepath.Join(upper, ".wh.dir"))
+	require.NoError(t, overlay.Mkdir(filepath.Join(root, "dir"), 0755))
+	assert.FileExists(t, filepath.Join(upper, "dir", opaqueMarker))
+	assert.NoFileExists(t, filepath.Join(upper, ".wh.dir"))
+
+	// A new overlay on the same upper directory sees the changes
+	reopened := NewOverlayBackend(root, OSBackend{}, upper)
+	assert.Empty(t, listNames(t, reopened, filepath.Join(root, "dir")))
+}
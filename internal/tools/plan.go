@@ -0,0 +1,273 @@
+package tools
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// maxDiffSize is the largest file for which a plan includes a diff
+const maxDiffSize = 1 << 20
+
+// diffContext is the number of context lines in plan diffs
+const diffContext = 3
+
+// checkWritable returns ErrPermissionDenied unless the file or directory at
+// validPath can be written or, if it does not exist, created inside its nearest
+// existing ancestor
+func checkWritable(fsys Backend, validPath string) error {
+	for path := validPath; ; path = filepath.Dir(path) {
+		info, err := fsys.Stat(path)
+		if err == nil {
+			if path != validPath && !info.IsDir() {
+				return errors.ErrInvalidOperation
+			}
+			if !fsys.Writable(path) {
+				return errors.ErrPermissionDenied
+			}
+			return nil
+		}
+		if filepath.Dir(path) == path {
+			return nil
+		}
+	}
+}
+
+// checkRemovable returns ErrPermissionDenied unless the entry at validPath can
+// be removed from its directory
+func checkRemovable(fsys Backend, validPath string) error {
+	if !fsys.Writable(filepath.Dir(validPath)) {
+		return errors.ErrPermissionDenied
+	}
+	return nil
+}
+
+// readable reports whether a plan may show the content of the file at
+// validPath. Diffs of files the path policy hides from reads would disclose
+// them, so their plans only give sizes.
+func (s *FileService) readable(validPath string) bool {
+	_, err := s.validator.ValidatePath(validPath)
+	return err == nil
+}
+
+// PlanWriteFile validates a write and describes it without writing
+func (s *FileService) PlanWriteFile(path, content string, append bool) (*Change, error) {
+	req, err := s.prepareWrite(path, content, append)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWritable(s.fsys, req.validPath); err != nil {
+		return nil, errors.NewFileSystemError("write_file", path, err)
+	}
+
+	change := &Change{
+		Operation:   "write_file",
+		Path:        req.validPath,
+		Files:       1,
+		BytesBefore: req.oldSize,
+		BytesAfter:  req.newSize,
+	}
+	switch {
+	case !req.exists:
+		change.Action = "create"
+		change.Description = fmt.Sprintf("Create %s (%d bytes)", req.validPath, req.newSize)
+	case append:
+		change.Action = "append"
+		change.Description = fmt.Sprintf("Append %d bytes to %s (%d -> %d bytes)", len(content), req.validPath, req.oldSize, req.newSize)
+	default:
+		change.Action = "overwrite"
+		change.Description = fmt.Sprintf("Overwrite %s (%d -> %d bytes)", req.validPath, req.oldSize, req.newSize)
+		if req.oldSize <= maxDiffSize && s.readable(req.validPath) {
+			if old, err := readFile(s.fsys, req.validPath); err == nil {
+				oldText, _ := decodeText(old)
+				change.Diff = unifiedDiff(req.validPath, req.validPath, oldText, req.text, diffContext)
+			}
+		}
+	}
+
+	return change, nil
+}
+
+// PlanEditFile validates an edit and describes it, with a diff, without writing
+func (s *FileService) PlanEditFile(path, content string, startLine, endLine int) (*Change, error) {
+	req, err := s.prepareEdit(path, content, startLine, endLine)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWritable(s.fsys, req.validPath); err != nil {
+		return nil, errors.NewFileSystemError("edit_file", path, err)
+	}
+
+	change := s.contentChange("edit_file", req)
+	change.Description = fmt.Sprintf("Replace lines %d-%d of %s", startLine, endLine, req.validPath)
+	return change, nil
+}
+
+// contentChange describes a validated edit of a file's content, with a diff if
+// the file may be read
+func (s *FileService) contentChange(op string, req *editRequest) *Change {
+	change := &Change{
+		Operation:   op,
+		Path:        req.validPath,
+		Action:      "modify",
+		Files:       1,
+		BytesBefore: req.oldSize,
+		BytesAfter:  int64(len(req.data)),
+	}
+	if req.oldSize <= maxDiffSize && s.readable(req.validPath) {
+		change.Diff = unifiedDiff(req.validPath, req.validPath, req.oldContent, req.newContent, diffContext)
+	}
+	if req.oldContent == req.newContent {
+		change.Action = "none"
+	}
+	return change
+}
+
+// PlanDeleteFile validates the deletion of a file and describes it without deleting
+func (s *FileService) PlanDeleteFile(path string) (*Change, error) {
+	validPath, info, err := s.prepareDelete(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRemovable(s.fsys, validPath); err != nil {
+		return nil, errors.NewFileSystemError("delete_file", path, err)
+	}
+
+	return &Change{
+		Operation:   "delete_file",
+		Path:        validPath,
+		Action:      "delete",
+		Files:       1,
+		BytesBefore: info.Size(),
+		Description: fmt.Sprintf("Delete %s (%d bytes)", validPath, info.Size()),
+	}, nil
+}
+
+// PlanMoveFile validates a move and describes it without moving
+func (s *FileService) PlanMoveFile(sourcePath, destinationPath string) (*Change, error) {
+	req, err := s.prepareTransfer("move_file", sourcePath, destinationPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRemovable(s.fsys, req.validSource); err != nil {
+		return nil, errors.NewFileSystemError("move_file", sourcePath, err)
+	}
+	if err := checkWritable(s.fsys, req.validDest); err != nil {
+		return nil, errors.NewFileSystemError("move_file", destinationPath, err)
+	}
+
+	return transferChange("move_file", "move", "Move", req), nil
+}
+
+// PlanCopyFile validates a copy and describes it without copying
+func (s *FileService) PlanCopyFile(sourcePath, destinationPath string) (*Change, error) {
+	req, err := s.prepareTransfer("copy_file", sourcePath, destinationPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWritable(s.fsys, req.validDest); err != nil {
+		return nil, errors.NewFileSystemError("copy_file", destinationPath, err)
+	}
+
+	return transferChange("copy_file", "copy", "Copy", req), nil
+}
+
+// transferChange describes a validated move or copy
+func transferChange(op, action, verb string, req *transferRequest) *Change {
+	description := fmt.Sprintf("%s %s to %s (%d bytes)", verb, req.validSource, req.validDest, req.info.Size())
+	if req.overwrite {
+		description += fmt.Sprintf(", replacing the existing file (%d bytes)", req.destSize)
+	}
+
+	return &Change{
+		Operation:   op,
+		Path:        req.validSource,
+		Destination: req.validDest,
+		Action:      action,
+		Files:       1,
+		BytesBefore: req.destSize,
+		BytesAfter:  req.info.Size(),
+		Description: description,
+	}
+}
+
+// PlanCreateDirectory validates the creation of a directory and describes it
+// without creating it
+func (s *DirectoryService) PlanCreateDirectory(path string) (*Change, error) {
+	validPath, err := s.validator.ValidateWritePath(path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("create_directory", path, err)
+	}
+
+	change := &Change{
+		Operation: "create_directory",
+		Path:      validPath,
+	}
+
+	if info, err := s.fsys.Stat(validPath); err == nil {
+		if !info.IsDir() {
+			return nil, errors.NewFileSystemError("create_directory", path, errors.ErrInvalidOperation)
+		}
+		change.Action = "none"
+		change.Description = fmt.Sprintf("Directory %s already exists", validPath)
+		return change, nil
+	}
+
+	if err := checkWritable(s.fsys, validPath); err != nil {
+		return nil, errors.NewFileSystemError("create_directory", path, err)
+	}
+	change.Action = "create"
+	change.Description = fmt.Sprintf("Create directory %s", validPath)
+
+	return change, nil
+}
+
+// PlanDeleteDirectory validates the deletion of a directory and describes it,
+// including how many files would be removed, without deleting it
+func (s *DirectoryService) PlanDeleteDirectory(path string, recursive bool) (*Change, error) {
+	validPath, err := s.prepareDeleteDirectory(path, recursive)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRemovable(s.fsys, validPath); err != nil {
+		return nil, errors.NewFileSystemError("delete_directory", path, err)
+	}
+
+	change := &Change{
+		Operation: "delete_directory",
+		Path:      validPath,
+		Action:    "delete",
+	}
+
+	denied := ""
+	err = walkDir(s.fsys, validPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Removing a directory's entries needs write access to it
+			if !s.fsys.Writable(p) {
+				denied = p
+				return fs.SkipAll
+			}
+			return nil
+		}
+
+		change.Files++
+		if info, err := d.Info(); err == nil {
+			change.BytesBefore += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.NewFileSystemError("delete_directory", path, err)
+	}
+	if denied != "" {
+		return nil, errors.NewFileSystemError("delete_directory", denied, errors.ErrPermissionDenied)
+	}
+
+	change.Description = fmt.Sprintf("Delete directory %s with %d file(s) (%d bytes)", validPath, change.Files, change.BytesBefore)
+	return change, nil
+}
@@ -0,0 +1,275 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeDryRun(t *testing.T, result *mcp.CallToolResult) *Change {
+	var response dryRunResponse
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &response))
+	require.True(t, response.DryRun)
+	require.NotNil(t, response.Change)
+	return response.Change
+}
+
+func TestFileService_PlanWriteFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+	existing := filepath.Join(tmpDir, "existing.txt")
+	require.NoError(t, os.WriteFile(existing, []byte("one\ntwo\n"), 0644))
+
+	t.Run("create", func(t *testing.T) {
+		path := filepath.Join(tmpDir, "nested", "new.txt")
+		change, err := service.PlanWriteFile(path, "hello", false)
+		require.NoError(t, err)
+		assert.Equal(t, "create", change.Action)
+		assert.Equal(t, int64(5), change.BytesAfter)
+		assert.NoFileExists(t, path)
+		assert.NoDirExists(t, filepath.Join(tmpDir, "nested"))
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		change, err := service.PlanWriteFile(existing, "one\nthree\n", false)
+		require.NoError(t, err)
+		assert.Equal(t, "overwrite", change.Action)
+		assert.Equal(t, int64(8), change.BytesBefore)
+		assert.Contains(t, change.Diff, "-two\n+three\n")
+
+		content, err := os.ReadFile(existing)
+		require.NoError(t, err)
+		assert.Equal(t, "one\ntwo\n", string(content))
+	})
+
+	t.Run("append", func(t *testing.T) {
+		change, err := service.PlanWriteFile(existing, "three\n", true)
+		require.NoError(t, err)
+		assert.Equal(t, "append", change.Action)
+		assert.Equal(t, int64(14), change.BytesAfter)
+	})
+
+	t.Run("outside allowed directories", func(t *testing.T) {
+		_, err := service.PlanWriteFile(filepath.Join(t.TempDir(), "x.txt"), "x", false)
+		assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+	})
+
+	t.Run("parent is a file", func(t *testing.T) {
+		_, err := service.PlanWriteFile(filepath.Join(existing, "x.txt"), "x", false)
+		assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+	})
+}
+
+func TestFileService_PlanWriteFileQuota(t *testing.T) {
+	tmpDir, service := newLimitedFileService(t, WriteLimits{QuotaBytes: 4})
+
+	_, err := service.PlanWriteFile(filepath.Join(tmpDir, "big.txt"), "12345", false)
+	assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+}
+
+func TestFileService_PlanWriteFilePermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission checks do not apply to root")
+	}
+
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+	readOnly := filepath.Join(tmpDir, "readonly")
+	require.NoError(t, os.Mkdir(readOnly, 0555))
+	t.Cleanup(func() { _ = os.Chmod(readOnly, 0755) })
+
+	_, err := service.PlanWriteFile(filepath.Join(readOnly, "x.txt"), "x", false)
+	assert.ErrorIs(t, err, errors.ErrPermissionDenied)
+}
+
+func TestFileService_PlanEditFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+	path := filepath.Join(tmpDir, "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\nc\n"), 0644))
+
+	change, err := service.PlanEditFile(path, "x", 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "modify", change.Action)
+	assert.Contains(t, change.Diff, "-b\n+x\n")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\nc\n", string(content))
+
+	change, err = service.PlanEditFile(path, "b", 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "none", change.Action)
+	assert.Empty(t, change.Diff)
+
+	_, err = service.PlanEditFile(filepath.Join(tmpDir, "missing.txt"), "x", 1, 1)
+	assert.ErrorIs(t, err, errors.ErrFileNotFound)
+}
+
+func TestFileService_PlanDeleteMoveCopy(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+	source := filepath.Join(tmpDir, "source.txt")
+	target := filepath.Join(tmpDir, "target.txt")
+	require.NoError(t, os.WriteFile(source, []byte("12345"), 0644))
+	require.NoError(t, os.WriteFile(target, []byte("123"), 0644))
+
+	change, err := service.PlanDeleteFile(source)
+	require.NoError(t, err)
+	assert.Equal(t, "delete", change.Action)
+	assert.Equal(t, int64(5), change.BytesBefore)
+
+	_, err = service.PlanDeleteFile(filepath.Join(tmpDir, "missing.txt"))
+	assert.ErrorIs(t, err, errors.ErrFileNotFound)
+
+	change, err = service.PlanMoveFile(source, filepath.Join(tmpDir, "moved.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "move", change.Action)
+	assert.Equal(t, filepath.Join(tmpDir, "moved.txt"), change.Destination)
+
+	change, err = service.PlanCopyFile(source, target)
+	require.NoError(t, err)
+	assert.Equal(t, "copy", change.Action)
+	assert.Equal(t, int64(3), change.BytesBefore)
+	assert.Contains(t, change.Description, "replacing the existing file")
+
+	_, err = service.PlanCopyFile(source, filepath.Join(t.TempDir(), "x.txt"))
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+
+	assert.FileExists(t, source)
+	assert.NoFileExists(t, filepath.Join(tmpDir, "moved.txt"))
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "123", string(content))
+}
+
+func TestDirectoryService_PlanCreateDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewDirectoryService([]string{tmpDir})
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("x"), 0644))
+
+	change, err := service.PlanCreateDirectory(filepath.Join(tmpDir, "a", "b"))
+	require.NoError(t, err)
+	assert.Equal(t, "create", change.Action)
+	assert.NoDirExists(t, filepath.Join(tmpDir, "a"))
+
+	change, err = service.PlanCreateDirectory(tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, "none", change.Action)
+
+	_, err = service.PlanCreateDirectory(filepath.Join(tmpDir, "file.txt"))
+	assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+}
+
+func TestDirectoryService_PlanDeleteDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	service := NewDirectoryService([]string{tmpDir})
+	dir := filepath.Join(tmpDir, "dir")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("12345"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("123"), 0644))
+
+	change, err := service.PlanDeleteDirectory(dir, true)
+	require.NoError(t, err)
+	assert.Equal(t, "delete", change.Action)
+	assert.Equal(t, 2, change.Files)
+	assert.Equal(t, int64(8), change.BytesBefore)
+	assert.DirExists(t, dir)
+
+	_, err = service.PlanDeleteDirectory(dir, false)
+	assert.Error(t, err)
+}
+
+func TestServiceProvider_DryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello\n"), 0644))
+
+	t.Run("dry_run argument", func(t *testing.T) {
+		provider := NewServiceProvider([]string{tmpDir})
+		result, err := callTool(provider.handleWriteFile, context.Background(), map[string]interface{}{
+			"path":    path,
+			"content": "goodbye\n",
+			"dry_run": true,
+		})
+		require.NoError(t, err)
+		change := decodeDryRun(t, result)
+		assert.Equal(t, "write_file", change.Operation)
+		assert.Equal(t, "overwrite", change.Action)
+		assert.Contains(t, change.Diff, "-hello\n+goodbye\n")
+
+		result, err = callTool(provider.handleDeleteFile, context.Background(), map[string]interface{}{
+			"path":    path,
+			"dry_run": true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "delete", decodeDryRun(t, result).Action)
+		assert.FileExists(t, path)
+	})
+
+	t.Run("global dry run", func(t *testing.T) {
+		provider := NewServiceProvider([]string{tmpDir}, WithDryRun(true))
+		result, err := callTool(provider.handleCreateDirectory, context.Background(), map[string]interface{}{
+			"path": filepath.Join(tmpDir, "new"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "create", decodeDryRun(t, result).Action)
+		assert.NoDirExists(t, filepath.Join(tmpDir, "new"))
+
+		_, err = callTool(provider.handleMoveFile, context.Background(), map[string]interface{}{
+			"source_path":      filepath.Join(tmpDir, "missing.txt"),
+			"destination_path": filepath.Join(tmpDir, "moved.txt"),
+		})
+		assert.ErrorIs(t, err, errors.ErrFileNotFound)
+	})
+
+	t.Run("skips confirmation", func(t *testing.T) {
+		provider := NewServiceProvider([]string{tmpDir}, WithConfirmationPolicy(ConfirmationPolicy{
+			Rules: []ConfirmationRule{{Tool: "delete_file"}},
+		}))
+		result, err := callTool(provider.handleDeleteFile, context.Background(), map[string]interface{}{
+			"path":    path,
+			"dry_run": true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "delete_file", decodeDryRun(t, result).Operation)
+		assert.FileExists(t, path)
+	})
+}
+
+func TestServiceProvider_DryRunHidesUnreadableFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	secret := filepath.Join(tmpDir, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("AWS_SECRET_ACCESS_KEY=abc\n"), 0644))
+	policy, err := NewPathPolicy([]PolicyRule{{Pattern: "secret.txt", Read: true}})
+	require.NoError(t, err)
+	provider := NewServiceProvider([]string{tmpDir}, WithPathPolicy(policy))
+
+	_, err = callTool(provider.handleReadFile, context.Background(), map[string]interface{}{"path": secret})
+	assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+	// Plans of files that cannot be read give sizes, not content
+	result, err := callTool(provider.handleWriteFile, context.Background(), map[string]interface{}{
+		"path": secret, "content": "", "dry_run": true,
+	})
+	require.NoError(t, err)
+	change := decodeDryRun(t, result)
+	assert.Equal(t, "overwrite", change.Action)
+	assert.Equal(t, int64(26), change.BytesBefore)
+	assert.Empty(t, change.Diff)
+
+	result, err = callTool(provider.handleEditFile, context.Background(), map[string]interface{}{
+		"path": secret, "content": "", "start_line": float64(1), "end_line": float64(1), "dry_run": true,
+	})
+	require.NoError(t, err)
+	change = decodeDryRun(t, result)
+	assert.Equal(t, "modify", change.Action)
+	assert.Empty(t, change.Diff)
+}
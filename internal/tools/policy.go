@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Access is the kind of access requested on a path
+type Access int
+
+const (
+	// ReadAccess covers reading, listing and searching
+	ReadAccess Access = iota
+	// WriteAccess covers creating, modifying, moving and deleting
+	WriteAccess
+)
+
+// PolicyRule allows or denies access to paths matching a glob pattern inside the
+// allowed directories.
+//
+// Patterns are matched against the slash-separated path relative to the allowed
+// directory. A pattern without a slash matches a file or directory name at any
+// depth (".env", "*.pem"); a pattern with a slash is anchored at the allowed
+// directory ("config/*.yaml"). "**" matches any number of directories. A rule
+// matching a directory applies to everything below it, so "secrets/" and
+// ".git/**" both cover the whole directory.
+type PolicyRule struct {
+	Root    string // Allowed directory the rule applies to, empty for all of them
+	Pattern string // Glob pattern
+	Allow   bool   // Whether a match grants (true) or refuses (false) access
+	Read    bool   // Whether the rule applies to read access
+	Write   bool   // Whether the rule applies to write access
+}
+
+// compiledRule is a PolicyRule with its pattern split into segments
+type compiledRule struct {
+	PolicyRule
+	segments []string
+	anchored bool
+}
+
+// PathPolicy evaluates ordered allow and deny rules. The first rule matching a
+// path decides; paths matching no rule are allowed.
+type PathPolicy struct {
+	rules []compiledRule
+}
+
+// NewPathPolicy compiles rules into a PathPolicy
+func NewPathPolicy(rules []PolicyRule) (*PathPolicy, error) {
+	policy := &PathPolicy{}
+	for _, rule := range rules {
+		pattern := strings.Trim(filepath.ToSlash(rule.Pattern), "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("empty policy pattern")
+		}
+
+		segments := strings.Split(pattern, "/")
+		for _, segment := range segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid policy pattern %q: %w", rule.Pattern, err)
+			}
+		}
+
+		if rule.Root != "" {
+			if abs, err := filepath.Abs(ExpandHome(rule.Root)); err == nil {
+				rule.Root = filepath.Clean(abs)
+			}
+		}
+
+		policy.rules = append(policy.rules, compiledRule{
+			PolicyRule: rule,
+			segments:   segments,
+			anchored:   len(segments) > 1,
+		})
+	}
+	return policy, nil
+}
+
+// Empty reports whether the policy has no rules
+func (p *PathPolicy) Empty() bool {
+	return p == nil || len(p.rules) == 0
+}
+
+// HasWriteRules reports whether any rule restricts write access
+func (p *PathPolicy) HasWriteRules() bool {
+	if p == nil {
+		return false
+	}
+	for _, rule := range p.rules {
+		if rule.Write {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits reports whether access to the path at rel, relative to root, is allowed
+func (p *PathPolicy) Permits(root, rel string, access Access) bool {
+	if p.Empty() {
+		return true
+	}
+
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == "" {
+		// The allowed directory itself is always reachable
+		return true
+	}
+	parts := strings.Split(rel, "/")
+
+	for _, rule := range p.rules {
+		if rule.Root != "" && rule.Root != root {
+			continue
+		}
+		if (access == ReadAccess && !rule.Read) || (access == WriteAccess && !rule.Write) {
+			continue
+		}
+		if rule.matches(parts) {
+			return rule.Allow
+		}
+	}
+
+	return true
+}
+
+// matches reports whether the rule matches the path or one of its ancestors
+func (r compiledRule) matches(parts []string) bool {
+	if !r.anchored {
+		for _, part := range parts {
+			if ok, _ := path.Match(r.segments[0], part); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 1; i <= len(parts); i++ {
+		if matchSegments(r.segments, parts[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches glob segments against path segments, with "**"
+// matching zero or more path segments
+func matchSegments(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchSegments(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], parts[1:])
+}
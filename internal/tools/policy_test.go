@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPathPolicy(t *testing.T) {
+	policy, err := NewPathPolicy(nil)
+	assert.NoError(t, err)
+	assert.True(t, policy.Empty())
+	assert.False(t, policy.HasWriteRules())
+
+	_, err = NewPathPolicy([]PolicyRule{{Pattern: "", Read: true}})
+	assert.Error(t, err)
+
+	_, err = NewPathPolicy([]PolicyRule{{Pattern: "[", Read: true}})
+	assert.Error(t, err)
+
+	policy, err = NewPathPolicy([]PolicyRule{{Pattern: "vendor", Write: true}})
+	assert.NoError(t, err)
+	assert.False(t, policy.Empty())
+	assert.True(t, policy.HasWriteRules())
+}
+
+func TestPathPolicy_Permits(t *testing.T) {
+	policy, err := NewPathPolicy([]PolicyRule{
+		{Pattern: "secrets/README.md", Allow: true, Read: true},
+		{Pattern: ".env", Read: true, Write: true},
+		{Pattern: "*.pem", Read: true, Write: true},
+		{Pattern: ".git/**", Read: true, Write: true},
+		{Pattern: "secrets/", Read: true, Write: true},
+		{Pattern: "docs/**/*.md", Write: true},
+		{Root: "/other", Pattern: "*.go", Read: true},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		rel    string
+		access Access
+		want   bool
+	}{
+		{"root is always allowed", ".", ReadAccess, true},
+		{"unmatched path", "main.go", ReadAccess, true},
+		{"name pattern at top level", ".env", ReadAccess, false},
+		{"name pattern nested", "config/.env", WriteAccess, false},
+		{"extension pattern", "certs/server.pem", ReadAccess, false},
+		{"double star directory itself", ".git", ReadAccess, false},
+		{"double star contents", ".git/objects/ab/cdef", ReadAccess, false},
+		{"trailing slash covers contents", "secrets/token.txt", ReadAccess, false},
+		{"earlier allow wins", "secrets/README.md", ReadAccess, true},
+		{"allow applies only to read", "secrets/README.md", WriteAccess, false},
+		{"anchored pattern does not match nested", "lib/docs/intro.md", WriteAccess, true},
+		{"directory name pattern matches nested", "lib/secrets/token.txt", ReadAccess, false},
+		{"write-only rule leaves reads alone", "docs/guide/intro.md", ReadAccess, true},
+		{"write-only rule refuses writes", "docs/guide/intro.md", WriteAccess, false},
+		{"double star matches zero directories", "docs/index.md", WriteAccess, false},
+		{"root-scoped rule ignored elsewhere", "main.go", ReadAccess, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.Permits("/repo", tt.rel, tt.access))
+		})
+	}
+
+	assert.False(t, policy.Permits("/other", "main.go", ReadAccess))
+	assert.True(t, policy.Permits("/other", "main.go", WriteAccess))
+}
+
+// newPolicyProvider creates a provider over a small tree with a path policy applied
+func newPolicyProvider(t *testing.T, rules []PolicyRule) (string, *ServiceProvider) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main // token"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, ".env"), []byte("TOKEN=abc"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "secrets"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "secrets", "key.txt"), []byte("token"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "vendor", "lib"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "vendor", "lib", "lib.go"), []byte("token"), 0644))
+
+	policy, err := NewPathPolicy(rules)
+	require.NoError(t, err)
+	return tmpDir, NewServiceProvider([]string{tmpDir}, WithPathPolicy(policy))
+}
+
+func TestServiceProvider_PathPolicy(t *testing.T) {
+	tmpDir, provider := newPolicyProvider(t, []PolicyRule{
+		{Pattern: ".env", Read: true, Write: true},
+		{Pattern: "secrets/", Read: true, Write: true},
+		{Pattern: "vendor/**", Write: true},
+	})
+
+	t.Run("read refused", func(t *testing.T) {
+		_, err := provider.fileService.ReadFile(filepath.Join(tmpDir, ".env"))
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+		assert.True(t, errors.IsPermissionDenied(err))
+
+		_, err = provider.fileService.ReadFile(filepath.Join(tmpDir, "secrets", "key.txt"))
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+	})
+
+	t.Run("write refused", func(t *testing.T) {
+		err := provider.fileWriter.WriteFile(filepath.Join(tmpDir, "vendor", "lib", "lib.go"), "changed", false)
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+		err = provider.fileManager.MoveFile(filepath.Join(tmpDir, "main.go"), filepath.Join(tmpDir, "secrets", "main.go"))
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+		// Reading is still allowed where only writes are denied
+		content, err := provider.fileService.ReadFile(filepath.Join(tmpDir, "vendor", "lib", "lib.go"))
+		assert.NoError(t, err)
+		assert.Equal(t, "token", content)
+	})
+
+	t.Run("recursive delete refused when it would remove protected paths", func(t *testing.T) {
+		err := provider.directoryService.DeleteDirectory(filepath.Join(tmpDir, "vendor"), true)
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+		assert.DirExists(t, filepath.Join(tmpDir, "vendor", "lib"))
+	})
+
+	t.Run("listing hides denied entries", func(t *testing.T) {
+		entries, err := provider.directoryService.ListDirectory(tmpDir)
+		require.NoError(t, err)
+
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		assert.ElementsMatch(t, []string{"main.go", "vendor"}, names)
+	})
+
+	t.Run("tree hides denied entries", func(t *testing.T) {
+		tree, err := provider.directoryService.DirectoryTree(tmpDir, 3)
+		require.NoError(t, err)
+
+		data, err := json.Marshal(tree)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "lib.go")
+		assert.NotContains(t, string(data), ".env")
+		assert.NotContains(t, string(data), "secrets")
+	})
+
+	t.Run("search skips denied files", func(t *testing.T) {
+		results, err := provider.searchService.SearchFiles("token", tmpDir, true)
+		require.NoError(t, err)
+
+		var paths []string
+		for _, result := range results {
+			paths = append(paths, result.Path)
+		}
+		assert.ElementsMatch(t, []string{
+			filepath.Join(tmpDir, "main.go"),
+			filepath.Join(tmpDir, "vendor", "lib", "lib.go"),
+		}, paths)
+	})
+
+	t.Run("symbolic links cannot reach denied paths", func(t *testing.T) {
+		leak := filepath.Join(tmpDir, "leak")
+		if err := os.Symlink(".env", leak); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		require.NoError(t, os.Symlink(filepath.Join("vendor", "lib", "lib.go"), filepath.Join(tmpDir, "lib.go")))
+		require.NoError(t, os.Symlink(filepath.Join("secrets", "new.txt"), filepath.Join(tmpDir, "new.txt")))
+
+		_, err := provider.fileService.ReadFile(leak)
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+		// Links are held to the rules of their target's access
+		content, err := provider.fileService.ReadFile(filepath.Join(tmpDir, "lib.go"))
+		require.NoError(t, err)
+		assert.Equal(t, "token", content)
+		err = provider.fileWriter.WriteFile(filepath.Join(tmpDir, "lib.go"), "changed", false)
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+		// A link to a missing file cannot create it where writes are denied
+		err = provider.fileWriter.WriteFile(filepath.Join(tmpDir, "new.txt"), "planted", false)
+		assert.ErrorIs(t, err, errors.ErrPathDenied)
+		assert.NoFileExists(t, filepath.Join(tmpDir, "secrets", "new.txt"))
+	})
+}
+
+func TestServiceProvider_HandleDirectoryTree(t *testing.T) {
+	tmpDir, provider := newPolicyProvider(t, nil)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]interface{}{
+		"path":      tmpDir,
+		"max_depth": float64(1),
+	}
+
+	result, err := provider.handleDirectoryTree(t.Context(), request)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 1)
+
+	var tree []TreeEntry
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &tree))
+	assert.Len(t, tree, 4)
+	for _, entry := range tree {
+		assert.Empty(t, entry.Children)
+	}
+
+	request.Params.Arguments = map[string]interface{}{}
+	_, err = provider.handleDirectoryTree(t.Context(), request)
+	assert.True(t, errors.IsInvalidArgument(err))
+}
@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// usageCacheTTL is how long a computed root usage is trusted before it is recomputed
+const usageCacheTTL = time.Minute
+
+// WriteLimits configures write size limits and per-root quotas. Zero disables a limit.
+type WriteLimits struct {
+	MaxWriteSize int64 // Maximum number of bytes in a single write
+	MaxFileSize  int64 // Maximum size of a file after a write or append
+	QuotaBytes   int64 // Maximum total size of the files under each allowed directory
+	QuotaFiles   int64 // Maximum number of files under each allowed directory
+}
+
+// hasQuota reports whether a per-root quota is configured
+func (l WriteLimits) hasQuota() bool {
+	return l.QuotaBytes > 0 || l.QuotaFiles > 0
+}
+
+// Usage is the disk usage of an allowed directory
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// usageEntry is a cached Usage
+type usageEntry struct {
+	usage    Usage
+	computed time.Time
+}
+
+// UsageTracker computes and caches the disk usage of each allowed directory.
+// Successful writes adjust the cached values so that the tree only needs to be
+// walked again once the cache expires.
+type UsageTracker struct {
+	roots []string
+	ttl   time.Duration
+	now   func() time.Time
+	mu    sync.Mutex
+	cache *usageCache
+	fsys  Backend
+}
+
+// usageCache holds the usage of each directory, shared by the trackers of a
+// server and of its tenants' sessions so that a quota counts every write under
+// its directory
+type usageCache struct {
+	mu      sync.Mutex
+	entries map[string]usageEntry
+}
+
+// NewUsageTracker creates a tracker for the given allowed directories
+func NewUsageTracker(allowedDirs []string) *UsageTracker {
+	return &UsageTracker{
+		roots: usageRoots(allowedDirs),
+		ttl:   usageCacheTTL,
+		now:   time.Now,
+		cache: &usageCache{entries: make(map[string]usageEntry)},
+		fsys:  OSBackend{},
+	}
+}
+
+// Scoped returns a tracker for other allowed directories sharing the cached
+// usage of t
+func (t *UsageTracker) Scoped(allowedDirs []string) *UsageTracker {
+	return &UsageTracker{
+		roots: usageRoots(allowedDirs),
+		ttl:   t.ttl,
+		now:   t.now,
+		cache: t.cache,
+		fsys:  t.fsys,
+	}
+}
+
+// usageRoots normalizes the allowed directories
+func usageRoots(allowedDirs []string) []string {
+	roots := make([]string, 0, len(allowedDirs))
+	for _, dir := range allowedDirs {
+		if abs, err := filepath.Abs(ExpandHome(dir)); err == nil {
+			roots = append(roots, filepath.Clean(abs))
+		}
+	}
+	return roots
+}
+
+// SetRoots replaces the allowed directories. The usage of directories that
+// remain allowed stays cached.
+func (t *UsageTracker) SetRoots(allowedDirs []string) {
+	roots := usageRoots(allowedDirs)
+
+	t.mu.Lock()
+	removed := slices.DeleteFunc(t.roots, func(root string) bool { return slices.Contains(roots, root) })
+	t.roots = roots
+	t.mu.Unlock()
+
+	t.cache.mu.Lock()
+	defer t.cache.mu.Unlock()
+	for _, root := range removed {
+		delete(t.cache.entries, root)
+	}
+}
+
+// RootFor returns the most specific allowed directory containing path
+func (t *UsageTracker) RootFor(path string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	best := ""
+	for _, root := range t.roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			if len(root) > len(best) {
+				best = root
+			}
+		}
+	}
+	return best, best != ""
+}
+
+// Usage returns the usage of root, walking the tree if the cached value is missing or stale
+func (t *UsageTracker) Usage(root string) Usage {
+	t.cache.mu.Lock()
+	entry, ok := t.cache.entries[root]
+	t.cache.mu.Unlock()
+
+	if ok && t.now().Sub(entry.computed) < t.ttl {
+		return entry.usage
+	}
+
+	usage := computeUsage(t.fsys, root)
+
+	t.cache.mu.Lock()
+	t.cache.entries[root] = usageEntry{usage: usage, computed: t.now()}
+	t.cache.mu.Unlock()
+
+	return usage
+}
+
+// Adjust applies a change under root to the cached usage of root and of the
+// cached directories containing it
+func (t *UsageTracker) Adjust(root string, bytes, files int64) {
+	t.cache.mu.Lock()
+	defer t.cache.mu.Unlock()
+
+	for dir, entry := range t.cache.entries {
+		if within(dir, root) {
+			entry.usage.Bytes += bytes
+			entry.usage.Files += files
+			t.cache.entries[dir] = entry
+		}
+	}
+}
+
+// Invalidate drops the cached usage of root so that it is recomputed on next use
+func (t *UsageTracker) Invalidate(root string) {
+	t.cache.invalidate(root)
+}
+
+// invalidate drops the cached usage of root and of the cached directories
+// containing it or inside it, whose usage a change under root may also affect
+func (c *usageCache) invalidate(root string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for dir := range c.entries {
+		if within(dir, root) || within(root, dir) {
+			delete(c.entries, dir)
+		}
+	}
+}
+
+// InvalidatePath drops the cached usage of the allowed directory containing path
+func (t *UsageTracker) InvalidatePath(path string) {
+	if root, ok := t.RootFor(path); ok {
+		t.Invalidate(root)
+	}
+}
+
+// computeUsage walks root and sums the sizes of the regular files below it
+func computeUsage(fsys Backend, root string) Usage {
+	var usage Usage
+	_ = walkDir(fsys, root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		usage.Bytes += info.Size()
+		usage.Files++
+		return nil
+	})
+	return usage
+}
+
+// usageChange is the effect a pending write will have on a root's usage
+type usageChange struct {
+	root  string
+	bytes int64
+	files int64
+}
+
+// checkWrite validates a pending write of writeSize bytes that leaves the file at
+// validPath with newSize bytes. It returns the usage change to commit once the
+// write has succeeded.
+func (s *FileService) checkWrite(validPath string, writeSize, newSize int64) (*usageChange, error) {
+	limits := s.validator.WriteLimits()
+	if limits.MaxWriteSize > 0 && writeSize > limits.MaxWriteSize {
+		return nil, errors.NewQuotaError("max_write_size", limits.MaxWriteSize, writeSize)
+	}
+	if limits.MaxFileSize > 0 && newSize > limits.MaxFileSize {
+		return nil, errors.NewQuotaError("max_file_size", limits.MaxFileSize, newSize)
+	}
+
+	if s.usage == nil {
+		return nil, nil
+	}
+	root, ok := s.usage.RootFor(validPath)
+	if !ok {
+		return nil, nil
+	}
+
+	change := &usageChange{root: root, bytes: newSize, files: 1}
+	if info, err := s.fsys.Stat(validPath); err == nil {
+		change.bytes -= info.Size()
+		change.files = 0
+	}
+
+	if !limits.hasQuota() {
+		return change, nil
+	}
+
+	usage := s.usage.Usage(root)
+	if limits.QuotaBytes > 0 && change.bytes > 0 && usage.Bytes+change.bytes > limits.QuotaBytes {
+		return nil, errors.NewQuotaError("quota_bytes", limits.QuotaBytes, usage.Bytes+change.bytes)
+	}
+	if limits.QuotaFiles > 0 && change.files > 0 && usage.Files+change.files > limits.QuotaFiles {
+		return nil, errors.NewQuotaError("quota_files", limits.QuotaFiles, usage.Files+change.files)
+	}
+
+	return change, nil
+}
+
+// commitUsage records a completed change in the usage tracker
+func (s *FileService) commitUsage(change *usageChange) {
+	if s.usage == nil || change == nil {
+		return
+	}
+	s.usage.Adjust(change.root, change.bytes, change.files)
+}
+
+// crossesRoots reports whether two validated paths belong to different allowed directories
+func (s *FileService) crossesRoots(a, b string) bool {
+	if s.usage == nil {
+		return false
+	}
+	rootA, _ := s.usage.RootFor(a)
+	rootB, _ := s.usage.RootFor(b)
+	return rootA != rootB
+}
+
+// releaseUsage records that a file of size bytes was removed from validPath
+func (s *FileService) releaseUsage(validPath string, size int64) {
+	if s.usage == nil {
+		return
+	}
+	if root, ok := s.usage.RootFor(validPath); ok {
+		s.usage.Adjust(root, -size, -1)
+	}
+}
@@ -0,0 +1,205 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLimitedFileService(t *testing.T, limits WriteLimits) (string, *FileService) {
+	tmpDir := t.TempDir()
+	service := NewFileService([]string{tmpDir})
+	service.validator.writes = limits
+	service.usage = NewUsageTracker([]string{tmpDir})
+	return tmpDir, service
+}
+
+func TestUsageTracker(t *testing.T) {
+	tmpDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("12345"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(tmpDir, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "sub", "b.txt"), []byte("123"), 0644))
+
+	tracker := NewUsageTracker([]string{tmpDir})
+	now := time.Unix(0, 0)
+	tracker.now = func() time.Time { return now }
+
+	root, ok := tracker.RootFor(filepath.Join(tmpDir, "sub", "b.txt"))
+	assert.True(t, ok)
+	assert.Equal(t, tmpDir, root)
+	_, ok = tracker.RootFor("/elsewhere")
+	assert.False(t, ok)
+
+	assert.Equal(t, Usage{Bytes: 8, Files: 2}, tracker.Usage(tmpDir))
+
+	// Cached values are adjusted in place
+	tracker.Adjust(tmpDir, 10, 1)
+	assert.Equal(t, Usage{Bytes: 18, Files: 3}, tracker.Usage(tmpDir))
+
+	// Once stale the tree is walked again
+	now = now.Add(2 * usageCacheTTL)
+	assert.Equal(t, Usage{Bytes: 8, Files: 2}, tracker.Usage(tmpDir))
+
+	// Invalidation forces a recompute
+	assert.NoError(t, os.Remove(filepath.Join(tmpDir, "a.txt")))
+	tracker.InvalidatePath(filepath.Join(tmpDir, "a.txt"))
+	assert.Equal(t, Usage{Bytes: 3, Files: 1}, tracker.Usage(tmpDir))
+}
+
+func TestUsageTrackerNestedRoots(t *testing.T) {
+	tmpDir := t.TempDir()
+	nested := filepath.Join(tmpDir, "nested")
+
+	tracker := NewUsageTracker([]string{tmpDir, nested})
+	root, ok := tracker.RootFor(filepath.Join(nested, "file.txt"))
+	assert.True(t, ok)
+	assert.Equal(t, nested, root)
+}
+
+func TestFileService_MaxWriteSize(t *testing.T) {
+	tmpDir, service := newLimitedFileService(t, WriteLimits{MaxWriteSize: 4})
+	path := filepath.Join(tmpDir, "file.txt")
+
+	assert.NoError(t, service.WriteFile(path, "1234", false))
+
+	err := service.WriteFile(path, "12345", false)
+	assert.True(t, errors.IsQuotaExceeded(err))
+	assert.Contains(t, err.Error(), "max_write_size")
+
+	// The rejected write did not touch the file
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "1234", string(content))
+}
+
+func TestFileService_MaxFileSize(t *testing.T) {
+	tmpDir, service := newLimitedFileService(t, WriteLimits{MaxFileSize: 6})
+	path := filepath.Join(tmpDir, "file.txt")
+
+	assert.NoError(t, service.WriteFile(path, "1234", false))
+	assert.NoError(t, service.WriteFile(path, "56", true))
+
+	err := service.WriteFile(path, "7", true)
+	assert.True(t, errors.IsQuotaExceeded(err))
+	assert.Contains(t, err.Error(), "max_file_size")
+
+	// Edits are checked against the resulting file size
+	err = service.EditFile(path, "1234567", 1, 1)
+	assert.True(t, errors.IsQuotaExceeded(err))
+
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "123456", string(content))
+}
+
+func TestFileService_QuotaBytes(t *testing.T) {
+	tmpDir, service := newLimitedFileService(t, WriteLimits{QuotaBytes: 10})
+
+	assert.NoError(t, service.WriteFile(filepath.Join(tmpDir, "a.txt"), "123456", false))
+
+	err := service.WriteFile(filepath.Join(tmpDir, "b.txt"), "12345", false)
+	assert.True(t, errors.IsQuotaExceeded(err))
+	assert.Contains(t, err.Error(), "quota_bytes")
+	_, statErr := os.Stat(filepath.Join(tmpDir, "b.txt"))
+	assert.True(t, os.IsNotExist(statErr))
+
+	// Overwriting with smaller content is always allowed
+	assert.NoError(t, service.WriteFile(filepath.Join(tmpDir, "a.txt"), "1", false))
+	assert.NoError(t, service.WriteFile(filepath.Join(tmpDir, "b.txt"), "12345", false))
+
+	// Copies count against the quota too
+	err = service.CopyFile(filepath.Join(tmpDir, "b.txt"), filepath.Join(tmpDir, "c.txt"))
+	assert.True(t, errors.IsQuotaExceeded(err))
+
+	// Deleting frees space
+	assert.NoError(t, service.DeleteFile(filepath.Join(tmpDir, "b.txt")))
+	assert.NoError(t, service.WriteFile(filepath.Join(tmpDir, "c.txt"), "123456789", false))
+}
+
+func TestFileService_QuotaFiles(t *testing.T) {
+	tmpDir, service := newLimitedFileService(t, WriteLimits{QuotaFiles: 2})
+
+	assert.NoError(t, service.WriteFile(filepath.Join(tmpDir, "a.txt"), "a", false))
+	assert.NoError(t, service.WriteFile(filepath.Join(tmpDir, "b.txt"), "b", false))
+
+	err := service.WriteFile(filepath.Join(tmpDir, "c.txt"), "c", false)
+	assert.True(t, errors.IsQuotaExceeded(err))
+	assert.Contains(t, err.Error(), "quota_files")
+
+	// Rewriting an existing file does not add to the count
+	assert.NoError(t, service.WriteFile(filepath.Join(tmpDir, "a.txt"), "aa", false))
+}
+
+func TestFileService_MoveAcrossRootsChecksQuota(t *testing.T) {
+	rootA := t.TempDir()
+	rootB := t.TempDir()
+	service := NewFileService([]string{rootA, rootB})
+	service.validator.writes = WriteLimits{QuotaBytes: 5}
+	service.usage = NewUsageTracker([]string{rootA, rootB})
+
+	assert.NoError(t, os.WriteFile(filepath.Join(rootA, "big.txt"), []byte(strings.Repeat("x", 4)), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(rootB, "existing.txt"), []byte("xx"), 0644))
+
+	// Renames within a root are unaffected by the quota
+	assert.NoError(t, service.MoveFile(filepath.Join(rootA, "big.txt"), filepath.Join(rootA, "renamed.txt")))
+
+	err := service.MoveFile(filepath.Join(rootA, "renamed.txt"), filepath.Join(rootB, "moved.txt"))
+	assert.True(t, errors.IsQuotaExceeded(err))
+	_, statErr := os.Stat(filepath.Join(rootA, "renamed.txt"))
+	assert.NoError(t, statErr)
+}
+
+func TestServiceProviderWriteLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	provider := NewServiceProvider([]string{tmpDir}, WithWriteLimits(WriteLimits{MaxWriteSize: 2}))
+
+	err := provider.fileWriter.WriteFile(filepath.Join(tmpDir, "file.txt"), "123", false)
+	assert.True(t, errors.IsQuotaExceeded(err))
+}
+
+func TestUsageTrackerSetRoots(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dirA, "a.txt"), []byte("12345"), 0644))
+
+	tracker := NewUsageTracker([]string{dirA})
+	assert.Equal(t, Usage{Bytes: 5, Files: 1}, tracker.Usage(dirA))
+	tracker.Adjust(dirA, 10, 0)
+
+	tracker.SetRoots([]string{dirA, dirB})
+	root, ok := tracker.RootFor(filepath.Join(dirB, "b.txt"))
+	assert.True(t, ok)
+	assert.Equal(t, dirB, root)
+	assert.Equal(t, Usage{Bytes: 15, Files: 1}, tracker.Usage(dirA), "usage of a remaining root stays cached")
+
+	tracker.SetRoots([]string{dirB})
+	_, ok = tracker.RootFor(filepath.Join(dirA, "a.txt"))
+	assert.False(t, ok)
+	tracker.SetRoots([]string{dirA})
+	assert.Equal(t, Usage{Bytes: 5, Files: 1}, tracker.Usage(dirA), "usage of a removed root is forgotten")
+}
+
+func TestUsageTrackerScoped(t *testing.T) {
+	tmpDir := t.TempDir()
+	nested := filepath.Join(tmpDir, "team")
+	assert.NoError(t, os.Mkdir(nested, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(nested, "a.txt"), []byte("12345"), 0644))
+
+	server := NewUsageTracker([]string{tmpDir})
+	first := server.Scoped([]string{nested})
+	second := server.Scoped([]string{nested})
+	assert.Equal(t, Usage{Bytes: 5, Files: 1}, server.Usage(tmpDir))
+	assert.Equal(t, Usage{Bytes: 5, Files: 1}, first.Usage(nested))
+
+	// Changes counted by one tracker are seen by the others, including the
+	// trackers of directories containing the change
+	first.Adjust(nested, 10, 1)
+	assert.Equal(t, Usage{Bytes: 15, Files: 2}, second.Usage(nested))
+	assert.Equal(t, Usage{Bytes: 15, Files: 2}, server.Usage(tmpDir))
+
+	second.InvalidatePath(filepath.Join(nested, "a.txt"))
+	assert.Equal(t, Usage{Bytes: 5, Files: 1}, server.Usage(tmpDir))
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// minSecretEntropy is the minimum Shannon entropy, in bits per character, of a
+// value assigned to a KEY=, TOKEN= or similar variable for it to be redacted
+const minSecretEntropy = 3.5
+
+// redactionRule detects one kind of secret
+type redactionRule struct {
+	kind    string
+	pattern *regexp.Regexp
+	// group is the capture group to mask, 0 for the whole match
+	group int
+	// accept optionally filters candidate values
+	accept func(value string) bool
+}
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN[ A-Z0-9]*PRIVATE KEY( BLOCK)?-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END[ A-Z0-9]*PRIVATE KEY( BLOCK)?-----`)
+)
+
+// builtinRedactionRules returns the detectors for common secret formats
+func builtinRedactionRules() []redactionRule {
+	return []redactionRule{
+		{
+			kind:    "private_key",
+			pattern: regexp.MustCompile(`-----BEGIN[ A-Z0-9]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END[ A-Z0-9]*PRIVATE KEY( BLOCK)?-----`),
+		},
+		{
+			kind:    "aws_access_key",
+			pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[0-9A-Z]{16}\b`),
+		},
+		{
+			kind:    "aws_secret_key",
+			pattern: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`),
+			group:   1,
+		},
+		{
+			kind:    "jwt",
+			pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+		},
+		{
+			kind:    "secret_assignment",
+			pattern: regexp.MustCompile(`(?i)[A-Z0-9_.-]*(?:KEY|SECRET|TOKEN|PASSWORD|PASSWD|PWD|CREDENTIALS?|AUTH)[A-Z0-9_.-]*["']?\s*[:=]\s*["']?([^\s"'#,;]{12,})`),
+			group:   1,
+			accept: func(value string) bool {
+				return !strings.HasPrefix(value, "[REDACTED") && shannonEntropy(value) >= minSecretEntropy
+			},
+		},
+	}
+}
+
+// Redactor masks secrets in content returned to clients
+type Redactor struct {
+	rules []redactionRule
+}
+
+// NewRedactor creates a Redactor with the built-in detectors and any custom
+// regular expressions. A custom expression with a capture group masks only the
+// first group, otherwise the whole match is masked.
+func NewRedactor(customPatterns []string) (*Redactor, error) {
+	r := &Redactor{rules: builtinRedactionRules()}
+	for _, expr := range customPatterns {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+
+		rule := redactionRule{kind: "custom", pattern: pattern}
+		if pattern.NumSubexp() > 0 {
+			rule.group = 1
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// Redact masks secrets in content and returns the result and the number of
+// redactions made
+func (r *Redactor) Redact(content string) (string, int) {
+	if r == nil {
+		return content, 0
+	}
+
+	total := 0
+	for _, rule := range r.rules {
+		var count int
+		content, count = rule.apply(content)
+		total += count
+	}
+	return content, total
+}
+
+// apply masks every match of the rule in content
+func (rule redactionRule) apply(content string) (string, int) {
+	matches := rule.pattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return content, 0
+	}
+
+	var b strings.Builder
+	last, count := 0, 0
+	for _, match := range matches {
+		start, end := match[2*rule.group], match[2*rule.group+1]
+		if start < 0 {
+			continue
+		}
+		if rule.accept != nil && !rule.accept(content[start:end]) {
+			continue
+		}
+
+		b.WriteString(content[last:start])
+		b.WriteString(redactionMask(rule.kind))
+		last = end
+		count++
+	}
+	b.WriteString(content[last:])
+
+	return b.String(), count
+}
+
+// redactionMask returns the replacement text for a secret of the given kind
+func redactionMask(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// lineRedactor redacts a file one line at a time, remembering whether it is
+// inside a private key block
+type lineRedactor struct {
+	redactor     *Redactor
+	inPrivateKey bool
+}
+
+// redact masks secrets in the next line of the file
+func (l *lineRedactor) redact(line string) (string, int) {
+	if l.inPrivateKey {
+		if privateKeyEnd.MatchString(line) {
+			l.inPrivateKey = false
+		}
+		return redactionMask("private_key"), 0
+	}
+
+	if privateKeyBegin.MatchString(line) && !privateKeyEnd.MatchString(line) {
+		l.inPrivateKey = true
+		return redactionMask("private_key"), 1
+	}
+
+	return l.redactor.Redact(line)
+}
+
+// RedactLines masks secrets in the lines of a file, keeping each line's
+// terminator so that the number of lines does not change
+func (r *Redactor) RedactLines(lines []string) ([]string, int) {
+	if r == nil {
+		return lines, 0
+	}
+
+	l := &lineRedactor{redactor: r}
+	redacted := make([]string, len(lines))
+	total := 0
+	for i, line := range lines {
+		text := strings.TrimRight(line, "\r\n")
+		masked, count := l.redact(text)
+		redacted[i] = masked + line[len(text):]
+		total += count
+	}
+	return redacted, total
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
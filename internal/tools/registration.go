@@ -4,11 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/moguyn/mcp-go-filesystem/internal/errors"
 	"github.com/moguyn/mcp-go-filesystem/internal/logging"
+	"github.com/moguyn/mcp-go-filesystem/internal/metrics"
+	"github.com/moguyn/mcp-go-filesystem/internal/ratelimit"
 )
 
 // ServiceProvider provides access to all services
@@ -18,62 +21,230 @@ type ServiceProvider struct {
 	fileManager      FileManager
 	directoryService DirectoryManager
 	searchService    SearchProvider
+	archiveService   ArchiveManager
+	gitService       GitManager
+	overlayService   OverlayManager
 	logger           *logging.Logger
-	allowedDirs      []string
+	metrics          *metrics.Metrics
+	writeLimits      WriteLimits
+	archiveLimits    ArchiveLimits
+	usage            *UsageTracker
+	policy           *PathPolicy
+	redactor         *Redactor
+	confirmations    *confirmations
+	dryRun           bool
+	validator        *PathValidatorImpl
+	workDir          string
+	backends         []BackendBinding
+	fsys             Backend // Storage of the allowed directories
+
+	// Settings a reload can change, guarded by mu
+	mu            sync.RWMutex
+	limits        *limits
+	rateLimits    ratelimit.Config
+	toolSelection ToolSelection
+	gitCommit     bool
+	enabledTools  []string
+	tenants       []Tenant
+
+	// Sessions served by their own provider, guarded by sessionsMu
+	clientRoots bool
+	sessionsMu  sync.Mutex
+	sessions    map[string]*sessionState
+}
+
+// ProviderOption configures a ServiceProvider
+type ProviderOption func(*ServiceProvider)
+
+// WithMetrics makes the provider record tool metrics into m instead of a private set
+func WithMetrics(m *metrics.Metrics) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.metrics = m
+	}
+}
+
+// WithWriteLimits enforces write size limits and per-root quotas
+func WithWriteLimits(limits WriteLimits) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.writeLimits = limits
+	}
+}
+
+// WithArchiveLimits replaces the default limits protecting archive extraction
+func WithArchiveLimits(limits ArchiveLimits) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.archiveLimits = limits
+	}
+}
+
+// WithGitCommit registers the git_commit tool, which commits staged changes
+func WithGitCommit(enabled bool) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.gitCommit = enabled
+	}
+}
+
+// WithWorkDir resolves relative paths against dir instead of the process's working directory
+func WithWorkDir(dir string) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.workDir = dir
+	}
+}
+
+// WithPathPolicy applies allow and deny rules inside the allowed directories
+func WithPathPolicy(policy *PathPolicy) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.policy = policy
+	}
+}
+
+// WithRedactor masks secrets in read and search output
+func WithRedactor(redactor *Redactor) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.redactor = redactor
+	}
 }
 
 // NewServiceProvider creates a new ServiceProvider
-func NewServiceProvider(allowedDirectories []string) *ServiceProvider {
+func NewServiceProvider(allowedDirectories []string, opts ...ProviderOption) *ServiceProvider {
+	provider := &ServiceProvider{
+		logger:        logging.DefaultLogger("service_provider"),
+		usage:         NewUsageTracker(allowedDirectories),
+		archiveLimits: DefaultArchiveLimits(),
+	}
+
+	for _, opt := range opts {
+		opt(provider)
+	}
+
+	if provider.metrics == nil {
+		provider.metrics = metrics.New()
+	}
+
+	if provider.fsys == nil {
+		fsys, err := newBackend(provider.backends)
+		if err != nil {
+			provider.logger.Error("Invalid storage backends, using the local filesystem: %v", err)
+			fsys = OSBackend{}
+		}
+		provider.fsys = fsys
+	}
+	provider.usage.fsys = provider.fsys
+
+	// All services share one validator so that the path policy and limits
+	// apply consistently and a reload changes them everywhere at once
+	validator := &PathValidatorImpl{
+		allowedDirs: allowedDirectories,
+		policy:      provider.policy,
+		writes:      provider.writeLimits,
+		archives:    provider.archiveLimits,
+		workDir:     provider.workDir,
+		fsys:        provider.fsys,
+	}
+	provider.setValidator(allowedDirectories, validator)
+
+	return provider
+}
+
+// setValidator makes validator the access policy of p and creates the services enforcing it
+func (p *ServiceProvider) setValidator(allowedDirectories []string, validator *PathValidatorImpl) {
+	p.validator = validator
+
 	fileService := NewFileService(allowedDirectories)
+	fileService.validator = validator
+	fileService.usage = p.usage
+	fileService.fsys = p.fsys
+
 	directoryService := NewDirectoryService(allowedDirectories)
+	directoryService.validator = validator
+	directoryService.usage = p.usage
+	directoryService.fsys = p.fsys
+
 	searchService := NewSearchService(allowedDirectories)
+	searchService.validator = validator
+	searchService.redactor = p.redactor
+	searchService.fsys = p.fsys
+
+	archiveService := NewArchiveService(allowedDirectories)
+	archiveService.validator = validator
+	archiveService.files = fileService
+	archiveService.fsys = p.fsys
+
+	gitService := NewGitService(allowedDirectories)
+	gitService.validator = validator
+
+	overlayService := NewOverlayService(allowedDirectories)
+	overlayService.validator = validator
+	overlayService.fsys = p.fsys
+
+	p.fileService = fileService
+	p.fileWriter = fileService
+	p.fileManager = fileService
+	p.directoryService = directoryService
+	p.searchService = searchService
+	p.archiveService = archiveService
+	p.gitService = gitService
+	p.overlayService = overlayService
+}
 
-	return &ServiceProvider{
-		fileService:      fileService,
-		fileWriter:       fileService,
-		fileManager:      fileService,
-		directoryService: directoryService,
-		searchService:    searchService,
-		logger:           logging.DefaultLogger("service_provider"),
-		allowedDirs:      allowedDirectories,
-	}
+// Metrics returns the metrics recorded by the provider's tool handlers
+func (p *ServiceProvider) Metrics() *metrics.Metrics {
+	return p.metrics
 }
 
 // ListAllowedDirectories returns the list of allowed directories
 func (p *ServiceProvider) ListAllowedDirectories() []string {
-	return p.allowedDirs
+	return p.validator.AllowedDirs()
+}
+
+// RegisterTools registers all filesystem tools with the MCP server and returns the
+// provider backing them
+func RegisterTools(s *server.MCPServer, allowedDirectories []string, opts ...ProviderOption) *ServiceProvider {
+	provider := NewServiceProvider(allowedDirectories, opts...)
+	provider.Register(s)
+	return provider
 }
 
-// RegisterTools registers all filesystem tools with the MCP server
-func RegisterTools(s *server.MCPServer, allowedDirectories []string) {
-	// Create service provider
-	provider := NewServiceProvider(allowedDirectories)
+// Register registers the selected tools with the MCP server. After a reload
+// changes the selection they are registered again with a new server.
+func (p *ServiceProvider) Register(s *server.MCPServer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enabledTools = nil
 
 	// Register read_file tool
 	readFileTool := mcp.NewTool("read_file",
-		mcp.WithDescription(`description: Read the complete contents of a file from the file system. This tool safely reads files only within allowed directories and handles various encodings. Returns the full text content of the specified file.
-demo_commands: [{"path": "/allowed/directory/file.txt"}, {"path": "/allowed/directory/documents/document.md"}]`),
+		mcp.WithDescription(`description: Read the complete contents of a file from the file system. This tool safely reads files only within allowed directories and handles various encodings. Returns the full text content of the specified file. Set line_numbers to prefix each line with its number (right-aligned, followed by a tab) and use start_line and end_line to read part of the file; the numbers are the ones edit_file expects. Files inside zip, jar, tar and tar.gz archives can be read without extracting them by separating the archive's path from the entry's with "!", and .gz files are decompressed.
+demo_commands: [{"path": "/allowed/directory/file.txt"}, {"path": "/allowed/directory/documents/document.md"}, {"path": "/allowed/directory/dist/app.zip!/config/app.yaml"}, {"path": "/allowed/directory/src/main.go", "line_numbers": true, "start_line": 40, "end_line": 60}]`),
 		mcp.WithString("path",
 			mcp.Required(),
 			mcp.Description("Path to the file to read"),
 		),
+		mcp.WithBoolean("line_numbers",
+			mcp.Description("Prefix each line with its line number, as used by edit_file's start_line and end_line"),
+		),
+		mcp.WithNumber("start_line",
+			mcp.Description("First line to read (1-indexed, default: 1)"),
+		),
+		mcp.WithNumber("end_line",
+			mcp.Description("Last line to read (1-indexed, inclusive, default: the last line)"),
+		),
 	)
-	s.AddTool(readFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleReadFile(ctx, request)
-	})
+	p.addTool(s, readFileTool, (*ServiceProvider).handleReadFile)
 
 	// Register read_multiple_files tool
 	readMultipleFilesTool := mcp.NewTool("read_multiple_files",
-		mcp.WithDescription(`description: Read multiple files in a single operation. This is more efficient than making separate read requests when analyzing related files. Provide a JSON array of file paths, and receive a JSON object mapping each path to its content.
-demo_commands: [{"paths": "[\"/allowed/directory/config.json\", \"/allowed/directory/settings.yaml\", \"/allowed/directory/data/sample.txt\"]"}]`),
+		mcp.WithDescription(`description: Read multiple files in a single operation. This is more efficient than making separate read requests when analyzing related files. Provide a JSON array of file paths, and receive a JSON object mapping each path to its content. Set line_numbers to prefix each line with its number.
+demo_commands: [{"paths": "[\"/allowed/directory/config.json\", \"/allowed/directory/settings.yaml\", \"/allowed/directory/data/sample.txt\"]"}, {"paths": "[\"/allowed/directory/main.go\", \"/allowed/directory/util.go\"]", "line_numbers": true}]`),
 		mcp.WithString("paths",
 			mcp.Required(),
 			mcp.Description("JSON array of paths to the files to read"),
 		),
+		mcp.WithBoolean("line_numbers",
+			mcp.Description("Prefix each line with its line number, as used by edit_file's start_line and end_line"),
+		),
 	)
-	s.AddTool(readMultipleFilesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleReadMultipleFiles(ctx, request)
-	})
+	p.addTool(s, readMultipleFilesTool, (*ServiceProvider).handleReadMultipleFiles)
 
 	// Register write_file tool
 	writeFileTool := mcp.NewTool("write_file",
@@ -90,14 +261,46 @@ demo_commands: [{"path": "/allowed/directory/new_file.txt", "content": "Hello, w
 		mcp.WithBoolean("append",
 			mcp.Description("Whether to append to the file instead of overwriting it"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
 	)
-	s.AddTool(writeFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleWriteFile(ctx, request)
-	})
+	p.addTool(s, writeFileTool, (*ServiceProvider).handleWriteFile)
+
+	// Register merge_files tool
+	mergeFilesTool := mcp.NewTool("merge_files",
+		mcp.WithDescription(`description: Reconcile two versions of a file edited from a common base with a line-based three-way merge. Each of base, ours and theirs is given as a path or as inline content (base_content, ours_content, theirs_content). Changes made on only one side, or identically on both, are merged; regions changed differently on both sides are written between <<<<<<< ours, ======= and >>>>>>> theirs markers and listed in conflicts with their line numbers. Writes the result to output_path, or returns it as content if output_path is not given.
+demo_commands: [{"base": "/allowed/directory/config.orig.yaml", "ours": "/allowed/directory/config.yaml", "theirs": "/allowed/directory/config.agent2.yaml", "output_path": "/allowed/directory/config.yaml"}, {"base_content": "a\nb\n", "ours_content": "a\nB\n", "theirs_content": "A\nb\n"}]`),
+		mcp.WithString("base",
+			mcp.Description("Path to the common ancestor of ours and theirs"),
+		),
+		mcp.WithString("ours",
+			mcp.Description("Path to our version"),
+		),
+		mcp.WithString("theirs",
+			mcp.Description("Path to their version"),
+		),
+		mcp.WithString("base_content",
+			mcp.Description("Content of the common ancestor, instead of base"),
+		),
+		mcp.WithString("ours_content",
+			mcp.Description("Content of our version, instead of ours"),
+		),
+		mcp.WithString("theirs_content",
+			mcp.Description("Content of their version, instead of theirs"),
+		),
+		mcp.WithString("output_path",
+			mcp.Description("Path to write the merged content to, even if it has conflicts; if not given, the content is returned"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
+	)
+	p.addTool(s, mergeFilesTool, (*ServiceProvider).handleMergeFiles)
 
 	// Register edit_file tool
 	editFileTool := mcp.NewTool("edit_file",
-		mcp.WithDescription(`description: Edit a specific portion of a file by replacing lines between start_line and end_line with new content. This is useful for making precise changes without rewriting the entire file. Line numbers are 1-indexed.
+		mcp.WithDescription(`description: Edit a specific portion of a file by replacing lines between start_line and end_line with new content. This is useful for making precise changes without rewriting the entire file. Line numbers are 1-indexed; read the file with line_numbers set to find them.
 demo_commands: [{"path": "/allowed/directory/config.json", "content": "  \"debug\": true,", "start_line": 5, "end_line": 5}, {"path": "/allowed/directory/src/main.go", "content": "// TODO: Implement error handling", "start_line": 42, "end_line": 45}]`),
 		mcp.WithString("path",
 			mcp.Required(),
@@ -115,23 +318,200 @@ demo_commands: [{"path": "/allowed/directory/config.json", "content": "  \"debug
 			mcp.Required(),
 			mcp.Description("Line number to end editing at (1-indexed, inclusive)"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
 	)
-	s.AddTool(editFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleEditFile(ctx, request)
-	})
+	p.addTool(s, editFileTool, (*ServiceProvider).handleEditFile)
+
+	// Register insert_lines tool
+	insertLinesTool := mcp.NewTool("insert_lines",
+		mcp.WithDescription(`description: Insert lines into a file before or after a given line without replacing anything. Use line 0 with position "after" to insert at the start of the file and line -1 to insert at the end. New lines use the file's line ending, and the file keeps or lacks a final newline as before. Line numbers are 1-indexed, as shown by read_file with line_numbers.
+demo_commands: [{"path": "/allowed/directory/src/main.go", "content": "// Package app runs the server", "line": 0}, {"path": "/allowed/directory/notes.md", "content": "- new item", "line": -1}, {"path": "/allowed/directory/script.sh", "content": "#!/bin/sh", "line": 1, "position": "before"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the file to edit"),
+		),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("Lines to insert"),
+		),
+		mcp.WithNumber("line",
+			mcp.Required(),
+			mcp.Description("Line to insert at (1-indexed); 0 is the start of the file and -1 the end"),
+		),
+		mcp.WithString("position",
+			mcp.Description("Insert \"after\" (default) or \"before\" the line"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
+	)
+	p.addTool(s, insertLinesTool, (*ServiceProvider).handleInsertLines)
+
+	// Register delete_lines tool
+	deleteLinesTool := mcp.NewTool("delete_lines",
+		mcp.WithDescription(`description: Delete the lines between start_line and end_line (1-indexed, inclusive) from a file. The rest of the file, including its line endings and final newline, is left unchanged.
+demo_commands: [{"path": "/allowed/directory/config.yaml", "start_line": 10, "end_line": 12}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the file to edit"),
+		),
+		mcp.WithNumber("start_line",
+			mcp.Required(),
+			mcp.Description("First line to delete (1-indexed)"),
+		),
+		mcp.WithNumber("end_line",
+			mcp.Required(),
+			mcp.Description("Last line to delete (1-indexed, inclusive)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
+	)
+	p.addTool(s, deleteLinesTool, (*ServiceProvider).handleDeleteLines)
+
+	// Register edit_lines tool
+	editLinesTool := mcp.NewTool("edit_lines",
+		mcp.WithDescription(`description: Apply several line edits to one file in a single call. Each edit replaces (default), inserts or deletes lines; all line numbers refer to the file before the call, so there is no need to adjust them for earlier edits. Edits are applied from the bottom of the file up and must not overlap. For an insert, start_line is the line to insert after (0 for the start, -1 for the end).
+demo_commands: [{"path": "/allowed/directory/src/main.go", "edits": "[{\"start_line\": 3, \"end_line\": 3, \"content\": \"package app\"}, {\"action\": \"delete\", \"start_line\": 20, \"end_line\": 22}, {\"action\": \"insert\", \"start_line\": -1, \"content\": \"// end\"}]"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the file to edit"),
+		),
+		mcp.WithString("edits",
+			mcp.Required(),
+			mcp.Description("JSON array of edits, each with action (\"replace\", \"insert\" or \"delete\"), start_line, end_line and content"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
+	)
+	p.addTool(s, editLinesTool, (*ServiceProvider).handleEditLines)
+
+	// Register convert_file tool
+	convertFileTool := mcp.NewTool("convert_file",
+		mcp.WithDescription(`description: Convert a text file to another encoding or line ending style. Other tools keep a file's encoding and line endings, so this is the only way to change them. Omitted arguments keep the current value.
+demo_commands: [{"path": "/allowed/directory/scripts/build.bat", "line_ending": "crlf"}, {"path": "/allowed/directory/legacy/notes.txt", "encoding": "utf-8", "line_ending": "lf"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the file to convert"),
+		),
+		mcp.WithString("encoding",
+			mcp.Description("Target encoding: \"utf-8\", \"utf-8-bom\", \"utf-16le\", \"utf-16be\" or \"latin-1\""),
+		),
+		mcp.WithString("line_ending",
+			mcp.Description("Target line ending style: \"lf\", \"crlf\" or \"cr\""),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
+	)
+	p.addTool(s, convertFileTool, (*ServiceProvider).handleConvertFile)
 
 	// Register list_directory tool
 	listDirectoryTool := mcp.NewTool("list_directory",
-		mcp.WithDescription(`description: List all files and subdirectories in a specified directory, including metadata like file size, modification time, and file type. Returns a JSON array of entry objects.
-demo_commands: [{"path": "/allowed/directory"}, {"path": "/allowed/directory/src"}, {"path": "/allowed/directory/data"}]`),
+		mcp.WithDescription(`description: List all files and subdirectories in a specified directory, including metadata like file size, modification time, permissions, owner, symlink target and MIME type. Returns a JSON object with the entries, the total number of matching entries and, if there are more, the cursor of the next page in next_cursor. Entries can be sorted, filtered by type or name and paginated with limit and cursor. Directories inside zip, jar, tar and tar.gz archives can be listed without extracting them, e.g. /allowed/directory/app.zip!/ or /allowed/directory/app.zip!/config.
+demo_commands: [{"path": "/allowed/directory"}, {"path": "/allowed/directory/dist/app.zip!/config"}, {"path": "/allowed/directory/src", "type": "file", "pattern": "*.go"}, {"path": "/allowed/directory/data", "sort_by": "size", "order": "desc", "limit": 20}, {"path": "/allowed/directory/data", "limit": 100, "cursor": "100"}]`),
 		mcp.WithString("path",
 			mcp.Required(),
 			mcp.Description("Path to the directory to list"),
 		),
+		mcp.WithString("sort_by",
+			mcp.Description("Sort key: \"name\" (default), \"size\" or \"mtime\""),
+		),
+		mcp.WithString("order",
+			mcp.Description("Sort order: \"asc\" (default) or \"desc\""),
+		),
+		mcp.WithString("type",
+			mcp.Description("Only list entries of this type: \"file\", \"directory\" or \"symlink\""),
+		),
+		mcp.WithString("pattern",
+			mcp.Description("Only list entries whose name matches this glob (e.g. \"*.go\")"),
+		),
+		mcp.WithBoolean("show_hidden",
+			mcp.Description("List entries whose name starts with a dot (default: true)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return (default: all)"),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("next_cursor from the previous page, to continue the listing"),
+		),
 	)
-	s.AddTool(listDirectoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleListDirectory(ctx, request)
-	})
+	p.addTool(s, listDirectoryTool, (*ServiceProvider).handleListDirectory)
+
+	// Register get_file_info tool
+	getFileInfoTool := mcp.NewTool("get_file_info",
+		mcp.WithDescription(`description: Get detailed metadata about a file or directory: size, permissions (octal and rwx), owner and group, inode and link count, symlink target, modification, access and creation times where the platform records them, and MIME type. For text files it also reports the encoding, line ending style and line count. Set hash to also compute a checksum of the content.
+demo_commands: [{"path": "/allowed/directory/file.txt"}, {"path": "/allowed/directory/release.tar.gz", "hash": "sha256"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the file or directory"),
+		),
+		mcp.WithString("hash",
+			mcp.Description("Hash algorithm to compute a checksum of the file's content with: \"md5\", \"sha1\", \"sha256\" or \"sha512\""),
+		),
+	)
+	p.addTool(s, getFileInfoTool, (*ServiceProvider).handleGetFileInfo)
+
+	// Register diff tool
+	diffTool := mcp.NewTool("diff",
+		mcp.WithDescription(`description: Compare two files or two directories on the server instead of reading both. For files, returns a unified diff turning from_path into to_path, or says they are identical; binary files are only reported as differing. For directories, returns JSON listing the files added, removed and changed below them, relative to the directories, with the diff of each changed file when include_diffs is set. Files inside archives can be compared using "!" paths.
+demo_commands: [{"from_path": "/allowed/directory/config.old.yaml", "to_path": "/allowed/directory/config.yaml"}, {"from_path": "/allowed/directory/v1", "to_path": "/allowed/directory/v2", "include_diffs": true, "ignore_whitespace": true}]`),
+		mcp.WithString("from_path",
+			mcp.Required(),
+			mcp.Description("Path to the original file or directory"),
+		),
+		mcp.WithString("to_path",
+			mcp.Required(),
+			mcp.Description("Path to the changed file or directory"),
+		),
+		mcp.WithNumber("context",
+			mcp.Description("Lines of context around each change (default: 3)"),
+		),
+		mcp.WithBoolean("ignore_whitespace",
+			mcp.Description("Treat lines differing only in whitespace as equal (default: false)"),
+		),
+		mcp.WithBoolean("include_diffs",
+			mcp.Description("When comparing directories, include the diff of each changed file (default: false)"),
+		),
+	)
+	p.addTool(s, diffTool, (*ServiceProvider).handleDiff)
+
+	// Register directory_tree tool
+	directoryTreeTool := mcp.NewTool("directory_tree",
+		mcp.WithDescription(`description: Get a recursive tree view of the files and directories below a path as a JSON structure. Each entry has a name, a type ("file" or "directory") and, for directories, its children. Use max_depth to limit how deep the tree goes.
+demo_commands: [{"path": "/allowed/directory"}, {"path": "/allowed/directory/src", "max_depth": 2}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the directory to show"),
+		),
+		mcp.WithNumber("max_depth",
+			mcp.Description("Maximum depth of the tree (default: 3)"),
+		),
+	)
+	p.addTool(s, directoryTreeTool, (*ServiceProvider).handleDirectoryTree)
+
+	// Register disk_usage tool
+	diskUsageTool := mcp.NewTool("disk_usage",
+		mcp.WithDescription(`description: Find out what is taking space under a directory. Walks the whole directory and returns its total size and file count, the size and file count of its largest children (down to max_depth levels), the largest files and the total size per file extension. Entries matching the exclude globs are left out; symbolic links are not followed.
+demo_commands: [{"path": "/allowed/directory"}, {"path": "/allowed/directory/project", "max_depth": 2, "top": 20, "exclude": "[\"node_modules\", \".git\"]"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the directory to measure"),
+		),
+		mcp.WithNumber("max_depth",
+			mcp.Description("Levels of children to break down (default: 1)"),
+		),
+		mcp.WithNumber("top",
+			mcp.Description("Number of largest files to list and of children to show per directory (default: 10)"),
+		),
+		mcp.WithString("exclude",
+			mcp.Description("JSON array of glob patterns of entries to leave out, e.g. [\"node_modules\", \"*.log\"]"),
+		),
+	)
+	p.addTool(s, diskUsageTool, (*ServiceProvider).handleDiskUsage)
 
 	// Register create_directory tool
 	createDirectoryTool := mcp.NewTool("create_directory",
@@ -141,10 +521,11 @@ demo_commands: [{"path": "/allowed/directory/new_directory"}, {"path": "/allowed
 			mcp.Required(),
 			mcp.Description("Path to the directory to create"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
 	)
-	s.AddTool(createDirectoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleCreateDirectory(ctx, request)
-	})
+	p.addTool(s, createDirectoryTool, (*ServiceProvider).handleCreateDirectory)
 
 	// Register delete_directory tool
 	deleteDirectoryTool := mcp.NewTool("delete_directory",
@@ -157,10 +538,11 @@ demo_commands: [{"path": "/allowed/directory/empty_dir"}, {"path": "/allowed/dir
 		mcp.WithBoolean("recursive",
 			mcp.Description("Whether to delete non-empty directories recursively"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
 	)
-	s.AddTool(deleteDirectoryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleDeleteDirectory(ctx, request)
-	})
+	p.addTool(s, deleteDirectoryTool, (*ServiceProvider).handleDeleteDirectory)
 
 	// Register delete_file tool
 	deleteFileTool := mcp.NewTool("delete_file",
@@ -170,10 +552,11 @@ demo_commands: [{"path": "/allowed/directory/temp.txt"}, {"path": "/allowed/dire
 			mcp.Required(),
 			mcp.Description("Path to the file to delete"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
 	)
-	s.AddTool(deleteFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleDeleteFile(ctx, request)
-	})
+	p.addTool(s, deleteFileTool, (*ServiceProvider).handleDeleteFile)
 
 	// Register move_file tool
 	moveFileTool := mcp.NewTool("move_file",
@@ -187,10 +570,11 @@ demo_commands: [{"source_path": "/allowed/directory/old_name.txt", "destination_
 			mcp.Required(),
 			mcp.Description("Path to move the file to"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
 	)
-	s.AddTool(moveFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleMoveFile(ctx, request)
-	})
+	p.addTool(s, moveFileTool, (*ServiceProvider).handleMoveFile)
 
 	// Register copy_file tool
 	copyFileTool := mcp.NewTool("copy_file",
@@ -204,15 +588,78 @@ demo_commands: [{"source_path": "/allowed/directory/template.html", "destination
 			mcp.Required(),
 			mcp.Description("Path to copy the file to"),
 		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
 	)
-	s.AddTool(copyFileTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleCopyFile(ctx, request)
-	})
+	p.addTool(s, copyFileTool, (*ServiceProvider).handleCopyFile)
+
+	// Register create_archive tool
+	createArchiveTool := mcp.NewTool("create_archive",
+		mcp.WithDescription(`description: Create a zip, tar or tar.gz archive from a list of files, directories and glob patterns. Directories are added with everything below them; symbolic links are stored, not followed. Entries are named relative to the parent of each source. Returns a JSON report of the archived entries.
+demo_commands: [{"path": "/allowed/directory/backup.zip", "sources": "[\"/allowed/directory/src\", \"/allowed/directory/README.md\"]"}, {"path": "/allowed/directory/logs.tar.gz", "sources": "[\"/allowed/directory/logs/*.log\"]", "overwrite": true}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path of the archive to create"),
+		),
+		mcp.WithString("sources",
+			mcp.Required(),
+			mcp.Description("JSON array of paths or glob patterns to add to the archive"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Archive format: \"zip\", \"tar\" or \"tar.gz\" (default: from the extension of path)"),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("Replace the archive if it already exists (default: false)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
+	)
+	p.addTool(s, createArchiveTool, (*ServiceProvider).handleCreateArchive)
+
+	// Register extract_archive tool
+	extractArchiveTool := mcp.NewTool("extract_archive",
+		mcp.WithDescription(`description: Extract a zip, jar, tar or tar.gz archive into a directory. Every entry is checked before anything is written: entries with absolute paths or ".." components, links pointing outside the destination and archives exceeding the size, entry count or compression ratio limits are refused. Returns a JSON report of the extracted entries.
+demo_commands: [{"path": "/allowed/directory/release.zip", "destination": "/allowed/directory/release"}, {"path": "/allowed/directory/data.tgz", "destination": "/allowed/directory/data", "overwrite": true}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path to the archive to extract"),
+		),
+		mcp.WithString("destination",
+			mcp.Required(),
+			mcp.Description("Directory to extract into; created if it does not exist"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Archive format: \"zip\", \"tar\" or \"tar.gz\" (default: from the extension of path)"),
+		),
+		mcp.WithBoolean("overwrite",
+			mcp.Description("Replace existing files (default: false)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the call and describe the change without applying it"),
+		),
+	)
+	p.addTool(s, extractArchiveTool, (*ServiceProvider).handleExtractArchive)
+
+	// Register apply_batch tool
+	applyBatchTool := mcp.NewTool("apply_batch",
+		mcp.WithDescription(`description: Apply several write_file, edit_file, move_file, copy_file, delete_file and create_directory operations as one unit. Every operation is validated before any is applied; if one fails while applying, the changes already made are rolled back. Each operation is an object with an "op" field naming the operation and that tool's arguments. Returns the status of the batch and a result for each operation.
+demo_commands: [{"operations": "[{\"op\": \"create_directory\", \"path\": \"/allowed/directory/pkg\"}, {\"op\": \"move_file\", \"source_path\": \"/allowed/directory/util.go\", \"destination_path\": \"/allowed/directory/pkg/util.go\"}, {\"op\": \"edit_file\", \"path\": \"/allowed/directory/main.go\", \"content\": \"package app\", \"start_line\": 1, \"end_line\": 1}]"}]`),
+		mcp.WithString("operations",
+			mcp.Required(),
+			mcp.Description("JSON array of operations to apply in order"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the batch and describe the changes without applying them"),
+		),
+	)
+	p.addTool(s, applyBatchTool, (*ServiceProvider).handleApplyBatch)
 
 	// Register search_files tool
 	searchFilesTool := mcp.NewTool("search_files",
-		mcp.WithDescription(`description: Search for text content within files in a directory. Returns matching files with line numbers and surrounding context for each match. Set recursive to true to search in all subdirectories recursively.
-demo_commands: [{"query": "function main", "path": "/allowed/directory/src", "recursive": true}, {"query": "TODO", "path": "/allowed/directory", "recursive": false}]`),
+		mcp.WithDescription(`description: Search for text content within files in a directory. Returns matching files with line numbers and surrounding context for each match. Set recursive to true to search in all subdirectories recursively. Paths inside archives, such as /allowed/directory/app.jar!/META-INF, are searched without extracting them, and .gz files are searched decompressed.
+demo_commands: [{"query": "function main", "path": "/allowed/directory/src", "recursive": true}, {"query": "TODO", "path": "/allowed/directory", "recursive": false}, {"query": "version", "path": "/allowed/directory/dist/app.zip!/", "recursive": true}]`),
 		mcp.WithString("query",
 			mcp.Required(),
 			mcp.Description("Text to search for"),
@@ -225,9 +672,157 @@ demo_commands: [{"query": "function main", "path": "/allowed/directory/src", "re
 			mcp.Description("Whether to search recursively in subdirectories"),
 		),
 	)
-	s.AddTool(searchFilesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleSearchFiles(ctx, request)
-	})
+	p.addTool(s, searchFilesTool, (*ServiceProvider).handleSearchFiles)
+
+	// Register git_status tool
+	gitStatusTool := mcp.NewTool("git_status",
+		mcp.WithDescription(`description: Show the state of the git repository containing a path: the current branch and commit, how far it is ahead of or behind its upstream, and the changed, staged, untracked and conflicted files below the path, relative to the repository root. Only repositories whose worktree is inside an allowed directory can be used.
+demo_commands: [{"path": "/allowed/directory/repo"}, {"path": "/allowed/directory/repo/src"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path inside the repository's worktree"),
+		),
+	)
+	p.addTool(s, gitStatusTool, (*ServiceProvider).handleGitStatus)
+
+	// Register git_diff tool
+	gitDiffTool := mcp.NewTool("git_diff",
+		mcp.WithDescription(`description: Show the changes below a path of a git repository as a unified diff: by default between HEAD and the working tree, or between from and to revisions. Set staged to diff the index instead of the working tree, as git diff --cached does. Untracked files are not included.
+demo_commands: [{"path": "/allowed/directory/repo"}, {"path": "/allowed/directory/repo/src/main.go", "staged": true}, {"path": "/allowed/directory/repo", "from": "v1.2.0", "to": "HEAD"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path inside the repository's worktree to show the changes of"),
+		),
+		mcp.WithString("from",
+			mcp.Description("Revision to compare from (default: HEAD)"),
+		),
+		mcp.WithString("to",
+			mcp.Description("Revision to compare to (default: the working tree, or the index if staged)"),
+		),
+		mcp.WithBoolean("staged",
+			mcp.Description("Compare the index instead of the working tree (default: false)"),
+		),
+		mcp.WithNumber("context",
+			mcp.Description("Lines of context around each change (default: 3)"),
+		),
+	)
+	p.addTool(s, gitDiffTool, (*ServiceProvider).handleGitDiff)
+
+	// Register git_log tool
+	gitLogTool := mcp.NewTool("git_log",
+		mcp.WithDescription(`description: List the commits of a git repository that changed a path, newest first, as a JSON array of hashes, authors, dates and subjects.
+demo_commands: [{"path": "/allowed/directory/repo"}, {"path": "/allowed/directory/repo/README.md", "limit": 5}, {"path": "/allowed/directory/repo", "revision": "main", "skip": 20}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path inside the repository's worktree"),
+		),
+		mcp.WithString("revision",
+			mcp.Description("Revision to start from (default: HEAD)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of commits (default: 20, at most 1000)"),
+		),
+		mcp.WithNumber("skip",
+			mcp.Description("Number of commits to skip, to page through history"),
+		),
+	)
+	p.addTool(s, gitLogTool, (*ServiceProvider).handleGitLog)
+
+	// Register git_show tool
+	gitShowTool := mcp.NewTool("git_show",
+		mcp.WithDescription(`description: Read a file of a git repository as it was at a revision, such as a commit hash, branch, tag or HEAD~2. The file does not need to exist in the working tree.
+demo_commands: [{"path": "/allowed/directory/repo/src/main.go", "revision": "HEAD~1"}, {"path": "/allowed/directory/repo/go.mod", "revision": "v1.0.0"}]`),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path of the file in the repository's worktree"),
+		),
+		mcp.WithString("revision",
+			mcp.Required(),
+			mcp.Description("Revision to read the file at"),
+		),
+	)
+	p.addTool(s, gitShowTool, (*ServiceProvider).handleGitShow)
+
+	// Register git_commit tool when the server allows commits
+	if p.gitCommit {
+		gitCommitTool := mcp.NewTool("git_commit",
+			mcp.WithDescription(`description: Commit the changes staged in the git repository containing a path, with the given message. Only what is already staged is committed; hooks are not run. Returns the new commit.
+demo_commands: [{"path": "/allowed/directory/repo", "message": "Fix off-by-one in pagination"}]`),
+			mcp.WithString("path",
+				mcp.Required(),
+				mcp.Description("Path inside the repository's worktree"),
+			),
+			mcp.WithString("message",
+				mcp.Required(),
+				mcp.Description("Commit message"),
+			),
+			mcp.WithBoolean("dry_run",
+				mcp.Description("Validate the call and describe the change without applying it"),
+			),
+		)
+		p.addTool(s, gitCommitTool, (*ServiceProvider).handleGitCommit)
+	}
+
+	// Register the overlay tools when an allowed directory is stored in an overlay
+	if p.hasOverlays() {
+		overlayDiffTool := mcp.NewTool("overlay_diff",
+			mcp.WithDescription(`description: List the changes an overlay directory holds below a path and not yet committed to the directory itself, as JSON: each added, modified or deleted file, directory and symbolic link, with the unified diff of changed text files.
+demo_commands: [{"path": "/allowed/directory/repo"}, {"path": "/allowed/directory/repo/src", "context": 1}]`),
+			mcp.WithString("path",
+				mcp.Required(),
+				mcp.Description("Path inside the overlay directory to show the changes below"),
+			),
+			mcp.WithNumber("context",
+				mcp.Description("Lines of context around each change (default: 3)"),
+			),
+			mcp.WithBoolean("ignore_whitespace",
+				mcp.Description("Treat lines differing only in whitespace as equal (default: false)"),
+			),
+		)
+		p.addTool(s, overlayDiffTool, (*ServiceProvider).handleOverlayDiff)
+
+		overlayCommitTool := mcp.NewTool("overlay_commit",
+			mcp.WithDescription(`description: Apply every change held by the overlay containing a path to the directory itself, then empty the overlay. Only call this once the user has reviewed the changes with overlay_diff and approved them. Returns the applied changes.
+demo_commands: [{"path": "/allowed/directory/repo"}, {"path": "/allowed/directory/repo", "dry_run": true}]`),
+			mcp.WithString("path",
+				mcp.Required(),
+				mcp.Description("Path inside the overlay directory"),
+			),
+			mcp.WithBoolean("dry_run",
+				mcp.Description("Validate the call and describe the change without applying it"),
+			),
+		)
+		p.addTool(s, overlayCommitTool, (*ServiceProvider).handleOverlayCommit)
+
+		overlayDiscardTool := mcp.NewTool("overlay_discard",
+			mcp.WithDescription(`description: Drop every change held by the overlay containing a path, restoring the view of the directory as it is. Returns the dropped changes.
+demo_commands: [{"path": "/allowed/directory/repo"}]`),
+			mcp.WithString("path",
+				mcp.Required(),
+				mcp.Description("Path inside the overlay directory"),
+			),
+			mcp.WithBoolean("dry_run",
+				mcp.Description("Validate the call and describe the change without applying it"),
+			),
+		)
+		p.addTool(s, overlayDiscardTool, (*ServiceProvider).handleOverlayDiscard)
+	}
+
+	// Register confirm_operation tool when destructive operations need confirmation
+	if p.confirmations != nil && p.confirmations.policy.Enabled() {
+		confirmOperationTool := mcp.NewTool("confirm_operation",
+			mcp.WithDescription(`description: Confirm or cancel an operation that returned status "pending_confirmation". Only call this after the user has reviewed the preview and approved the operation. Pending operations expire after a timeout.
+demo_commands: [{"operation_id": "0f8fad5b-d9cb-469f-a165-70867728950e"}, {"operation_id": "0f8fad5b-d9cb-469f-a165-70867728950e", "approve": false}]`),
+			mcp.WithString("operation_id",
+				mcp.Required(),
+				mcp.Description("ID of the pending operation"),
+			),
+			mcp.WithBoolean("approve",
+				mcp.Description("Whether to run the operation (true, default) or cancel it (false)"),
+			),
+		)
+		p.addTool(s, confirmOperationTool, (*ServiceProvider).handleConfirmOperation)
+	}
 
 	// Register list_allowed_directories tool
 	listAllowedDirectoriesTool := mcp.NewTool("list_allowed_directories",
@@ -237,9 +832,8 @@ demo_commands: [{"hi": ""}]`),
 			mcp.Description("no effect"),
 		),
 	)
-	s.AddTool(listAllowedDirectoriesTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		return provider.handleListAllowedDirectories(ctx, request)
-	})
+	p.addTool(s, listAllowedDirectoriesTool, (*ServiceProvider).handleListAllowedDirectories)
+
 }
 
 // Handler methods for ServiceProvider
@@ -250,12 +844,44 @@ func (p *ServiceProvider) handleReadFile(_ context.Context, request mcp.CallTool
 		return nil, errors.NewFileSystemError("read_file", "", errors.ErrInvalidArgument)
 	}
 
-	content, err := p.fileService.ReadFile(path)
+	opts, err := parseLineOptions("read_file", request.Params.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	content, format, err := p.fileService.ReadFileFormat(path)
 	if err != nil {
 		return nil, err
 	}
+	p.metrics.BytesRead.Add(float64(len(content)), "read_file")
+
+	if !opts.enabled() {
+		content, redactions := p.redactor.Redact(content)
+		result := withFormatReport(mcp.NewToolResultText(content), format)
+		return p.withRedactionReport(result, "read_file", redactions), nil
+	}
+
+	content, redactions, total, err := formatLines(content, opts, p.redactor)
+	if err != nil {
+		return nil, errors.NewFileSystemError("read_file", path, err)
+	}
+	result := withFormatReport(withLineRangeReport(mcp.NewToolResultText(content), opts, total), format)
+
+	return p.withRedactionReport(result, "read_file", redactions), nil
+}
+
+// withFormatReport tells the client the encoding and line endings of a file
+// that is not plain UTF-8 with LF line endings
+func withFormatReport(result *mcp.CallToolResult, format TextFormat) *mcp.CallToolResult {
+	if format.plain() {
+		return result
+	}
 
-	return mcp.NewToolResultText(content), nil
+	result.Content = append(result.Content, mcp.TextContent{
+		Type: "text",
+		Text: fmt.Sprintf("File encoding: %s, line endings: %s. The content above is UTF-8; edits and writes keep the file's encoding and line endings.", format.Encoding, format.LineEnding),
+	})
+	return result
 }
 
 func (p *ServiceProvider) handleReadMultipleFiles(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -270,10 +896,22 @@ func (p *ServiceProvider) handleReadMultipleFiles(ctx context.Context, request m
 		return nil, errors.NewFileSystemError("read_multiple_files", "", err)
 	}
 
+	lineNumbers, _ := request.Params.Arguments["line_numbers"].(bool)
+
 	results, err := p.fileService.ReadMultipleFiles(paths)
 	if err != nil {
 		return nil, err
 	}
+	redactions := 0
+	for i := range results {
+		p.metrics.BytesRead.Add(float64(len(results[i].Content)), "read_multiple_files")
+		if lineNumbers && results[i].Error == "" {
+			results[i].Content, results[i].Redactions, _, _ = formatLines(results[i].Content, lineOptions{numbers: true, startLine: 1}, p.redactor)
+		} else {
+			results[i].Content, results[i].Redactions = p.redactor.Redact(results[i].Content)
+		}
+		redactions += results[i].Redactions
+	}
 
 	// Convert results to JSON
 	resultJSON, err := json.Marshal(results)
@@ -281,10 +919,10 @@ func (p *ServiceProvider) handleReadMultipleFiles(ctx context.Context, request m
 		return nil, errors.NewFileSystemError("read_multiple_files", "", err)
 	}
 
-	return mcp.NewToolResultText(string(resultJSON)), nil
+	return p.withRedactionReport(mcp.NewToolResultText(string(resultJSON)), "read_multiple_files", redactions), nil
 }
 
-func (p *ServiceProvider) handleWriteFile(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (p *ServiceProvider) handleWriteFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	path, ok := request.Params.Arguments["path"].(string)
 	if !ok {
 		return nil, errors.NewFileSystemError("write_file", "", errors.ErrInvalidArgument)
@@ -300,59 +938,625 @@ func (p *ServiceProvider) handleWriteFile(_ context.Context, request mcp.CallToo
 		appendFlag = appendArg
 	}
 
-	if err := p.fileWriter.WriteFile(path, content, appendFlag); err != nil {
-		return nil, err
+	if p.isDryRun(request) {
+		return p.dryRunResult("write_file", path)(p.fileWriter.PlanWriteFile(path, content, appendFlag))
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("File written successfully: %s", path)), nil
-}
+	execute := func() (*mcp.CallToolResult, error) {
+		if err := p.fileWriter.WriteFile(path, content, appendFlag); err != nil {
+			return nil, err
+		}
+		p.metrics.BytesWritten.Add(float64(len(content)), "write_file")
 
-func (p *ServiceProvider) handleEditFile(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	path, ok := request.Params.Arguments["path"].(string)
-	if !ok {
-		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
+		return mcp.NewToolResultText(fmt.Sprintf("File written successfully: %s", path)), nil
 	}
-
-	content, ok := request.Params.Arguments["content"].(string)
-	if !ok {
-		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
+	if appendFlag {
+		return execute()
 	}
 
-	startLine, ok := request.Params.Arguments["start_line"].(float64)
-	if !ok {
-		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
-	}
+	return p.confirm(ctx, "write_file", path, p.previewOverwrite(len(content)), execute)
+}
 
-	endLine, ok := request.Params.Arguments["end_line"].(float64)
-	if !ok {
-		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
-	}
+func (p *ServiceProvider) handleMergeFiles(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	outputPath, _ := request.Params.Arguments["output_path"].(string)
 
-	if err := p.fileWriter.EditFile(path, content, int(startLine), int(endLine)); err != nil {
+	base, _, err := p.mergeInput(request, "base", outputPath)
+	if err != nil {
 		return nil, err
 	}
-
-	return mcp.NewToolResultText(fmt.Sprintf("File edited successfully: %s (lines %d-%d)", path, int(startLine), int(endLine))), nil
-}
-
+	ours, oursName, err := p.mergeInput(request, "ours", outputPath)
+	if err != nil {
+		return nil, err
+	}
+	theirs, theirsName, err := p.mergeInput(request, "theirs", outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := merge3(base, ours, theirs, oursName, theirsName)
+	response := mergeResponse{MergeResult: result}
+	if outputPath == "" {
+		return p.mergeResult(response, outputPath)
+	}
+
+	content := result.Content
+	response.Content = ""
+	response.Path = outputPath
+	if p.isDryRun(request) {
+		change, err := p.fileWriter.PlanWriteFile(outputPath, content, false)
+		if err != nil {
+			return nil, err
+		}
+		response.DryRun = true
+		response.Change = change
+		return p.mergeResult(response, outputPath)
+	}
+
+	execute := func() (*mcp.CallToolResult, error) {
+		if err := p.fileWriter.WriteFile(outputPath, content, false); err != nil {
+			return nil, err
+		}
+		p.metrics.BytesWritten.Add(float64(len(content)), "merge_files")
+		return p.mergeResult(response, outputPath)
+	}
+
+	validPath, required := p.requiresConfirmation("write_file", outputPath)
+	if !required {
+		return execute()
+	}
+	op, err := p.previewOverwrite(len(content))(validPath)
+	if err != nil {
+		return nil, errors.NewFileSystemError("merge_files", outputPath, err)
+	}
+	if op == nil {
+		return execute()
+	}
+	op.Tool = "merge_files"
+	return p.awaitConfirmation(ctx, "merge_files", outputPath, op, execute)
+}
+
+// mergeInput returns one version given to merge_files, either inline or read
+// from its path, and the name to label it with in conflict markers
+func (p *ServiceProvider) mergeInput(request mcp.CallToolRequest, name, outputPath string) (string, string, error) {
+	if content, ok := request.Params.Arguments[name+"_content"].(string); ok {
+		return content, name, nil
+	}
+	path, ok := request.Params.Arguments[name].(string)
+	if !ok || path == "" {
+		return "", "", errors.NewFileSystemError("merge_files", outputPath, fmt.Errorf("%w: %s or %s_content is required", errors.ErrInvalidArgument, name, name))
+	}
+
+	content, err := p.fileService.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	p.metrics.BytesRead.Add(float64(len(content)), "merge_files")
+	return content, path, nil
+}
+
+// mergeResult redacts the content and conflicts of a merge and returns them as
+// the tool result
+func (p *ServiceProvider) mergeResult(response mergeResponse, outputPath string) (*mcp.CallToolResult, error) {
+	redactions := 0
+	redact := func(text *string) {
+		var n int
+		*text, n = p.redactor.Redact(*text)
+		redactions += n
+	}
+	redact(&response.Content)
+	redactions += p.redactChange(response.Change)
+	for i := range response.Conflicts {
+		redact(&response.Conflicts[i].BaseText)
+		redact(&response.Conflicts[i].OursText)
+		redact(&response.Conflicts[i].TheirsText)
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		return nil, errors.NewFileSystemError("merge_files", outputPath, err)
+	}
+	return p.withRedactionReport(mcp.NewToolResultText(string(responseJSON)), "merge_files", redactions), nil
+}
+
+func (p *ServiceProvider) handleEditFile(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
+	}
+
+	content, ok := request.Params.Arguments["content"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
+	}
+
+	startLine, ok := request.Params.Arguments["start_line"].(float64)
+	if !ok {
+		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
+	}
+
+	endLine, ok := request.Params.Arguments["end_line"].(float64)
+	if !ok {
+		return nil, errors.NewFileSystemError("edit_file", "", errors.ErrInvalidArgument)
+	}
+
+	if p.isDryRun(request) {
+		return p.dryRunResult("edit_file", path)(p.fileWriter.PlanEditFile(path, content, int(startLine), int(endLine)))
+	}
+
+	if err := p.fileWriter.EditFile(path, content, int(startLine), int(endLine)); err != nil {
+		return nil, err
+	}
+	p.metrics.BytesWritten.Add(float64(len(content)), "edit_file")
+
+	return mcp.NewToolResultText(fmt.Sprintf("File edited successfully: %s (lines %d-%d)", path, int(startLine), int(endLine))), nil
+}
+
+func (p *ServiceProvider) handleInsertLines(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("insert_lines", "", errors.ErrInvalidArgument)
+	}
+
+	content, ok := request.Params.Arguments["content"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("insert_lines", "", errors.ErrInvalidArgument)
+	}
+
+	line, ok := request.Params.Arguments["line"].(float64)
+	if !ok {
+		return nil, errors.NewFileSystemError("insert_lines", "", errors.ErrInvalidArgument)
+	}
+
+	after := int(line)
+	switch position, _ := request.Params.Arguments["position"].(string); position {
+	case "", "after":
+	case "before":
+		if after < 1 {
+			return nil, errors.NewFileSystemError("insert_lines", path, errors.ErrInvalidArgument)
+		}
+		after--
+	default:
+		return nil, errors.NewFileSystemError("insert_lines", path, errors.ErrInvalidArgument)
+	}
+
+	edits := []LineEdit{{Action: lineInsert, StartLine: after, Content: content}}
+	return p.editLines(request, "insert_lines", path, edits, fmt.Sprintf("Lines inserted successfully: %s", path))
+}
+
+func (p *ServiceProvider) handleDeleteLines(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("delete_lines", "", errors.ErrInvalidArgument)
+	}
+
+	startLine, ok := request.Params.Arguments["start_line"].(float64)
+	if !ok {
+		return nil, errors.NewFileSystemError("delete_lines", "", errors.ErrInvalidArgument)
+	}
+
+	endLine, ok := request.Params.Arguments["end_line"].(float64)
+	if !ok {
+		return nil, errors.NewFileSystemError("delete_lines", "", errors.ErrInvalidArgument)
+	}
+
+	edits := []LineEdit{{Action: lineDelete, StartLine: int(startLine), EndLine: int(endLine)}}
+	return p.editLines(request, "delete_lines", path, edits, fmt.Sprintf("Lines deleted successfully: %s (lines %d-%d)", path, int(startLine), int(endLine)))
+}
+
+func (p *ServiceProvider) handleEditLines(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("edit_lines", "", errors.ErrInvalidArgument)
+	}
+
+	var edits []LineEdit
+	if err := decodeJSONArgument(request.Params.Arguments["edits"], &edits); err != nil {
+		return nil, errors.NewFileSystemError("edit_lines", path, err)
+	}
+
+	return p.editLines(request, "edit_lines", path, edits, fmt.Sprintf("File edited successfully: %s (%d edit(s))", path, len(edits)))
+}
+
+func (p *ServiceProvider) handleConvertFile(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("convert_file", "", errors.ErrInvalidArgument)
+	}
+
+	encoding, _ := request.Params.Arguments["encoding"].(string)
+	lineEnding, _ := request.Params.Arguments["line_ending"].(string)
+	format := TextFormat{Encoding: encoding, LineEnding: lineEnding}
+	if format.Encoding == "" && format.LineEnding == "" {
+		return nil, errors.NewFileSystemError("convert_file", path, fmt.Errorf("%w: encoding or line_ending is required", errors.ErrInvalidArgument))
+	}
+
+	if p.isDryRun(request) {
+		return p.dryRunResult("convert_file", path)(p.fileWriter.PlanConvertFile(path, format))
+	}
+
+	if err := p.fileWriter.ConvertFile(path, format); err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("File converted successfully: %s", path)), nil
+}
+
+// editLines applies line edits for the insert_lines, delete_lines and edit_lines tools
+func (p *ServiceProvider) editLines(request mcp.CallToolRequest, tool, path string, edits []LineEdit, message string) (*mcp.CallToolResult, error) {
+	if p.isDryRun(request) {
+		return p.dryRunResult(tool, path)(p.fileWriter.PlanEditLines(path, edits))
+	}
+
+	if err := p.fileWriter.EditLines(path, edits); err != nil {
+		return nil, err
+	}
+	for _, edit := range edits {
+		p.metrics.BytesWritten.Add(float64(len(edit.Content)), tool)
+	}
+
+	return mcp.NewToolResultText(message), nil
+}
+
 func (p *ServiceProvider) handleListDirectory(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	path, ok := request.Params.Arguments["path"].(string)
 	if !ok {
 		return nil, errors.NewFileSystemError("list_directory", "", errors.ErrInvalidArgument)
 	}
 
-	entries, err := p.directoryService.ListDirectory(path)
+	args := request.Params.Arguments
+	opts := ListOptions{ShowHidden: true}
+	opts.SortBy, _ = args["sort_by"].(string)
+	opts.Order, _ = args["order"].(string)
+	opts.Type, _ = args["type"].(string)
+	opts.Pattern, _ = args["pattern"].(string)
+	opts.Cursor, _ = args["cursor"].(string)
+	if showHidden, ok := args["show_hidden"].(bool); ok {
+		opts.ShowHidden = showHidden
+	}
+	if limit, ok := args["limit"].(float64); ok {
+		opts.Limit = int(limit)
+	}
+
+	page, err := p.directoryService.ListDirectoryPage(path, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert entries to JSON
-	entriesJSON, err := json.Marshal(entries)
+	// Convert the page to JSON
+	pageJSON, err := json.Marshal(page)
 	if err != nil {
 		return nil, errors.NewFileSystemError("list_directory", "", err)
 	}
 
-	return mcp.NewToolResultText(string(entriesJSON)), nil
+	return mcp.NewToolResultText(string(pageJSON)), nil
+}
+
+func (p *ServiceProvider) handleGetFileInfo(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("get_file_info", "", errors.ErrInvalidArgument)
+	}
+
+	hashAlgorithm, _ := request.Params.Arguments["hash"].(string)
+
+	info, err := p.fileService.GetFileInfo(path, hashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return nil, errors.NewFileSystemError("get_file_info", path, err)
+	}
+
+	return mcp.NewToolResultText(string(infoJSON)), nil
+}
+
+func (p *ServiceProvider) handleDiff(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	fromPath, ok := request.Params.Arguments["from_path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("diff", "", errors.ErrInvalidArgument)
+	}
+	toPath, ok := request.Params.Arguments["to_path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("diff", fromPath, errors.ErrInvalidArgument)
+	}
+
+	opts := DiffOptions{Context: diffContext}
+	if context, ok := request.Params.Arguments["context"].(float64); ok {
+		if context < 0 {
+			return nil, errors.NewFileSystemError("diff", fromPath, errors.ErrInvalidArgument)
+		}
+		opts.Context = int(context)
+	}
+	opts.IgnoreWhitespace, _ = request.Params.Arguments["ignore_whitespace"].(bool)
+	opts.IncludeDiffs, _ = request.Params.Arguments["include_diffs"].(bool)
+
+	result, err := p.fileService.Diff(fromPath, toPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Type == "file" {
+		switch {
+		case result.Identical:
+			return mcp.NewToolResultText(fmt.Sprintf("Files %s and %s are identical", fromPath, toPath)), nil
+		case result.Binary:
+			return mcp.NewToolResultText(fmt.Sprintf("Binary files %s and %s differ", fromPath, toPath)), nil
+		}
+		diff, n := p.redactor.Redact(result.Diff)
+		p.metrics.BytesRead.Add(float64(len(diff)), "diff")
+		return p.withRedactionReport(mcp.NewToolResultText(diff), "diff", n), nil
+	}
+
+	redactions := 0
+	for i := range result.Changed {
+		var n int
+		result.Changed[i].Diff, n = p.redactor.Redact(result.Changed[i].Diff)
+		redactions += n
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, errors.NewFileSystemError("diff", fromPath, err)
+	}
+	return p.withRedactionReport(mcp.NewToolResultText(string(resultJSON)), "diff", redactions), nil
+}
+
+func (p *ServiceProvider) handleGitStatus(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("git_status", "", errors.ErrInvalidArgument)
+	}
+
+	status, err := p.gitService.Status(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_status", path, err)
+	}
+	return mcp.NewToolResultText(string(statusJSON)), nil
+}
+
+func (p *ServiceProvider) handleGitDiff(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("git_diff", "", errors.ErrInvalidArgument)
+	}
+
+	opts := GitDiffOptions{Context: diffContext}
+	opts.From, _ = request.Params.Arguments["from"].(string)
+	opts.To, _ = request.Params.Arguments["to"].(string)
+	opts.Staged, _ = request.Params.Arguments["staged"].(bool)
+	if lines, ok := request.Params.Arguments["context"].(float64); ok {
+		opts.Context = int(lines)
+	}
+
+	diff, err := p.gitService.Diff(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if diff == "" {
+		return mcp.NewToolResultText("No changes"), nil
+	}
+
+	diff, redactions := p.redactor.Redact(diff)
+	p.metrics.BytesRead.Add(float64(len(diff)), "git_diff")
+	return p.withRedactionReport(mcp.NewToolResultText(diff), "git_diff", redactions), nil
+}
+
+func (p *ServiceProvider) handleGitLog(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("git_log", "", errors.ErrInvalidArgument)
+	}
+
+	var opts GitLogOptions
+	opts.Revision, _ = request.Params.Arguments["revision"].(string)
+	if limit, ok := request.Params.Arguments["limit"].(float64); ok {
+		opts.Limit = int(limit)
+	}
+	if skip, ok := request.Params.Arguments["skip"].(float64); ok {
+		opts.Skip = int(skip)
+	}
+
+	commits, err := p.gitService.Log(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	commitsJSON, err := json.Marshal(commits)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_log", path, err)
+	}
+	return mcp.NewToolResultText(string(commitsJSON)), nil
+}
+
+func (p *ServiceProvider) handleGitShow(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("git_show", "", errors.ErrInvalidArgument)
+	}
+	revision, ok := request.Params.Arguments["revision"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("git_show", path, errors.ErrInvalidArgument)
+	}
+
+	content, err := p.gitService.Show(ctx, path, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	content, redactions := p.redactor.Redact(content)
+	p.metrics.BytesRead.Add(float64(len(content)), "git_show")
+	return p.withRedactionReport(mcp.NewToolResultText(content), "git_show", redactions), nil
+}
+
+func (p *ServiceProvider) handleGitCommit(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("git_commit", "", errors.ErrInvalidArgument)
+	}
+	message, ok := request.Params.Arguments["message"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("git_commit", path, errors.ErrInvalidArgument)
+	}
+
+	if p.isDryRun(request) {
+		return p.dryRunResult("git_commit", path)(p.gitService.PlanCommit(ctx, path, message))
+	}
+
+	commit, err := p.gitService.Commit(ctx, path, message)
+	if err != nil {
+		return nil, err
+	}
+
+	commitJSON, err := json.Marshal(commit)
+	if err != nil {
+		return nil, errors.NewFileSystemError("git_commit", path, err)
+	}
+	return mcp.NewToolResultText(string(commitJSON)), nil
+}
+
+func (p *ServiceProvider) handleOverlayDiff(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("overlay_diff", "", errors.ErrInvalidArgument)
+	}
+
+	opts := DiffOptions{Context: diffContext}
+	if context, ok := request.Params.Arguments["context"].(float64); ok {
+		if context < 0 {
+			return nil, errors.NewFileSystemError("overlay_diff", path, errors.ErrInvalidArgument)
+		}
+		opts.Context = int(context)
+	}
+	opts.IgnoreWhitespace, _ = request.Params.Arguments["ignore_whitespace"].(bool)
+
+	result, err := p.overlayService.Diff(path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	redactions := 0
+	for i := range result.Changes {
+		var n int
+		result.Changes[i].Diff, n = p.redactor.Redact(result.Changes[i].Diff)
+		redactions += n
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, errors.NewFileSystemError("overlay_diff", path, err)
+	}
+	p.metrics.BytesRead.Add(float64(len(resultJSON)), "overlay_diff")
+	return p.withRedactionReport(mcp.NewToolResultText(string(resultJSON)), "overlay_diff", redactions), nil
+}
+
+func (p *ServiceProvider) handleOverlayCommit(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("overlay_commit", "", errors.ErrInvalidArgument)
+	}
+
+	if p.isDryRun(request) {
+		return p.dryRunResult("overlay_commit", path)(p.overlayService.PlanCommit(path))
+	}
+
+	return p.confirm(ctx, "overlay_commit", path, p.previewOverlay("Apply"), func() (*mcp.CallToolResult, error) {
+		result, err := p.overlayService.Commit(path)
+		if err != nil {
+			return nil, err
+		}
+
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return nil, errors.NewFileSystemError("overlay_commit", path, err)
+		}
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	})
+}
+
+func (p *ServiceProvider) handleOverlayDiscard(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("overlay_discard", "", errors.ErrInvalidArgument)
+	}
+
+	if p.isDryRun(request) {
+		return p.dryRunResult("overlay_discard", path)(p.overlayService.PlanDiscard(path))
+	}
+
+	return p.confirm(ctx, "overlay_discard", path, p.previewOverlay("Drop"), func() (*mcp.CallToolResult, error) {
+		result, err := p.overlayService.Discard(path)
+		if err != nil {
+			return nil, err
+		}
+
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return nil, errors.NewFileSystemError("overlay_discard", path, err)
+		}
+		return mcp.NewToolResultText(string(resultJSON)), nil
+	})
+}
+
+func (p *ServiceProvider) handleDiskUsage(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("disk_usage", "", errors.ErrInvalidArgument)
+	}
+
+	var opts DiskUsageOptions
+	if maxDepth, ok := request.Params.Arguments["max_depth"].(float64); ok {
+		opts.MaxDepth = int(maxDepth)
+	}
+	if top, ok := request.Params.Arguments["top"].(float64); ok {
+		opts.Top = int(top)
+	}
+	if exclude, ok := request.Params.Arguments["exclude"]; ok && exclude != "" {
+		if err := decodeJSONArgument(exclude, &opts.Exclude); err != nil {
+			return nil, errors.NewFileSystemError("disk_usage", path, err)
+		}
+	}
+
+	report, err := p.directoryService.DiskUsage(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return nil, errors.NewFileSystemError("disk_usage", path, err)
+	}
+
+	return mcp.NewToolResultText(string(reportJSON)), nil
+}
+
+func (p *ServiceProvider) handleDirectoryTree(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("directory_tree", "", errors.ErrInvalidArgument)
+	}
+
+	maxDepth := 3 // Default max depth
+	if maxDepthArg, ok := request.Params.Arguments["max_depth"].(float64); ok {
+		maxDepth = int(maxDepthArg)
+	}
+
+	tree, err := p.directoryService.DirectoryTree(path, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert tree to JSON
+	treeJSON, err := json.Marshal(tree)
+	if err != nil {
+		return nil, errors.NewFileSystemError("directory_tree", "", err)
+	}
+
+	return mcp.NewToolResultText(string(treeJSON)), nil
 }
 
 func (p *ServiceProvider) handleCreateDirectory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -361,6 +1565,10 @@ func (p *ServiceProvider) handleCreateDirectory(ctx context.Context, request mcp
 		return nil, errors.NewFileSystemError("create_directory", "", errors.ErrInvalidArgument)
 	}
 
+	if p.isDryRun(request) {
+		return p.dryRunResult("create_directory", path)(p.directoryService.PlanCreateDirectory(path))
+	}
+
 	if err := p.directoryService.CreateDirectory(path); err != nil {
 		return nil, err
 	}
@@ -368,7 +1576,7 @@ func (p *ServiceProvider) handleCreateDirectory(ctx context.Context, request mcp
 	return mcp.NewToolResultText(fmt.Sprintf("Directory created successfully: %s", path)), nil
 }
 
-func (p *ServiceProvider) handleDeleteDirectory(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (p *ServiceProvider) handleDeleteDirectory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	path, ok := request.Params.Arguments["path"].(string)
 	if !ok {
 		return nil, errors.NewFileSystemError("delete_directory", "", errors.ErrInvalidArgument)
@@ -379,27 +1587,44 @@ func (p *ServiceProvider) handleDeleteDirectory(_ context.Context, request mcp.C
 		recursive = recursiveArg
 	}
 
-	if err := p.directoryService.DeleteDirectory(path, recursive); err != nil {
-		return nil, err
+	if p.isDryRun(request) {
+		return p.dryRunResult("delete_directory", path)(p.directoryService.PlanDeleteDirectory(path, recursive))
+	}
+
+	execute := func() (*mcp.CallToolResult, error) {
+		if err := p.directoryService.DeleteDirectory(path, recursive); err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("Directory deleted successfully: %s", path)), nil
+	}
+	if !recursive {
+		return execute()
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Directory deleted successfully: %s", path)), nil
+	return p.confirm(ctx, "delete_directory", path, p.previewDeleteDirectory, execute)
 }
 
-func (p *ServiceProvider) handleDeleteFile(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (p *ServiceProvider) handleDeleteFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	path, ok := request.Params.Arguments["path"].(string)
 	if !ok {
 		return nil, errors.NewFileSystemError("delete_file", "", errors.ErrInvalidArgument)
 	}
 
-	if err := p.fileManager.DeleteFile(path); err != nil {
-		return nil, err
+	if p.isDryRun(request) {
+		return p.dryRunResult("delete_file", path)(p.fileManager.PlanDeleteFile(path))
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("File deleted successfully: %s", path)), nil
+	return p.confirm(ctx, "delete_file", path, p.previewDeleteFile, func() (*mcp.CallToolResult, error) {
+		if err := p.fileManager.DeleteFile(path); err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("File deleted successfully: %s", path)), nil
+	})
 }
 
-func (p *ServiceProvider) handleMoveFile(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (p *ServiceProvider) handleMoveFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sourcePath, ok := request.Params.Arguments["source_path"].(string)
 	if !ok {
 		return nil, errors.NewFileSystemError("move_file", "", errors.ErrInvalidArgument)
@@ -410,14 +1635,20 @@ func (p *ServiceProvider) handleMoveFile(_ context.Context, request mcp.CallTool
 		return nil, errors.NewFileSystemError("move_file", "", errors.ErrInvalidArgument)
 	}
 
-	if err := p.fileManager.MoveFile(sourcePath, destinationPath); err != nil {
-		return nil, err
+	if p.isDryRun(request) {
+		return p.dryRunResult("move_file", sourcePath)(p.fileManager.PlanMoveFile(sourcePath, destinationPath))
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("File moved successfully from %s to %s", sourcePath, destinationPath)), nil
+	return p.confirm(ctx, "move_file", destinationPath, p.previewTransfer(sourcePath), func() (*mcp.CallToolResult, error) {
+		if err := p.fileManager.MoveFile(sourcePath, destinationPath); err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("File moved successfully from %s to %s", sourcePath, destinationPath)), nil
+	})
 }
 
-func (p *ServiceProvider) handleCopyFile(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (p *ServiceProvider) handleCopyFile(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	sourcePath, ok := request.Params.Arguments["source_path"].(string)
 	if !ok {
 		return nil, errors.NewFileSystemError("copy_file", "", errors.ErrInvalidArgument)
@@ -428,11 +1659,78 @@ func (p *ServiceProvider) handleCopyFile(_ context.Context, request mcp.CallTool
 		return nil, errors.NewFileSystemError("copy_file", "", errors.ErrInvalidArgument)
 	}
 
-	if err := p.fileManager.CopyFile(sourcePath, destinationPath); err != nil {
+	if p.isDryRun(request) {
+		return p.dryRunResult("copy_file", sourcePath)(p.fileManager.PlanCopyFile(sourcePath, destinationPath))
+	}
+
+	return p.confirm(ctx, "copy_file", destinationPath, p.previewTransfer(sourcePath), func() (*mcp.CallToolResult, error) {
+		if err := p.fileManager.CopyFile(sourcePath, destinationPath); err != nil {
+			return nil, err
+		}
+
+		return mcp.NewToolResultText(fmt.Sprintf("File copied successfully from %s to %s", sourcePath, destinationPath)), nil
+	})
+}
+
+func (p *ServiceProvider) handleCreateArchive(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("create_archive", "", errors.ErrInvalidArgument)
+	}
+
+	var sources []string
+	if err := decodeJSONArgument(request.Params.Arguments["sources"], &sources); err != nil {
+		return nil, errors.NewFileSystemError("create_archive", path, err)
+	}
+	format, _ := request.Params.Arguments["format"].(string)
+	overwrite, _ := request.Params.Arguments["overwrite"].(bool)
+
+	if p.isDryRun(request) {
+		return p.dryRunResult("create_archive", path)(p.archiveService.PlanCreateArchive(path, sources, format, overwrite))
+	}
+
+	result, err := p.archiveService.CreateArchive(path, sources, format, overwrite)
+	if err != nil {
 		return nil, err
 	}
+	p.metrics.BytesWritten.Add(float64(result.ArchiveSize), "create_archive")
 
-	return mcp.NewToolResultText(fmt.Sprintf("File copied successfully from %s to %s", sourcePath, destinationPath)), nil
+	return archiveResult("create_archive", path, result)
+}
+
+func (p *ServiceProvider) handleExtractArchive(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("extract_archive", "", errors.ErrInvalidArgument)
+	}
+
+	destination, ok := request.Params.Arguments["destination"].(string)
+	if !ok {
+		return nil, errors.NewFileSystemError("extract_archive", path, errors.ErrInvalidArgument)
+	}
+	format, _ := request.Params.Arguments["format"].(string)
+	overwrite, _ := request.Params.Arguments["overwrite"].(bool)
+
+	if p.isDryRun(request) {
+		return p.dryRunResult("extract_archive", path)(p.archiveService.PlanExtractArchive(path, destination, format, overwrite))
+	}
+
+	result, err := p.archiveService.ExtractArchive(path, destination, format, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	p.metrics.BytesWritten.Add(float64(result.Bytes), "extract_archive")
+
+	return archiveResult("extract_archive", path, result)
+}
+
+// archiveResult returns the report of an archive operation as the tool result
+func archiveResult(op, path string, result *ArchiveResult) (*mcp.CallToolResult, error) {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, errors.NewFileSystemError(op, path, err)
+	}
+	return mcp.NewToolResultText(string(resultJSON)), nil
 }
 
 func (p *ServiceProvider) handleSearchFiles(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -456,13 +1754,33 @@ func (p *ServiceProvider) handleSearchFiles(_ context.Context, request mcp.CallT
 		return nil, err
 	}
 
+	redactions := 0
+	for _, result := range results {
+		redactions += result.Redactions
+	}
+
 	// Convert results to JSON
 	resultsJSON, err := json.Marshal(results)
 	if err != nil {
 		return nil, errors.NewFileSystemError("search_files", "", err)
 	}
 
-	return mcp.NewToolResultText(string(resultsJSON)), nil
+	return p.withRedactionReport(mcp.NewToolResultText(string(resultsJSON)), "search_files", redactions), nil
+}
+
+// withRedactionReport records redactions made for a response and, if there
+// were any, tells the client how many secrets were masked
+func (p *ServiceProvider) withRedactionReport(result *mcp.CallToolResult, tool string, redactions int) *mcp.CallToolResult {
+	if redactions == 0 {
+		return result
+	}
+
+	p.metrics.Redactions.Add(float64(redactions), tool)
+	result.Content = append(result.Content, mcp.TextContent{
+		Type: "text",
+		Text: fmt.Sprintf("Redacted %d secret(s) from this response", redactions),
+	})
+	return result
 }
 
 func (p *ServiceProvider) handleListAllowedDirectories(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
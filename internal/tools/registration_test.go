@@ -9,7 +9,9 @@ import (
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewServiceProvider(t *testing.T) {
@@ -23,7 +25,7 @@ func TestNewServiceProvider(t *testing.T) {
 	assert.NotNil(t, provider.directoryService)
 	assert.NotNil(t, provider.searchService)
 	assert.NotNil(t, provider.logger)
-	assert.Equal(t, allowedDirs, provider.allowedDirs)
+	assert.Equal(t, allowedDirs, provider.ListAllowedDirectories())
 }
 
 func TestRegisterTools(t *testing.T) {
@@ -209,10 +211,37 @@ func TestHandleListDirectory(t *testing.T) {
 	textContent, ok := result.Content[0].(mcp.TextContent)
 	assert.True(t, ok)
 
-	var entries []FileInfo
-	err = json.Unmarshal([]byte(textContent.Text), &entries)
+	var page DirectoryPage
+	err = json.Unmarshal([]byte(textContent.Text), &page)
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(entries)) // test.txt and testdir
+	assert.Equal(t, 2, len(page.Entries)) // test.txt and testdir
+	assert.Equal(t, 2, page.Total)
+
+	// The page carries its total and the next page's cursor
+	request.Params.Arguments = map[string]interface{}{
+		"path":  tmpDir,
+		"type":  "directory",
+		"limit": float64(1),
+	}
+	result, err = provider.handleListDirectory(context.Background(), request)
+	require.NoError(t, err)
+	require.Len(t, result.Content, 1)
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &page))
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, "testdir", page.Entries[0].Name)
+	assert.Equal(t, 1, page.Total)
+	assert.Empty(t, page.NextCursor)
+
+	request.Params.Arguments = map[string]interface{}{"path": tmpDir, "limit": float64(1)}
+	result, err = provider.handleListDirectory(context.Background(), request)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &page))
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, "1", page.NextCursor)
+
+	request.Params.Arguments["type"] = "all"
+	_, err = provider.handleListDirectory(context.Background(), request)
+	assert.ErrorIs(t, err, errors.ErrInvalidArgument)
 }
 
 func TestHandleCreateDirectory(t *testing.T) {
@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"reflect"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/ratelimit"
+)
+
+// Settings are the parts of the provider configuration that can change while
+// the server runs
+type Settings struct {
+	AllowedDirs   []string
+	PathPolicy    *PathPolicy
+	WriteLimits   WriteLimits
+	ArchiveLimits ArchiveLimits
+	RateLimits    ratelimit.Config
+	ToolSelection ToolSelection
+	GitCommit     bool
+	WorkDir       string
+	Tenants       []Tenant
+}
+
+// Reload applies new settings to a running provider. The allowed directories,
+// path policy and limits are swapped at once; calls already past validation
+// finish under the old ones. Rate limiters are only rebuilt, and their state
+// lost, when the rate limits change. A changed tool selection takes effect
+// when the tools are registered again with Register. Changed tenants apply to
+// the sessions started afterwards.
+func (p *ServiceProvider) Reload(settings Settings) {
+	p.validator.Update(settings.AllowedDirs, settings.PathPolicy, settings.WriteLimits, settings.ArchiveLimits, settings.WorkDir)
+	p.usage.SetRoots(settings.AllowedDirs)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.limits == nil || !reflect.DeepEqual(p.rateLimits, settings.RateLimits) {
+		p.rateLimits = settings.RateLimits
+		p.limits = newLimits(settings.RateLimits)
+	}
+	p.toolSelection = settings.ToolSelection
+	p.gitCommit = settings.GitCommit
+	p.tenants = settings.Tenants
+}
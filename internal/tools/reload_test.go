@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceProvider_Reload(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	writeTree(t, dirA, map[string]string{"a.txt": "a", ".env": "TOKEN=a"})
+	writeTree(t, dirB, map[string]string{"b.txt": "b"})
+
+	provider := NewServiceProvider([]string{dirA}, WithRateLimits(ratelimit.Config{}))
+	provider.Register(server.NewMCPServer("test", "1.0.0"))
+	assert.Contains(t, provider.EnabledTools(), "write_file")
+
+	_, err := provider.fileService.ReadFile(filepath.Join(dirB, "b.txt"))
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+
+	policy, err := NewPathPolicy([]PolicyRule{{Pattern: ".env", Read: true, Write: true}})
+	require.NoError(t, err)
+	limiters := provider.limits
+	provider.Reload(Settings{
+		AllowedDirs:   []string{dirA, dirB},
+		PathPolicy:    policy,
+		WriteLimits:   WriteLimits{MaxWriteSize: 4},
+		ArchiveLimits: DefaultArchiveLimits(),
+		ToolSelection: ToolSelection{Profile: ProfileReadOnly},
+	})
+
+	assert.Equal(t, []string{dirA, dirB}, provider.ListAllowedDirectories())
+	content, err := provider.fileService.ReadFile(filepath.Join(dirB, "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "b", content)
+
+	_, err = provider.fileService.ReadFile(filepath.Join(dirA, ".env"))
+	assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+	err = provider.fileWriter.WriteFile(filepath.Join(dirB, "c.txt"), "too long", false)
+	assert.True(t, errors.IsQuotaExceeded(err), "write limits apply to every service")
+
+	assert.Same(t, limiters, provider.limits, "unchanged rate limits keep their state")
+	assert.Contains(t, provider.EnabledTools(), "write_file", "the selection changes when the tools are registered again")
+
+	provider.Register(server.NewMCPServer("test", "1.0.0"))
+	assert.NotContains(t, provider.EnabledTools(), "write_file")
+	assert.Contains(t, provider.EnabledTools(), "read_file")
+
+	provider.Reload(Settings{AllowedDirs: []string{dirB}, RateLimits: ratelimit.Config{MaxConcurrentExpensive: 2}})
+	assert.NotSame(t, limiters, provider.limits)
+	_, err = provider.fileService.ReadFile(filepath.Join(dirA, "a.txt"))
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed, "removed directories are no longer allowed")
+}
+
+func TestServiceProvider_ReloadConcurrent(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dirA, "a.txt"), []byte("a"), 0644))
+	provider := NewServiceProvider([]string{dirA})
+	provider.Register(server.NewMCPServer("test", "1.0.0"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := callTool(provider.handleReadFile, context.Background(), map[string]interface{}{"path": filepath.Join(dirA, "a.txt")})
+				assert.NoError(t, err, "dirA stays allowed across reloads")
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		dirs := []string{dirA}
+		if i%2 == 0 {
+			dirs = append(dirs, dirB)
+		}
+		provider.Reload(Settings{AllowedDirs: dirs, ArchiveLimits: DefaultArchiveLimits()})
+	}
+	wg.Wait()
+}
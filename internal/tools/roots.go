@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+)
+
+// rootsTimeout bounds how long the server waits for a client to list its roots
+const rootsTimeout = 10 * time.Second
+
+// WithClientRoots confines each session to the roots its client advertises.
+// The allowed directories remain the ceiling: a session only gets the parts of
+// its roots inside them. Clients that cannot list roots get every allowed directory.
+func WithClientRoots(enabled bool) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.clientRoots = enabled
+	}
+}
+
+// sessionRoots is the listing of a client's roots
+type sessionRoots struct {
+	ready    chan struct{} // Closed once the roots are listed
+	provider *ServiceProvider
+	err      error
+}
+
+// RefreshRoots asks the client of the session in ctx for its roots and confines
+// the session to them. It is called when the client initializes and when it
+// reports that its roots changed; tool calls wait for the client's answer.
+func (p *ServiceProvider) RefreshRoots(ctx context.Context) {
+	info, ok := session.FromContext(ctx)
+	if !p.clientRoots || !ok || info.Peer == nil {
+		return
+	}
+
+	state, err := p.sessionState(info)
+	if err != nil {
+		p.logger.Warn("Not listing the roots of session %s: %v", info.ID, err)
+		return
+	}
+	p.listRoots(ctx, state, info.Peer)
+}
+
+// sessionRootsFor returns the provider confined to the roots of a session's
+// client, listing them if they have not been requested yet
+func (p *ServiceProvider) sessionRootsFor(ctx context.Context, state *sessionState, peer session.Peer) (*ServiceProvider, error) {
+	p.sessionsMu.Lock()
+	roots := state.roots
+	p.sessionsMu.Unlock()
+	if roots == nil {
+		roots = p.listRoots(ctx, state, peer)
+	}
+
+	select {
+	case <-roots.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if roots.err != nil {
+		// Ask the client again on the next call
+		p.sessionsMu.Lock()
+		if state.roots == roots {
+			state.roots = nil
+		}
+		p.sessionsMu.Unlock()
+		return nil, roots.err
+	}
+	return roots.provider, nil
+}
+
+// listRoots starts listing the roots of a session's client in the background.
+// The session is confined to the parts of the roots its provider allows.
+func (p *ServiceProvider) listRoots(ctx context.Context, state *sessionState, peer session.Peer) *sessionRoots {
+	roots := &sessionRoots{ready: make(chan struct{})}
+
+	p.sessionsMu.Lock()
+	state.roots = roots
+	p.sessionsMu.Unlock()
+
+	// The request that triggered the listing may end before the client answers
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer close(roots.ready)
+		roots.provider, roots.err = state.provider.rootsProvider(ctx, peer)
+	}()
+	return roots
+}
+
+// rootsProvider asks a client for its roots and returns a provider confined to them
+func (p *ServiceProvider) rootsProvider(ctx context.Context, peer session.Peer) (*ServiceProvider, error) {
+	if !peer.Supports("roots") {
+		return p, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, rootsTimeout)
+	defer cancel()
+
+	raw, err := peer.Request(ctx, "roots/list", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: listing the client's roots: %v", errors.ErrInvalidOperation, err)
+	}
+
+	var result struct {
+		Roots []struct {
+			URI string `json:"uri"`
+		} `json:"roots"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("%w: invalid roots from the client: %v", errors.ErrInvalidOperation, err)
+	}
+
+	var dirs []string
+	for _, root := range result.Roots {
+		if dir, ok := rootPath(root.URI); ok {
+			dirs = append(dirs, dir)
+		} else {
+			p.logger.Warn("Ignoring client root %s: not a file URI", root.URI)
+		}
+	}
+
+	scoped := p.scoped(dirs)
+	p.logger.Info("Client roots %v allow %v", dirs, scoped.ListAllowedDirectories())
+	return scoped, nil
+}
+
+// scoped returns a provider serving the same tools as p, confined to dirs
+func (p *ServiceProvider) scoped(dirs []string) *ServiceProvider {
+	scoped := &ServiceProvider{
+		logger:        p.logger,
+		metrics:       p.metrics,
+		writeLimits:   p.writeLimits,
+		archiveLimits: p.archiveLimits,
+		usage:         p.usage,
+		policy:        p.policy,
+		redactor:      p.redactor,
+		confirmations: p.confirmations,
+		dryRun:        p.dryRun,
+		fsys:          p.fsys,
+	}
+	scoped.setValidator(dirs, p.validator.scoped(dirs))
+	return scoped
+}
+
+// rootPath returns the local directory named by a file:// root URI
+func rootPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || u.Path == "" {
+		return "", false
+	}
+
+	path := u.Path
+	// file:///C:/dir names the Windows path C:/dir
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+
+	abs, err := filepath.Abs(filepath.FromSlash(path))
+	if err != nil {
+		return "", false
+	}
+	return filepath.Clean(abs), true
+}
+
+// intersectDirs returns the directories lying inside both a directory of a and
+// a directory of b, leaving out those inside another result
+func intersectDirs(a, b []string) []string {
+	var found []string
+	for _, x := range a {
+		for _, y := range b {
+			dir := ""
+			switch {
+			case within(y, x):
+				dir = x
+			case within(x, y):
+				dir = y
+			}
+			if dir != "" && !slices.Contains(found, dir) {
+				found = append(found, dir)
+			}
+		}
+	}
+
+	var dirs []string
+	for _, dir := range found {
+		nested := slices.ContainsFunc(found, func(other string) bool {
+			return other != dir && within(other, dir)
+		})
+		if !nested {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rootsResult formats a roots/list result naming dirs
+func rootsResult(t *testing.T, uris ...string) string {
+	roots := make([]map[string]string, 0, len(uris))
+	for _, uri := range uris {
+		roots = append(roots, map[string]string{"uri": uri})
+	}
+	data, err := json.Marshal(map[string]any{"roots": roots})
+	require.NoError(t, err)
+	return string(data)
+}
+
+// fileURI returns the file:// URI of a local path
+func fileURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return "file://" + path
+}
+
+func TestServiceProvider_ClientRoots(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	writeTree(t, base, map[string]string{"a/a.txt": "a", "a/.env": "TOKEN=a", "b/b.txt": "b"})
+	writeTree(t, outside, map[string]string{"o.txt": "o"})
+
+	policy, err := NewPathPolicy([]PolicyRule{{Pattern: "a/.env", Read: true, Write: true}})
+	require.NoError(t, err)
+	provider := NewServiceProvider([]string{base}, WithPathPolicy(policy), WithClientRoots(true))
+
+	dirA := filepath.Join(base, "a")
+	peer := &fakePeer{
+		capabilities: map[string]bool{"roots": true},
+		result:       rootsResult(t, fileURI(dirA), fileURI(outside), "https://example.com/repo"),
+	}
+	ctx := session.NewContext(context.Background(), session.Info{ID: "one", Peer: peer})
+	provider.RefreshRoots(ctx)
+
+	readFile := provider.dispatch("read_file", (*ServiceProvider).handleReadFile)
+	result, err := callTool(readFile, ctx, map[string]interface{}{"path": filepath.Join(dirA, "a.txt")})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "a")
+
+	_, err = callTool(readFile, ctx, map[string]interface{}{"path": filepath.Join(base, "b", "b.txt")})
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed, "directories outside the client's roots are not allowed")
+
+	_, err = callTool(readFile, ctx, map[string]interface{}{"path": filepath.Join(outside, "o.txt")})
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed, "roots outside the allowed directories grant nothing")
+
+	_, err = callTool(readFile, ctx, map[string]interface{}{"path": filepath.Join(dirA, ".env")})
+	assert.ErrorIs(t, err, errors.ErrPathDenied, "path rules stay relative to the allowed directory")
+
+	scoped, err := provider.forSession(ctx, "read_file")
+	require.NoError(t, err)
+	assert.Equal(t, []string{dirA}, scoped.ListAllowedDirectories())
+	assert.Equal(t, []string{"roots/list"}, peer.requests, "roots are listed once per refresh")
+
+	// Other sessions and requests without a session are not confined
+	_, err = callTool(readFile, context.Background(), map[string]interface{}{"path": filepath.Join(base, "b", "b.txt")})
+	assert.NoError(t, err)
+
+	// A reload of the allowed directories applies to confined sessions
+	provider.Reload(Settings{AllowedDirs: []string{filepath.Join(base, "b")}})
+	_, err = callTool(readFile, ctx, map[string]interface{}{"path": filepath.Join(dirA, "a.txt")})
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+	assert.Empty(t, scoped.ListAllowedDirectories())
+
+	provider.EndSession("one")
+	provider.sessionsMu.Lock()
+	assert.Empty(t, provider.sessions)
+	provider.sessionsMu.Unlock()
+}
+
+func TestServiceProvider_ClientRootsFallback(t *testing.T) {
+	base := t.TempDir()
+
+	tests := []struct {
+		name        string
+		clientRoots bool
+		peer        *fakePeer
+		expectSame  bool
+		expectError bool
+	}{
+		{
+			name:        "Option disabled",
+			peer:        &fakePeer{capabilities: map[string]bool{"roots": true}, result: rootsResult(t)},
+			expectSame:  true,
+			clientRoots: false,
+		},
+		{
+			name:        "Client without roots",
+			clientRoots: true,
+			peer:        &fakePeer{},
+			expectSame:  true,
+		},
+		{
+			name:        "No roots open",
+			clientRoots: true,
+			peer:        &fakePeer{capabilities: map[string]bool{"roots": true}, result: rootsResult(t)},
+		},
+		{
+			name:        "Listing fails",
+			clientRoots: true,
+			peer:        &fakePeer{capabilities: map[string]bool{"roots": true}, err: fmt.Errorf("boom")},
+			expectError: true,
+		},
+		{
+			name:        "Invalid result",
+			clientRoots: true,
+			peer:        &fakePeer{capabilities: map[string]bool{"roots": true}, result: `{"roots":"none"}`},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewServiceProvider([]string{base}, WithClientRoots(tt.clientRoots))
+			ctx := session.NewContext(context.Background(), session.Info{ID: "one", Peer: tt.peer})
+
+			target, err := provider.forSession(ctx, "read_file")
+			if tt.expectError {
+				assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+
+				// The roots are requested again on the next call
+				_, err = provider.forSession(ctx, "read_file")
+				assert.Error(t, err)
+				assert.Len(t, tt.peer.requests, 2)
+				return
+			}
+
+			require.NoError(t, err)
+			if tt.expectSame {
+				assert.Same(t, provider, target)
+				assert.Empty(t, tt.peer.requests)
+				return
+			}
+			assert.NotSame(t, provider, target)
+			assert.Empty(t, target.ListAllowedDirectories())
+		})
+	}
+}
+
+func TestRootPath(t *testing.T) {
+	dir := t.TempDir()
+
+	path, ok := rootPath(fileURI(dir))
+	assert.True(t, ok)
+	assert.Equal(t, dir, path)
+
+	path, ok = rootPath(fileURI(dir) + "/sub/")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "sub"), path)
+
+	for _, uri := range []string{"https://example.com/dir", "file://", "relative/dir", "%zz"} {
+		_, ok := rootPath(uri)
+		assert.False(t, ok, uri)
+	}
+}
+
+func TestIntersectDirs(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "srv")
+	projects := filepath.Join(root, "projects")
+	api := filepath.Join(projects, "api")
+	web := filepath.Join(projects, "web")
+	other := filepath.Join(string(filepath.Separator), "home")
+
+	assert.Equal(t, []string{api}, intersectDirs([]string{api}, []string{projects}))
+	assert.Equal(t, []string{projects}, intersectDirs([]string{root}, []string{projects}))
+	assert.Equal(t, []string{api, web}, intersectDirs([]string{api, web, other}, []string{projects}))
+	assert.Empty(t, intersectDirs([]string{other}, []string{projects}))
+	assert.Equal(t, []string{projects}, intersectDirs([]string{projects, api}, []string{projects}))
+}
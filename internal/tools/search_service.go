@@ -2,6 +2,8 @@ package tools
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,24 +16,37 @@ import (
 type SearchService struct {
 	allowedDirs []string
 	logger      *logging.Logger
-	validator   PathValidator
+	validator   *PathValidatorImpl
+	redactor    *Redactor
+	fsys        Backend
 }
 
 // NewSearchService creates a new SearchService
 func NewSearchService(allowedDirs []string) *SearchService {
-	validator := &PathValidatorImpl{
-		allowedDirs: allowedDirs,
-	}
-
 	return &SearchService{
 		allowedDirs: allowedDirs,
 		logger:      logging.DefaultLogger("search_service"),
-		validator:   validator,
+		validator:   newPathValidator(allowedDirs),
+		fsys:        OSBackend{},
 	}
 }
 
-// SearchFiles searches for files matching the query
+// SearchFiles searches for files matching the query. Paths inside archives,
+// such as /repo/app.zip!/config, are searched without extracting them, and
+// .gz files are searched decompressed.
 func (s *SearchService) SearchFiles(query string, path string, recursive bool) ([]SearchResult, error) {
+	vp, virtual, err := resolveVirtualPath(s.fsys, s.validator, path)
+	if err != nil {
+		return nil, errors.NewFileSystemError("search_files", path, err)
+	}
+	if virtual {
+		results := make([]SearchResult, 0)
+		if err := s.searchInArchive(path, vp, query, recursive, &results); err != nil {
+			return nil, errors.NewFileSystemError("search_files", path, err)
+		}
+		return results, nil
+	}
+
 	// Validate path
 	validPath, err := s.validator.ValidatePath(path)
 	if err != nil {
@@ -39,7 +54,7 @@ func (s *SearchService) SearchFiles(query string, path string, recursive bool) (
 	}
 
 	// Check if the path exists and is a directory
-	info, err := os.Stat(validPath)
+	info, err := s.fsys.Stat(validPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, errors.NewFileSystemError("search_files", path, errors.ErrDirectoryNotFound)
@@ -67,7 +82,7 @@ func (s *SearchService) SearchFiles(query string, path string, recursive bool) (
 // searchInDirectory searches for files in a directory
 func (s *SearchService) searchInDirectory(dirPath, query string, recursive bool, results *[]SearchResult) error {
 	// Read the directory
-	entries, err := os.ReadDir(dirPath)
+	entries, err := s.fsys.ReadDir(dirPath)
 	if err != nil {
 		return err
 	}
@@ -76,6 +91,11 @@ func (s *SearchService) searchInDirectory(dirPath, query string, recursive bool,
 	for _, entry := range entries {
 		entryPath := filepath.Join(dirPath, entry.Name())
 
+		// Skip entries the path policy does not allow reading
+		if !s.validator.Permits(entryPath, ReadAccess) {
+			continue
+		}
+
 		// If it's a directory and recursive is true, search in the subdirectory
 		if entry.IsDir() && recursive {
 			if err := s.searchInDirectory(entryPath, query, recursive, results); err != nil {
@@ -97,8 +117,17 @@ func (s *SearchService) searchInDirectory(dirPath, query string, recursive bool,
 
 // searchInFile searches for a query in a file
 func (s *SearchService) searchInFile(filePath, query string, results *[]SearchResult) error {
+	if isGzipFile(filePath) {
+		data, err := readGzipFile(s.fsys, filePath, s.validator.ArchiveLimits())
+		if err != nil {
+			return err
+		}
+		s.searchContent(filePath, data, query, results)
+		return nil
+	}
+
 	// Open the file
-	file, err := os.Open(filePath) // #nosec G304 - path is validated by ValidatePath in the calling function
+	file, err := s.fsys.Open(filePath)
 	if err != nil {
 		return err
 	}
@@ -135,25 +164,53 @@ func (s *SearchService) searchInFile(filePath, query string, results *[]SearchRe
 		return nil
 	}
 
+	return s.searchLines(filePath, file, query, results)
+}
+
+// searchContent searches for a query in content already read, reported as filePath
+func (s *SearchService) searchContent(filePath string, data []byte, query string, results *[]SearchResult) {
+	if len(data) == 0 || isBinary(data[:min(len(data), 512)]) {
+		return
+	}
+	if err := s.searchLines(filePath, bytes.NewReader(data), query, results); err != nil {
+		s.logger.Warn("Error searching in file %s: %v", filePath, err)
+	}
+}
+
+// searchLines searches for a query in the lines of a text file, reported as filePath
+func (s *SearchService) searchLines(filePath string, r io.Reader, query string, results *[]SearchResult) error {
 	// Read the file line by line
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 
 	// Increase buffer size to handle longer lines
 	const maxScanTokenSize = 1024 * 1024 * 10 // 10MB buffer
 	scanBuf := make([]byte, maxScanTokenSize)
 	scanner.Buffer(scanBuf, maxScanTokenSize)
 
+	// Every line goes through the redactor so that it can track private key
+	// blocks, and the query is matched against the redacted text so that
+	// searches cannot be used to probe for secret values
+	var redactor *lineRedactor
+	if s.redactor != nil {
+		redactor = &lineRedactor{redactor: s.redactor}
+	}
+
 	lineNum := 1
 	query = strings.ToLower(query)
 	for scanner.Scan() {
 		content := scanner.Text()
+		redactions := 0
+		if redactor != nil {
+			content, redactions = redactor.redact(content)
+		}
 		line := strings.ToLower(content)
 		if strings.Contains(line, query) {
 			// Add the result
 			*results = append(*results, SearchResult{
-				Path:    filePath,
-				Line:    lineNum,
-				Content: content,
+				Path:       filePath,
+				Line:       lineNum,
+				Content:    content,
+				Redactions: redactions,
 			})
 		}
 		lineNum++
@@ -162,6 +219,52 @@ func (s *SearchService) searchInFile(filePath, query string, results *[]SearchRe
 	return scanner.Err()
 }
 
+// searchInArchive searches the files inside an archive at or below vp.inner,
+// or directly inside it unless recursive. Results name files as path does.
+func (s *SearchService) searchInArchive(path string, vp *virtualPath, query string, recursive bool, results *[]SearchResult) error {
+	index, err := vp.index(s.validator.ArchiveLimits())
+	if err != nil {
+		return err
+	}
+	root, ok := index[vp.inner]
+	if !ok {
+		return errors.ErrDirectoryNotFound
+	}
+
+	archive, _, _ := splitVirtualPath(path)
+	return walkArchive(vp.fsys, vp.archive, vp.format, func(h archiveHeader, r io.Reader) error {
+		name, err := archiveEntryPath(h.name)
+		if err != nil || h.kind != entryFile || !vp.permits(s.validator, name) {
+			return nil
+		}
+
+		if !root.IsDir() {
+			if name != vp.inner {
+				return nil
+			}
+		} else {
+			rel := name
+			if vp.inner != "" {
+				var below bool
+				if rel, below = strings.CutPrefix(name, vp.inner+"/"); !below {
+					return nil
+				}
+			}
+			if !recursive && strings.Contains(rel, "/") {
+				return nil
+			}
+		}
+
+		data, err := readLimited(r, s.validator.ArchiveLimits().MaxTotalSize)
+		if err != nil {
+			s.logger.Warn("Error searching in %s!/%s: %v", archive, name, err)
+			return nil
+		}
+		s.searchContent(archive+"!/"+name, data, query, results)
+		return nil
+	})
+}
+
 // isBinary checks if data appears to be binary content
 func isBinary(data []byte) bool {
 	// Check for null bytes, which are common in binary files
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+)
+
+// sessionState is what the provider keeps about a connected session
+type sessionState struct {
+	tenant   string           // Name of the session's tenant, if any
+	provider *ServiceProvider // Provider of the session's tenant, or the server's
+	roots    *sessionRoots    // Listing of the client's roots, once requested
+}
+
+// StartSession sets up the session in ctx once its client has initialized: it
+// selects the session's tenant and asks the client for its roots. Sessions
+// that were not started are set up by their first tool call.
+func (p *ServiceProvider) StartSession(ctx context.Context) {
+	info, ok := session.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if _, err := p.sessionState(info); err != nil {
+		p.logger.Warn("Session %s: %v", info.ID, err)
+		return
+	}
+	p.RefreshRoots(ctx)
+}
+
+// EndSession tears down the provider and roots of a session once its client
+// has disconnected
+func (p *ServiceProvider) EndSession(id string) {
+	p.sessionsMu.Lock()
+	state, ok := p.sessions[id]
+	delete(p.sessions, id)
+	p.sessionsMu.Unlock()
+
+	if ok && state.tenant != "" {
+		p.logger.Info("Session %s of tenant %s ended", id, state.tenant)
+	}
+}
+
+// sessionState returns the state of a session, selecting its tenant the first
+// time the session is seen
+func (p *ServiceProvider) sessionState(info session.Info) (*sessionState, error) {
+	p.sessionsMu.Lock()
+	defer p.sessionsMu.Unlock()
+
+	if state, ok := p.sessions[info.ID]; ok {
+		return state, nil
+	}
+
+	tenant, err := p.selectTenant(info)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &sessionState{provider: p}
+	if tenant != nil {
+		state.tenant = tenant.Name
+		state.provider = p.tenantProvider(*tenant)
+		p.logger.Info("Session %s started for tenant %s with directories %v", info.ID, tenant.Name, tenant.AllowedDirs)
+	}
+	if p.sessions == nil {
+		p.sessions = make(map[string]*sessionState)
+	}
+	p.sessions[info.ID] = state
+	return state, nil
+}
+
+// forSession returns the provider serving a call of tool in the session in
+// ctx: the provider of the session's tenant, confined to the client's roots if
+// they are used, or p itself for requests without a session
+func (p *ServiceProvider) forSession(ctx context.Context, tool string) (*ServiceProvider, error) {
+	info, ok := session.FromContext(ctx)
+	if !ok {
+		return p, nil
+	}
+
+	state, err := p.sessionState(info)
+	if err != nil {
+		return nil, err
+	}
+	if state.provider != p && !state.provider.allows(tool) {
+		return nil, fmt.Errorf("%w: %s is not enabled for tenant %s", errors.ErrPermissionDenied, tool, state.tenant)
+	}
+
+	if !p.clientRoots || info.Peer == nil {
+		return state.provider, nil
+	}
+	return p.sessionRootsFor(ctx, state, info.Peer)
+}
+
+// dispatch returns a handler calling handler on the provider serving the request's session
+func (p *ServiceProvider) dispatch(name string, handler providerHandler) ToolHandler {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		target, err := p.forSession(ctx, name)
+		if err != nil {
+			return nil, errors.NewFileSystemError(name, "", err)
+		}
+		return handler(target, ctx, request)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build darwin
+
+package tools
+
+import (
+	"syscall"
+	"time"
+)
+
+// statTimes returns the access and creation times of a file
+func statTimes(st *syscall.Stat_t) (accessed, created time.Time) {
+	return time.Unix(st.Atimespec.Unix()), time.Unix(st.Birthtimespec.Unix())
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package tools
+
+import (
+	"syscall"
+	"time"
+)
+
+// statTimes returns the access time of a file. Linux does not report the
+// creation time through stat(2).
+func statTimes(st *syscall.Stat_t) (accessed, created time.Time) {
+	return time.Unix(st.Atim.Unix()), time.Time{}
+}
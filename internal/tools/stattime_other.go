@@ -0,0 +1,13 @@
+//go:build unix && !linux && !darwin
+
+package tools
+
+import (
+	"syscall"
+	"time"
+)
+
+// statTimes reports no times on platforms whose stat fields are not mapped
+func statTimes(_ *syscall.Stat_t) (accessed, created time.Time) {
+	return time.Time{}, time.Time{}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package tools
+
+import "os"
+
+// addSysInfo adds nothing on platforms without further file metadata
+func addSysInfo(_ *FileInfo, _ os.FileInfo) {}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package tools
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// ownerNames caches user and group names by id, keyed "u<uid>" and "g<gid>"
+var ownerNames sync.Map
+
+// addSysInfo adds the owner, group, inode, link count and access and creation
+// times recorded by the platform to fileInfo
+func addSysInfo(fileInfo *FileInfo, info os.FileInfo) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	fileInfo.Owner = ownerName("u", strconv.FormatUint(uint64(st.Uid), 10))
+	fileInfo.Group = ownerName("g", strconv.FormatUint(uint64(st.Gid), 10))
+	fileInfo.Inode = uint64(st.Ino)
+	fileInfo.Links = uint64(st.Nlink)
+
+	accessed, created := statTimes(st)
+	fileInfo.AccessTime = formatFileTime(accessed)
+	fileInfo.CreateTime = formatFileTime(created)
+}
+
+// ownerName returns the name of a user (kind "u") or group (kind "g"), or its
+// id if it has no name
+func ownerName(kind, id string) string {
+	if name, ok := ownerNames.Load(kind + id); ok {
+		return name.(string)
+	}
+
+	name := id
+	if kind == "u" {
+		if u, err := user.LookupId(id); err == nil {
+			name = u.Username
+		}
+	} else if g, err := user.LookupGroupId(id); err == nil {
+		name = g.Name
+	}
+	ownerNames.Store(kind+id, name)
+	return name
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package tools
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// addSysInfo adds the access and creation times recorded by the platform to fileInfo
+func addSysInfo(fileInfo *FileInfo, info os.FileInfo) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return
+	}
+
+	fileInfo.AccessTime = formatFileTime(time.Unix(0, data.LastAccessTime.Nanoseconds()))
+	fileInfo.CreateTime = formatFileTime(time.Unix(0, data.CreationTime.Nanoseconds()))
+}
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+)
+
+// Tenant is a group of sessions served with their own directories, rules and
+// limits instead of the server's. Each session of a tenant gets a provider of
+// its own, created when the session starts and dropped when it ends.
+type Tenant struct {
+	Name          string
+	Tokens        []string // Bearer tokens selecting the tenant; without any, clients select it by name
+	AllowedDirs   []string
+	WorkDir       string
+	PathPolicy    *PathPolicy
+	WriteLimits   WriteLimits
+	ArchiveLimits ArchiveLimits
+	ToolSelection ToolSelection
+	GitCommit     bool
+}
+
+// WithTenants serves the sessions selecting one of tenants with its settings
+func WithTenants(tenants []Tenant) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.tenants = tenants
+	}
+}
+
+// selectTenant returns the tenant of a session: the tenant whose token the
+// client presents, else the tenant it named when initializing, or nil for the
+// server's own settings
+func (p *ServiceProvider) selectTenant(info session.Info) (*Tenant, error) {
+	p.mu.RLock()
+	tenants := p.tenants
+	p.mu.RUnlock()
+
+	if info.Token != "" {
+		for i := range tenants {
+			for _, token := range tenants[i].Tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(info.Token)) == 1 {
+					return &tenants[i], nil
+				}
+			}
+		}
+	}
+
+	if info.Tenant == "" {
+		return nil, nil
+	}
+	for i := range tenants {
+		if tenants[i].Name != info.Tenant {
+			continue
+		}
+		if len(tenants[i].Tokens) > 0 {
+			return nil, fmt.Errorf("%w: tenant %s requires a token", errors.ErrPermissionDenied, info.Tenant)
+		}
+		return &tenants[i], nil
+	}
+	return nil, fmt.Errorf("%w: unknown tenant %s", errors.ErrInvalidArgument, info.Tenant)
+}
+
+// tenantProvider creates the provider serving a session of a tenant. Metrics,
+// redaction, dry-run mode, pending confirmations, storage backends and the
+// usage counted against quotas are shared with p.
+func (p *ServiceProvider) tenantProvider(t Tenant) *ServiceProvider {
+	provider := NewServiceProvider(t.AllowedDirs,
+		WithMetrics(p.metrics),
+		WithWriteLimits(t.WriteLimits),
+		WithArchiveLimits(t.ArchiveLimits),
+		WithPathPolicy(t.PathPolicy),
+		WithWorkDir(t.WorkDir),
+		WithRedactor(p.redactor),
+		WithToolSelection(t.ToolSelection),
+		WithGitCommit(t.GitCommit),
+		WithDryRun(p.dryRun),
+		withUsage(p.usage.Scoped(t.AllowedDirs)),
+		withStorage(p.fsys, tenantBackends(p.backends, t.AllowedDirs)),
+	)
+	provider.logger = p.logger
+	provider.confirmations = p.confirmations
+	return provider
+}
+
+// withUsage makes the provider count quota usage with tracker
+func withUsage(tracker *UsageTracker) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.usage = tracker
+	}
+}
+
+// withStorage makes the provider store files in fsys, whose bound directories
+// are bindings, instead of creating backends of its own
+func withStorage(fsys Backend, bindings []BackendBinding) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.fsys = fsys
+		p.backends = bindings
+	}
+}
+
+// tenantBackends returns the bindings storing files in or around the allowed
+// directories of a tenant
+func tenantBackends(bindings []BackendBinding, allowedDirs []string) []BackendBinding {
+	var scoped []BackendBinding
+	for _, binding := range bindings {
+		for _, dir := range usageRoots(allowedDirs) {
+			if within(binding.Root, dir) || within(dir, binding.Root) {
+				scoped = append(scoped, binding)
+				break
+			}
+		}
+	}
+	return scoped
+}
+
+// allows reports whether the provider's tool selection includes a tool
+func (p *ServiceProvider) allows(name string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if name == "git_commit" && !p.gitCommit {
+		return false
+	}
+	return p.toolSelection.Enabled(name)
+}
@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/moguyn/mcp-go-filesystem/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listedDirectories calls list_allowed_directories in ctx
+func listedDirectories(t *testing.T, provider *ServiceProvider, ctx context.Context) []string {
+	t.Helper()
+	result, err := callTool(provider.dispatch("list_allowed_directories", (*ServiceProvider).handleListAllowedDirectories), ctx, map[string]interface{}{})
+	require.NoError(t, err)
+	var dirs []string
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &dirs))
+	return dirs
+}
+
+func TestServiceProvider_Tenants(t *testing.T) {
+	serverDir := t.TempDir()
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	writeTree(t, dirA, map[string]string{"src/main.go": "package main"})
+
+	provider := NewServiceProvider([]string{serverDir}, WithTenants([]Tenant{
+		{
+			Name:          "a",
+			Tokens:        []string{"secret"},
+			AllowedDirs:   []string{dirA},
+			WorkDir:       filepath.Join(dirA, "src"),
+			ToolSelection: ToolSelection{Profile: ProfileReadOnly},
+		},
+		{Name: "b", AllowedDirs: []string{dirB}},
+	}))
+
+	tokenCtx := session.NewContext(context.Background(), session.Info{ID: "one", Token: "secret"})
+	assert.Equal(t, []string{dirA}, listedDirectories(t, provider, tokenCtx))
+
+	// Relative paths resolve against the tenant's working directory
+	readFile := provider.dispatch("read_file", (*ServiceProvider).handleReadFile)
+	result, err := callTool(readFile, tokenCtx, map[string]interface{}{"path": "main.go"})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(mcp.TextContent).Text, "package main")
+
+	_, err = callTool(readFile, tokenCtx, map[string]interface{}{"path": filepath.Join(serverDir, "x")})
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+
+	// The tenant's tool selection applies although the server registers the tool
+	writeFile := provider.dispatch("write_file", (*ServiceProvider).handleWriteFile)
+	_, err = callTool(writeFile, tokenCtx, map[string]interface{}{"path": "new.go", "content": "x"})
+	assert.ErrorIs(t, err, errors.ErrPermissionDenied)
+
+	// Tenants without tokens are selected by name
+	namedCtx := session.NewContext(context.Background(), session.Info{ID: "two", Tenant: "b"})
+	assert.Equal(t, []string{dirB}, listedDirectories(t, provider, namedCtx))
+	_, err = callTool(writeFile, namedCtx, map[string]interface{}{"path": filepath.Join(dirB, "new.txt"), "content": "x"})
+	assert.NoError(t, err)
+
+	// Sessions without a tenant get the server's settings
+	plainCtx := session.NewContext(context.Background(), session.Info{ID: "three", Token: "unknown"})
+	assert.Equal(t, []string{serverDir}, listedDirectories(t, provider, plainCtx))
+
+	// Each session has its own provider
+	first, err := provider.forSession(tokenCtx, "read_file")
+	require.NoError(t, err)
+	second, err := provider.forSession(session.NewContext(context.Background(), session.Info{ID: "four", Token: "secret"}), "read_file")
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+
+	// Reloading the tenants applies to new sessions only
+	provider.Reload(Settings{AllowedDirs: []string{serverDir}})
+	assert.Equal(t, []string{dirA}, listedDirectories(t, provider, tokenCtx))
+	assert.Equal(t, []string{serverDir}, listedDirectories(t, provider, session.NewContext(context.Background(), session.Info{ID: "five", Token: "secret"})))
+
+	// Ending a session drops its provider
+	provider.EndSession("one")
+	assert.Equal(t, []string{serverDir}, listedDirectories(t, provider, tokenCtx))
+}
+
+func TestServiceProvider_TenantQuota(t *testing.T) {
+	dir := t.TempDir()
+	provider := NewServiceProvider([]string{t.TempDir()}, WithTenants([]Tenant{
+		{Name: "a", AllowedDirs: []string{dir}, WriteLimits: WriteLimits{QuotaBytes: 8}},
+	}))
+	writeFile := provider.dispatch("write_file", (*ServiceProvider).handleWriteFile)
+	first := session.NewContext(context.Background(), session.Info{ID: "one", Tenant: "a"})
+	second := session.NewContext(context.Background(), session.Info{ID: "two", Tenant: "a"})
+
+	// Sessions of a tenant share its quota
+	_, err := callTool(writeFile, first, map[string]interface{}{"path": filepath.Join(dir, "a.txt"), "content": "12345"})
+	require.NoError(t, err)
+	_, err = callTool(writeFile, second, map[string]interface{}{"path": filepath.Join(dir, "b.txt"), "content": "12"})
+	require.NoError(t, err)
+	_, err = callTool(writeFile, first, map[string]interface{}{"path": filepath.Join(dir, "c.txt"), "content": "12"})
+	assert.True(t, errors.IsQuotaExceeded(err))
+}
+
+func TestServiceProvider_TenantBackends(t *testing.T) {
+	scratch := filepath.Join(t.TempDir(), "scratch")
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{"main.go": "package main\n"})
+	provider := NewServiceProvider([]string{scratch, repo},
+		WithBackends([]BackendBinding{{Root: scratch, Kind: BackendMemory}, {Root: repo, Kind: BackendOverlay}}),
+		WithTenants([]Tenant{
+			{Name: "a", AllowedDirs: []string{filepath.Join(scratch, "a"), repo}},
+			{Name: "b", AllowedDirs: []string{t.TempDir()}},
+		}))
+	ctx := session.NewContext(context.Background(), session.Info{ID: "one", Tenant: "a"})
+
+	// The tenant writes to the server's backends, not to the disk
+	writeFile := provider.dispatch("write_file", (*ServiceProvider).handleWriteFile)
+	_, err := callTool(writeFile, ctx, map[string]interface{}{"path": filepath.Join(scratch, "a", "notes.txt"), "content": "x"})
+	require.NoError(t, err)
+	_, err = callTool(writeFile, ctx, map[string]interface{}{"path": filepath.Join(repo, "main.go"), "content": "broken"})
+	require.NoError(t, err)
+	assert.NoDirExists(t, scratch)
+	data, err := os.ReadFile(filepath.Join(repo, "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n", string(data))
+
+	// The server sees the tenant's changes
+	_, err = callTool(provider.handleReadFile, context.Background(), map[string]interface{}{"path": filepath.Join(scratch, "a", "notes.txt")})
+	require.NoError(t, err)
+
+	result, err := callTool(provider.dispatch("overlay_diff", (*ServiceProvider).handleOverlayDiff), ctx, map[string]interface{}{"path": repo})
+	require.NoError(t, err)
+	diff := decodeOverlayDiff(t, result)
+	require.Len(t, diff.Changes, 1)
+	assert.Equal(t, "main.go", diff.Changes[0].Path)
+
+	assert.Len(t, provider.tenantProvider(provider.tenants[0]).backends, 2)
+	assert.Empty(t, provider.tenantProvider(provider.tenants[1]).backends)
+}
+
+func TestServiceProvider_SelectTenant(t *testing.T) {
+	provider := NewServiceProvider([]string{t.TempDir()}, WithTenants([]Tenant{
+		{Name: "a", Tokens: []string{"secret"}},
+		{Name: "b"},
+	}))
+
+	tests := []struct {
+		name          string
+		info          session.Info
+		expectTenant  string
+		expectedError error
+	}{
+		{name: "No tenant", info: session.Info{ID: "x"}},
+		{name: "Token", info: session.Info{Token: "secret"}, expectTenant: "a"},
+		{name: "Token wins over name", info: session.Info{Token: "secret", Tenant: "b"}, expectTenant: "a"},
+		{name: "Name", info: session.Info{Tenant: "b"}, expectTenant: "b"},
+		{name: "Unknown token", info: session.Info{Token: "guess"}},
+		{name: "Name of a tenant with tokens", info: session.Info{Tenant: "a"}, expectedError: errors.ErrPermissionDenied},
+		{name: "Unknown name", info: session.Info{Tenant: "c"}, expectedError: errors.ErrInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, err := provider.selectTenant(tt.info)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			if tt.expectTenant == "" {
+				assert.Nil(t, tenant)
+				return
+			}
+			require.NotNil(t, tenant)
+			assert.Equal(t, tt.expectTenant, tenant.Name)
+		})
+	}
+}
+
+func TestPathValidatorWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	validator := newPathValidator([]string{dir})
+	validator.workDir = dir
+
+	path, err := validator.ValidatePath("notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "notes.txt"), path)
+
+	_, err = validator.ValidatePath(filepath.Join("..", "escape.txt"))
+	assert.ErrorIs(t, err, errors.ErrPathNotAllowed)
+
+	// Scoped validators resolve against their parent's working directory
+	scoped := validator.scoped([]string{filepath.Join(dir, "sub")})
+	path, err = scoped.ValidatePath(filepath.Join("sub", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "sub", "a.txt"), path)
+}
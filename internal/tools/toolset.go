@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Tool profiles select a predefined set of tools
+const (
+	// ProfileFull enables every tool
+	ProfileFull = "full"
+	// ProfileReadOnly enables only tools that read, list, search or describe
+	ProfileReadOnly = "readonly"
+	// ProfileNoDelete enables every tool except those that delete files or directories
+	ProfileNoDelete = "no-delete"
+)
+
+// toolClass describes what a tool can do to the filesystem
+type toolClass int
+
+const (
+	// readTool never modifies the filesystem
+	readTool toolClass = iota
+	// writeTool creates or modifies files and directories
+	writeTool
+	// deleteTool removes files or directories
+	deleteTool
+)
+
+// toolClasses lists every tool the server can register
+var toolClasses = map[string]toolClass{
+	"read_file":                readTool,
+	"read_multiple_files":      readTool,
+	"list_directory":           readTool,
+	"directory_tree":           readTool,
+	"get_file_info":            readTool,
+	"diff":                     readTool,
+	"disk_usage":               readTool,
+	"search_files":             readTool,
+	"list_allowed_directories": readTool,
+	"git_status":               readTool,
+	"git_diff":                 readTool,
+	"git_log":                  readTool,
+	"git_show":                 readTool,
+	"git_commit":               writeTool,
+	"overlay_diff":             readTool,
+	"overlay_commit":           deleteTool,
+	"overlay_discard":          deleteTool,
+	"write_file":               writeTool,
+	"edit_file":                writeTool,
+	"insert_lines":             writeTool,
+	"delete_lines":             writeTool,
+	"edit_lines":               writeTool,
+	"convert_file":             writeTool,
+	"merge_files":              writeTool,
+	"create_directory":         writeTool,
+	"move_file":                writeTool,
+	"copy_file":                writeTool,
+	"create_archive":           writeTool,
+	"extract_archive":          writeTool,
+	"delete_file":              deleteTool,
+	"delete_directory":         deleteTool,
+	"apply_batch":              deleteTool,
+	"confirm_operation":        writeTool,
+}
+
+// profileClasses maps each profile to the most permissive tool class it enables
+var profileClasses = map[string]toolClass{
+	ProfileFull:     deleteTool,
+	ProfileReadOnly: readTool,
+	ProfileNoDelete: writeTool,
+}
+
+// ToolNames returns the names of all tools the server can register, sorted
+func ToolNames() []string {
+	names := make([]string, 0, len(toolClasses))
+	for name := range toolClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ToolSelection chooses which tools are registered. A tool is enabled when the
+// profile allows it, it is in Enable (if Enable is not empty) and it is not in
+// Disable.
+type ToolSelection struct {
+	Profile string
+	Enable  []string
+	Disable []string
+}
+
+// Validate checks that the profile and every tool name are known
+func (t ToolSelection) Validate() error {
+	if t.Profile != "" {
+		if _, ok := profileClasses[t.Profile]; !ok {
+			return fmt.Errorf("unknown tool profile: %s", t.Profile)
+		}
+	}
+
+	for _, name := range append(append([]string{}, t.Enable...), t.Disable...) {
+		if _, ok := toolClasses[name]; !ok {
+			return fmt.Errorf("unknown tool: %s (available: %s)", name, strings.Join(ToolNames(), ", "))
+		}
+	}
+
+	return nil
+}
+
+// Enabled reports whether the named tool is selected
+func (t ToolSelection) Enabled(name string) bool {
+	class, ok := toolClasses[name]
+	if !ok {
+		return false
+	}
+
+	profile := t.Profile
+	if profile == "" {
+		profile = ProfileFull
+	}
+	if class > profileClasses[profile] {
+		return false
+	}
+
+	if len(t.Enable) > 0 && !slices.Contains(t.Enable, name) {
+		return false
+	}
+
+	return !slices.Contains(t.Disable, name)
+}
+
+// WithToolSelection registers only the selected tools
+func WithToolSelection(selection ToolSelection) ProviderOption {
+	return func(p *ServiceProvider) {
+		p.toolSelection = selection
+	}
+}
+
+// addTool registers a tool with the server if it is selected
+func (p *ServiceProvider) addTool(s *server.MCPServer, tool mcp.Tool, handler providerHandler) {
+	if !p.toolSelection.Enabled(tool.Name) {
+		p.logger.Debug("Tool %s is disabled", tool.Name)
+		return
+	}
+
+	s.AddTool(tool, p.wrap(tool.Name, p.dispatch(tool.Name, handler)))
+	p.enabledTools = append(p.enabledTools, tool.Name)
+}
+
+// EnabledTools returns the names of the tools registered by RegisterTools
+func (p *ServiceProvider) EnabledTools() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.enabledTools
+}
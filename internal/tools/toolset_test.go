@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolSelection_Validate(t *testing.T) {
+	assert.NoError(t, ToolSelection{}.Validate())
+	assert.NoError(t, ToolSelection{Profile: ProfileReadOnly, Enable: []string{"read_file"}, Disable: []string{"search_files"}}.Validate())
+	assert.Error(t, ToolSelection{Profile: "admin"}.Validate())
+	assert.Error(t, ToolSelection{Enable: []string{"format_disk"}}.Validate())
+	assert.Error(t, ToolSelection{Disable: []string{"format_disk"}}.Validate())
+}
+
+func TestToolSelection_Enabled(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection ToolSelection
+		tool      string
+		want      bool
+	}{
+		{"default enables everything", ToolSelection{}, "delete_directory", true},
+		{"unknown tool", ToolSelection{}, "format_disk", false},
+		{"full profile", ToolSelection{Profile: ProfileFull}, "delete_file", true},
+		{"readonly allows reads", ToolSelection{Profile: ProfileReadOnly}, "search_files", true},
+		{"readonly refuses writes", ToolSelection{Profile: ProfileReadOnly}, "write_file", false},
+		{"readonly refuses deletes", ToolSelection{Profile: ProfileReadOnly}, "delete_file", false},
+		{"no-delete allows writes", ToolSelection{Profile: ProfileNoDelete}, "move_file", true},
+		{"no-delete refuses deletes", ToolSelection{Profile: ProfileNoDelete}, "delete_directory", false},
+		{"no-delete refuses batches", ToolSelection{Profile: ProfileNoDelete}, "apply_batch", false},
+		{"enable list restricts", ToolSelection{Enable: []string{"read_file"}}, "write_file", false},
+		{"enable list allows", ToolSelection{Enable: []string{"read_file"}}, "read_file", true},
+		{"enable list cannot widen profile", ToolSelection{Profile: ProfileReadOnly, Enable: []string{"write_file"}}, "write_file", false},
+		{"disable list", ToolSelection{Disable: []string{"search_files"}}, "search_files", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.selection.Enabled(tt.tool))
+		})
+	}
+}
+
+// listTools returns the names of the tools the server reports in tools/list
+func listTools(t *testing.T, s *server.MCPServer) []string {
+	response := s.HandleMessage(context.Background(), json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+
+	data, err := json.Marshal(response)
+	require.NoError(t, err)
+
+	var decoded struct {
+		Result mcp.ListToolsResult `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	names := make([]string, 0, len(decoded.Result.Tools))
+	for _, tool := range decoded.Result.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestRegisterTools_Selection(t *testing.T) {
+	t.Run("full registers every known tool", func(t *testing.T) {
+		s := server.NewMCPServer("test-server", "1.0.0")
+		dir := t.TempDir()
+		provider := RegisterTools(s, []string{dir}, WithConfirmationPolicy(ConfirmationPolicy{
+			Rules: []ConfirmationRule{{Tool: "delete_file"}},
+		}), WithGitCommit(true), WithBackends([]BackendBinding{{Root: dir, Kind: BackendOverlay}}))
+
+		assert.ElementsMatch(t, ToolNames(), provider.EnabledTools())
+		assert.ElementsMatch(t, ToolNames(), listTools(t, s))
+	})
+
+	t.Run("readonly registers no mutating tools", func(t *testing.T) {
+		s := server.NewMCPServer("test-server", "1.0.0")
+		provider := RegisterTools(s, []string{t.TempDir()}, WithToolSelection(ToolSelection{Profile: ProfileReadOnly}))
+
+		listed := listTools(t, s)
+		assert.ElementsMatch(t, provider.EnabledTools(), listed)
+		assert.ElementsMatch(t, []string{
+			"read_file", "read_multiple_files", "list_directory", "directory_tree",
+			"get_file_info", "diff", "disk_usage", "search_files", "list_allowed_directories",
+			"git_status", "git_diff", "git_log", "git_show",
+		}, listed)
+	})
+
+	t.Run("git_commit is opt-in", func(t *testing.T) {
+		s := server.NewMCPServer("test-server", "1.0.0")
+		RegisterTools(s, []string{t.TempDir()})
+
+		assert.NotContains(t, listTools(t, s), "git_commit")
+	})
+
+	t.Run("overlay tools need an overlay", func(t *testing.T) {
+		s := server.NewMCPServer("test-server", "1.0.0")
+		RegisterTools(s, []string{t.TempDir()})
+
+		listed := listTools(t, s)
+		assert.NotContains(t, listed, "overlay_diff")
+		assert.NotContains(t, listed, "overlay_commit")
+		assert.NotContains(t, listed, "overlay_discard")
+	})
+
+	t.Run("explicit list and disable", func(t *testing.T) {
+		s := server.NewMCPServer("test-server", "1.0.0")
+		RegisterTools(s, []string{t.TempDir()}, WithToolSelection(ToolSelection{
+			Profile: ProfileNoDelete,
+			Enable:  []string{"read_file", "write_file", "delete_file"},
+			Disable: []string{"write_file"},
+		}))
+
+		assert.Equal(t, []string{"read_file"}, listTools(t, s))
+	})
+}
@@ -9,20 +9,34 @@ import (
 // FileReader defines operations for reading files
 type FileReader interface {
 	ReadFile(path string) (string, error)
+	ReadFileFormat(path string) (string, TextFormat, error)
 	ReadMultipleFiles(paths []string) ([]FileContent, error)
+	GetFileInfo(path, hashAlgorithm string) (*FileInfo, error)
+	Diff(fromPath, toPath string, opts DiffOptions) (*DiffResult, error)
 }
 
 // FileWriter defines operations for writing files
 type FileWriter interface {
 	WriteFile(path, content string, append bool) error
 	EditFile(path, content string, startLine, endLine int) error
+	EditLines(path string, edits []LineEdit) error
+	ConvertFile(path string, format TextFormat) error
+	PlanWriteFile(path, content string, append bool) (*Change, error)
+	PlanEditFile(path, content string, startLine, endLine int) (*Change, error)
+	PlanEditLines(path string, edits []LineEdit) (*Change, error)
+	PlanConvertFile(path string, format TextFormat) (*Change, error)
 }
 
 // DirectoryManager defines operations for directory management
 type DirectoryManager interface {
 	CreateDirectory(path string) error
 	ListDirectory(path string) ([]FileInfo, error)
+	ListDirectoryPage(path string, opts ListOptions) (*DirectoryPage, error)
 	DeleteDirectory(path string, recursive bool) error
+	DirectoryTree(path string, maxDepth int) ([]TreeEntry, error)
+	DiskUsage(ctx context.Context, path string, opts DiskUsageOptions) (*DiskUsageReport, error)
+	PlanCreateDirectory(path string) (*Change, error)
+	PlanDeleteDirectory(path string, recursive bool) (*Change, error)
 }
 
 // FileManager defines operations for file management
@@ -30,6 +44,36 @@ type FileManager interface {
 	DeleteFile(path string) error
 	MoveFile(sourcePath, destinationPath string) error
 	CopyFile(sourcePath, destinationPath string) error
+	PlanDeleteFile(path string) (*Change, error)
+	PlanMoveFile(sourcePath, destinationPath string) (*Change, error)
+	PlanCopyFile(sourcePath, destinationPath string) (*Change, error)
+}
+
+// ArchiveManager defines operations for creating and extracting archives
+type ArchiveManager interface {
+	CreateArchive(path string, sources []string, format string, overwrite bool) (*ArchiveResult, error)
+	ExtractArchive(path, destination, format string, overwrite bool) (*ArchiveResult, error)
+	PlanCreateArchive(path string, sources []string, format string, overwrite bool) (*Change, error)
+	PlanExtractArchive(path, destination, format string, overwrite bool) (*Change, error)
+}
+
+// GitManager defines operations on git repositories
+type GitManager interface {
+	Status(ctx context.Context, path string) (*GitStatus, error)
+	Diff(ctx context.Context, path string, opts GitDiffOptions) (string, error)
+	Log(ctx context.Context, path string, opts GitLogOptions) ([]GitCommit, error)
+	Show(ctx context.Context, path, revision string) (string, error)
+	Commit(ctx context.Context, path, message string) (*GitCommit, error)
+	PlanCommit(ctx context.Context, path, message string) (*Change, error)
+}
+
+// OverlayManager defines operations on the changes held by overlays
+type OverlayManager interface {
+	Diff(path string, opts DiffOptions) (*OverlayDiff, error)
+	Commit(path string) (*OverlayDiff, error)
+	PlanCommit(path string) (*Change, error)
+	Discard(path string) (*OverlayDiff, error)
+	PlanDiscard(path string) (*Change, error)
 }
 
 // SearchProvider defines operations for searching files
@@ -40,6 +84,8 @@ type SearchProvider interface {
 // PathValidator defines operations for validating paths
 type PathValidator interface {
 	ValidatePath(requestedPath string) (string, error)
+	ValidateWritePath(requestedPath string) (string, error)
+	Permits(validPath string, access Access) bool
 }
 
 // AllowedDirectoriesProvider defines operations for listing allowed directories
@@ -49,31 +95,84 @@ type AllowedDirectoriesProvider interface {
 
 // FileContent represents the content of a file with its path
 type FileContent struct {
-	Path    string `json:"path"`
-	Content string `json:"content"`
-	Error   string `json:"error,omitempty"`
+	Path       string `json:"path"`
+	Content    string `json:"content"`
+	Error      string `json:"error,omitempty"`
+	Redactions int    `json:"redactions,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+	LineEnding string `json:"line_ending,omitempty"`
 }
 
 // FileInfo represents information about a file or directory
+// Fields the platform does not record are left empty.
 type FileInfo struct {
-	Name      string `json:"name"`
-	Path      string `json:"path"`
-	Size      int64  `json:"size"`
-	IsDir     bool   `json:"is_dir"`
-	ModTime   string `json:"mod_time"`
-	Extension string `json:"extension,omitempty"`
+	Name          string `json:"name"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	IsDir         bool   `json:"is_dir"`
+	ModTime       string `json:"mod_time"`
+	Extension     string `json:"extension,omitempty"`
+	Mode          string `json:"mode,omitempty"`        // e.g. "-rw-r--r--"
+	Permissions   string `json:"permissions,omitempty"` // Octal, e.g. "0644"
+	Owner         string `json:"owner,omitempty"`
+	Group         string `json:"group,omitempty"`
+	Inode         uint64 `json:"inode,omitempty"`
+	Links         uint64 `json:"links,omitempty"`
+	IsSymlink     bool   `json:"is_symlink,omitempty"`
+	SymlinkTarget string `json:"symlink_target,omitempty"`
+	CreateTime    string `json:"create_time,omitempty"`
+	AccessTime    string `json:"access_time,omitempty"`
+	MimeType      string `json:"mime_type,omitempty"`
+	// Only set by GetFileInfo, for text files
+	LineCount  *int   `json:"line_count,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+	LineEnding string `json:"line_ending,omitempty"`
+	// Only set by GetFileInfo when a hash is requested
+	Hash          string `json:"hash,omitempty"`
+	HashAlgorithm string `json:"hash_algorithm,omitempty"`
 }
 
 // SearchResult represents a search result
 type SearchResult struct {
-	Path    string `json:"path"`
-	Line    int    `json:"line,omitempty"`
-	Content string `json:"content,omitempty"`
+	Path       string `json:"path"`
+	Line       int    `json:"line,omitempty"`
+	Content    string `json:"content,omitempty"`
+	Redactions int    `json:"redactions,omitempty"`
+}
+
+// LineEdit is one change to the lines of a file. Line numbers are 1-indexed and
+// refer to the file before any edit of the same call is applied.
+type LineEdit struct {
+	Action string `json:"action"` // "replace" (default), "insert" or "delete"
+	// StartLine is the first line to replace or delete. For an insert it is the
+	// line to insert after: 0 for the start of the file, -1 for the end.
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line,omitempty"` // Last line to replace or delete, inclusive
+	Content   string `json:"content,omitempty"`  // Lines to insert or replace with
+}
+
+// Change describes what a mutating operation would do. Plan methods perform the
+// same validation as the operation itself and return a Change without touching
+// the disk.
+type Change struct {
+	Operation   string `json:"operation"`
+	Path        string `json:"path"`
+	Destination string `json:"destination,omitempty"`
+	Action      string `json:"action"` // "create", "overwrite", "append", "modify", "delete", "move", "copy", "commit", "discard" or "none"
+	Files       int    `json:"files"`
+	BytesBefore int64  `json:"bytes_before"`
+	BytesAfter  int64  `json:"bytes_after"`
+	Description string `json:"description"`
+	Diff        string `json:"diff,omitempty"`
 }
 
 // ToolHandler defines the function signature for handling tool requests
 type ToolHandler func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
 
+// providerHandler is a ServiceProvider method handling tool requests, called on
+// the provider serving the request's session
+type providerHandler func(p *ServiceProvider, ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+
 // TreeEntry represents an entry in a directory tree
 type TreeEntry struct {
 	Name     string      `json:"name"`
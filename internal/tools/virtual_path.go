@@ -0,0 +1,318 @@
+package tools
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+)
+
+// maxLinkHops is how many hard links readEntry follows to find the content of an entry
+const maxLinkHops = 8
+
+// virtualPath is a read-only path to an entry inside an archive. The archive's
+// path and the entry's are separated by "!", as in
+// /repo/dist/app.zip!/config/app.yaml.
+type virtualPath struct {
+	archive string // Validated path of the archive
+	format  string
+	inner   string // Clean slash-separated path inside the archive, "" for its root
+	fsys    Backend
+}
+
+// splitVirtualPath splits a path that traverses into a zip, jar, tar or tar.gz
+// archive into the archive's path and the path inside it. ok is false for
+// ordinary paths.
+func splitVirtualPath(p string) (archive, inner string, ok bool) {
+	slashed := filepath.ToSlash(p)
+	for offset := 0; ; {
+		i := strings.Index(slashed[offset:], "!")
+		if i < 0 {
+			return "", "", false
+		}
+		i += offset
+		offset = i + 1
+
+		rest := slashed[i+1:]
+		if rest != "" && rest[0] != '/' {
+			continue
+		}
+		if _, err := archiveFormat(slashed[:i], ""); err != nil {
+			continue
+		}
+		return p[:i], strings.TrimPrefix(rest, "/"), true
+	}
+}
+
+// resolveVirtualPath validates a path into an archive. ok is false for
+// ordinary paths. The archive must be readable, and so must the entry,
+// matched against the path policy as if the archive were a directory.
+func resolveVirtualPath(fsys Backend, validator PathValidator, p string) (vp *virtualPath, ok bool, err error) {
+	archive, inner, ok := splitVirtualPath(p)
+	if !ok {
+		return nil, false, nil
+	}
+
+	validArchive, err := validator.ValidatePath(archive)
+	if err != nil {
+		return nil, true, err
+	}
+	inner, err = archiveEntryPath(inner)
+	if err != nil {
+		return nil, true, err
+	}
+	if inner != "" && !validator.Permits(filepath.Join(validArchive, filepath.FromSlash(inner)), ReadAccess) {
+		return nil, true, errors.ErrPathDenied
+	}
+
+	info, err := fsys.Stat(validArchive)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, true, errors.ErrFileNotFound
+		}
+		return nil, true, err
+	}
+	if info.IsDir() {
+		return nil, true, errors.ErrInvalidOperation
+	}
+
+	format, _ := archiveFormat(validArchive, "")
+	return &virtualPath{archive: validArchive, format: format, inner: inner, fsys: fsys}, true, nil
+}
+
+// isVirtualPath reports whether a path traverses into an archive
+func isVirtualPath(p string) bool {
+	_, _, ok := splitVirtualPath(p)
+	return ok
+}
+
+// permits reports whether the path policy allows reading an entry of the archive
+func (vp *virtualPath) permits(validator PathValidator, name string) bool {
+	return validator.Permits(filepath.Join(vp.archive, filepath.FromSlash(name)), ReadAccess)
+}
+
+// archiveFileInfo describes an archive entry as an fs.FileInfo
+type archiveFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	target  string // Symbolic link target
+}
+
+func (i *archiveFileInfo) Name() string       { return i.name }
+func (i *archiveFileInfo) Size() int64        { return i.size }
+func (i *archiveFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *archiveFileInfo) ModTime() time.Time { return i.modTime }
+func (i *archiveFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *archiveFileInfo) Sys() any           { return nil }
+
+// describeArchiveEntry builds the metadata of an entry inside an archive,
+// reported as path
+func describeArchiveEntry(path string, info *archiveFileInfo) FileInfo {
+	fileInfo := FileInfo{
+		Name:          info.name,
+		Path:          path,
+		Size:          info.size,
+		IsDir:         info.IsDir(),
+		ModTime:       info.modTime.Format(time.RFC3339),
+		Mode:          info.mode.String(),
+		Permissions:   fmt.Sprintf("%04o", info.mode.Perm()),
+		IsSymlink:     info.mode&fs.ModeSymlink != 0,
+		SymlinkTarget: info.target,
+	}
+	if !info.IsDir() {
+		fileInfo.Extension = filepath.Ext(info.name)
+		fileInfo.MimeType = mime.TypeByExtension(fileInfo.Extension)
+	}
+	return fileInfo
+}
+
+// archiveIndex maps the clean names of an archive's entries, including the
+// directories only implied by the names of the entries below them, to their
+// descriptions
+type archiveIndex map[string]*archiveFileInfo
+
+// index reads the entries of the archive. Entries whose names are not safe to
+// extract are left out, and archives with more entries than limits allow are
+// refused.
+func (vp *virtualPath) index(limits ArchiveLimits) (archiveIndex, error) {
+	index := archiveIndex{"": {name: filepath.Base(vp.archive), mode: fs.ModeDir | 0555}}
+	count := 0
+	err := walkArchive(vp.fsys, vp.archive, vp.format, func(h archiveHeader, _ io.Reader) error {
+		count++
+		if limits.MaxEntries > 0 && count > limits.MaxEntries {
+			return errors.NewQuotaError("archive_max_entries", int64(limits.MaxEntries), int64(count))
+		}
+
+		name, err := archiveEntryPath(h.name)
+		if err != nil || name == "" || h.kind == "" {
+			return nil
+		}
+
+		info := &archiveFileInfo{name: path.Base(name), mode: h.mode, modTime: h.modTime}
+		switch h.kind {
+		case entryDir:
+			info.mode = fs.ModeDir | h.mode.Perm()
+		case entrySymlink:
+			info.mode = fs.ModeSymlink | h.mode.Perm()
+			info.target = h.linkname
+		default:
+			// Hard links are listed as the files they share content with
+			info.mode = h.mode.Perm()
+			info.size = h.size
+		}
+		index[name] = info
+
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if _, ok := index[dir]; ok {
+				break
+			}
+			index[dir] = &archiveFileInfo{name: path.Base(dir), mode: fs.ModeDir | 0555, modTime: h.modTime}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// children returns the names of the entries directly inside dir, sorted
+func (idx archiveIndex) children(dir string) []string {
+	var names []string
+	for name := range idx {
+		if name == "" {
+			continue
+		}
+		parent := path.Dir(name)
+		if parent == "." {
+			parent = ""
+		}
+		if parent == dir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readEntry reads the content of a file inside the archive. Entries larger
+// than limits.MaxTotalSize are refused, and symbolic links are not followed.
+func (vp *virtualPath) readEntry(name string, limits ArchiveLimits) ([]byte, error) {
+	return vp.readLinkedEntry(name, limits, maxLinkHops)
+}
+
+// readLinkedEntry reads the content of a file inside the archive, following
+// at most hops hard links
+func (vp *virtualPath) readLinkedEntry(name string, limits ArchiveLimits, hops int) ([]byte, error) {
+	if name == "" {
+		return nil, errors.ErrInvalidOperation
+	}
+
+	var data []byte
+	found := false
+	err := walkArchive(vp.fsys, vp.archive, vp.format, func(h archiveHeader, r io.Reader) error {
+		entryName, err := archiveEntryPath(h.name)
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(entryName, name+"/") {
+			return errors.ErrInvalidOperation // A directory only implied by the entries below it
+		}
+		if entryName != name {
+			return nil
+		}
+
+		switch h.kind {
+		case entryFile:
+		case entryHardlink:
+			// The content is stored with the file the link points to
+			linked, err := archiveEntryPath(h.linkname)
+			if err != nil {
+				return err
+			}
+			if hops == 0 {
+				return fmt.Errorf("%w: too many hard links", errors.ErrInvalidArgument)
+			}
+			if data, err = vp.readLinkedEntry(linked, limits, hops-1); err != nil {
+				return err
+			}
+			found = true
+			return fs.SkipAll
+		default:
+			return errors.ErrInvalidOperation
+		}
+
+		data, err = readLimited(r, limits.MaxTotalSize)
+		if err != nil {
+			return err
+		}
+		found = true
+		return fs.SkipAll
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.ErrFileNotFound
+	}
+	return data, nil
+}
+
+// readLimited reads r to the end, refusing more than max bytes unless max is zero
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, errors.NewQuotaError("archive_max_size", max, int64(len(data)))
+	}
+	return data, nil
+}
+
+// isGzipFile reports whether a path names a single gzip-compressed file, as
+// opposed to a compressed tar archive
+func isGzipFile(p string) bool {
+	name := strings.ToLower(p)
+	return strings.HasSuffix(name, ".gz") && !strings.HasSuffix(name, ".tar.gz")
+}
+
+// readGzipFile reads and decompresses a gzip-compressed file, refusing more
+// than limits.MaxTotalSize bytes of content
+func readGzipFile(fsys Backend, validPath string, limits ArchiveLimits) ([]byte, error) {
+	file, err := fsys.Open(validPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+	}
+	defer gz.Close()
+
+	data, err := readLimited(gz, limits.MaxTotalSize)
+	if err != nil {
+		if _, ok := err.(*errors.QuotaError); ok {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errors.ErrInvalidArgument, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/moguyn/mcp-go-filesystem/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestGzip writes content gzip-compressed to path
+func writeTestGzip(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(testGzip(t, content)), 0644))
+}
+
+// testGzip returns content gzip-compressed
+func testGzip(t *testing.T, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.String()
+}
+
+// newArchiveTree creates a zip and a tar.gz archive holding the same entries
+func newArchiveTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	tarball := testTar(t,
+		tarEntry{header: tar.Header{Name: "lib/", Typeflag: tar.TypeDir, Mode: 0755}},
+		tarEntry{header: tar.Header{Name: "lib/a.txt"}, body: "alpha\n"},
+		tarEntry{header: tar.Header{Name: "lib/b.txt", Typeflag: tar.TypeLink, Linkname: "lib/a.txt"}},
+		tarEntry{header: tar.Header{Name: "lib/c", Typeflag: tar.TypeSymlink, Linkname: "a.txt"}},
+	)
+	writeTree(t, root, map[string]string{
+		"app.zip": testZip(t, map[string]string{
+			"config/app.yaml":     "name: app\nversion: 2\n",
+			"config/secret.txt":   "token\n",
+			"docs/guide/intro.md": "# Intro\nversion notes\n",
+			"README":              "read me\n",
+		}),
+		"plain.tar":  tarball,
+		"lib.tar.gz": testGzip(t, tarball),
+	})
+	return root
+}
+
+func TestSplitVirtualPath(t *testing.T) {
+	tests := []struct {
+		path, archive, inner string
+		ok                   bool
+	}{
+		{"/repo/dist/app.zip!/config/app.yaml", "/repo/dist/app.zip", "config/app.yaml", true},
+		{"/repo/app.JAR!", "/repo/app.JAR", "", true},
+		{"/repo/lib.tar.gz!/", "/repo/lib.tar.gz", "", true},
+		{"/repo/wow!/app.tgz!/a", "/repo/wow!/app.tgz", "a", true},
+		{"/repo/app.zip", "", "", false},
+		{"/repo/notes!/a.txt", "", "", false},
+		{"/repo/app.zip!x", "", "", false},
+	}
+	for _, tt := range tests {
+		archive, inner, ok := splitVirtualPath(tt.path)
+		assert.Equal(t, tt.ok, ok, tt.path)
+		assert.Equal(t, tt.archive, archive, tt.path)
+		assert.Equal(t, tt.inner, inner, tt.path)
+	}
+}
+
+func TestFileService_ReadInsideArchives(t *testing.T) {
+	root := newArchiveTree(t)
+	service := NewFileService([]string{root})
+
+	content, err := service.ReadFile(filepath.Join(root, "app.zip") + "!/config/app.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "name: app\nversion: 2\n", content)
+
+	// Hard links read the content of the file they point to
+	content, err = service.ReadFile(filepath.Join(root, "lib.tar.gz") + "!/lib/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "alpha\n", content)
+
+	t.Run("gzip file", func(t *testing.T) {
+		path := filepath.Join(root, "server.log.gz")
+		writeTestGzip(t, path, "started\nstopped\n")
+
+		content, err := service.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "started\nstopped\n", content)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		zip := filepath.Join(root, "app.zip")
+		_, err := service.ReadFile(zip + "!/missing.txt")
+		assert.ErrorIs(t, err, errors.ErrFileNotFound)
+
+		_, err = service.ReadFile(zip + "!/config")
+		assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+
+		_, err = service.ReadFile(filepath.Join(root, "plain.tar") + "!/lib/c")
+		assert.ErrorIs(t, err, errors.ErrInvalidOperation, "symbolic links are not followed")
+
+		_, err = service.ReadFile(zip + "!/../plain.tar")
+		assert.ErrorIs(t, err, errors.ErrInvalidPath)
+
+		_, err = service.ReadFile(filepath.Join(root, "missing.zip") + "!/a")
+		assert.ErrorIs(t, err, errors.ErrFileNotFound)
+
+		err = service.WriteFile(zip+"!/config/app.yaml", "x", false)
+		assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+		assert.NoDirExists(t, zip+"!")
+	})
+
+	t.Run("size limit", func(t *testing.T) {
+		limited := NewFileService([]string{root})
+		limited.validator.archives = ArchiveLimits{MaxTotalSize: 4}
+
+		_, err := limited.ReadFile(filepath.Join(root, "app.zip") + "!/config/app.yaml")
+		assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+	})
+}
+
+func TestDirectoryService_ListInsideArchives(t *testing.T) {
+	root := newArchiveTree(t)
+	service := NewDirectoryService([]string{root})
+	zip := filepath.Join(root, "app.zip")
+
+	entries, err := service.ListDirectory(zip + "!")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "README", entries[0].Name)
+	assert.Equal(t, filepath.Join(zip+"!", "README"), entries[0].Path)
+	assert.Equal(t, "config", entries[1].Name)
+	assert.True(t, entries[1].IsDir)
+	assert.True(t, entries[2].IsDir, "directories only implied by entry names are listed")
+
+	page, err := service.ListDirectoryPage(zip+"!/config", ListOptions{Pattern: "*.yaml", ShowHidden: true})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, int64(21), page.Entries[0].Size)
+	assert.Equal(t, ".yaml", page.Entries[0].Extension)
+
+	entries, err = service.ListDirectory(filepath.Join(root, "lib.tar.gz") + "!/lib")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.True(t, entries[2].IsSymlink)
+	assert.Equal(t, "a.txt", entries[2].SymlinkTarget)
+
+	_, err = service.ListDirectory(zip + "!/README")
+	assert.ErrorIs(t, err, errors.ErrInvalidOperation)
+	_, err = service.ListDirectory(zip + "!/nothing")
+	assert.ErrorIs(t, err, errors.ErrDirectoryNotFound)
+}
+
+func TestSearchService_SearchInsideArchives(t *testing.T) {
+	root := newArchiveTree(t)
+	service := NewSearchService([]string{root})
+	zip := filepath.Join(root, "app.zip")
+
+	results, err := service.SearchFiles("version", zip+"!/", true)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	paths := []string{results[0].Path, results[1].Path}
+	assert.ElementsMatch(t, []string{zip + "!/config/app.yaml", zip + "!/docs/guide/intro.md"}, paths)
+
+	results, err = service.SearchFiles("version", zip+"!/docs", false)
+	require.NoError(t, err)
+	assert.Empty(t, results, "subdirectories are only searched when recursive")
+
+	results, err = service.SearchFiles("alpha", filepath.Join(root, "lib.tar.gz")+"!/lib/a.txt", false)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, 1, results[0].Line)
+
+	writeTestGzip(t, filepath.Join(root, "app.log.gz"), "ok\nversion mismatch\n")
+	results, err = service.SearchFiles("mismatch", root, false)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, 2, results[0].Line)
+}
+
+func TestServiceProvider_ArchivePolicy(t *testing.T) {
+	root := newArchiveTree(t)
+	policy, err := NewPathPolicy([]PolicyRule{{Pattern: "**/secret.txt", Read: true}})
+	require.NoError(t, err)
+	provider := NewServiceProvider([]string{root}, WithPathPolicy(policy))
+	zip := filepath.Join(root, "app.zip")
+
+	result, err := callTool(provider.handleListDirectory, context.Background(), map[string]interface{}{"path": zip + "!/config"})
+	require.NoError(t, err)
+	assert.NotContains(t, result.Content[0].(mcp.TextContent).Text, "secret.txt")
+
+	_, err = callTool(provider.handleReadFile, context.Background(), map[string]interface{}{"path": zip + "!/config/secret.txt"})
+	assert.ErrorIs(t, err, errors.ErrPathDenied)
+
+	result, err = callTool(provider.handleSearchFiles, context.Background(), map[string]interface{}{
+		"query": "token", "path": zip + "!", "recursive": true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "[]", result.Content[0].(mcp.TextContent).Text)
+}